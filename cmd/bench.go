@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/katasec/dstream/pkg/builtin"
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchCount          int
+	benchRate           float64
+	benchSize           int
+	benchSizeMax        int
+	benchSchema         string
+	benchSeed           uint64
+	benchDuration       time.Duration
+	benchSampleInterval time.Duration
+	benchFormat         string
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench [task_name]",
+	Short: "Benchmark a task's output provider with generated events",
+	Long: `Run a task with the builtin generator in place of its input provider and its
+real output provider, and report how the pipeline kept up:
+
+  throughput     events and bytes per second, from the first event relayed to the last
+  latency        p50, p90, p99 and max, from the generator creating an event to
+                 the relay handing it to the output provider
+  backpressure   time the relay spent blocked writing to the output provider
+  processes      CPU and peak memory of DStream (which runs the relay and the
+                 generator) and of the output provider process
+
+The run is a batch run: it ends once the generator has sent --count events and
+the output has drained, or after --duration. It isn't recorded in the run
+history. Use --format json and the output provider's digest in the report to
+track regressions between provider versions; --seed makes the event sizes
+repeatable. The exit status is 1 if the run failed.
+
+Example:
+  dstream bench mssql-to-asb
+  dstream bench mssql-to-asb --count 0 --rate 2000 --duration 1m
+  dstream bench mssql-to-asb --size 200 --size-max 4000 --seed 42 --format json > bench.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if benchFormat != "text" && benchFormat != "json" {
+			log.Error("Invalid --format", "format", benchFormat, "expected", "text or json")
+			os.Exit(1)
+		}
+		root, err := config.LoadRootFile(cfgFile)
+		if err != nil {
+			log.Error("Failed to load root config", "config", cfgFile, "error", err.Error())
+			os.Exit(1)
+		}
+		task := root.Task(args[0])
+		if task == nil {
+			log.Error("Task not found", "task", args[0], "config", cfgFile)
+			os.Exit(1)
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		report, err := executor.RunBench(context.Background(), task, signals, executor.BenchOptions{
+			Generator: executor.BenchGenerator{
+				Count:   benchCount,
+				Rate:    benchRate,
+				Size:    benchSize,
+				SizeMax: benchSizeMax,
+				Schema:  benchSchema,
+				Seed:    benchSeed,
+			},
+			MaxRuntime:     benchDuration,
+			SampleInterval: benchSampleInterval,
+		})
+		if report == nil {
+			log.Error("Benchmark failed", "task", task.Name, "error", err.Error())
+			exit(1)
+		}
+
+		if benchFormat == "json" {
+			out, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(out))
+		} else {
+			renderBenchReport(os.Stdout, report)
+		}
+		if err != nil {
+			log.Error("Benchmark run failed", "task", task.Name, "error", err.Error())
+			exit(1)
+		}
+	},
+}
+
+// renderBenchReport prints a benchmark report for people
+func renderBenchReport(w io.Writer, r *executor.BenchReport) {
+	output := r.Output.Ref
+	if output == "" {
+		output = r.Output.Path
+	}
+	if r.Output.Digest != "" {
+		output += " " + r.Output.Digest
+	}
+	fmt.Fprintf(w, "Benchmark of %s (output: %s)\n", r.Task, output)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	gen := r.Generator
+	size := fmt.Sprintf("%d bytes", gen.Size)
+	if gen.SizeMax > gen.Size {
+		size = fmt.Sprintf("%d-%d bytes", gen.Size, gen.SizeMax)
+	}
+	rate := "unlimited rate"
+	if gen.Rate > 0 {
+		rate = fmt.Sprintf("%g events/s", gen.Rate)
+	}
+	count := "unlimited"
+	if gen.Count > 0 {
+		count = fmt.Sprint(gen.Count)
+	}
+	fmt.Fprintf(tw, "  generator\t%s events, %s schema, %s padding, %s\n", count, gen.Schema, size, rate)
+	fmt.Fprintf(tw, "  status\t%s (%s)\n", r.Status, r.ExitReason)
+	fmt.Fprintf(tw, "  events\t%d relayed, %d dropped, %s in %.2fs\n", r.Events, r.EventsDropped, formatBytes(float64(r.Bytes)), r.RelaySeconds)
+	fmt.Fprintf(tw, "  throughput\t%.0f events/s, %s/s\n", r.EventsPerSecond, formatBytes(r.BytesPerSecond))
+	if r.Latency.Samples > 0 {
+		fmt.Fprintf(tw, "  latency\tp50 %.3fms  p90 %.3fms  p99 %.3fms  max %.3fms\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	}
+	fmt.Fprintf(tw, "  backpressure\t%.2fs (%.0f%% of relay time)\n", r.Backpressure.Seconds, 100*r.Backpressure.Fraction)
+
+	names := make([]string, 0, len(r.Processes))
+	for name := range r.Processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := r.Processes[name]
+		fmt.Fprintf(tw, "  %s\tpid %d, cpu %.2fs (%.0f%%), peak rss %s\n", name, p.PID, p.CPUSeconds, p.CPUPercent, formatBytes(float64(p.PeakRSSBytes)))
+	}
+	tw.Flush()
+	if r.Error != "" {
+		fmt.Fprintf(w, "  error: %s\n", r.Error)
+	}
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+func init() {
+	benchCmd.Flags().IntVar(&benchCount, "count", 100000, "Events to generate (0 for no limit, with --duration)")
+	benchCmd.Flags().Float64Var(&benchRate, "rate", 0, "Events per second (0 for as fast as the output takes them)")
+	benchCmd.Flags().IntVar(&benchSize, "size", 256, "Bytes of padding in each event")
+	benchCmd.Flags().IntVar(&benchSizeMax, "size-max", 0, "Pad events by a random number of bytes between --size and this")
+	benchCmd.Flags().StringVar(&benchSchema, "schema", builtin.SchemaCDC, "Event schema: cdc or simple")
+	benchCmd.Flags().Uint64Var(&benchSeed, "seed", 0, "Seed for the event sizes (0 for random)")
+	benchCmd.Flags().DurationVar(&benchDuration, "duration", 0, "Stop the benchmark after this long (0 for no limit)")
+	benchCmd.Flags().DurationVar(&benchSampleInterval, "sample-interval", 500*time.Millisecond, "How often CPU and memory are sampled")
+	benchCmd.Flags().StringVar(&benchFormat, "format", "text", "Output format: text or json")
+	rootCmd.AddCommand(benchCmd)
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/katasec/dstream/pkg/daemon"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ctlSocket string
+	ctlAddr   string
+	ctlJSON   bool
+)
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Manage the tasks of a running dstream serve",
+	Long: `Talk to a running 'dstream serve' over its management API.
+
+Example:
+  dstream ctl list                     # Every task and its state
+  dstream ctl status mssql-to-asb      # One task
+  dstream ctl stop mssql-to-asb        # Stop gracefully
+  dstream ctl start mssql-to-asb
+  dstream ctl restart mssql-to-asb
+  dstream ctl reload                   # Re-read dstream.hcl, restart only what changed`,
+}
+
+var ctlListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tasks and their state",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tasks, err := ctlClient().Tasks()
+		ctlCheck(err)
+		if ctlJSON {
+			printJSON(tasks)
+			return
+		}
+		if len(tasks) == 0 {
+			fmt.Println("No tasks")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TASK\tSTATE\tRESTARTS\tSTARTED\tERROR")
+		for _, t := range tasks {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", t.Name, t.State, t.Restarts, formatTime(t.StartedAt), firstLine(t.Error))
+		}
+		w.Flush()
+	},
+}
+
+var ctlStatusCmd = &cobra.Command{
+	Use:   "status [task_name]",
+	Short: "Show a task, or the health of every task",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := ctlClient()
+		if len(args) == 0 {
+			status, err := client.Status()
+			ctlCheck(err)
+			printJSON(status)
+			return
+		}
+		st, err := client.Task(args[0])
+		ctlCheck(err)
+		printTaskState(st)
+	},
+}
+
+// ctlTaskCommand builds the start, stop and restart subcommands
+func ctlTaskCommand(use, short string, action func(*daemon.Client, string) (executor.TaskState, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " [task_name]",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			st, err := action(ctlClient(), args[0])
+			ctlCheck(err)
+			printTaskState(st)
+		},
+	}
+}
+
+var ctlReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload the config from disk, restarting only the tasks that changed",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := ctlClient().Reload()
+		ctlCheck(err)
+		if ctlJSON {
+			printJSON(result)
+			return
+		}
+		for _, group := range []struct {
+			label string
+			names []string
+		}{
+			{"Started", result.Started},
+			{"Restarted", result.Restarted},
+			{"Reloaded", result.Reloaded},
+			{"Stopped", result.Stopped},
+			{"Unchanged", result.Unchanged},
+		} {
+			fmt.Printf("%-10s %s\n", group.label+":", valueOrDash(strings.Join(group.names, ", ")))
+		}
+	},
+}
+
+func ctlClient() *daemon.Client {
+	return daemon.NewClient(ctlSocket, ctlAddr)
+}
+
+// ctlCheck exits with the API error, if any
+func ctlCheck(err error) {
+	if errors.Is(err, daemon.ErrNotRunning) {
+		log.Error("Could not reach dstream serve", "socket", ctlSocket, "error", err.Error())
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Error("Request failed", "error", err.Error())
+		os.Exit(1)
+	}
+}
+
+func printTaskState(st executor.TaskState) {
+	if ctlJSON {
+		printJSON(st)
+		return
+	}
+	fmt.Printf("Task:        %s\n", st.Name)
+	fmt.Printf("State:       %s\n", st.State)
+	fmt.Printf("Config hash: %s\n", valueOrDash(st.ConfigHash))
+	fmt.Printf("Started:     %s\n", formatTime(st.StartedAt))
+	if !st.StoppedAt.IsZero() {
+		fmt.Printf("Stopped:     %s\n", formatTime(st.StoppedAt))
+	}
+	fmt.Printf("Restarts:    %d\n", st.Restarts)
+	if !st.NextRun.IsZero() {
+		fmt.Printf("Next run:    %s\n", formatTime(st.NextRun))
+	}
+	if run := st.LastRun; run != nil {
+		fmt.Printf("Last run:    %s, %s (%s): %d events relayed, %d dropped, %d bytes\n", formatTime(run.StartedAt),
+			run.Status, run.ExitReason, run.EventsRelayed, run.EventsDropped, run.BytesRelayed)
+	}
+	if st.Error != "" {
+		fmt.Printf("Error:       %s\n", strings.ReplaceAll(st.Error, "\n", "\n             "))
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func init() {
+	ctlCmd.PersistentFlags().StringVar(&ctlSocket, "socket", daemon.DefaultSocket, "Unix socket of dstream serve")
+	ctlCmd.PersistentFlags().StringVar(&ctlAddr, "addr", "", "TCP address of dstream serve, instead of the socket")
+	ctlCmd.PersistentFlags().BoolVar(&ctlJSON, "json", false, "Print as JSON")
+	ctlCmd.AddCommand(ctlListCmd, ctlStatusCmd,
+		ctlTaskCommand("start", "Start a stopped task", (*daemon.Client).Start),
+		ctlTaskCommand("stop", "Stop a task gracefully", (*daemon.Client).Stop),
+		ctlTaskCommand("restart", "Stop and start a task", (*daemon.Client).Restart),
+		ctlReloadCmd)
+	rootCmd.AddCommand(ctlCmd)
+}
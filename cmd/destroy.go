@@ -3,29 +3,38 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/katasec/dstream/pkg/config"
 	"github.com/katasec/dstream/pkg/executor"
 	"github.com/spf13/cobra"
 )
 
+var (
+	destroyAll  bool
+	destroyTags []string
+)
+
 var destroyCmd = &cobra.Command{
-	Use:   "destroy [task_name]",
-	Short: "Destroy infrastructure for a specific task",
-	Long: `Destroy and clean up the infrastructure resources for a task.
+	Use:   "destroy [task_name...]",
+	Short: "Destroy infrastructure for one or more tasks",
+	Long: `Destroy and clean up the infrastructure resources for tasks.
 
 This command will:
 - Remove queues, topics, or other infrastructure resources
 - Clean up any resources created by the init command
 - Ensure no lingering resources remain
 
+Several tasks are destroyed in reverse dependency order, so a task goes before
+the tasks it names in depends_on; the first failure stops the rest.
+
 Example:
   dstream destroy mssql-to-asb    # Destroy infrastructure for mssql-to-asb task
+  dstream destroy --all           # Destroy every task, dependents first
 
 Warning: This operation is irreversible and will delete infrastructure resources.`,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		taskName := args[0]
 		hclPath := "dstream.hcl"
 
 		if _, err := os.Stat(hclPath); os.IsNotExist(err) {
@@ -39,29 +48,26 @@ Warning: This operation is irreversible and will delete infrastructure resources
 			os.Exit(1)
 		}
 
-		var task *config.TaskBlock
-		for _, t := range root.Tasks {
-			if t.Name == taskName {
-				task = &t
-				break
-			}
-		}
-
-		if task == nil {
-			log.Error("Task %q not found in %s", taskName, hclPath)
+		tasks, err := selectInDependencyOrder(root, args, destroyAll, destroyTags)
+		if err != nil {
+			log.Error("No tasks to destroy", "config", hclPath, "error", err.Error())
 			os.Exit(1)
 		}
+		slices.Reverse(tasks)
 
 		// Execute infrastructure destruction
-		if err := executor.ExecuteTaskWithCommand(task, "destroy"); err != nil {
-			log.Error("Task destruction failed", "task", taskName, "error", err.Error())
-			os.Exit(1)
+		for _, task := range tasks {
+			if err := executor.ExecuteTaskWithCommand(task, "destroy"); err != nil {
+				log.Error("Task destruction failed", "task", task.Name, "error", err.Error())
+				exit(1)
+			}
+			fmt.Printf("✅ Infrastructure for task %q destroyed successfully\n", task.Name)
 		}
-
-		fmt.Printf("✅ Infrastructure for task %q destroyed successfully\n", taskName)
 	},
 }
 
 func init() {
+	destroyCmd.Flags().BoolVar(&destroyAll, "all", false, "Destroy every task in the config")
+	destroyCmd.Flags().StringArrayVar(&destroyTags, "tag", nil, "Destroy every task with this tag (repeatable)")
 	rootCmd.AddCommand(destroyCmd)
-}
\ No newline at end of file
+}
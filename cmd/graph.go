@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var graphFormat string
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Print the dependency graph of the tasks",
+	Long: `Print how the tasks in the config depend on each other, set with depends_on:
+
+  task "asb-to-webhook" {
+    depends_on = ["mssql-to-asb"]
+    ...
+  }
+
+The text format lists the tasks in the order init and run bring them up, each
+with the tasks it depends on. The dot format is a Graphviz digraph with an edge
+from each task to the tasks it depends on.
+
+Example:
+  dstream graph
+  dstream graph --format dot | dot -Tsvg > tasks.svg`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := config.LoadRootFile(cfgFile)
+		if err != nil {
+			log.Error("Failed to load root config", "config", cfgFile, "error", err.Error())
+			os.Exit(1)
+		}
+		order, err := root.TaskOrder()
+		if err != nil {
+			log.Error("Invalid task dependencies", "error", err.Error())
+			os.Exit(1)
+		}
+
+		switch graphFormat {
+		case "text":
+			writeGraphText(os.Stdout, order)
+		case "dot":
+			writeGraphDOT(os.Stdout, order)
+		default:
+			log.Error("Unknown graph format, use text or dot", "format", graphFormat)
+			os.Exit(1)
+		}
+	},
+}
+
+// writeGraphText lists tasks in dependency order with what each depends on
+func writeGraphText(w io.Writer, order []*config.TaskBlock) {
+	for i, task := range order {
+		line := fmt.Sprintf("%d. %s", i+1, task.Name)
+		if !task.IsEnabled() {
+			line += " (disabled)"
+		}
+		if len(task.DependsOn) > 0 {
+			line += "  ← " + strings.Join(task.DependsOn, ", ")
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// writeGraphDOT writes tasks as a Graphviz digraph
+func writeGraphDOT(w io.Writer, order []*config.TaskBlock) {
+	fmt.Fprintln(w, "digraph dstream {")
+	fmt.Fprintln(w, "  rankdir = \"RL\";")
+	for _, task := range order {
+		attrs := ""
+		if !task.IsEnabled() {
+			attrs = " [style = \"dashed\"]"
+		}
+		fmt.Fprintf(w, "  %q%s;\n", task.Name, attrs)
+	}
+	for _, task := range order {
+		for _, dep := range task.DependsOn {
+			fmt.Fprintf(w, "  %q -> %q;\n", task.Name, dep)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func init() {
+	graphCmd.Flags().StringVar(&graphFormat, "format", "text", "Output format: text or dot")
+	rootCmd.AddCommand(graphCmd)
+}
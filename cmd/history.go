@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/katasec/dstream/pkg/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyLimit int
+	historyJSON  bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Inspect recorded task runs",
+	Long: `Inspect the runs DStream has recorded.
+
+Every run appends a record to ~/.dstream/history/<task>.jsonl with its run ID,
+config hash, provider refs and digests, start and end time, exit reason, event
+and byte counts, restart count and, when it failed, the providers' last stderr
+lines. Retention is set with a top-level history block in dstream.hcl:
+
+  history {
+    max_runs = 100     # runs kept per task, 0 for no limit
+    max_age  = "720h"  # also drop older runs
+  }
+
+Example:
+  dstream history list                         # Recent runs of every task
+  dstream history list mssql-to-asb            # Runs of one task
+  dstream history show 20250102T150405         # Details of one run (ID prefix is enough)`,
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list [task_name]",
+	Short: "List recorded runs newest first, for one task or all of them",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store := openHistory()
+		task := ""
+		if len(args) == 1 {
+			task = args[0]
+		}
+
+		runs, err := store.List(task)
+		if err != nil {
+			log.Error("Failed to read history", "error", err.Error())
+			os.Exit(1)
+		}
+		if historyLimit > 0 && len(runs) > historyLimit {
+			runs = runs[:historyLimit]
+		}
+
+		if historyJSON {
+			printJSON(runs)
+			return
+		}
+		if len(runs) == 0 {
+			fmt.Println("No runs recorded")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN ID\tTASK\tSTARTED\tDURATION\tSTATUS\tEVENTS\tREASON")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", r.ID, r.Task,
+				r.StartedAt.Local().Format("2006-01-02 15:04:05"), r.Duration().Round(time.Second),
+				r.Status, r.EventsRelayed, r.ExitReason)
+		}
+		w.Flush()
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show [run_id]",
+	Short: "Show the details of a recorded run",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		run, err := openHistory().Get(args[0])
+		if errors.Is(err, history.ErrNotFound) {
+			fmt.Printf("No run with ID %q\n", args[0])
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Error("Failed to read history", "error", err.Error())
+			os.Exit(1)
+		}
+
+		if historyJSON {
+			printJSON(run)
+			return
+		}
+
+		fmt.Printf("Run:         %s\n", run.ID)
+		fmt.Printf("Task:        %s\n", run.Task)
+		fmt.Printf("Config hash: %s\n", valueOrDash(run.ConfigHash))
+		for _, role := range []string{"input", "output"} {
+			p, ok := run.Providers[role]
+			if !ok {
+				continue
+			}
+			ref := p.Ref
+			if ref == "" {
+				ref = p.Path
+			}
+			fmt.Printf("%-13s%s (%s)\n", role+":", valueOrDash(ref), valueOrDash(p.Digest))
+		}
+		fmt.Printf("Started:     %s\n", run.StartedAt.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Finished:    %s (%s)\n", run.FinishedAt.Local().Format("2006-01-02 15:04:05"), run.Duration().Round(time.Millisecond))
+		fmt.Printf("Status:      %s (%s)\n", run.Status, run.ExitReason)
+		if run.Error != "" {
+			fmt.Printf("Error:       %s\n", strings.ReplaceAll(run.Error, "\n", "\n             "))
+		}
+		fmt.Printf("Events:      %d relayed, %d dropped, %d bytes\n", run.EventsRelayed, run.EventsDropped, run.BytesRelayed)
+		fmt.Printf("Restarts:    %d\n", run.Restarts)
+		if len(run.FaultsInjected) > 0 {
+			faults := make([]string, 0, len(run.FaultsInjected))
+			for fault, n := range run.FaultsInjected {
+				faults = append(faults, fmt.Sprintf("%s %d", fault, n))
+			}
+			sort.Strings(faults)
+			fmt.Printf("Faults:      %s\n", strings.Join(faults, ", "))
+		}
+
+		roles := make([]string, 0, len(run.StderrTail))
+		for role := range run.StderrTail {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		for _, role := range roles {
+			fmt.Printf("\nLast %s stderr:\n", role)
+			for _, line := range run.StderrTail[role] {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+	},
+}
+
+func openHistory() *history.Store {
+	dir, err := history.DefaultDir()
+	if err != nil {
+		log.Error("Failed to locate history", "error", err.Error())
+		os.Exit(1)
+	}
+	return history.NewStore(dir)
+}
+
+func printJSON(v any) {
+	out, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(out))
+}
+
+func init() {
+	historyCmd.PersistentFlags().BoolVar(&historyJSON, "json", false, "Print as JSON")
+	historyListCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Show at most this many runs, 0 for all")
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	rootCmd.AddCommand(historyCmd)
+}
@@ -3,27 +3,41 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/katasec/dstream/pkg/config"
 	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/plan"
 	"github.com/spf13/cobra"
 )
 
+var (
+	initAll  bool
+	initTags []string
+)
+
 var initCmd = &cobra.Command{
-	Use:   "init [task_name]",
-	Short: "Initialize infrastructure for a specific task",
-	Long: `Initialize and provision the required infrastructure for a task.
+	Use:   "init [task_name... | plan_file.json]",
+	Short: "Initialize infrastructure for one or more tasks",
+	Long: `Initialize and provision the required infrastructure for tasks.
 
 This command will:
 - Create necessary queues, topics, or other infrastructure resources
 - Prepare the environment for data streaming
 - Validate provider configurations
 
+Several tasks are initialized in dependency order, so a task comes after the
+tasks it names in depends_on; the first failure stops the rest.
+
+Given a plan file saved by 'dstream plan --out', only the reviewed changes in
+that plan are applied. The plan is rejected if the task config has changed.
+
 Example:
-  dstream init mssql-to-asb    # Initialize infrastructure for mssql-to-asb task`,
-	Args: cobra.ExactArgs(1),
+  dstream init mssql-to-asb    # Initialize infrastructure for mssql-to-asb task
+  dstream init --all           # Initialize every task, dependencies first
+  dstream init plan.json       # Apply a previously saved plan`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		taskName := args[0]
 		hclPath := "dstream.hcl"
 
 		if _, err := os.Stat(hclPath); os.IsNotExist(err) {
@@ -37,29 +51,55 @@ Example:
 			os.Exit(1)
 		}
 
-		var task *config.TaskBlock
-		for _, t := range root.Tasks {
-			if t.Name == taskName {
-				task = &t
-				break
+		// A .json argument is a saved plan rather than a task name
+		if len(args) == 1 && filepath.Ext(args[0]) == ".json" {
+			savedPlan, err := plan.Load(args[0])
+			if err != nil {
+				log.Error("Failed to load plan", "path", args[0], "error", err.Error())
+				os.Exit(1)
 			}
+			task := root.Task(savedPlan.Task)
+			if task == nil {
+				log.Error("Task %q not found in %s", savedPlan.Task, hclPath)
+				os.Exit(1)
+			}
+			if err := executor.ApplyPlan(task, savedPlan); err != nil {
+				log.Error("Applying plan failed", "task", task.Name, "error", err.Error())
+				exit(1)
+			}
+			fmt.Printf("✅ Plan for task %q applied successfully (%s)\n", task.Name, savedPlan.Summarize())
+			return
 		}
 
-		if task == nil {
-			log.Error("Task %q not found in %s", taskName, hclPath)
+		tasks, err := selectInDependencyOrder(root, args, initAll, initTags)
+		if err != nil {
+			log.Error("No tasks to initialize", "config", hclPath, "error", err.Error())
 			os.Exit(1)
 		}
 
 		// Execute infrastructure initialization
-		if err := executor.ExecuteTaskWithCommand(task, "init"); err != nil {
-			log.Error("Task initialization failed", "task", taskName, "error", err.Error())
-			os.Exit(1)
+		for _, task := range tasks {
+			if err := executor.ExecuteTaskWithCommand(task, "init"); err != nil {
+				log.Error("Task initialization failed", "task", task.Name, "error", err.Error())
+				exit(1)
+			}
+			fmt.Printf("✅ Infrastructure for task %q initialized successfully\n", task.Name)
 		}
-
-		fmt.Printf("✅ Infrastructure for task %q initialized successfully\n", taskName)
 	},
 }
 
+// selectInDependencyOrder selects tasks as run does and sorts them so that each
+// comes after the tasks it depends on
+func selectInDependencyOrder(root *config.RootHCL, names []string, all bool, tags []string) ([]*config.TaskBlock, error) {
+	tasks, err := root.SelectTasks(names, all, tags)
+	if err != nil {
+		return nil, err
+	}
+	return root.InDependencyOrder(tasks)
+}
+
 func init() {
+	initCmd.Flags().BoolVar(&initAll, "all", false, "Initialize every task in the config")
+	initCmd.Flags().StringArrayVar(&initTags, "tag", nil, "Initialize every task with this tag (repeatable)")
 	rootCmd.AddCommand(initCmd)
-}
\ No newline at end of file
+}
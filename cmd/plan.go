@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/katasec/dstream/pkg/config"
 	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/plan"
+	"github.com/katasec/dstream/pkg/state"
 	"github.com/spf13/cobra"
 )
 
@@ -19,9 +22,15 @@ This command will:
 - Show what resources would be created by init
 - Show what resources would be destroyed by destroy
 - Validate provider configurations
+- Report config changes since the state recorded by the last init
+
+Providers report proposed changes as structured JSON, which is rendered as a
+diff with a summary line. Save the plan with --out and apply exactly those
+changes later with 'dstream init <plan file>'.
 
 Example:
-  dstream plan mssql-to-asb    # Show planned changes for mssql-to-asb task
+  dstream plan mssql-to-asb                    # Show planned changes for mssql-to-asb task
+  dstream plan mssql-to-asb --out plan.json    # Save the plan for a later 'dstream init plan.json'
 
 This is similar to 'terraform plan' - it shows what would happen without making changes.`,
 	Args: cobra.ExactArgs(1),
@@ -31,13 +40,13 @@ This is similar to 'terraform plan' - it shows what would happen without making
 
 		if _, err := os.Stat(hclPath); os.IsNotExist(err) {
 			log.Error("Config file not found: %s", hclPath)
-			os.Exit(1)
+			exit(1)
 		}
 
 		root, err := config.LoadRootFile(hclPath)
 		if err != nil {
 			log.Error("Failed to load root config from %s: %v", hclPath, err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		var task *config.TaskBlock
@@ -50,19 +59,61 @@ This is similar to 'terraform plan' - it shows what would happen without making
 
 		if task == nil {
 			log.Error("Task %q not found in %s", taskName, hclPath)
-			os.Exit(1)
+			exit(1)
 		}
 
+		// Compare the current config against what the last init recorded
+		showStateDrift(task)
+
 		// Execute infrastructure planning
-		if err := executor.ExecuteTaskWithCommand(task, "plan"); err != nil {
+		p, err := executor.PlanTask(task)
+		if err != nil {
 			log.Error("Task planning failed", "task", taskName, "error", err.Error())
-			os.Exit(1)
+			exit(1)
+		}
+
+		renderer := &plan.Renderer{Out: os.Stdout, Color: !planNoColor}
+		renderer.Render(p)
+
+		if planOut != "" {
+			if err := plan.Save(p, planOut); err != nil {
+				log.Error("Failed to save plan", "path", planOut, "error", err.Error())
+				exit(1)
+			}
+			fmt.Printf("\nSaved the plan to: %s\n", planOut)
+			fmt.Printf("To perform exactly these actions, run:\n  dstream init %s\n", planOut)
 		}
 
 		fmt.Printf("✅ Infrastructure plan for task %q completed successfully\n", taskName)
 	},
 }
 
+var (
+	planOut     string
+	planNoColor bool
+)
+
+// showStateDrift prints how the task config differs from its recorded state
+func showStateDrift(task *config.TaskBlock) {
+	_, diffs, err := executor.CompareState(task)
+	switch {
+	case errors.Is(err, state.ErrNotFound):
+		fmt.Printf("Task %q has no recorded state; init has not been run yet.\n\n", task.Name)
+	case err != nil:
+		log.Warn("Failed to compare config against state", "task", task.Name, "error", err.Error())
+	case len(diffs) == 0:
+		fmt.Printf("Task %q config matches recorded state.\n\n", task.Name)
+	default:
+		fmt.Printf("Task %q config has changed since the last init:\n", task.Name)
+		for _, d := range diffs {
+			fmt.Printf("  ~ %s\n", d)
+		}
+		fmt.Println()
+	}
+}
+
 func init() {
+	planCmd.Flags().StringVar(&planOut, "out", "", "Write the plan to this file for a later 'dstream init <file>'")
+	planCmd.Flags().BoolVar(&planNoColor, "no-color", false, "Disable colored diff output")
 	rootCmd.AddCommand(planCmd)
-}
\ No newline at end of file
+}
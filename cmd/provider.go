@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/conformance"
+	"github.com/katasec/dstream/pkg/orasfetch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	providerTestRole             string
+	providerTestConfig           string
+	providerTestConfigFile       string
+	providerTestEvents           string
+	providerTestLifecycle        []string
+	providerTestSkip             []string
+	providerTestFormat           string
+	providerTestReadyTimeout     time.Duration
+	providerTestShutdownTimeout  time.Duration
+	providerTestLifecycleTimeout time.Duration
+	providerTestObserve          time.Duration
+)
+
+var providerCmd = &cobra.Command{
+	Use:   "provider",
+	Short: "Tools for provider authors",
+}
+
+var providerTestCmd = &cobra.Command{
+	Use:   "test [path|ref]",
+	Short: "Check that a provider speaks the DStream provider protocol",
+	Long: `Run a provider binary against the provider contract and print a pass/fail
+matrix. The provider is given by path, or pulled by OCI reference like
+provider_ref in dstream.hcl.
+
+Each check starts a fresh process the way DStream would:
+
+  handshake            reads the run envelope and reports ready within the ready timeout
+  stdout_json          an input writes only JSON events to stdout; logs go to stderr
+  stdin_eof            an output exits 0 on stdin EOF; an input keeps running once its
+                       stdin is closed after the handshake
+  sigterm              exits 0 within the shutdown timeout of SIGTERM
+  malformed_envelope   refuses an envelope that isn't JSON instead of reporting ready
+  malformed_event      an output doesn't hang on a data line that isn't JSON
+  lifecycle_<command>  handles init, plan, status and destroy and exits 0
+
+The config has to be one the provider accepts. Lifecycle commands act on
+whatever it points at, so use a test config, or --lifecycle to pick commands
+and --skip to leave checks out. The exit status is 1 if any check failed.
+Provider authors writing Go can run the same checks from go test with the
+pkg/conformance package.
+
+Example:
+  dstream provider test ./bin/asb-output --role output --provider-config-file asb.json
+  dstream provider test ghcr.io/katasec/mssql-input:v0.2.0 --role input \
+      --provider-config '{"db_connection_string":"..."}' --lifecycle plan,status
+  dstream provider test ./bin/out --role output --format json > conformance.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := providerTestOptions()
+		if err != nil {
+			log.Error("Invalid provider test flags", "error", err.Error())
+			os.Exit(1)
+		}
+		if opts.Path, err = resolveProviderArg(args[0]); err != nil {
+			log.Error("Failed to resolve provider", "provider", args[0], "error", err.Error())
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		report, err := conformance.Run(ctx, opts)
+		if err != nil && report == nil {
+			log.Error("Provider test failed", "error", err.Error())
+			exit(1)
+		}
+
+		if providerTestFormat == "json" {
+			out, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(out))
+		} else {
+			report.Render(os.Stdout)
+		}
+		if err != nil || !report.Passed() {
+			exit(1)
+		}
+	},
+}
+
+// providerTestOptions builds the conformance options from flags
+func providerTestOptions() (conformance.Options, error) {
+	opts := conformance.Options{
+		Role:             providerTestRole,
+		Lifecycle:        providerTestLifecycle,
+		Skip:             providerTestSkip,
+		ReadyTimeout:     providerTestReadyTimeout,
+		ShutdownTimeout:  providerTestShutdownTimeout,
+		LifecycleTimeout: providerTestLifecycleTimeout,
+		Observe:          providerTestObserve,
+	}
+	if providerTestFormat != "text" && providerTestFormat != "json" {
+		return opts, fmt.Errorf("unknown format %q, use text or json", providerTestFormat)
+	}
+	if len(opts.Lifecycle) == 1 && opts.Lifecycle[0] == "none" {
+		opts.Lifecycle = []string{}
+	}
+
+	switch {
+	case providerTestConfig != "" && providerTestConfigFile != "":
+		return opts, fmt.Errorf("--provider-config and --provider-config-file are mutually exclusive")
+	case providerTestConfig != "":
+		opts.Config = json.RawMessage(providerTestConfig)
+	case providerTestConfigFile != "":
+		data, err := os.ReadFile(providerTestConfigFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Config = json.RawMessage(data)
+	}
+
+	if providerTestEvents != "" {
+		f, err := os.Open(providerTestEvents)
+		if err != nil {
+			return opts, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				opts.Events = append(opts.Events, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return opts, fmt.Errorf("read %s: %w", providerTestEvents, err)
+		}
+	}
+	return opts, nil
+}
+
+// resolveProviderArg returns the binary for a provider path or OCI reference
+func resolveProviderArg(arg string) (string, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, nil
+	}
+	if !strings.Contains(arg, "/") || !strings.Contains(arg, ":") {
+		return "", fmt.Errorf("no such file, and not an OCI reference")
+	}
+	return orasfetch.PullBinary(arg)
+}
+
+func init() {
+	providerTestCmd.Flags().StringVar(&providerTestRole, "role", "", "The provider's role: input or output (required)")
+	providerTestCmd.Flags().StringVar(&providerTestConfig, "provider-config", "", "The provider's config as JSON")
+	providerTestCmd.Flags().StringVar(&providerTestConfigFile, "provider-config-file", "", "Read the provider's config from this JSON file")
+	providerTestCmd.Flags().StringVar(&providerTestEvents, "events", "", "JSON lines file of events to write to an output (default: a few sample events)")
+	providerTestCmd.Flags().StringSliceVar(&providerTestLifecycle, "lifecycle", nil, `Lifecycle commands to check (default init,plan,status,destroy; "none" for none)`)
+	providerTestCmd.Flags().StringSliceVar(&providerTestSkip, "skip", nil, "Checks to skip, e.g. sigterm,lifecycle_destroy")
+	providerTestCmd.Flags().StringVar(&providerTestFormat, "format", "text", "Output format: text or json")
+	providerTestCmd.Flags().DurationVar(&providerTestReadyTimeout, "ready-timeout", 0, "How long to wait for the ready handshake (default 30s)")
+	providerTestCmd.Flags().DurationVar(&providerTestShutdownTimeout, "shutdown-timeout", 0, "How long to wait for the provider to exit (default 10s)")
+	providerTestCmd.Flags().DurationVar(&providerTestLifecycleTimeout, "lifecycle-timeout", 0, "How long a lifecycle command may take (default 5m)")
+	providerTestCmd.Flags().DurationVar(&providerTestObserve, "observe", 0, "How long to watch an input's output (default 2s)")
+	providerTestCmd.MarkFlagRequired("role")
+	providerCmd.AddCommand(providerTestCmd)
+	rootCmd.AddCommand(providerCmd)
+}
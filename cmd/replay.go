@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replaySpeed string
+	replayFrom  string
+	replayTo    string
+	replayLimit int
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [task_name] [recording]",
+	Short: "Feed a recorded event stream into a task's output provider",
+	Long: `Feed a file written by 'dstream run --record' into the task's output provider.
+
+Only the output provider is started; the input provider is not run. This is
+useful for reproducing a bug in an output provider, or for loading the same
+events into a fresh destination.
+
+Speed:
+  max        Send events as fast as the provider takes them (default)
+  original   Keep the recorded gaps between events
+  Nx         Replay N times faster than recorded, e.g. 10x or 0.5x
+
+Example:
+  dstream run mssql-to-asb --record events.jsonl
+  dstream replay mssql-to-asb events.jsonl
+  dstream replay mssql-to-asb events.jsonl --speed original
+  dstream replay mssql-to-asb events.jsonl --from 2025-01-02T15:00:00Z --limit 100`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		taskName, recordingPath := args[0], args[1]
+		hclPath := "dstream.hcl"
+
+		opts, err := replayOptions()
+		if err != nil {
+			log.Error("Invalid replay flags", "error", err.Error())
+			os.Exit(1)
+		}
+
+		if _, err := os.Stat(hclPath); os.IsNotExist(err) {
+			log.Error("Config file not found: %s", hclPath)
+			os.Exit(1)
+		}
+
+		root, err := config.LoadRootFile(hclPath)
+		if err != nil {
+			log.Error("Failed to load root config from %s: %v", hclPath, err)
+			os.Exit(1)
+		}
+
+		var task *config.TaskBlock
+		for _, t := range root.Tasks {
+			if t.Name == taskName {
+				task = &t
+				break
+			}
+		}
+
+		if task == nil {
+			log.Error("Task %q not found in %s", taskName, hclPath)
+			os.Exit(1)
+		}
+
+		if err := executor.ReplayTask(task, recordingPath, opts); err != nil {
+			log.Error("Replay failed", "task", taskName, "error", err.Error())
+			exit(1)
+		}
+
+		fmt.Printf("✅ Replayed %s into task %q\n", recordingPath, taskName)
+	},
+}
+
+// replayOptions converts the replay flags
+func replayOptions() (executor.ReplayOptions, error) {
+	opts := executor.ReplayOptions{Limit: replayLimit}
+	if replayLimit < 0 {
+		return opts, fmt.Errorf("--limit must not be negative")
+	}
+
+	speed, err := parseSpeed(replaySpeed)
+	if err != nil {
+		return opts, err
+	}
+	opts.Speed = speed
+
+	if replayFrom != "" {
+		if opts.From, err = time.Parse(time.RFC3339Nano, replayFrom); err != nil {
+			return opts, fmt.Errorf("--from: %w", err)
+		}
+	}
+	if replayTo != "" {
+		if opts.To, err = time.Parse(time.RFC3339Nano, replayTo); err != nil {
+			return opts, fmt.Errorf("--to: %w", err)
+		}
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.To.Before(opts.From) {
+		return opts, fmt.Errorf("--to is before --from")
+	}
+	return opts, nil
+}
+
+// parseSpeed accepts "max", "original" or a multiplier such as "10x"
+func parseSpeed(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "", "max":
+		return 0, nil
+	case "original":
+		return 1, nil
+	}
+	n, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("--speed must be max, original or a positive multiplier like 10x, got %q", s)
+	}
+	return n, nil
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replaySpeed, "speed", "max", "Replay speed: max, original, or a multiplier like 10x")
+	replayCmd.Flags().StringVar(&replayFrom, "from", "", "Skip events recorded before this time (RFC3339)")
+	replayCmd.Flags().StringVar(&replayTo, "to", "", "Stop at events recorded after this time (RFC3339)")
+	replayCmd.Flags().IntVar(&replayLimit, "limit", 0, "Stop after this many events (0 for all)")
+	rootCmd.AddCommand(replayCmd)
+}
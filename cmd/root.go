@@ -1,19 +1,30 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/katasec/dstream/internal/logging"
+	"github.com/katasec/dstream/pkg/logging"
+	"github.com/katasec/dstream/pkg/tracing"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cfgFile     string
-	logLevel    string
-	logFormat   string
-	logWithTime bool
+	cfgFile       string
+	logLevel      string
+	logFormat     string
+	logWithTime   bool
+	logColor      string
+	logFile       string
+	logMaxSize    int
+	logMaxBackups int
+
+	traceExporter    string
+	traceEndpoint    string
+	traceEventSample float64
 )
 
 var rootCmd = &cobra.Command{
@@ -22,8 +33,33 @@ var rootCmd = &cobra.Command{
 	Long:  `DStream is a plugin-based tool for streaming data between various sources and destinations using a flexible plugin architecture.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		logLevel = resolveLogLevel()
-		logging.SetLogLevel(logLevel)
+		if err := logging.Configure(logging.Options{
+			Level:      logLevel,
+			Format:     logFormat,
+			Time:       logWithTime,
+			Color:      logColor,
+			File:       logFile,
+			MaxSizeMB:  logMaxSize,
+			MaxBackups: logMaxBackups,
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		logging.GetHCLogger().Info("Log level set to", "level", logLevel)
+
+		if err := tracing.Setup(context.Background(), tracing.Options{
+			Exporter:         traceExporter,
+			Endpoint:         traceEndpoint,
+			Writer:           os.Stderr,
+			EventSampleRatio: traceEventSample,
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		shutdownTracing()
+		logging.Close()
 	},
 }
 
@@ -32,7 +68,16 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "dstream.hcl", "Config file path")
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "l", "", "Set log level (debug, info, warn, error)")
 	rootCmd.PersistentFlags().StringVarP(&logFormat, "log-format", "f", "text", "Set log format (text, json)")
-	rootCmd.PersistentFlags().BoolVarP(&logWithTime, "log-time", "t", false, "Include timestamp in logs")
+	rootCmd.PersistentFlags().BoolVarP(&logWithTime, "log-time", "t", true, "Include timestamp in text logs")
+	rootCmd.PersistentFlags().StringVar(&logColor, "log-color", logging.ColorAuto, "Color text logs: auto, always or never")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Write logs to this file instead of stderr")
+	rootCmd.PersistentFlags().IntVar(&logMaxSize, "log-max-size", 100, "Rotate the log file once it reaches this many megabytes, 0 to never rotate")
+	rootCmd.PersistentFlags().IntVar(&logMaxBackups, "log-max-backups", 3, "Number of rotated log files to keep")
+
+	// Tracing flags; OTLP also honours the standard OTEL_EXPORTER_OTLP_* variables
+	rootCmd.PersistentFlags().StringVar(&traceExporter, "trace-exporter", os.Getenv("DSTREAM_TRACE_EXPORTER"), "Export traces to otlp, stdout (JSON spans on stderr) or none")
+	rootCmd.PersistentFlags().StringVar(&traceEndpoint, "trace-endpoint", "", "OTLP collector address, e.g. localhost:4317")
+	rootCmd.PersistentFlags().Float64Var(&traceEventSample, "trace-sample-events", 0, "Fraction of relayed events to trace, 0 to 1")
 }
 
 func Execute() {
@@ -42,6 +87,23 @@ func Execute() {
 	}
 }
 
+// shutdownTracing flushes buffered spans before the process exits
+func shutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "flush traces:", err)
+	}
+}
+
+// exit flushes traces and exits; commands use it after a task fails so the
+// failing spans are not lost
+func exit(code int) {
+	shutdownTracing()
+	logging.Close()
+	os.Exit(code)
+}
+
 func resolveLogLevel() string {
 	if logLevel == "" {
 		logLevel = strings.ToLower(os.Getenv("DSTREAM_LOG_LEVEL"))
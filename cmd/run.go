@@ -2,22 +2,97 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/katasec/dstream/pkg/config"
 	"github.com/katasec/dstream/pkg/executor"
-	"github.com/katasec/dstream/internal/logging"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/httpserver"
+	"github.com/katasec/dstream/pkg/logging"
+	"github.com/katasec/dstream/pkg/metrics"
 	"github.com/spf13/cobra"
 )
 
 var log = logging.GetLogger()
 
+var (
+	runMetricsAddr    string
+	runHealthAddr     string
+	runStallThreshold time.Duration
+	runRecord         string
+	runInput          string
+	runOutput         string
+	runAll            bool
+	runTags           []string
+	runBatch          bool
+	runMaxRuntime     time.Duration
+	runRebootstrap    bool
+)
+
 var runCmd = &cobra.Command{
-	Use:   "run [task_name]",
-	Short: "Execute a specific task by name",
-	Args:  cobra.ExactArgs(1),
+	Use:   "run [task_name...]",
+	Short: "Execute one or more tasks",
+	Long: `Run tasks from dstream.hcl until they finish or DStream is stopped.
+
+Several tasks run side by side under one supervisor, each with its own provider
+processes and restart policy; they share the metrics and health endpoints, and
+SIGINT or SIGTERM shuts them all down gracefully.
+
+SIGHUP re-reads dstream.hcl without stopping the pipeline. A provider whose
+config changed is sent the new config if it advertised "reconfigure" in its
+handshake (an input only with reconfigure = true in its input block, which keeps
+its stdin open after the run envelope), or else restarted on its own while the
+other provider keeps running.
+Tasks whose task-level settings changed are restarted, and tasks that are newly
+selected or no longer selected are started or stopped.
+
+With --batch, or for a task with a schedule block, a run is a job: it lasts until
+the input provider exits and the output has drained, only failed runs are
+restarted, and --max-runtime (or the schedule's max_runtime) stops a run that
+goes on too long. run starts such a task once, straight away; dstream serve runs
+it on its schedule. A summary of each run is printed and the exit status says
+how it ended:
+
+  0  the input finished and the output drained
+  1  the run failed
+  2  stopped by a signal before the input finished
+  3  stopped after reaching its max runtime
+
+With several tasks the status is that of the first one that didn't complete.
+
+A task with a bootstrap block first copies the data that already exists: its
+snapshot provider runs with the "snapshot" command, and once it reports
+completion the input takes over from its high-watermark in the same pipeline.
+An interrupted snapshot resumes from its last checkpoint on the next run; a
+completed one isn't repeated unless --rebootstrap is given.
+
+A task with a fault_injection block has its relay misbehave on purpose, to check
+that its output provider survives bad conditions: lines are dropped, duplicated,
+corrupted, reordered or delayed, the output is paused, or a provider is killed
+with SIGKILL, as the block asks. A seed makes the faults repeatable, and each
+run's history records how many of each were injected. Don't use it in production.
+
+  task "orders" {
+    tags = ["cdc"]
+    restart {
+      policy       = "on_failure"  # never (default), on_failure or always
+      max_restarts = 5
+      backoff      = "1s"
+      max_backoff  = "1m"
+    }
+    ...
+  }
+
+Example:
+  dstream run mssql-to-asb          # One task
+  dstream run orders customers      # Several tasks
+  dstream run --all                 # Every task in dstream.hcl
+  dstream run --tag cdc             # Every task tagged cdc
+  dstream run --batch backfill      # Run until the input is exhausted, then exit`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		taskName := args[0]
 		hclPath := "dstream.hcl"
 
 		if _, err := os.Stat(hclPath); os.IsNotExist(err) {
@@ -31,28 +106,171 @@ var runCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		var task *config.TaskBlock
-		for _, t := range root.Tasks {
-			if t.Name == taskName {
-				task = &t // ✅ fix: take address of struct
-				break
-			}
+		tasks, err := root.SelectTasks(args, runAll, runTags)
+		if err != nil {
+			log.Error("No tasks to run", "config", hclPath, "error", err.Error())
+			os.Exit(1)
 		}
 
-		if task == nil {
-			log.Error("Task %q not found in %s", taskName, hclPath)
+		if err := executor.ConfigureHistory(root.History); err != nil {
+			log.Error("Invalid history settings", "error", err.Error())
 			os.Exit(1)
 		}
 
-		if err := executor.ExecuteTask(task); err != nil {
-			log.Error("Task execution failed", "task", taskName, "error", err.Error())
+		servers, err := startEndpoints()
+		if err != nil {
+			log.Error("Failed to start HTTP endpoints", "error", err.Error())
 			os.Exit(1)
 		}
+		for _, srv := range servers {
+			defer srv.Close()
+		}
 
-		fmt.Printf("✅ Task %q executed successfully\n", taskName)
+		opts := executor.RunOptions{
+			Record:      runRecord,
+			Input:       runInput,
+			Output:      runOutput,
+			Batch:       runBatch,
+			MaxRuntime:  runMaxRuntime,
+			Rebootstrap: runRebootstrap,
+		}
+		var states []executor.TaskState
+		if len(tasks) == 1 && tasks[0].Type != "providers" {
+			// Legacy plugin tasks run on their own, outside the supervisor
+			err = executor.ExecuteTaskWithOptions(tasks[0], opts)
+		} else {
+			// SIGHUP re-reads the config and reloads the selected tasks
+			load := func() ([]*config.TaskBlock, error) {
+				root, err := config.LoadRootFile(hclPath)
+				if err != nil {
+					return nil, err
+				}
+				return root.SelectTasks(args, runAll, runTags)
+			}
+			states, err = executor.Supervise(tasks, opts, load)
+		}
+		if err != nil {
+			log.Error("Task execution failed", "error", err.Error())
+		}
+		if isBatchRun(tasks) && len(states) > 0 {
+			if code := reportBatchRuns(states); code != executor.ExitCompleted {
+				exit(code)
+			}
+			return
+		}
+		if err != nil {
+			exit(1)
+		}
+
+		// With --output - stdout carries the events and nothing else
+		if runOutput != executor.StdioEndpoint {
+			for _, task := range tasks {
+				fmt.Printf("✅ Task %q executed successfully\n", task.Name)
+			}
+		}
 	},
 }
 
+// isBatchRun reports whether the tasks run as batch jobs: with --batch, or when
+// one of them has a schedule block
+func isBatchRun(tasks []*config.TaskBlock) bool {
+	if runBatch || runMaxRuntime > 0 {
+		return true
+	}
+	for _, task := range tasks {
+		if task.Schedule != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reportBatchRuns prints a summary of each task's last run and returns the exit
+// status of the first one that didn't complete
+func reportBatchRuns(states []executor.TaskState) int {
+	// With --output - stdout carries the events and nothing else
+	w := os.Stdout
+	if runOutput == executor.StdioEndpoint {
+		w = os.Stderr
+	}
+
+	code := executor.ExitCompleted
+	for _, st := range states {
+		run := st.LastRun
+		if run == nil {
+			// It never got as far as running, e.g. a dependency failed
+			fmt.Fprintf(w, "❌ Task %q did not run: %s\n", st.Name, firstLine(st.Error))
+			if code == executor.ExitCompleted {
+				code = executor.ExitFailed
+			}
+			continue
+		}
+		icon := "✅"
+		if run.ExitCode() != executor.ExitCompleted {
+			icon = "❌"
+			if code == executor.ExitCompleted {
+				code = run.ExitCode()
+			}
+		}
+		fmt.Fprintf(w, "%s Task %q %s: %d events relayed, %d dropped, %d bytes in %s\n", icon, st.Name,
+			run.ExitReason, run.EventsRelayed, run.EventsDropped, run.BytesRelayed, run.Duration().Round(time.Millisecond))
+	}
+	return code
+}
+
+// startEndpoints serves the metrics and health endpoints requested by flags. When
+// both use the same address they share one server.
+func startEndpoints() ([]*httpserver.Server, error) {
+	health.Default.StallThreshold = runStallThreshold
+
+	muxes := make(map[string]*http.ServeMux)
+	var addrs []string
+	mux := func(addr string) *http.ServeMux {
+		if _, ok := muxes[addr]; !ok {
+			muxes[addr] = http.NewServeMux()
+			addrs = append(addrs, addr)
+		}
+		return muxes[addr]
+	}
+
+	if runMetricsAddr != "" {
+		metrics.Default.Register(mux(runMetricsAddr))
+	}
+	if runHealthAddr != "" {
+		health.Default.Register(mux(runHealthAddr))
+	}
+
+	var servers []*httpserver.Server
+	for _, addr := range addrs {
+		srv, err := httpserver.Serve(addr, muxes[addr])
+		if err != nil {
+			for _, s := range servers {
+				s.Close()
+			}
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		servers = append(servers, srv)
+		if addr == runMetricsAddr {
+			log.Info("Serving metrics", "url", "http://"+srv.Addr()+"/metrics")
+		}
+		if addr == runHealthAddr {
+			log.Info("Serving health checks", "url", "http://"+srv.Addr()+"/healthz")
+		}
+	}
+	return servers, nil
+}
+
 func init() {
+	runCmd.Flags().StringVar(&runMetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9102")
+	runCmd.Flags().StringVar(&runHealthAddr, "health-addr", "", "Serve /healthz, /readyz and /status on this address, e.g. :8080")
+	runCmd.Flags().DurationVar(&runStallThreshold, "stall-threshold", health.DefaultStallThreshold, "Report not ready when a write to the output provider blocks longer than this")
+	runCmd.Flags().StringVar(&runRecord, "record", "", "Write every relayed event with its timestamp to this file, for dstream replay")
+	runCmd.Flags().StringVar(&runInput, "input", "", `Set to "-" to read events from stdin instead of starting the input provider`)
+	runCmd.Flags().StringVar(&runOutput, "output", "", `Set to "-" to write events to stdout instead of starting the output provider`)
+	runCmd.Flags().BoolVar(&runAll, "all", false, "Run every task in the config")
+	runCmd.Flags().StringArrayVar(&runTags, "tag", nil, "Run every task with this tag (repeatable)")
+	runCmd.Flags().BoolVar(&runBatch, "batch", false, "Run until the input provider exits, then print a summary and exit with the run's status")
+	runCmd.Flags().DurationVar(&runMaxRuntime, "max-runtime", 0, "Stop a run gracefully after this long; implies --batch")
+	runCmd.Flags().BoolVar(&runRebootstrap, "rebootstrap", false, "Take a task's bootstrap snapshot again even if it completed before")
 	rootCmd.AddCommand(runCmd)
 }
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/daemon"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/httpserver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveSocket string
+	serveAddr   string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run as an agent that supervises every enabled task",
+	Long: `Run as a long-lived agent: load the config, start every enabled task under one
+supervisor, and serve a management API for 'dstream ctl' on a unix socket
+(.dstream/dstream.sock by default) and optionally on a TCP address.
+
+Through the API tasks can be listed, started, stopped and restarted one at a
+time, and the config can be reloaded from disk: new and changed tasks are
+started or restarted, removed and disabled ones are stopped, and the rest keep
+running untouched. A running task where only provider config changed is
+reloaded in place: each changed provider is sent its new config if it supports
+"reconfigure", or else restarted on its own. SIGHUP reloads the config too.
+Tasks with 'enabled = false' are known but not started.
+
+A task with a schedule block runs as a batch job each time its cron expression
+fires, and sits in the "scheduled" state in between:
+
+  task "nightly-export" {
+    schedule {
+      cron        = "0 2 * * *"
+      timezone    = "Europe/London"  # defaults to the local time zone
+      max_runtime = "1h"
+      overlap     = "skip"           # skip (default), queue or replace
+    }
+    ...
+  }
+
+A run lasts until the input provider exits and the output has drained. When the
+next run is due while one is still going, overlap decides: skip it, queue it to
+start as soon as the current run finishes, or stop the current run and replace it.
+
+SIGINT or SIGTERM stops every task gracefully and exits; a second one force
+kills the providers.
+
+Example:
+  dstream serve
+  dstream serve --addr 127.0.0.1:7070 --metrics-addr :9102 --health-addr :8080`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := config.LoadRootFile(cfgFile)
+		if err != nil {
+			log.Error("Failed to load root config", "config", cfgFile, "error", err.Error())
+			os.Exit(1)
+		}
+		if err := executor.ConfigureHistory(root.History); err != nil {
+			log.Error("Invalid history settings", "error", err.Error())
+			os.Exit(1)
+		}
+
+		sup := executor.NewSupervisor(executor.RunOptions{})
+		sup.FollowSchedules()
+		load := func() ([]*config.TaskBlock, error) {
+			root, err := config.LoadRootFile(cfgFile)
+			if err != nil {
+				return nil, err
+			}
+			return servedTasks(root), nil
+		}
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(sigChan)
+
+		servers, err := startEndpoints()
+		if err != nil {
+			log.Error("Failed to start HTTP endpoints", "error", err.Error())
+			os.Exit(1)
+		}
+		for _, srv := range servers {
+			defer srv.Close()
+		}
+
+		api := &daemon.API{Supervisor: sup, Load: load, Health: health.Default}
+		apiSrv, err := httpserver.ServeUnix(serveSocket, api.Handler())
+		if err != nil {
+			log.Error("Failed to serve the management API", "socket", serveSocket, "error", err.Error())
+			exit(1)
+		}
+		defer apiSrv.Close()
+		log.Info("Serving the management API", "socket", serveSocket)
+		if serveAddr != "" {
+			tcpSrv, err := httpserver.Serve(serveAddr, api.Handler())
+			if err != nil {
+				log.Error("Failed to serve the management API", "addr", serveAddr, "error", err.Error())
+				exit(1)
+			}
+			defer tcpSrv.Close()
+			log.Info("Serving the management API", "url", "http://"+tcpSrv.Addr()+"/v1/tasks")
+		}
+
+		result, err := sup.Apply(servedTasks(root))
+		if err != nil {
+			log.Error("Failed to start tasks", "error", err.Error())
+			sup.StopAll(syscall.SIGTERM)
+			sup.Wait()
+			exit(1)
+		}
+		log.Info("DStream agent started", "tasks", len(result.Started))
+
+		sig := <-sigChan
+		for sig == syscall.SIGHUP {
+			sup.ReloadFrom(load)
+			sig = <-sigChan
+		}
+		signal.Ignore(syscall.SIGHUP) // nothing to reload while stopping
+		log.Info("Received signal, stopping all tasks", "signal", sig.String())
+		sup.StopAll(sig)
+		stopped := make(chan struct{})
+		go func() {
+			sup.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case sig := <-sigChan:
+			log.Warn("Received second signal, force killing providers", "signal", sig.String())
+			sup.StopAll(sig)
+			<-stopped
+		}
+		fmt.Println("✅ DStream agent stopped")
+	},
+}
+
+// servedTasks returns the tasks serve can supervise; legacy plugin tasks are
+// left out with a warning
+func servedTasks(root *config.RootHCL) []*config.TaskBlock {
+	var tasks []*config.TaskBlock
+	for i := range root.Tasks {
+		task := &root.Tasks[i]
+		if task.Type != "providers" {
+			log.Warn("Skipping task: only type = \"providers\" tasks can be served", "task", task.Name)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveSocket, "socket", daemon.DefaultSocket, "Unix socket for the management API")
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "", "Also serve the management API on this TCP address, e.g. 127.0.0.1:7070")
+	serveCmd.Flags().StringVar(&runMetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9102")
+	serveCmd.Flags().StringVar(&runHealthAddr, "health-addr", "", "Serve /healthz, /readyz and /status on this address, e.g. :8080")
+	serveCmd.Flags().DurationVar(&runStallThreshold, "stall-threshold", health.DefaultStallThreshold, "Report not ready when a write to the output provider blocks longer than this")
+	rootCmd.AddCommand(serveCmd)
+}
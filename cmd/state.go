@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/katasec/dstream/pkg/state"
+	"github.com/spf13/cobra"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect and modify recorded task state",
+	Long: `Inspect and modify the state DStream records for each task.
+
+State is written to .dstream/tasks/<task>/state.json by lifecycle commands and
+holds the resources providers reported during init, the config hash and
+provider digests they were created with, the outcome of the last run, and the
+progress of a bootstrap snapshot.
+
+Example:
+  dstream state list                                  # Tasks with recorded state
+  dstream state show mssql-to-asb                     # Resources and last run for a task
+  dstream state rm mssql-to-asb output.queue.cars     # Forget a single resource
+  dstream state rm mssql-to-asb                       # Forget the task entirely`,
+}
+
+var stateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tasks with recorded state",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store := state.NewStore(state.DefaultDir)
+		tasks, err := store.List()
+		if err != nil {
+			log.Error("Failed to list state", "error", err.Error())
+			os.Exit(1)
+		}
+		if len(tasks) == 0 {
+			fmt.Println("No task state recorded")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TASK\tRESOURCES\tLAST COMMAND\tSTATUS\tUPDATED")
+		for _, name := range tasks {
+			st, err := store.Load(name)
+			if err != nil {
+				fmt.Fprintf(w, "%s\t-\t-\terror: %v\t-\n", name, err)
+				continue
+			}
+			lastCmd, status := "-", "-"
+			if st.LastRun != nil {
+				lastCmd, status = st.LastRun.Command, st.LastRun.Status
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", name, len(st.Resources), lastCmd, status,
+				st.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+var stateShowJSON bool
+
+var stateShowCmd = &cobra.Command{
+	Use:   "show [task_name]",
+	Short: "Show recorded state for a task",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		taskName := args[0]
+		st, err := state.NewStore(state.DefaultDir).Load(taskName)
+		if errors.Is(err, state.ErrNotFound) {
+			fmt.Printf("No state recorded for task %q\n", taskName)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to load state", "task", taskName, "error", err.Error())
+			os.Exit(1)
+		}
+
+		if stateShowJSON {
+			out, _ := json.MarshalIndent(st, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+
+		fmt.Printf("Task:        %s\n", st.Task)
+		fmt.Printf("Config hash: %s\n", valueOrDash(st.ConfigHash))
+		for _, role := range []string{"input", "output"} {
+			p, ok := st.Providers[role]
+			if !ok {
+				continue
+			}
+			ref := p.Ref
+			if ref == "" {
+				ref = p.Path
+			}
+			fmt.Printf("%-13s%s (%s)\n", role+":", valueOrDash(ref), valueOrDash(p.Digest))
+		}
+		if st.LastRun != nil {
+			fmt.Printf("Last run:    %s %s at %s", st.LastRun.Command, st.LastRun.Status,
+				st.LastRun.FinishedAt.Local().Format("2006-01-02 15:04:05"))
+			if st.LastRun.Error != "" {
+				fmt.Printf(" (%s)", st.LastRun.Error)
+			}
+			fmt.Println()
+		}
+		if b := st.Bootstrap; b != nil {
+			fmt.Printf("Bootstrap:   %s, %d event(s)", b.Status, b.Events)
+			if b.Total > 0 {
+				fmt.Printf(", %d of %d done", b.Done, b.Total)
+			}
+			fmt.Println()
+			if len(b.Checkpoint) > 0 {
+				fmt.Printf("Checkpoint:  %s\n", compactJSON(b.Checkpoint))
+			}
+			if len(b.Watermark) > 0 {
+				fmt.Printf("Watermark:   %s\n", compactJSON(b.Watermark))
+			}
+		}
+
+		fmt.Printf("\nResources (%d):\n", len(st.Resources))
+		for _, r := range st.Resources {
+			if r.ID != "" {
+				fmt.Printf("  %s  id=%s\n", r.Address(), r.ID)
+			} else {
+				fmt.Printf("  %s\n", r.Address())
+			}
+		}
+	},
+}
+
+var stateRmCmd = &cobra.Command{
+	Use:   "rm [task_name] [address...]",
+	Short: "Remove resources, or a whole task, from recorded state",
+	Long: `Remove resources from recorded state without touching the infrastructure itself.
+
+With only a task name, the task's state file is deleted. With one or more
+resource addresses, only those resources are forgotten.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		taskName := args[0]
+		store := state.NewStore(state.DefaultDir)
+
+		if len(args) == 1 {
+			if err := store.Remove(taskName); err != nil {
+				log.Error("Failed to remove state", "task", taskName, "error", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("✅ State for task %q removed\n", taskName)
+			return
+		}
+
+		st, err := store.Load(taskName)
+		if err != nil {
+			log.Error("Failed to load state", "task", taskName, "error", err.Error())
+			os.Exit(1)
+		}
+		for _, addr := range args[1:] {
+			if !st.Remove(addr) {
+				log.Error("Resource not found in state", "task", taskName, "address", addr)
+				os.Exit(1)
+			}
+		}
+		if err := store.Save(st); err != nil {
+			log.Error("Failed to save state", "task", taskName, "error", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Removed %d resource(s) from state for task %q\n", len(args)-1, taskName)
+	},
+}
+
+// compactJSON renders a JSON value from the state file on one line
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	stateShowCmd.Flags().BoolVar(&stateShowJSON, "json", false, "Print raw state as JSON")
+
+	stateCmd.AddCommand(stateListCmd)
+	stateCmd.AddCommand(stateShowCmd)
+	stateCmd.AddCommand(stateRmCmd)
+	rootCmd.AddCommand(stateCmd)
+}
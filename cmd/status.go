@@ -56,7 +56,7 @@ This provides visibility into the current state of your streaming infrastructure
 		// Execute infrastructure status check
 		if err := executor.ExecuteTaskWithCommand(task, "status"); err != nil {
 			log.Error("Task status check failed", "task", taskName, "error", err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Printf("✅ Infrastructure status for task %q retrieved successfully\n", taskName)
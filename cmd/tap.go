@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/katasec/dstream/pkg/control"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tapFilters []string
+	tapEvery   int
+	tapRate    float64
+	tapLimit   int
+)
+
+var tapCmd = &cobra.Command{
+	Use:   "tap [task_name]",
+	Short: "Stream a copy of the events a running task relays",
+	Long: `Attach to a running task and print a copy of the events it relays, one per line.
+
+'dstream run' listens on a control socket in the task's working directory
+(.dstream/tasks/<task>/control.sock); run tap from the same directory. While no
+tap is attached the pipeline does no extra work, and a tap that can't keep up
+misses events instead of slowing the pipeline down.
+
+Filters are JSON paths with an optional comparison, and must all match:
+  --filter metadata.table                  the field is present
+  --filter 'data.op == "insert"'           the field equals a JSON value
+  --filter metadata.table=orders           a bare value compares as a string
+  --filter 'data.items.0.qty != 0'         array elements by index
+
+Example:
+  dstream tap mssql-to-asb                             # Everything
+  dstream tap mssql-to-asb --filter metadata.table=orders --rate 5
+  dstream tap mssql-to-asb --every 100 | jq .data`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		taskName := args[0]
+
+		for _, expr := range tapFilters {
+			if _, err := control.ParseFilter(expr); err != nil {
+				log.Error("Invalid filter", "error", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		conn, err := control.Dial(executor.ControlSocket(taskName), control.Request{
+			Command: control.CommandTap,
+			Tap:     &control.TapOptions{Filters: tapFilters, Every: tapEvery, Rate: tapRate},
+		})
+		if errors.Is(err, control.ErrNotRunning) {
+			log.Error("Task is not running in this directory", "task", taskName)
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Error("Failed to attach to task", "task", taskName, "error", err.Error())
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for n := 0; tapLimit == 0 || n < tapLimit; n++ {
+			if !scanner.Scan() {
+				break
+			}
+			fmt.Println(scanner.Text())
+		}
+	},
+}
+
+func init() {
+	tapCmd.Flags().StringArrayVar(&tapFilters, "filter", nil, "Only show events matching this JSON path predicate (repeatable)")
+	tapCmd.Flags().IntVar(&tapEvery, "every", 0, "Show one matching event in N")
+	tapCmd.Flags().Float64Var(&tapRate, "rate", 0, "Show at most this many events per second")
+	tapCmd.Flags().IntVar(&tapLimit, "limit", 0, "Exit after this many events (0 to run until the task stops)")
+	rootCmd.AddCommand(tapCmd)
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/pipetest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	testUpdate bool
+	testRun    string
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test [file|dir...]",
+	Short: "Run pipeline tests from *.dstest.hcl files",
+	Long: `Run the pipeline tests in *.dstest.hcl files, found under the current directory
+or the directories given.
+
+A test feeds a JSONL fixture through the relay in place of the task's input
+provider, through optional transform stages, and either captures what is relayed
+or delivers it to the task's real output provider. The relayed events are then
+checked against a golden JSONL file, an event count and JSON path assertions.
+No input provider or database is needed.
+
+  test "inserts reach the queue" {
+    task   = "mssql-to-asb"            # from this file or dstream.hcl
+    input  = "fixtures/orders.jsonl"
+    output = "capture"                 # default; "provider" runs the output provider
+    transform {
+      filter = "metadata.operation == \"insert\""
+    }
+    transform {
+      command = ["jq", "-c", "del(.metadata.lsn)"]
+    }
+    expect {
+      golden = "golden/inserts.jsonl"
+      count  = 2
+      assert = ["data.id != null", "metadata.table == \"orders\""]
+    }
+  }
+
+Golden files are compared event by event as JSON values. --update writes the
+relayed events to them instead. The exit status is 1 if any test failed.
+
+Example:
+  dstream test                          # Every *.dstest.hcl under .
+  dstream test tests/orders.dstest.hcl
+  dstream test --run inserts --update   # Rewrite the golden files of matching tests`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts pipetest.Options
+		opts.Update = testUpdate
+		if testRun != "" {
+			re, err := regexp.Compile(testRun)
+			if err != nil {
+				log.Error("Invalid --run pattern", "error", err.Error())
+				os.Exit(1)
+			}
+			opts.Run = re
+		}
+
+		files, err := findTestFiles(args)
+		if err != nil {
+			log.Error("Failed to find test files", "error", err.Error())
+			os.Exit(1)
+		}
+		if len(files) == 0 {
+			fmt.Println("No *.dstest.hcl files found")
+			return
+		}
+
+		// dstream.hcl is optional: tests may use only tasks of their own
+		var root *config.RootHCL
+		if _, err := os.Stat(cfgFile); err == nil {
+			if root, err = config.LoadRootFile(cfgFile); err != nil {
+				log.Error("Failed to load root config", "config", cfgFile, "error", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if !runTestFiles(ctx, files, root, opts) {
+			exit(1)
+		}
+	},
+}
+
+// runTestFiles runs every test file and prints the results; it reports whether
+// they all passed
+func runTestFiles(ctx context.Context, files []string, root *config.RootHCL, opts pipetest.Options) bool {
+	passed, failed := 0, 0
+	for _, path := range files {
+		started := time.Now()
+		f, err := config.LoadTestFile(path)
+		if err != nil {
+			fmt.Printf("FAIL\t%s\n    %v\n", path, err)
+			failed++
+			continue
+		}
+		fileOK := true
+		for _, res := range pipetest.RunFile(ctx, f, root, opts) {
+			duration := res.Duration.Round(time.Millisecond)
+			if !res.Passed() {
+				fileOK = false
+				failed++
+				fmt.Printf("--- FAIL: %s (%s)\n", res.Name, duration)
+				for _, failure := range res.Failures {
+					fmt.Printf("    %s\n", strings.ReplaceAll(failure, "\n", "\n    "))
+				}
+				continue
+			}
+			passed++
+			note := ""
+			if res.Updated {
+				note = ", golden file updated"
+			}
+			fmt.Printf("--- PASS: %s (%s, %d events%s)\n", res.Name, duration, res.Events, note)
+		}
+		status := "ok"
+		if !fileOK {
+			status = "FAIL"
+		}
+		fmt.Printf("%s\t%s\t%s\n", status, path, time.Since(started).Round(time.Millisecond))
+	}
+	fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+	return failed == 0
+}
+
+// findTestFiles expands the arguments into *.dstest.hcl files; directories are
+// searched recursively, skipping hidden ones
+func findTestFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path != arg && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), config.TestFileSuffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func init() {
+	testCmd.Flags().BoolVar(&testUpdate, "update", false, "Write the relayed events to the golden files instead of comparing")
+	testCmd.Flags().StringVar(&testRun, "run", "", "Run only tests whose name matches this regular expression")
+	rootCmd.AddCommand(testCmd)
+}
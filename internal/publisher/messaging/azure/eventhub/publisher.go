@@ -5,7 +5,7 @@ import (
 	"fmt"
 
 	publishertypes "github.com/katasec/dstream/internal/types/publisher"
-	"github.com/katasec/dstream/internal/logging"
+	"github.com/katasec/dstream/pkg/logging"
 )
 
 var log = logging.GetLogger()
@@ -0,0 +1,216 @@
+// Package builtin holds the providers that ship inside DStream, addressed as
+// provider_ref = "builtin://<name>". They run in-process, but speak the same
+// protocol as a provider binary: a command envelope on stdin, the ready or
+// error handshake on stdout, events on stdout (inputs) or stdin (outputs),
+// logs on stderr, and a graceful stop in place of SIGTERM.
+//
+//	generator   input   synthetic events at a set rate, count and size
+//	file        input   the lines of a file, optionally following it
+//	stdout      output  events printed to DStream's stdout
+//	null        output  events discarded and counted
+//	jsonl-file  output  events appended to a JSONL file
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Scheme prefixes the provider_ref of a builtin provider
+const Scheme = "builtin://"
+
+// lifecycleCommands are answered with ready and nothing else: builtins manage
+// no infrastructure
+var lifecycleCommands = []string{"init", "plan", "status", "destroy"}
+
+// IO stands in for a provider process's stdio and signals
+type IO struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Stop   <-chan struct{} // closed in place of SIGTERM
+}
+
+// provider is one builtin. Its config is decoded into the provider itself.
+type provider interface {
+	validate() error
+	run(ctx context.Context, s *session) error
+}
+
+type entry struct {
+	role string
+	new  func() provider // returns the provider with its config defaults set
+}
+
+var registry = map[string]entry{
+	"generator":  {"input", func() provider { return newGenerator() }},
+	"file":       {"input", func() provider { return newFileInput() }},
+	"stdout":     {"output", func() provider { return &stdoutSink{} }},
+	"null":       {"output", func() provider { return &nullSink{} }},
+	"jsonl-file": {"output", func() provider { return &jsonlSink{} }},
+}
+
+// Parse returns the builtin name in a provider_ref, and whether it is one
+func Parse(ref string) (name string, ok bool) {
+	return strings.CutPrefix(ref, Scheme)
+}
+
+// Known reports whether name is a builtin provider
+func Known(name string) bool {
+	_, ok := registry[name]
+	return ok
+}
+
+// Names returns the builtin providers, sorted
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// session is one invocation of a builtin provider
+type session struct {
+	IO
+	name string
+	in   *bufio.Reader // stdin, after the envelope
+	log  *slog.Logger
+}
+
+// Run runs the builtin provider name in role, as main would in a provider
+// binary: it reads the command envelope from stdin and answers the handshake,
+// then runs until its input ends, stdin reaches EOF, Stop is closed or ctx is
+// cancelled. The error stands in for a non-zero exit status.
+func Run(ctx context.Context, name, role string, stdio IO) error {
+	s := &session{
+		IO:   stdio,
+		name: name,
+		in:   bufio.NewReaderSize(stdio.Stdin, 64*1024),
+		log:  slog.New(slog.NewJSONHandler(stdio.Stderr, nil)).With("logger", "builtin."+name),
+	}
+	command, p, err := s.start(role)
+	if err != nil {
+		handshake, _ := json.Marshal(map[string]string{"status": "error", "message": err.Error()})
+		s.emit(handshake)
+		return err
+	}
+	if _, err := io.WriteString(s.Stdout, "{\"status\":\"ready\"}\n"); err != nil {
+		return err
+	}
+	if command != "run" {
+		return nil
+	}
+	return p.run(ctx, s)
+}
+
+// start reads the command envelope and decodes its config
+func (s *session) start(role string) (string, provider, error) {
+	e, ok := registry[s.name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown builtin provider %q, expected one of %s", s.name, strings.Join(Names(), ", "))
+	}
+	if e.role != role {
+		return "", nil, fmt.Errorf("%s%s is an %s provider, not %s", Scheme, s.name, e.role, role)
+	}
+
+	line, err := s.in.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return "", nil, fmt.Errorf("read command envelope: %w", err)
+	}
+	var envelope struct {
+		Command string          `json:"command"`
+		Config  json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return "", nil, fmt.Errorf("parse command envelope: %w", err)
+	}
+	if envelope.Command != "run" && !slices.Contains(lifecycleCommands, envelope.Command) {
+		return "", nil, fmt.Errorf("%s%s doesn't support the %q command", Scheme, s.name, envelope.Command)
+	}
+
+	p := e.new()
+	if len(envelope.Config) > 0 && !bytes.Equal(envelope.Config, []byte("null")) {
+		dec := json.NewDecoder(bytes.NewReader(envelope.Config))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(p); err != nil {
+			return "", nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	if err := p.validate(); err != nil {
+		return "", nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return envelope.Command, p, nil
+}
+
+// lines reads stdin line by line in the background, so that an output can wait
+// on its events, Stop and ctx together. The channel is closed at EOF, after
+// which readErr returns any read error. The reader is left blocked if the
+// provider returns first; the host closes stdin once it has.
+func (s *session) lines() (events <-chan string, readErr func() error) {
+	ch := make(chan string)
+	var err error
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(s.in)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				ch <- line
+			}
+		}
+		err = scanner.Err()
+	}()
+	return ch, func() error { return err }
+}
+
+// consume passes each event on stdin to handle until stdin reaches EOF or Stop
+// is closed, which both end an output cleanly
+func (s *session) consume(ctx context.Context, handle func(line string) error) error {
+	events, readErr := s.lines()
+	for {
+		select {
+		case line, ok := <-events:
+			if !ok {
+				if err := readErr(); err != nil {
+					return fmt.Errorf("read events: %w", err)
+				}
+				return nil
+			}
+			if err := handle(line); err != nil {
+				return err
+			}
+		case <-s.Stop:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// emit writes one event to stdout
+func (s *session) emit(event []byte) error {
+	_, err := s.Stdout.Write(append(event, '\n'))
+	return err
+}
+
+// stopped reports whether the provider has been asked to stop
+func (s *session) stopped(ctx context.Context) bool {
+	select {
+	case <-s.Stop:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,227 @@
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run runs a builtin with the given stdin and returns what it wrote to stdout
+func run(t *testing.T, name, role, stdin string) (string, error) {
+	t.Helper()
+	var stdout bytes.Buffer
+	err := Run(context.Background(), name, role, IO{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		Stop:   make(chan struct{}),
+	})
+	return stdout.String(), err
+}
+
+func envelope(command, config string) string {
+	return `{"command":"` + command + `","config":` + config + "}\n"
+}
+
+func TestGeneratorEmitsEventsFromTemplate(t *testing.T) {
+	out, err := run(t, "generator", "input", envelope("run", `{"count":3,"template":"{\"id\": [[.Seq]],\n \"table\": [[json .Table]]}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"status":"ready"}
+{"id":1,"table":"generated"}
+{"id":2,"table":"generated"}
+{"id":3,"table":"generated"}
+`
+	if out != want {
+		t.Fatalf("expected %q, got %q", want, out)
+	}
+
+	out, err = run(t, "generator", "input", envelope("run", `{"count":1,"size":4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		Metadata struct{ Table, Operation string }
+		Data     struct{ Payload string }
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &event); err != nil || event.Metadata.Operation != "insert" || event.Data.Payload != "xxxx" {
+		t.Fatalf("unexpected default event %q (err=%v)", lines[len(lines)-1], err)
+	}
+}
+
+func TestGeneratorSizesAreSeeded(t *testing.T) {
+	config := `{"count":20,"size":10,"size_max":50,"schema":"cdc","seed":7}`
+	sizes := func() []int {
+		out, err := run(t, "generator", "input", envelope("run", config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sizes []int
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n")[1:] {
+			var event struct {
+				Data     struct{ Notes string }
+				Metadata struct{ Timestamp string }
+			}
+			if err := json.Unmarshal([]byte(line), &event); err != nil || event.Metadata.Timestamp == "" {
+				t.Fatalf("unexpected cdc event %q (err=%v)", line, err)
+			}
+			if n := len(event.Data.Notes); n < 10 || n > 50 {
+				t.Fatalf("expected 10 to 50 bytes of padding, got %d", n)
+			}
+			sizes = append(sizes, len(event.Data.Notes))
+		}
+		return sizes
+	}
+	first, second := sizes(), sizes()
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Fatalf("expected the same sizes from the same seed, got %v and %v", first, second)
+	}
+}
+
+func TestGeneratorStopsWhenAsked(t *testing.T) {
+	stop := make(chan struct{})
+	stdoutR, stdoutW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(context.Background(), "generator", "input", IO{
+			Stdin:  strings.NewReader(envelope("run", `{"rate":1000}`)),
+			Stdout: stdoutW,
+			Stderr: io.Discard,
+			Stop:   stop,
+		})
+	}()
+	go io.Copy(io.Discard, stdoutR)
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected a clean stop, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generator didn't stop")
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, provider, role, stdin, message string
+	}{
+		{"unknown config field", "generator", "input", envelope("run", `{"cuont":1}`), "unknown field"},
+		{"wrong role", "null", "input", envelope("run", `{}`), "is an output provider"},
+		{"unsupported command", "generator", "input", envelope("snapshot", `{}`), `doesn't support the "snapshot" command`},
+		{"missing path", "jsonl-file", "output", envelope("run", `{}`), "path is required"},
+		{"malformed envelope", "null", "output", "not json\n", "parse command envelope"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := run(t, tc.provider, tc.role, tc.stdin)
+			var handshake struct{ Status, Message string }
+			if jerr := json.Unmarshal([]byte(out), &handshake); err == nil || jerr != nil || handshake.Status != "error" || !strings.Contains(handshake.Message, tc.message) {
+				t.Fatalf("expected an error handshake mentioning %q, got %q (err=%v)", tc.message, out, err)
+			}
+		})
+	}
+}
+
+func TestLifecycleCommandsReportReady(t *testing.T) {
+	for _, command := range lifecycleCommands {
+		out, err := run(t, "jsonl-file", "output", envelope(command, `{"path":"/nonexistent/out.jsonl"}`))
+		if err != nil || out != "{\"status\":\"ready\"}\n" {
+			t.Fatalf("%s: expected only the ready handshake, got %q (err=%v)", command, out, err)
+		}
+	}
+}
+
+func TestFileInputWrapsLinesThatArentJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.log")
+	os.WriteFile(path, []byte("{\"data\":{\"id\":1}}\n\nplain text\nlast"), 0o644)
+
+	out, err := run(t, "file", "input", envelope("run", `{"path":`+jsonString(path)+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || lines[1] != `{"data":{"id":1}}` {
+		t.Fatalf("unexpected events %q", out)
+	}
+	want := `{"data":{"text":"plain text"},"metadata":{"file":` + jsonString(path) + `,"line":3}}`
+	if lines[2] != want || !strings.Contains(lines[3], `"text":"last"`) {
+		t.Fatalf("expected wrapped lines, got %q", out)
+	}
+}
+
+func TestFileInputFollowsAppendedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.jsonl")
+	os.WriteFile(path, []byte("{\"old\":true}\n"), 0o644)
+
+	stop := make(chan struct{})
+	stdoutR, stdoutW := io.Pipe()
+	go Run(context.Background(), "file", "input", IO{
+		Stdin:  strings.NewReader(envelope("run", `{"path":`+jsonString(path)+`,"follow":true,"start_at_end":true,"poll_interval":"10ms"}`)),
+		Stdout: stdoutW,
+		Stderr: io.Discard,
+		Stop:   stop,
+	})
+	defer close(stop)
+
+	buf := make([]byte, 256)
+	n, _ := stdoutR.Read(buf)
+	if string(buf[:n]) != "{\"status\":\"ready\"}\n" {
+		t.Fatalf("expected the handshake, got %q", buf[:n])
+	}
+	time.Sleep(50 * time.Millisecond) // it seeks to the end after the handshake
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("{\"new\":")
+	f.Sync()
+	time.Sleep(30 * time.Millisecond)
+	f.WriteString("true}\n")
+	f.Close()
+	if n, _ = stdoutR.Read(buf); string(buf[:n]) != "{\"new\":true}\n" {
+		t.Fatalf("expected only the appended line, got %q", buf[:n])
+	}
+}
+
+func TestJSONLFileAppendsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	os.WriteFile(path, []byte("{\"existing\":true}\n"), 0o644)
+
+	if _, err := run(t, "jsonl-file", "output", envelope("run", `{"path":`+jsonString(path)+`}`)+"{\"id\":1}\n{\"id\":2}\n"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "{\"existing\":true}\n{\"id\":1}\n{\"id\":2}\n"; string(data) != want {
+		t.Fatalf("expected %q, got %q", want, data)
+	}
+
+	if _, err := run(t, "jsonl-file", "output", envelope("run", `{"path":`+jsonString(path)+`,"truncate":true}`)+"{\"id\":3}\n"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = os.ReadFile(path); string(data) != "{\"id\":3}\n" {
+		t.Fatalf("expected the file to be truncated, got %q", data)
+	}
+}
+
+func TestStdoutPrintsEvents(t *testing.T) {
+	out, err := run(t, "stdout", "output", envelope("run", `{"pretty":true}`)+"{\"id\":1}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"status\":\"ready\"}\n{\n  \"id\": 1\n}\n"; out != want {
+		t.Fatalf("expected %q, got %q", want, out)
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,120 @@
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// fileInput is an input of the lines of a file. Lines that are JSON objects
+// are emitted as they are; others are wrapped as
+// {"metadata":{"file":...,"line":N},"data":{"text":...}}.
+//
+//	path           the file to read (required)
+//	follow         keep reading lines as they are appended, like tail -f
+//	start_at_end   with follow, skip the lines already in the file
+//	poll_interval  how often a followed file is checked for new lines
+type fileInput struct {
+	Path         string `json:"path"`
+	Follow       bool   `json:"follow"`
+	StartAtEnd   bool   `json:"start_at_end"`
+	PollInterval string `json:"poll_interval"`
+
+	poll time.Duration
+}
+
+func newFileInput() *fileInput {
+	return &fileInput{PollInterval: "250ms"}
+}
+
+func (f *fileInput) validate() error {
+	if f.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if f.StartAtEnd && !f.Follow {
+		return fmt.Errorf("start_at_end needs follow")
+	}
+	poll, err := time.ParseDuration(f.PollInterval)
+	if err != nil || poll <= 0 {
+		return fmt.Errorf("poll_interval must be a positive duration, got %q", f.PollInterval)
+	}
+	f.poll = poll
+	return nil
+}
+
+func (f *fileInput) run(ctx context.Context, s *session) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if f.StartAtEnd {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	s.log.Info("Reading file", "path", f.Path, "follow", f.Follow)
+
+	r := bufio.NewReaderSize(file, 64*1024)
+	var partial []byte // a line not yet terminated while following
+	lineNo := 0
+	for {
+		if s.stopped(ctx) {
+			return ctx.Err()
+		}
+		chunk, err := r.ReadBytes('\n')
+		partial = append(partial, chunk...)
+		if errors.Is(err, io.EOF) {
+			if !f.Follow {
+				if len(partial) > 0 {
+					lineNo++
+					return f.emitLine(s, partial, lineNo)
+				}
+				s.log.Info("Read whole file", "path", f.Path, "lines", lineNo)
+				return nil
+			}
+			// A writer may be part way through a line; wait for the rest
+			select {
+			case <-time.After(f.poll):
+			case <-s.Stop:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f.Path, err)
+		}
+		lineNo++
+		if err := f.emitLine(s, partial, lineNo); err != nil {
+			return err
+		}
+		partial = partial[:0]
+	}
+}
+
+// emitLine emits one line of the file as an event; blank lines are skipped
+func (f *fileInput) emitLine(s *session, line []byte, n int) error {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	if line[0] == '{' && json.Valid(line) {
+		return s.emit(line)
+	}
+	event, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"file": f.Path, "line": n},
+		"data":     map[string]any{"text": string(line)},
+	})
+	if err != nil {
+		return err
+	}
+	return s.emit(event)
+}
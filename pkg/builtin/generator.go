@@ -0,0 +1,186 @@
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Generator schemas
+const (
+	SchemaSimple = "simple" // {"metadata":{table,operation,sequence,timestamp},"data":{id,payload}}
+	SchemaCDC    = "cdc"    // a row change as the MSSQL ingester reports it
+)
+
+// generator is an input of synthetic events, for trying out a pipeline or
+// load testing an output without a database.
+//
+//	count     events to emit before exiting; 0 runs until stopped
+//	rate      events per second; 0 is as fast as the relay takes them
+//	size      bytes of padding in each event
+//	size_max  with size, pad each event by a uniformly random number of bytes
+//	          between size and size_max
+//	schema    "simple" (default) or "cdc"
+//	table     metadata.table of the event
+//	seed      makes the sizes and randInt repeatable; 0 picks one at random
+//	template  a text/template rendering one event as JSON, in place of the
+//	          schema. It sees .Seq (from 1), .Time, .Table and .Payload, and
+//	          the functions json and randInt. Actions are delimited by [[ ]],
+//	          since dstream.hcl's own templating consumes {{ }}.
+//
+// Every event of a schema carries metadata.timestamp, when it was generated.
+type generator struct {
+	Count    int     `json:"count"`
+	Rate     float64 `json:"rate"`
+	Size     int     `json:"size"`
+	SizeMax  int     `json:"size_max"`
+	Schema   string  `json:"schema"`
+	Table    string  `json:"table"`
+	Seed     uint64  `json:"seed"`
+	Template string  `json:"template"`
+
+	tmpl *template.Template
+	rng  *rand.Rand
+}
+
+func newGenerator() *generator {
+	return &generator{Schema: SchemaSimple, Table: "generated"}
+}
+
+func (g *generator) validate() error {
+	if g.Count < 0 || g.Rate < 0 || g.Size < 0 {
+		return fmt.Errorf("count, rate and size must not be negative")
+	}
+	if g.SizeMax != 0 && g.SizeMax < g.Size {
+		return fmt.Errorf("size_max must not be less than size")
+	}
+	if g.Schema != SchemaSimple && g.Schema != SchemaCDC {
+		return fmt.Errorf("schema must be %q or %q, got %q", SchemaSimple, SchemaCDC, g.Schema)
+	}
+	if g.Template == "" {
+		return nil
+	}
+	tmpl, err := template.New("event").Delims("[[", "]]").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"randInt": func(n int) int { return g.rng.IntN(max(n, 1)) },
+	}).Parse(g.Template)
+	if err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	g.tmpl = tmpl
+	return nil
+}
+
+// generatedEvent is what the template sees
+type generatedEvent struct {
+	Seq     int
+	Time    time.Time
+	Table   string
+	Payload string
+}
+
+func (g *generator) run(ctx context.Context, s *session) error {
+	seed := g.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	g.rng = rand.New(rand.NewPCG(seed, seed))
+	padding := strings.Repeat("x", max(g.Size, g.SizeMax))
+	started := time.Now()
+	s.log.Info("Generating events", "count", g.Count, "rate", g.Rate, "size", g.Size, "size_max", g.SizeMax, "seed", seed)
+
+	for seq := 1; g.Count == 0 || seq <= g.Count; seq++ {
+		if g.Rate > 0 {
+			// Pace against the start rather than the last event, so slow writes
+			// don't lower the rate
+			due := started.Add(time.Duration(float64(seq-1) / g.Rate * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-s.Stop:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		if s.stopped(ctx) {
+			return ctx.Err()
+		}
+
+		size := g.Size
+		if g.SizeMax > g.Size {
+			size += g.rng.IntN(g.SizeMax - g.Size + 1)
+		}
+		event, err := g.render(generatedEvent{Seq: seq, Time: time.Now().UTC(), Table: g.Table, Payload: padding[:size]})
+		if err != nil {
+			return fmt.Errorf("event %d: %w", seq, err)
+		}
+		if err := s.emit(event); err != nil {
+			return err
+		}
+	}
+	s.log.Info("Generated all events", "count", g.Count)
+	return nil
+}
+
+// render returns one event as a JSON line
+func (g *generator) render(e generatedEvent) ([]byte, error) {
+	timestamp := e.Time.Format(time.RFC3339Nano)
+	switch {
+	case g.tmpl != nil:
+		var buf bytes.Buffer
+		if err := g.tmpl.Execute(&buf, e); err != nil {
+			return nil, err
+		}
+		// Templates may span lines; events may not
+		var event bytes.Buffer
+		if err := json.Compact(&event, buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("template didn't render JSON: %w: %s", err, bytes.TrimSpace(buf.Bytes()))
+		}
+		return event.Bytes(), nil
+
+	case g.Schema == SchemaCDC:
+		return json.Marshal(map[string]any{
+			"data": map[string]any{
+				"__$operation":   2,
+				"__$start_lsn":   fmt.Sprintf("0x%020X", e.Seq),
+				"__$update_mask": "0x1F",
+				"PersonID":       e.Seq,
+				"FirstName":      "John",
+				"LastName":       "Doe",
+				"Email":          "john.doe@example.com",
+				"Phone":          "+1-555-0123",
+				"Address":        "123 Main St, Springfield, IL 62701",
+				"Notes":          e.Payload,
+				"UpdatedAt":      timestamp,
+			},
+			"metadata": map[string]any{
+				"table":     e.Table,
+				"host":      "localhost",
+				"database":  "generated",
+				"sequence":  e.Seq,
+				"timestamp": timestamp,
+			},
+		})
+
+	default:
+		return json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"table":     e.Table,
+				"operation": "insert",
+				"sequence":  e.Seq,
+				"timestamp": timestamp,
+			},
+			"data": map[string]any{"id": e.Seq, "payload": e.Payload},
+		})
+	}
+}
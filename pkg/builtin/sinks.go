@@ -0,0 +1,91 @@
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// stdoutSink prints events to its stdout, which DStream forwards to its own.
+//
+//	pretty  indent each event over several lines
+type stdoutSink struct {
+	Pretty bool `json:"pretty"`
+}
+
+func (o *stdoutSink) validate() error { return nil }
+
+func (o *stdoutSink) run(ctx context.Context, s *session) error {
+	return s.consume(ctx, func(line string) error {
+		if !o.Pretty {
+			return s.emit([]byte(line))
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(line), "", "  "); err != nil {
+			// Not JSON: print it as it came
+			return s.emit([]byte(line))
+		}
+		return s.emit(buf.Bytes())
+	})
+}
+
+// nullSink discards events, counting them. It has no config.
+type nullSink struct{}
+
+func (o *nullSink) validate() error { return nil }
+
+func (o *nullSink) run(ctx context.Context, s *session) error {
+	discarded := 0
+	err := s.consume(ctx, func(string) error {
+		discarded++
+		return nil
+	})
+	s.log.Info("Discarded events", "count", discarded)
+	return err
+}
+
+// jsonlSink writes events to a JSONL file, one per line.
+//
+//	path      the file to write (required)
+//	truncate  empty the file first rather than appending to it
+type jsonlSink struct {
+	Path     string `json:"path"`
+	Truncate bool   `json:"truncate"`
+}
+
+func (o *jsonlSink) validate() error {
+	if o.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	return nil
+}
+
+func (o *jsonlSink) run(ctx context.Context, s *session) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if o.Truncate {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(o.Path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	written := 0
+	err = s.consume(ctx, func(line string) error {
+		written++
+		_, err := fmt.Fprintln(w, line)
+		return err
+	})
+	// Whatever was relayed before a stop still reaches the file
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	s.log.Info("Wrote events", "path", o.Path, "count", written)
+	return err
+}
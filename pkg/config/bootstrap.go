@@ -0,0 +1,49 @@
+package config
+
+// BootstrapBlock gives a task a snapshot phase: before streaming starts, a
+// provider copies the data that already exists, up to a high-watermark, and the
+// input then streams from that watermark on.
+//
+//	bootstrap {
+//	  provider_path = "./mssql-snapshot"  # defaults to the input provider
+//	  config {                            # defaults to the input's config
+//	    batch_size = 5000
+//	  }
+//	}
+//
+// An empty block snapshots with the input provider itself.
+type BootstrapBlock struct {
+	Provider     string         `hcl:"provider,optional"`
+	ProviderPath string         `hcl:"provider_path,optional"`
+	ProviderRef  string         `hcl:"provider_ref,optional"`
+	Timeouts     *TimeoutsBlock `hcl:"timeouts,block"`
+	Config       *ConfigBlock   `hcl:"config,block"`
+}
+
+// BootstrapTask returns a copy of the task whose input is its snapshot provider:
+// the bootstrap block's provider, timeouts and config, each falling back to the
+// input's. It returns nil for a task without a bootstrap block.
+func (t *TaskBlock) BootstrapTask() *TaskBlock {
+	b := t.Bootstrap
+	if b == nil {
+		return nil
+	}
+
+	input := InputBlock{}
+	if t.Input != nil {
+		input = *t.Input
+	}
+	if b.Provider != "" || b.ProviderPath != "" || b.ProviderRef != "" {
+		input.Provider, input.ProviderPath, input.ProviderRef = b.Provider, b.ProviderPath, b.ProviderRef
+	}
+	if b.Timeouts != nil {
+		input.Timeouts = b.Timeouts
+	}
+	if b.Config != nil {
+		input.Config = b.Config
+	}
+
+	snapshot := *t
+	snapshot.Input = &input
+	return &snapshot
+}
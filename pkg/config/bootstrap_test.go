@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestBootstrapTask(t *testing.T) {
+	task := decodeTask(t, `
+task "t" {
+  input {
+    provider_path = "./mssql"
+    config {
+      tables = ["orders"]
+    }
+  }
+  bootstrap {
+    provider_path = "./mssql-snapshot"
+  }
+}`)
+	snapshot := task.BootstrapTask()
+	if snapshot.Input.ProviderPath != "./mssql-snapshot" || task.Input.ProviderPath != "./mssql" {
+		t.Fatalf("expected the snapshot provider in a copy of the task, got %q and %q",
+			snapshot.Input.ProviderPath, task.Input.ProviderPath)
+	}
+	if got, err := snapshot.InputConfigAsJSON(); err != nil || got != `{"tables":["orders"]}` {
+		t.Fatalf("expected the input's config, got %s (err=%v)", got, err)
+	}
+
+	task.Bootstrap = &BootstrapBlock{Config: &ConfigBlock{}}
+	if snapshot := task.BootstrapTask(); snapshot.Input.ProviderPath != "./mssql" || snapshot.Input.Config != task.Bootstrap.Config {
+		t.Fatalf("expected the input provider with the bootstrap config, got %+v", snapshot.Input)
+	}
+	if task.Bootstrap = nil; task.BootstrapTask() != nil {
+		t.Fatal("expected no snapshot task without a bootstrap block")
+	}
+}
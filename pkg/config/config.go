@@ -5,6 +5,7 @@ import "os"
 type RootHCL struct {
 	Locals  *LocalsBlock   `hcl:"locals,block"`
 	DStream *DStreamConfig `hcl:"dstream,block"`
+	History *HistoryBlock  `hcl:"history,block"`
 	Tasks   []TaskBlock    `hcl:"task,block"`
 }
 
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TaskOrder returns every task ordered so that each comes after the tasks it
+// depends on; tasks that don't depend on each other keep their config order. It
+// fails on a dependency on an unknown task or on a cycle.
+func (r *RootHCL) TaskOrder() ([]*TaskBlock, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(r.Tasks))
+	var order []*TaskBlock
+	var path []string
+
+	var visit func(t *TaskBlock) error
+	visit = func(t *TaskBlock) error {
+		switch marks[t.Name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, t.Name):], t.Name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		marks[t.Name] = visiting
+		path = append(path, t.Name)
+		for _, name := range t.DependsOn {
+			dep := r.Task(name)
+			if dep == nil {
+				return fmt.Errorf("task %q depends on unknown task %q", t.Name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[t.Name] = visited
+		order = append(order, t)
+		return nil
+	}
+
+	for i := range r.Tasks {
+		if err := visit(&r.Tasks[i]); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// InDependencyOrder sorts tasks, a selection from r, so that each comes after
+// the tasks it depends on, directly or through tasks that aren't selected
+func (r *RootHCL) InDependencyOrder(tasks []*TaskBlock) ([]*TaskBlock, error) {
+	order, err := r.TaskOrder()
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(tasks))
+	for _, t := range tasks {
+		selected[t.Name] = true
+	}
+	sorted := make([]*TaskBlock, 0, len(tasks))
+	for _, t := range order {
+		if selected[t.Name] {
+			sorted = append(sorted, t)
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+func decodeRoot(t *testing.T, src string) *RootHCL {
+	t.Helper()
+	var root RootHCL
+	if err := hclsimple.Decode("test.hcl", []byte(src), nil, &root); err != nil {
+		t.Fatal(err)
+	}
+	return &root
+}
+
+func taskNames(tasks []*TaskBlock) []string {
+	var names []string
+	for _, t := range tasks {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestTaskOrder(t *testing.T) {
+	root := decodeRoot(t, `
+task "webhook" {
+  depends_on = ["topic"]
+}
+task "export" {}
+task "topic" {
+  depends_on = ["cdc"]
+}
+task "cdc" {}
+`)
+	order, err := root.TaskOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := taskNames(order); !slices.Equal(got, []string{"cdc", "topic", "webhook", "export"}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+
+	// Order carries through tasks that aren't selected
+	sorted, err := root.InDependencyOrder([]*TaskBlock{root.Task("export"), root.Task("webhook"), root.Task("cdc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := taskNames(sorted); !slices.Equal(got, []string{"cdc", "webhook", "export"}) {
+		t.Fatalf("unexpected selection order: %v", got)
+	}
+}
+
+func TestTaskOrderRejectsBadDependencies(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		want string
+	}{
+		{`task "a" { depends_on = ["missing"] }`, `task "a" depends on unknown task "missing"`},
+		{`task "a" { depends_on = ["a"] }`, "dependency cycle: a -> a"},
+		{`
+task "a" { depends_on = ["b"] }
+task "b" { depends_on = ["c"] }
+task "c" { depends_on = ["a"] }
+`, "dependency cycle: a -> b -> c -> a"},
+	} {
+		_, err := decodeRoot(t, tt.src).TaskOrder()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected %q, got %v", tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+// TestFileSuffix names the files dstream test runs
+const TestFileSuffix = ".dstest.hcl"
+
+// Test outputs
+const (
+	TestOutputCapture  = "capture"  // relayed events are captured in place of the output provider
+	TestOutputProvider = "provider" // the task's output provider runs and receives them
+)
+
+// TestFile is a *.dstest.hcl file: pipeline tests, and tasks of its own that
+// they may use in place of those in dstream.hcl.
+//
+//	test "inserts reach the queue" {
+//	  task   = "mssql-to-asb"
+//	  input  = "fixtures/orders.jsonl"   # fed in place of the input provider
+//	  output = "capture"                 # or "provider" to run the real output
+//	  transform {
+//	    filter = "metadata.operation == \"insert\""
+//	  }
+//	  expect {
+//	    golden = "golden/orders.jsonl"
+//	    count  = 2
+//	    assert = ["data.id != null"]
+//	  }
+//	}
+//
+// Paths are relative to the test file.
+type TestFile struct {
+	Tasks []TaskBlock `hcl:"task,block"`
+	Tests []TestBlock `hcl:"test,block"`
+
+	Path string // the file the tests were loaded from
+}
+
+// TestBlock is one pipeline test
+type TestBlock struct {
+	Name       string           `hcl:"name,label"`
+	Task       string           `hcl:"task"`
+	Input      string           `hcl:"input"`
+	Output     string           `hcl:"output,optional"` // TestOutputCapture (default) or TestOutputProvider
+	Transforms []TransformBlock `hcl:"transform,block"`
+	Expect     *ExpectBlock     `hcl:"expect,block"`
+}
+
+// TransformBlock is a stage events pass through between the input fixture and
+// the output. It sets one of:
+//
+//	filter   keep only events matching a JSON path predicate, as dstream tap --filter
+//	command  pipe the events through a command, one JSON line each way
+type TransformBlock struct {
+	Filter  string   `hcl:"filter,optional"`
+	Command []string `hcl:"command,optional"`
+}
+
+// ExpectBlock is what the relayed events must look like
+type ExpectBlock struct {
+	Golden string   `hcl:"golden,optional"` // JSONL file the events must equal, line by line
+	Count  *int     `hcl:"count,optional"`  // number of events
+	Assert []string `hcl:"assert,optional"` // predicates every event must match
+}
+
+// LoadTestFile reads, templates and decodes a *.dstest.hcl file
+func LoadTestFile(path string) (*TestFile, error) {
+	hclStr, err := RenderHCLTemplate(path)
+	if err != nil {
+		return nil, fmt.Errorf("template processing failed: %w", err)
+	}
+	var f TestFile
+	if err := hclsimple.Decode(path, []byte(hclStr), nil, &f); err != nil {
+		return nil, fmt.Errorf("HCL decode failed: %w", err)
+	}
+	f.Path = path
+
+	for _, t := range f.Tests {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("test %q: %w", t.Name, err)
+		}
+	}
+	return &f, nil
+}
+
+// Resolve returns path relative to the test file
+func (f *TestFile) Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(f.Path), path)
+}
+
+// TaskFor returns the task a test runs: one defined in the test file, or else
+// one from root, which may be nil
+func (f *TestFile) TaskFor(t *TestBlock, root *RootHCL) (*TaskBlock, error) {
+	for i := range f.Tasks {
+		if f.Tasks[i].Name == t.Task {
+			return &f.Tasks[i], nil
+		}
+	}
+	if root != nil {
+		if task := root.Task(t.Task); task != nil {
+			return task, nil
+		}
+	}
+	return nil, fmt.Errorf("task %q not found in %s or dstream.hcl", t.Task, f.Path)
+}
+
+func (t *TestBlock) validate() error {
+	switch t.Output {
+	case "", TestOutputCapture, TestOutputProvider:
+	default:
+		return fmt.Errorf("output must be %q or %q, got %q", TestOutputCapture, TestOutputProvider, t.Output)
+	}
+	for i, tr := range t.Transforms {
+		if (tr.Filter == "") == (len(tr.Command) == 0) {
+			return fmt.Errorf("transform %d must set exactly one of filter or command", i+1)
+		}
+	}
+	if t.Expect != nil && t.Expect.Count != nil && *t.Expect.Count < 0 {
+		return fmt.Errorf("expect count must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTestFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(src string) string {
+		path := filepath.Join(dir, "t"+TestFileSuffix)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	f, err := LoadTestFile(write(`
+task "local" {}
+test "t" {
+  task  = "local"
+  input = "fixtures/in.jsonl"
+  transform {
+    filter = "data.id"
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Resolve(f.Tests[0].Input); got != filepath.Join(dir, "fixtures/in.jsonl") {
+		t.Fatalf("expected the fixture path relative to the file, got %s", got)
+	}
+	if task, err := f.TaskFor(&f.Tests[0], nil); err != nil || task.Name != "local" {
+		t.Fatalf("expected the file's own task, got %v (err=%v)", task, err)
+	}
+	root := &RootHCL{Tasks: []TaskBlock{{Name: "shared"}}}
+	if task, err := f.TaskFor(&TestBlock{Task: "shared"}, root); err != nil || task.Name != "shared" {
+		t.Fatalf("expected the task from dstream.hcl, got %v (err=%v)", task, err)
+	}
+
+	for block, want := range map[string]string{
+		`output = "stdout"`:             "output must be",
+		"transform {}":                  "exactly one of filter or command",
+		"expect {\n    count = -1\n  }": "must not be negative",
+	} {
+		_, err := LoadTestFile(write("test \"t\" {\n  task = \"x\"\n  input = \"in.jsonl\"\n  " + block + "\n}"))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", block, want, err)
+		}
+	}
+}
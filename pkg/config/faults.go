@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Providers a fault injection block can kill
+const (
+	KillOutput = "output" // the default
+	KillInput  = "input"
+	KillAny    = "any" // either, picked at random each time
+)
+
+// FaultInjectionBlock makes the relay misbehave on purpose, to check that the
+// output provider copes with what can go wrong in production:
+//
+//	fault_injection {
+//	  seed              = 42        # repeat the same faults; 0 picks one at random
+//	  delay             = "50ms"    # hold lines back by a random time up to this
+//	  delay_percent     = 10        # of lines delayed; 100 when unset, 0 for none
+//	  drop_percent      = 1         # of lines never written to the output
+//	  duplicate_percent = 1         # of lines written twice
+//	  corrupt_percent   = 0.5       # of lines truncated so they aren't valid JSON
+//	  reorder_window    = 10        # shuffle lines within batches of this many
+//	  pause             = "5s"      # stop writing to the output for this long
+//	  pause_interval    = "1m"      # at random intervals averaging this
+//	  kill_interval     = "2m"      # SIGKILL a provider at random intervals averaging this
+//	  kill_provider     = "output"  # output (default), input or any
+//	}
+//
+// Faults are chosen with a random source seeded by seed, so a run over the same
+// input injects the same line faults.
+type FaultInjectionBlock struct {
+	Seed             int64    `hcl:"seed,optional"`
+	Delay            string   `hcl:"delay,optional"`
+	DelayPercent     *float64 `hcl:"delay_percent,optional"`
+	DropPercent      float64  `hcl:"drop_percent,optional"`
+	DuplicatePercent float64  `hcl:"duplicate_percent,optional"`
+	CorruptPercent   float64  `hcl:"corrupt_percent,optional"`
+	ReorderWindow    int      `hcl:"reorder_window,optional"`
+	Pause            string   `hcl:"pause,optional"`
+	PauseInterval    string   `hcl:"pause_interval,optional"`
+	KillInterval     string   `hcl:"kill_interval,optional"`
+	KillProvider     string   `hcl:"kill_provider,optional"`
+}
+
+// FaultPolicy is a task's resolved fault injection block. Percentages are
+// fractions between 0 and 1.
+type FaultPolicy struct {
+	Seed          int64
+	Delay         time.Duration
+	DelayRate     float64
+	DropRate      float64
+	DuplicateRate float64
+	CorruptRate   float64
+	ReorderWindow int
+	Pause         time.Duration
+	PauseInterval time.Duration
+	KillInterval  time.Duration
+	KillProvider  string
+}
+
+// FaultPolicy validates the task's fault injection block and fills in
+// defaults. It returns nil for a task without one.
+func (t *TaskBlock) FaultPolicy() (*FaultPolicy, error) {
+	b := t.FaultInjection
+	if b == nil {
+		return nil, nil
+	}
+
+	p := &FaultPolicy{Seed: b.Seed, ReorderWindow: b.ReorderWindow, KillProvider: KillOutput}
+	delayPercent := 100.0
+	if b.DelayPercent != nil {
+		delayPercent = *b.DelayPercent
+	}
+	for _, f := range []struct {
+		name  string
+		value float64
+		dst   *float64
+	}{
+		{"delay_percent", delayPercent, &p.DelayRate},
+		{"drop_percent", b.DropPercent, &p.DropRate},
+		{"duplicate_percent", b.DuplicatePercent, &p.DuplicateRate},
+		{"corrupt_percent", b.CorruptPercent, &p.CorruptRate},
+	} {
+		if f.value < 0 || f.value > 100 {
+			return nil, fmt.Errorf("task %q: fault_injection.%s must be between 0 and 100, got %g", t.Name, f.name, f.value)
+		}
+		*f.dst = f.value / 100
+	}
+	if b.ReorderWindow < 0 {
+		return nil, fmt.Errorf("task %q: fault_injection.reorder_window must not be negative, got %d", t.Name, b.ReorderWindow)
+	}
+
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"delay", b.Delay, &p.Delay},
+		{"pause", b.Pause, &p.Pause},
+		{"pause_interval", b.PauseInterval, &p.PauseInterval},
+		{"kill_interval", b.KillInterval, &p.KillInterval},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("task %q: invalid fault_injection.%s %q: %w", t.Name, f.name, f.value, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("task %q: fault_injection.%s must be positive, got %q", t.Name, f.name, f.value)
+		}
+		*f.dst = d
+	}
+	if (p.Pause == 0) != (p.PauseInterval == 0) {
+		return nil, fmt.Errorf("task %q: fault_injection.pause and pause_interval must be set together", t.Name)
+	}
+
+	switch b.KillProvider {
+	case "":
+	case KillOutput, KillInput, KillAny:
+		p.KillProvider = b.KillProvider
+	default:
+		return nil, fmt.Errorf("task %q: fault_injection.kill_provider must be %q, %q or %q, got %q",
+			t.Name, KillOutput, KillInput, KillAny, b.KillProvider)
+	}
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFaultPolicy(t *testing.T) {
+	task := decodeTask(t, `
+task "t" {
+  fault_injection {
+    seed           = 42
+    delay          = "10ms"
+    drop_percent   = 5
+    reorder_window = 4
+    pause          = "1s"
+    pause_interval = "30s"
+    kill_interval  = "1m"
+    kill_provider  = "any"
+  }
+}`)
+	p, err := task.FaultPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Seed != 42 || p.Delay != 10*time.Millisecond || p.DelayRate != 1 || p.DropRate != 0.05 || p.DuplicateRate != 0 ||
+		p.ReorderWindow != 4 || p.Pause != time.Second || p.PauseInterval != 30*time.Second ||
+		p.KillInterval != time.Minute || p.KillProvider != KillAny {
+		t.Fatalf("unexpected policy: %+v", p)
+	}
+
+	if p, err := decodeTask(t, `task "t" {}`).FaultPolicy(); p != nil || err != nil {
+		t.Fatalf("expected no policy without a block, got %+v (err=%v)", p, err)
+	}
+	def, err := decodeTask(t, "task \"t\" {\n  fault_injection {}\n}").FaultPolicy()
+	if err != nil || def.KillProvider != KillOutput || def.DelayRate != 1 {
+		t.Fatalf("expected kill_provider to default to output and every line to be delayed, got %+v (err=%v)", def, err)
+	}
+	none, err := decodeTask(t, "task \"t\" {\n  fault_injection {\n    delay = \"1s\"\n    delay_percent = 0\n  }\n}").FaultPolicy()
+	if err != nil || none.DelayRate != 0 {
+		t.Fatalf("expected delay_percent = 0 to delay no lines, got %+v (err=%v)", none, err)
+	}
+
+	for _, block := range []string{`drop_percent = 101`, `corrupt_percent = -1`, `reorder_window = -2`, `delay = "soon"`,
+		`kill_interval = "0s"`, `pause = "1s"`, `kill_provider = "both"`} {
+		task := decodeTask(t, "task \"t\" {\n  fault_injection {\n    "+block+"\n  }\n}")
+		if _, err := task.FaultPolicy(); err == nil {
+			t.Errorf("%s: expected an error", block)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// ConfigHash returns a stable hash of everything that determines what a task's
+// providers will do: each provider's reference and its rendered config block.
+// Sprig templates are rendered before hashing, so a changed environment variable
+// shows up as a changed hash.
+func (t *TaskBlock) ConfigHash() (string, error) {
+	inputHash, err := t.InputConfigHash()
+	if err != nil {
+		return "", err
+	}
+	outputHash, err := t.OutputConfigHash()
+	if err != nil {
+		return "", err
+	}
+	return hashStrings(t.Name, inputHash, outputHash), nil
+}
+
+// InputConfigHash returns a stable hash of the input provider reference and config
+func (t *TaskBlock) InputConfigHash() (string, error) {
+	configJSON, err := t.InputConfigAsJSON()
+	if err != nil {
+		return "", fmt.Errorf("hash input config: %w", err)
+	}
+	if t.Input == nil {
+		return hashStrings(configJSON), nil
+	}
+	return hashStrings(t.Input.ProviderRef, t.Input.ProviderPath, configJSON), nil
+}
+
+// OutputConfigHash returns a stable hash of the output provider reference and config
+func (t *TaskBlock) OutputConfigHash() (string, error) {
+	configJSON, err := t.OutputConfigAsJSON()
+	if err != nil {
+		return "", fmt.Errorf("hash output config: %w", err)
+	}
+	if t.Output == nil {
+		return hashStrings(configJSON), nil
+	}
+	return hashStrings(t.Output.ProviderRef, t.Output.ProviderPath, configJSON), nil
+}
+
+// hashStrings hashes the given parts with a separator so ("ab", "c") and ("a", "bc") differ
+func hashStrings(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
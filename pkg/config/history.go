@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultHistoryMaxRuns is how many runs are kept per task unless configured
+const DefaultHistoryMaxRuns = 100
+
+// HistoryBlock configures the run history kept under ~/.dstream/history. It is a
+// top-level block in dstream.hcl:
+//
+//	history {
+//	  enabled  = true    # record runs (default true)
+//	  max_runs = 100     # runs kept per task, 0 for no limit
+//	  max_age  = "720h"  # also drop runs older than this (default: no limit)
+//	}
+type HistoryBlock struct {
+	Enabled *bool  `hcl:"enabled,optional"`
+	MaxRuns *int   `hcl:"max_runs,optional"`
+	MaxAge  string `hcl:"max_age,optional"`
+}
+
+// HistorySettings are the resolved history options
+type HistorySettings struct {
+	Enabled bool
+	MaxRuns int
+	MaxAge  time.Duration
+}
+
+// Settings validates the block and fills in defaults; a nil block is valid
+func (b *HistoryBlock) Settings() (HistorySettings, error) {
+	s := HistorySettings{Enabled: true, MaxRuns: DefaultHistoryMaxRuns}
+	if b == nil {
+		return s, nil
+	}
+	if b.Enabled != nil {
+		s.Enabled = *b.Enabled
+	}
+	if b.MaxRuns != nil {
+		if *b.MaxRuns < 0 {
+			return s, fmt.Errorf("history: max_runs must not be negative, got %d", *b.MaxRuns)
+		}
+		s.MaxRuns = *b.MaxRuns
+	}
+	if b.MaxAge != "" {
+		d, err := time.ParseDuration(b.MaxAge)
+		if err != nil {
+			return s, fmt.Errorf("history: invalid max_age %q: %w", b.MaxAge, err)
+		}
+		if d <= 0 {
+			return s, fmt.Errorf("history: max_age must be positive, got %q", b.MaxAge)
+		}
+		s.MaxAge = d
+	}
+	return s, nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+func TestHistorySettings(t *testing.T) {
+	var root RootHCL
+	err := hclsimple.Decode("test.hcl", []byte(`
+history {
+  max_runs = 0
+  max_age  = "72h"
+}`), nil, &root)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	s, err := root.History.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Enabled || s.MaxRuns != 0 || s.MaxAge != 72*time.Hour {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+
+	var none *HistoryBlock
+	if s, _ := none.Settings(); !s.Enabled || s.MaxRuns != DefaultHistoryMaxRuns {
+		t.Fatalf("unexpected defaults: %+v", s)
+	}
+
+	if _, err := (&HistoryBlock{MaxAge: "soon"}).Settings(); err == nil {
+		t.Fatal("expected an invalid max_age to be rejected")
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Restart policies for a task run under the supervisor
+const (
+	// RestartNever lets the task stop when its pipeline ends. This is the default.
+	RestartNever = "never"
+	// RestartOnFailure restarts the task when its pipeline fails
+	RestartOnFailure = "on_failure"
+	// RestartAlways also restarts the task when its pipeline completes
+	RestartAlways = "always"
+)
+
+// Default restart backoff, doubled after each restart up to the maximum
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartMaxBackoff = time.Minute
+)
+
+// RestartBlock sets what happens when a task's pipeline stops on its own:
+//
+//	restart {
+//	  policy       = "on_failure"  # never (default), on_failure or always
+//	  max_restarts = 5             # give up after this many in a row, 0 for no limit
+//	  backoff      = "1s"          # wait before the first restart
+//	  max_backoff  = "1m"          # the wait doubles up to this
+//	}
+//
+// A run that lasts longer than max_backoff resets the count and the backoff.
+type RestartBlock struct {
+	Policy      string `hcl:"policy,optional"`
+	MaxRestarts int    `hcl:"max_restarts,optional"`
+	Backoff     string `hcl:"backoff,optional"`
+	MaxBackoff  string `hcl:"max_backoff,optional"`
+}
+
+// RestartPolicy is a task's resolved restart block
+type RestartPolicy struct {
+	Policy      string
+	MaxRestarts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// RestartPolicy validates the task's restart block and fills in defaults
+func (t *TaskBlock) RestartPolicy() (RestartPolicy, error) {
+	p := RestartPolicy{
+		Policy:     RestartNever,
+		Backoff:    DefaultRestartBackoff,
+		MaxBackoff: DefaultRestartMaxBackoff,
+	}
+	b := t.Restart
+	if b == nil {
+		return p, nil
+	}
+
+	switch b.Policy {
+	case "":
+	case RestartNever, RestartOnFailure, RestartAlways:
+		p.Policy = b.Policy
+	default:
+		return p, fmt.Errorf("task %q: restart.policy must be %q, %q or %q, got %q",
+			t.Name, RestartNever, RestartOnFailure, RestartAlways, b.Policy)
+	}
+	if b.MaxRestarts < 0 {
+		return p, fmt.Errorf("task %q: restart.max_restarts must not be negative, got %d", t.Name, b.MaxRestarts)
+	}
+	p.MaxRestarts = b.MaxRestarts
+
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"backoff", b.Backoff, &p.Backoff},
+		{"max_backoff", b.MaxBackoff, &p.MaxBackoff},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return p, fmt.Errorf("task %q: invalid restart.%s %q: %w", t.Name, f.name, f.value, err)
+		}
+		if d <= 0 {
+			return p, fmt.Errorf("task %q: restart.%s must be positive, got %q", t.Name, f.name, f.value)
+		}
+		*f.dst = d
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	return p, nil
+}
+
+// ShouldRestart reports whether a pipeline that ended with err is restarted
+func (p RestartPolicy) ShouldRestart(err error) bool {
+	switch p.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
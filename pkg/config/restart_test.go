@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	task := decodeTask(t, `
+task "t" {
+  restart {
+    policy       = "on_failure"
+    max_restarts = 3
+    backoff      = "500ms"
+  }
+}`)
+	p, err := task.RestartPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Policy != RestartOnFailure || p.MaxRestarts != 3 || p.Backoff != 500*time.Millisecond || p.MaxBackoff != DefaultRestartMaxBackoff {
+		t.Fatalf("unexpected policy: %+v", p)
+	}
+	if !p.ShouldRestart(errors.New("boom")) || p.ShouldRestart(nil) {
+		t.Fatal("on_failure should restart on errors only")
+	}
+
+	def, err := decodeTask(t, `task "t" {}`).RestartPolicy()
+	if err != nil || def.Policy != RestartNever || def.ShouldRestart(errors.New("boom")) {
+		t.Fatalf("default should never restart: %+v (err=%v)", def, err)
+	}
+
+	for _, block := range []string{`policy = "sometimes"`, `max_restarts = -1`, `backoff = "soon"`, `max_backoff = "0s"`} {
+		task := decodeTask(t, "task \"t\" {\n  restart {\n    "+block+"\n  }\n}")
+		if _, err := task.RestartPolicy(); err == nil {
+			t.Errorf("%s: expected an error", block)
+		}
+	}
+}
+
+func TestSelectTasks(t *testing.T) {
+	var root RootHCL
+	src := `
+task "orders" {
+  tags = ["cdc", "sales"]
+}
+task "customers" {
+  tags = ["cdc"]
+}
+task "export" {}
+task "retired" {
+  enabled = false
+  tags    = ["cdc"]
+}
+`
+	if err := hclsimple.Decode("test.hcl", []byte(src), nil, &root); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(tasks []*TaskBlock) []string {
+		var out []string
+		for _, t := range tasks {
+			out = append(out, t.Name)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		names []string
+		all   bool
+		tags  []string
+		want  []string
+	}{
+		{names: []string{"export", "orders"}, want: []string{"export", "orders"}},
+		{all: true, want: []string{"orders", "customers", "export"}},
+		{tags: []string{"cdc"}, want: []string{"orders", "customers"}},
+		{names: []string{"customers"}, tags: []string{"sales"}, want: []string{"customers", "orders"}},
+		{names: []string{"retired"}, want: []string{"retired"}},
+	} {
+		got, err := root.SelectTasks(tt.names, tt.all, tt.tags)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		if g := names(got); !slices.Equal(g, tt.want) {
+			t.Fatalf("%+v: got %v, want %v", tt, g, tt.want)
+		}
+	}
+
+	for _, bad := range []struct {
+		names []string
+		all   bool
+		tags  []string
+	}{
+		{},
+		{names: []string{"missing"}},
+		{tags: []string{"nope"}},
+		{names: []string{"orders"}, all: true},
+	} {
+		if _, err := root.SelectTasks(bad.names, bad.all, bad.tags); err == nil {
+			t.Errorf("%+v: expected an error", bad)
+		}
+	}
+}
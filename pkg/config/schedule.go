@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/katasec/dstream/pkg/schedule"
+)
+
+// What `dstream serve` does when a scheduled run is due while the last one is
+// still going
+const (
+	// OverlapSkip lets the running run finish and drops the due one. This is the default.
+	OverlapSkip = "skip"
+	// OverlapQueue starts the due run as soon as the running one finishes
+	OverlapQueue = "queue"
+	// OverlapReplace stops the running run and starts the due one
+	OverlapReplace = "replace"
+)
+
+// ScheduleBlock makes a task a batch job that `dstream serve` runs on a
+// schedule instead of keeping it running:
+//
+//	schedule {
+//	  cron        = "0 2 * * *"      # five-field cron expression, or @daily, @hourly, ...
+//	  timezone    = "Europe/London"  # defaults to the local time zone
+//	  max_runtime = "1h"             # stop a run that goes on longer than this
+//	  overlap     = "skip"           # skip (default), queue or replace
+//	}
+//
+// Each run lasts until the input provider exits and the output has drained.
+type ScheduleBlock struct {
+	Cron       string `hcl:"cron"`
+	Timezone   string `hcl:"timezone,optional"`
+	MaxRuntime string `hcl:"max_runtime,optional"`
+	Overlap    string `hcl:"overlap,optional"`
+}
+
+// SchedulePolicy is a task's resolved schedule block
+type SchedulePolicy struct {
+	Cron       *schedule.Cron
+	Location   *time.Location
+	MaxRuntime time.Duration // 0 for no limit
+	Overlap    string
+}
+
+// SchedulePolicy validates the task's schedule block and fills in defaults. It
+// returns nil for a task without one.
+func (t *TaskBlock) SchedulePolicy() (*SchedulePolicy, error) {
+	b := t.Schedule
+	if b == nil {
+		return nil, nil
+	}
+
+	cron, err := schedule.Parse(b.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("task %q: invalid schedule.cron: %w", t.Name, err)
+	}
+	p := &SchedulePolicy{Cron: cron, Location: time.Local, Overlap: OverlapSkip}
+
+	if b.Timezone != "" {
+		if p.Location, err = time.LoadLocation(b.Timezone); err != nil {
+			return nil, fmt.Errorf("task %q: invalid schedule.timezone %q: %w", t.Name, b.Timezone, err)
+		}
+	}
+	if b.MaxRuntime != "" {
+		d, err := time.ParseDuration(b.MaxRuntime)
+		if err != nil {
+			return nil, fmt.Errorf("task %q: invalid schedule.max_runtime %q: %w", t.Name, b.MaxRuntime, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("task %q: schedule.max_runtime must be positive, got %q", t.Name, b.MaxRuntime)
+		}
+		p.MaxRuntime = d
+	}
+	switch b.Overlap {
+	case "":
+	case OverlapSkip, OverlapQueue, OverlapReplace:
+		p.Overlap = b.Overlap
+	default:
+		return nil, fmt.Errorf("task %q: schedule.overlap must be %q, %q or %q, got %q",
+			t.Name, OverlapSkip, OverlapQueue, OverlapReplace, b.Overlap)
+	}
+	return p, nil
+}
+
+// Next returns when the schedule next fires after t
+func (p *SchedulePolicy) Next(t time.Time) time.Time {
+	return p.Cron.Next(t.In(p.Location))
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulePolicy(t *testing.T) {
+	task := decodeTask(t, `
+task "t" {
+  schedule {
+    cron        = "0 2 * * *"
+    timezone    = "UTC"
+    max_runtime = "1h"
+    overlap     = "queue"
+  }
+}`)
+	p, err := task.SchedulePolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Location != time.UTC || p.MaxRuntime != time.Hour || p.Overlap != OverlapQueue {
+		t.Fatalf("unexpected policy: %+v", p)
+	}
+	next := p.Next(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	if !next.Equal(time.Date(2025, 3, 2, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next run: %s", next)
+	}
+
+	def, err := decodeTask(t, "task \"t\" {\n  schedule {\n    cron = \"@hourly\"\n  }\n}").SchedulePolicy()
+	if err != nil || def.Location != time.Local || def.MaxRuntime != 0 || def.Overlap != OverlapSkip {
+		t.Fatalf("unexpected defaults: %+v (err=%v)", def, err)
+	}
+	if p, err := decodeTask(t, `task "t" {}`).SchedulePolicy(); p != nil || err != nil {
+		t.Fatalf("expected no schedule, got %+v (err=%v)", p, err)
+	}
+
+	for _, block := range []string{
+		`cron = "every day"`,
+		"cron = \"@daily\"\n    timezone = \"Mars/Olympus\"",
+		"cron = \"@daily\"\n    max_runtime = \"-1s\"",
+		"cron = \"@daily\"\n    overlap = \"merge\"",
+	} {
+		task := decodeTask(t, "task \"t\" {\n  schedule {\n    "+block+"\n  }\n}")
+		if _, err := task.SchedulePolicy(); err == nil {
+			t.Errorf("%s: expected an error", block)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// SelectTasks picks the tasks to run: those named, in the order given, or every
+// task when all is set, or those carrying any of tags. Names and tags combine.
+// Disabled tasks are only run when named.
+func (r *RootHCL) SelectTasks(names []string, all bool, tags []string) ([]*TaskBlock, error) {
+	if all && (len(names) > 0 || len(tags) > 0) {
+		return nil, fmt.Errorf("--all can't be combined with task names or --tag")
+	}
+	if !all && len(names) == 0 && len(tags) == 0 {
+		return nil, fmt.Errorf("name at least one task, or use --all or --tag")
+	}
+
+	var selected []*TaskBlock
+	seen := make(map[string]bool)
+	add := func(t *TaskBlock) {
+		if !seen[t.Name] {
+			seen[t.Name] = true
+			selected = append(selected, t)
+		}
+	}
+
+	for _, name := range names {
+		t := r.Task(name)
+		if t == nil {
+			return nil, fmt.Errorf("task %q not found", name)
+		}
+		add(t)
+	}
+	for i := range r.Tasks {
+		t := &r.Tasks[i]
+		if !t.IsEnabled() {
+			continue
+		}
+		if all || slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(t.Tags, tag) }) {
+			add(t)
+		}
+	}
+
+	if len(selected) == 0 {
+		if all {
+			return nil, fmt.Errorf("no task is enabled")
+		}
+		return nil, fmt.Errorf("no enabled task is tagged %v", tags)
+	}
+	return selected, nil
+}
+
+// Task returns the task with the given name, or nil
+func (r *RootHCL) Task(name string) *TaskBlock {
+	for i := range r.Tasks {
+		if r.Tasks[i].Name == name {
+			return &r.Tasks[i]
+		}
+	}
+	return nil
+}
+
+// IsEnabled reports whether the task is enabled; tasks are enabled unless they
+// set enabled = false
+func (t *TaskBlock) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
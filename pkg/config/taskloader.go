@@ -19,5 +19,10 @@ func LoadRootFile(path string) (*RootHCL, error) {
 		return nil, fmt.Errorf("HCL decode failed: %w", err)
 	}
 
+	// Unknown dependencies and cycles are config errors, whatever the command
+	if _, err := root.TaskOrder(); err != nil {
+		return nil, err
+	}
+
 	return &root, nil
 }
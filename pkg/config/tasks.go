@@ -13,27 +13,41 @@ import (
 )
 
 type TaskBlock struct {
-	Name       string       `hcl:"name,label"`
-	Type       string       `hcl:"type,optional"`
-	PluginPath string       `hcl:"plugin_path,optional"`
-	PluginRef  string       `hcl:"plugin_ref,optional"`
-	Config     *ConfigBlock `hcl:"config,block"`
-	Input      *InputBlock  `hcl:"input,block"`
-	Output     *OutputBlock `hcl:"output,block"`
+	Name             string               `hcl:"name,label"`
+	Type             string               `hcl:"type,optional"`
+	PluginPath       string               `hcl:"plugin_path,optional"`
+	PluginRef        string               `hcl:"plugin_ref,optional"`
+	ShutdownSequence string               `hcl:"shutdown_sequence,optional"` // "input_first" (default) or "parallel"
+	Enabled          *bool                `hcl:"enabled,optional"`           // false keeps the task out of --all, --tag and serve
+	Tags             []string             `hcl:"tags,optional"`              // for selecting tasks with `run --tag`
+	DependsOn        []string             `hcl:"depends_on,optional"`        // tasks to init and start before this one
+	Timeouts         *TimeoutsBlock       `hcl:"timeouts,block"`
+	Restart          *RestartBlock        `hcl:"restart,block"`
+	Schedule         *ScheduleBlock       `hcl:"schedule,block"`
+	Bootstrap        *BootstrapBlock      `hcl:"bootstrap,block"`
+	FaultInjection   *FaultInjectionBlock `hcl:"fault_injection,block"`
+	Config           *ConfigBlock         `hcl:"config,block"`
+	Input            *InputBlock          `hcl:"input,block"`
+	Output           *OutputBlock         `hcl:"output,block"`
 }
 
 type InputBlock struct {
-	Provider     string       `hcl:"provider,optional"`
-	ProviderPath string       `hcl:"provider_path,optional"`
-	ProviderRef  string       `hcl:"provider_ref,optional"`
-	Config       *ConfigBlock `hcl:"config,block"`
+	Provider      string         `hcl:"provider,optional"`
+	ProviderPath  string         `hcl:"provider_path,optional"`
+	ProviderRef   string         `hcl:"provider_ref,optional"`
+	SkipLifecycle bool           `hcl:"skip_lifecycle,optional"` // don't send init/plan/status/destroy to this provider
+	Reconfigure   bool           `hcl:"reconfigure,optional"`    // keep stdin open after the run envelope for reconfigure envelopes
+	Timeouts      *TimeoutsBlock `hcl:"timeouts,block"`
+	Config        *ConfigBlock   `hcl:"config,block"`
 }
 
 type OutputBlock struct {
-	Provider     string       `hcl:"provider,optional"`
-	ProviderPath string       `hcl:"provider_path,optional"`
-	ProviderRef  string       `hcl:"provider_ref,optional"`
-	Config       *ConfigBlock `hcl:"config,block"`
+	Provider      string         `hcl:"provider,optional"`
+	ProviderPath  string         `hcl:"provider_path,optional"`
+	ProviderRef   string         `hcl:"provider_ref,optional"`
+	SkipLifecycle bool           `hcl:"skip_lifecycle,optional"` // don't send init/plan/status/destroy to this provider
+	Timeouts      *TimeoutsBlock `hcl:"timeouts,block"`
+	Config        *ConfigBlock   `hcl:"config,block"`
 }
 
 // Wrap the config block body so we can decode it later
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default timeouts applied when a task doesn't override them
+const (
+	DefaultReadyTimeout     = 30 * time.Second
+	DefaultLifecycleTimeout = 5 * time.Minute
+	DefaultShutdownTimeout  = 10 * time.Second
+)
+
+// Shutdown sequences for the run pipeline
+const (
+	// ShutdownInputFirst stops the input, lets the relay drain, closes the output's
+	// stdin and waits for it to finish before escalating. This is the default.
+	ShutdownInputFirst = "input_first"
+	// ShutdownParallel signals both providers at once
+	ShutdownParallel = "parallel"
+)
+
+// TimeoutsBlock overrides how long DStream waits on providers, as Go durations.
+// It may appear on a task (applies to both providers) or on an input/output block.
+//
+//	timeouts {
+//	  ready     = "2m"   # handshake after start
+//	  lifecycle = "20m"  # whole init/plan/status/destroy command
+//	  shutdown  = "60s"  # grace period between SIGTERM and SIGKILL
+//	}
+type TimeoutsBlock struct {
+	Ready     string `hcl:"ready,optional"`
+	Lifecycle string `hcl:"lifecycle,optional"`
+	Shutdown  string `hcl:"shutdown,optional"`
+}
+
+// Timeouts are the resolved durations for one provider
+type Timeouts struct {
+	Ready     time.Duration
+	Lifecycle time.Duration
+	Shutdown  time.Duration
+}
+
+// TimeoutsFor resolves the timeouts for the "input" or "output" provider:
+// provider block values win over task values, which win over the defaults.
+func (t *TaskBlock) TimeoutsFor(role string) (Timeouts, error) {
+	resolved := Timeouts{
+		Ready:     DefaultReadyTimeout,
+		Lifecycle: DefaultLifecycleTimeout,
+		Shutdown:  DefaultShutdownTimeout,
+	}
+
+	if err := resolved.apply(t.Timeouts, fmt.Sprintf("task %q", t.Name)); err != nil {
+		return resolved, err
+	}
+
+	var providerTimeouts *TimeoutsBlock
+	switch role {
+	case "input":
+		if t.Input != nil {
+			providerTimeouts = t.Input.Timeouts
+		}
+	case "output":
+		if t.Output != nil {
+			providerTimeouts = t.Output.Timeouts
+		}
+	default:
+		return resolved, fmt.Errorf("unknown provider role %q", role)
+	}
+
+	err := resolved.apply(providerTimeouts, fmt.Sprintf("task %q %s", t.Name, role))
+	return resolved, err
+}
+
+// ShutdownSequenceOrDefault returns the configured shutdown sequence, validated
+func (t *TaskBlock) ShutdownSequenceOrDefault() (string, error) {
+	switch t.ShutdownSequence {
+	case "":
+		return ShutdownInputFirst, nil
+	case ShutdownParallel, ShutdownInputFirst:
+		return t.ShutdownSequence, nil
+	default:
+		return "", fmt.Errorf("task %q: shutdown_sequence must be %q or %q, got %q",
+			t.Name, ShutdownInputFirst, ShutdownParallel, t.ShutdownSequence)
+	}
+}
+
+// apply overlays the non-empty values of a timeouts block
+func (r *Timeouts) apply(b *TimeoutsBlock, where string) error {
+	if b == nil {
+		return nil
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"ready", b.Ready, &r.Ready},
+		{"lifecycle", b.Lifecycle, &r.Lifecycle},
+		{"shutdown", b.Shutdown, &r.Shutdown},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid timeouts.%s %q: %w", where, f.name, f.value, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("%s: timeouts.%s must be positive, got %q", where, f.name, f.value)
+		}
+		*f.dst = d
+	}
+	return nil
+}
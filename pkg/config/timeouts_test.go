@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+func decodeTask(t *testing.T, src string) *TaskBlock {
+	t.Helper()
+	var root RootHCL
+	if err := hclsimple.Decode("test.hcl", []byte(src), nil, &root); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return &root.Tasks[0]
+}
+
+func TestTimeoutsFor(t *testing.T) {
+	task := decodeTask(t, `
+task "t" {
+  type = "providers"
+  timeouts {
+    ready     = "2m"
+    lifecycle = "20m"
+  }
+  input {
+    provider_path = "in"
+  }
+  output {
+    provider_path = "out"
+    timeouts {
+      ready    = "45s"
+      shutdown = "60s"
+    }
+  }
+}`)
+
+	in, err := task.TimeoutsFor("input")
+	if err != nil {
+		t.Fatalf("input timeouts: %v", err)
+	}
+	if in.Ready != 2*time.Minute || in.Lifecycle != 20*time.Minute || in.Shutdown != DefaultShutdownTimeout {
+		t.Fatalf("unexpected input timeouts: %+v", in)
+	}
+
+	out, err := task.TimeoutsFor("output")
+	if err != nil {
+		t.Fatalf("output timeouts: %v", err)
+	}
+	if out.Ready != 45*time.Second || out.Lifecycle != 20*time.Minute || out.Shutdown != time.Minute {
+		t.Fatalf("unexpected output timeouts: %+v", out)
+	}
+}
+
+func TestTimeoutsForRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"soon", "-5s", "0s"} {
+		task := decodeTask(t, `
+task "t" {
+  timeouts {
+    shutdown = "`+value+`"
+  }
+}`)
+		if _, err := task.TimeoutsFor("output"); err == nil {
+			t.Errorf("expected shutdown = %q to be rejected", value)
+		}
+	}
+}
+
+func TestShutdownSequence(t *testing.T) {
+	task := &TaskBlock{Name: "t"}
+	if seq, _ := task.ShutdownSequenceOrDefault(); seq != ShutdownInputFirst {
+		t.Fatalf("expected default %q, got %q", ShutdownInputFirst, seq)
+	}
+	task.ShutdownSequence = "sideways"
+	if _, err := task.ShutdownSequenceOrDefault(); err == nil {
+		t.Fatal("expected unknown shutdown_sequence to be rejected")
+	}
+}
@@ -1,6 +1,5 @@
 package config
 
-// import "github.com/katasec/dstream/pkg/logging"
-import "github.com/katasec/dstream/internal/logging"
+import "github.com/katasec/dstream/pkg/logging"
 
-var log = logging.GetHCLogger()
+var log = logging.GetHCLogger().Named("config")
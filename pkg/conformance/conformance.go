@@ -0,0 +1,371 @@
+// Package conformance checks that a provider binary speaks the DStream provider
+// protocol. Each check starts the provider the way the host would and fails on
+// any departure from the contract:
+//
+//	handshake           reads the run envelope and reports ready within the ready timeout,
+//	                    without writing anything to stdout first
+//	stdout_json         an input writes only JSON events to stdout; logs go to stderr
+//	stdin_eof           an output exits with status 0 once stdin reaches EOF; an input
+//	                    keeps running when the host closes its stdin after the handshake
+//	sigterm             exits with status 0 within the shutdown timeout of SIGTERM
+//	malformed_envelope  refuses an envelope that isn't JSON, with an error handshake or
+//	                    a non-zero exit, instead of reporting ready or hanging
+//	malformed_event     an output doesn't hang on a data line that isn't JSON
+//	lifecycle_<command> handles init, plan, status and destroy: reports ready, writes only
+//	                    JSON records to stdout and exits with status 0
+//
+// Run returns the results as a Report; Test runs the checks from a provider's
+// own go test suite.
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// Result statuses
+const (
+	Passed  = "pass"
+	Failed  = "fail"
+	Skipped = "skip"
+)
+
+// DefaultObserve is how long an input is watched for events and crashes
+const DefaultObserve = 2 * time.Second
+
+// LifecycleCommands are the lifecycle commands checked by default
+var LifecycleCommands = []string{"init", "plan", "status", "destroy"}
+
+// Options describes the provider to check
+type Options struct {
+	Path string // the provider binary
+	Role string // "input" or "output"
+
+	// Config is the provider's config block, sent in every envelope. It has to
+	// be one the provider accepts; {} when empty.
+	Config json.RawMessage
+	// Events are the data lines written to an output; a few sample events
+	// when empty
+	Events []string
+	// Lifecycle lists the lifecycle commands to check; LifecycleCommands when
+	// nil. Lifecycle commands run against whatever the config points at.
+	Lifecycle []string
+	// Skip lists checks not to run
+	Skip []string
+
+	ReadyTimeout     time.Duration // config.DefaultReadyTimeout when 0
+	ShutdownTimeout  time.Duration // config.DefaultShutdownTimeout when 0
+	LifecycleTimeout time.Duration // config.DefaultLifecycleTimeout when 0
+	Observe          time.Duration // DefaultObserve when 0
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Check    string        `json:"check"`
+	Status   string        `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Report is the outcome of every check against a provider
+type Report struct {
+	Provider string   `json:"provider"`
+	Role     string   `json:"role"`
+	Results  []Result `json:"results"`
+}
+
+// Passed reports whether no check failed
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Status == Failed {
+			return false
+		}
+	}
+	return true
+}
+
+// check is one part of the contract. run returns nil when the provider
+// conforms and a description of what it did wrong otherwise.
+type check struct {
+	name string
+	role string // "" for checks that apply to both roles
+	run  func(ctx context.Context, o *Options) error
+}
+
+// Run runs every check that applies to the provider's role, one after another,
+// each against a fresh process
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Provider: opts.Path, Role: opts.Role}
+	for _, c := range checks(opts.Lifecycle) {
+		if c.role != "" && c.role != opts.Role {
+			continue
+		}
+		res := Result{Check: c.name}
+		if slices.Contains(opts.Skip, c.name) {
+			res.Status, res.Detail = Skipped, "skipped by request"
+			report.Results = append(report.Results, res)
+			continue
+		}
+
+		started := time.Now()
+		err := c.run(ctx, &opts)
+		res.Duration = time.Since(started)
+		res.Status = Passed
+		if err != nil {
+			res.Status, res.Detail = Failed, err.Error()
+		}
+		report.Results = append(report.Results, res)
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+	}
+	return report, nil
+}
+
+// Test runs the checks as subtests of t
+func Test(t *testing.T, opts Options) {
+	t.Helper()
+	report, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range report.Results {
+		t.Run(res.Check, func(t *testing.T) {
+			switch res.Status {
+			case Skipped:
+				t.Skip(res.Detail)
+			case Failed:
+				t.Error(res.Detail)
+			}
+		})
+	}
+}
+
+func (o *Options) setDefaults() error {
+	if o.Path == "" {
+		return errors.New("no provider path given")
+	}
+	if o.Role != "input" && o.Role != "output" {
+		return fmt.Errorf("role must be input or output, got %q", o.Role)
+	}
+	if len(o.Config) == 0 {
+		o.Config = json.RawMessage("{}")
+	}
+	if !json.Valid(o.Config) {
+		return errors.New("config is not valid JSON")
+	}
+	if len(o.Events) == 0 {
+		for i := 1; i <= 3; i++ {
+			o.Events = append(o.Events, fmt.Sprintf(
+				`{"metadata":{"table":"conformance","operation":"insert","sequence":%d},"data":{"id":%d}}`, i, i))
+		}
+	}
+	if o.Lifecycle == nil {
+		o.Lifecycle = LifecycleCommands
+	}
+	if o.ReadyTimeout == 0 {
+		o.ReadyTimeout = config.DefaultReadyTimeout
+	}
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = config.DefaultShutdownTimeout
+	}
+	if o.LifecycleTimeout == 0 {
+		o.LifecycleTimeout = config.DefaultLifecycleTimeout
+	}
+	if o.Observe == 0 {
+		o.Observe = DefaultObserve
+	}
+	return nil
+}
+
+// envelope renders the command envelope for command
+func (o *Options) envelope(command string) string {
+	env := map[string]any{"command": command, "config": o.Config}
+	if command != "run" {
+		env["resources"] = []any{}
+	}
+	data, _ := json.Marshal(env)
+	return string(data)
+}
+
+// startReady starts the provider with the run command and waits for its
+// handshake. Like the host, it closes an input's stdin once it is ready unless
+// the input advertised "reconfigure".
+func (o *Options) startReady(ctx context.Context) (*process, error) {
+	p, err := start(ctx, o.Path, o.envelope("run"))
+	if err != nil {
+		return nil, err
+	}
+	capabilities, err := p.awaitReady(o.ReadyTimeout)
+	if err != nil {
+		p.kill()
+		return nil, err
+	}
+	if o.Role == "input" && !slices.Contains(capabilities, "reconfigure") {
+		p.stdin.Close()
+	}
+	return p, nil
+}
+
+func checks(lifecycle []string) []check {
+	list := []check{
+		{name: "handshake", run: checkHandshake},
+		{name: "stdout_json", role: "input", run: checkStdoutJSON},
+		{name: "stdin_eof", role: "output", run: checkOutputEOF},
+		{name: "stdin_eof", role: "input", run: checkInputEOF},
+		{name: "sigterm", run: checkSigterm},
+		{name: "malformed_envelope", run: checkMalformedEnvelope},
+		{name: "malformed_event", role: "output", run: checkMalformedEvent},
+	}
+	for _, command := range lifecycle {
+		list = append(list, check{name: "lifecycle_" + command, run: func(ctx context.Context, o *Options) error {
+			return checkLifecycle(ctx, o, command)
+		}})
+	}
+	return list
+}
+
+func checkHandshake(ctx context.Context, o *Options) error {
+	p, err := o.startReady(ctx)
+	if err != nil {
+		return err
+	}
+	p.kill()
+	return nil
+}
+
+func checkStdoutJSON(ctx context.Context, o *Options) error {
+	p, err := o.startReady(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.kill()
+	p.wait(o.Observe)
+	return p.checkStdout()
+}
+
+func checkOutputEOF(ctx context.Context, o *Options) error {
+	p, err := o.startReady(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.write(o.Events...); err != nil {
+		p.kill()
+		return fmt.Errorf("%w%s", err, p.stderrTail())
+	}
+	p.stdin.Close()
+	if !p.wait(o.ShutdownTimeout) {
+		p.kill()
+		return fmt.Errorf("still running %s after stdin reached EOF", o.ShutdownTimeout)
+	}
+	return p.checkExit("stdin reached EOF")
+}
+
+func checkInputEOF(ctx context.Context, o *Options) error {
+	p, err := o.startReady(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.kill()
+	// An input that finishes its work may exit, but not fail
+	p.wait(o.Observe)
+	if exited, err := p.exited(); exited && err != nil {
+		return p.checkExit("the host closed its stdin")
+	}
+	return nil
+}
+
+func checkSigterm(ctx context.Context, o *Options) error {
+	p, err := o.startReady(ctx)
+	if err != nil {
+		return err
+	}
+	if o.Role == "output" {
+		if err := p.write(o.Events...); err != nil {
+			p.kill()
+			return fmt.Errorf("%w%s", err, p.stderrTail())
+		}
+	} else {
+		p.wait(o.Observe / 4)
+	}
+	if exited, _ := p.exited(); exited {
+		// An input with nothing to stream may have finished already
+		return p.checkExit("finishing before SIGTERM")
+	}
+	p.terminate()
+	if !p.wait(o.ShutdownTimeout) {
+		p.kill()
+		return fmt.Errorf("still running %s after SIGTERM", o.ShutdownTimeout)
+	}
+	return p.checkExit("SIGTERM")
+}
+
+func checkMalformedEnvelope(ctx context.Context, o *Options) error {
+	p, err := start(ctx, o.Path, `{"command":"run","config":`)
+	if err != nil {
+		return err
+	}
+	defer p.kill()
+	p.stdin.Close()
+	_, err = p.awaitReady(o.ReadyTimeout)
+	switch {
+	case err == nil:
+		return errors.New("reported ready for an envelope that isn't JSON")
+	case p.wait(o.ShutdownTimeout):
+		if exited, exitErr := p.exited(); exited && exitErr == nil {
+			return errors.New("exited with status 0 for an envelope that isn't JSON")
+		}
+		return nil
+	default:
+		return fmt.Errorf("still running %s after refusing an envelope that isn't JSON", o.ShutdownTimeout)
+	}
+}
+
+func checkMalformedEvent(ctx context.Context, o *Options) error {
+	p, err := o.startReady(ctx)
+	if err != nil {
+		return err
+	}
+	// A provider may exit as soon as it reads the bad line, so write errors
+	// don't count against it
+	p.write(append([]string{"this is not json"}, o.Events...)...)
+	p.stdin.Close()
+	if !p.wait(o.ShutdownTimeout) {
+		p.kill()
+		return fmt.Errorf("still running %s after stdin reached EOF", o.ShutdownTimeout)
+	}
+	return nil
+}
+
+func checkLifecycle(ctx context.Context, o *Options, command string) error {
+	ctx, cancel := context.WithTimeout(ctx, o.LifecycleTimeout)
+	defer cancel()
+	p, err := start(ctx, o.Path, o.envelope(command))
+	if err != nil {
+		return err
+	}
+	defer p.kill()
+	p.stdin.Close()
+	if _, err := p.awaitReady(o.ReadyTimeout); err != nil {
+		return err
+	}
+	<-p.done
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("did not finish within %s", o.LifecycleTimeout)
+	}
+	if err := p.checkExit(command); err != nil {
+		return err
+	}
+	return p.checkStdout()
+}
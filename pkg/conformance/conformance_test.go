@@ -0,0 +1,135 @@
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain doubles as the providers under test: with CONFORMANCE_PROVIDER set
+// the test binary behaves as one
+func TestMain(m *testing.M) {
+	switch os.Getenv("CONFORMANCE_PROVIDER") {
+	case "":
+		os.Exit(m.Run())
+	case "output":
+		conformingProvider("output", false)
+	case "input":
+		conformingProvider("input", false)
+	case "sloppy_input":
+		conformingProvider("input", true)
+	}
+}
+
+// conformingProvider follows the contract, unless sloppy: then it logs to
+// stdout, ignores SIGTERM and accepts any envelope
+func conformingProvider(role string, sloppy bool) {
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGTERM)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	var envelope struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil && !sloppy {
+		fmt.Printf(`{"status":"error","message":%q}`+"\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(`{"status":"ready"}`)
+
+	if envelope.Command != "run" {
+		fmt.Println(`{"resource":{"type":"queue","name":"q"},"action":"exists"}`)
+		os.Exit(0)
+	}
+	if role == "output" {
+		go func() {
+			<-terminated
+			os.Exit(0)
+		}()
+		for scanner.Scan() {
+			fmt.Fprintln(os.Stderr, "received", scanner.Text())
+		}
+		os.Exit(0)
+	}
+
+	if sloppy {
+		fmt.Println("connected to the database")
+		signal.Ignore(syscall.SIGTERM)
+	}
+	for i := 1; ; i++ {
+		select {
+		case <-terminated:
+			os.Exit(0)
+		case <-time.After(10 * time.Millisecond):
+			fmt.Printf(`{"data":{"id":%d}}`+"\n", i)
+		}
+	}
+}
+
+func checkProvider(t *testing.T, behavior, role string) map[string]Result {
+	t.Helper()
+	t.Setenv("CONFORMANCE_PROVIDER", behavior)
+	report, err := Run(context.Background(), Options{
+		Path:            os.Args[0],
+		Role:            role,
+		Skip:            []string{"lifecycle_destroy"},
+		ReadyTimeout:    5 * time.Second,
+		ShutdownTimeout: 5 * time.Second,
+		Observe:         200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]Result{}
+	for _, res := range report.Results {
+		results[res.Check] = res
+	}
+	return results
+}
+
+func TestConformingProvidersPass(t *testing.T) {
+	for _, role := range []string{"input", "output"} {
+		results := checkProvider(t, role, role)
+		for name, res := range results {
+			want := Passed
+			if name == "lifecycle_destroy" {
+				want = Skipped
+			}
+			if res.Status != want {
+				t.Errorf("%s %s: expected %s, got %+v", role, name, want, res)
+			}
+		}
+		if _, ok := results["stdout_json"]; ok != (role == "input") {
+			t.Errorf("%s: stdout_json should only be checked for inputs", role)
+		}
+	}
+}
+
+func TestSloppyProviderFails(t *testing.T) {
+	results := checkProvider(t, "sloppy_input", "input")
+	for name, want := range map[string]string{
+		"handshake":          Passed,
+		"stdout_json":        Failed,
+		"sigterm":            Failed,
+		"malformed_envelope": Failed,
+		"lifecycle_init":     Passed,
+	} {
+		if res := results[name]; res.Status != want {
+			t.Errorf("%s: expected %s, got %+v", name, want, res)
+		}
+	}
+	if report := (&Report{Results: []Result{results["sigterm"]}}); report.Passed() {
+		t.Error("expected a report with a failed check not to pass")
+	}
+}
+
+func TestPackageTest(t *testing.T) {
+	t.Setenv("CONFORMANCE_PROVIDER", "output")
+	Test(t, Options{Path: os.Args[0], Role: "output", ShutdownTimeout: 5 * time.Second})
+}
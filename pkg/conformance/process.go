@@ -0,0 +1,217 @@
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stderrTailLines is how many lines of a provider's stderr a failure quotes
+const stderrTailLines = 3
+
+// process is a provider started by a check
+type process struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	first chan string   // receives the first stdout line, if there is one
+	done  chan struct{} // closed once stdout is drained and the process has exited
+	err   error         // the exit error, once done is closed
+
+	mu      sync.Mutex
+	lines   int    // stdout lines after the first
+	invalid string // the first of them that isn't a JSON object
+	stderr  bytes.Buffer
+}
+
+// start launches the provider at path and writes envelope to its stdin
+func start(ctx context.Context, path, envelope string) (*process, error) {
+	p := &process{
+		cmd:   exec.CommandContext(ctx, path),
+		first: make(chan string, 1),
+		done:  make(chan struct{}),
+	}
+	p.cmd.Stderr = stderrWriter{p}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start provider: %w", err)
+	}
+
+	go func() {
+		defer close(p.done)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		if scanner.Scan() {
+			p.first <- scanner.Text()
+		}
+		for scanner.Scan() {
+			p.mu.Lock()
+			p.lines++
+			if p.invalid == "" && !isJSONObject(scanner.Bytes()) {
+				p.invalid = scanner.Text()
+			}
+			p.mu.Unlock()
+		}
+		p.err = p.cmd.Wait()
+	}()
+
+	// A provider that exits without reading its envelope closes the pipe; that
+	// is reported by the check waiting for it, not here
+	io.WriteString(p.stdin, envelope+"\n")
+	return p, nil
+}
+
+// awaitReady waits for the ready handshake and returns the capabilities it lists
+func (p *process) awaitReady(timeout time.Duration) ([]string, error) {
+	var line string
+	select {
+	case line = <-p.first:
+	case <-p.done:
+		select {
+		case line = <-p.first:
+		default:
+			return nil, fmt.Errorf("exited before the ready handshake: %s%s", p.exitStatus(), p.stderrTail())
+		}
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no ready handshake within %s%s", timeout, p.stderrTail())
+	}
+
+	var ready struct {
+		Status       string   `json:"status"`
+		Message      string   `json:"message"`
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := json.Unmarshal([]byte(line), &ready); err != nil || ready.Status == "" {
+		return nil, fmt.Errorf("first stdout line is not a handshake: %q; logs belong on stderr", truncate(line))
+	}
+	switch ready.Status {
+	case "ready":
+		return ready.Capabilities, nil
+	case "error":
+		return nil, fmt.Errorf("handshake reported an error: %s", ready.Message)
+	default:
+		return nil, fmt.Errorf("handshake has unknown status %q", ready.Status)
+	}
+}
+
+// wait waits up to timeout for the process to exit
+func (p *process) wait(timeout time.Duration) bool {
+	select {
+	case <-p.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// kill force kills the process and waits for it
+func (p *process) kill() {
+	p.cmd.Process.Kill()
+	<-p.done
+}
+
+// terminate sends SIGTERM
+func (p *process) terminate() {
+	p.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// write writes lines to stdin
+func (p *process) write(lines ...string) error {
+	for _, line := range lines {
+		if _, err := io.WriteString(p.stdin, line+"\n"); err != nil {
+			return fmt.Errorf("write to stdin: %w", err)
+		}
+	}
+	return nil
+}
+
+// exited reports whether the process has exited, and its exit status
+func (p *process) exited() (bool, error) {
+	select {
+	case <-p.done:
+		return true, p.err
+	default:
+		return false, nil
+	}
+}
+
+// checkExit fails unless the process has exited with status 0
+func (p *process) checkExit(after string) error {
+	if p.err != nil {
+		return fmt.Errorf("exited with %s after %s%s", p.exitStatus(), after, p.stderrTail())
+	}
+	return nil
+}
+
+// checkStdout fails if the process wrote anything but JSON objects on stdout
+// after the handshake
+func (p *process) checkStdout() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.invalid != "" {
+		return fmt.Errorf("wrote a non-JSON line to stdout: %q; logs belong on stderr", truncate(p.invalid))
+	}
+	return nil
+}
+
+// exitStatus describes how the process exited
+func (p *process) exitStatus() string {
+	var exitErr *exec.ExitError
+	switch {
+	case p.err == nil:
+		return "status 0"
+	case errors.As(p.err, &exitErr) && exitErr.ExitCode() >= 0:
+		return fmt.Sprintf("status %d", exitErr.ExitCode())
+	default:
+		return p.err.Error()
+	}
+}
+
+// stderrTail quotes the last lines the process wrote to stderr
+func (p *process) stderrTail() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lines := strings.Split(strings.TrimSpace(p.stderr.String()), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return ""
+	}
+	if len(lines) > stderrTailLines {
+		lines = lines[len(lines)-stderrTailLines:]
+	}
+	return " (stderr: " + strings.Join(lines, " | ") + ")"
+}
+
+// stderrWriter collects a process's stderr
+type stderrWriter struct{ p *process }
+
+func (w stderrWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	return w.p.stderr.Write(b)
+}
+
+func isJSONObject(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return len(line) > 0 && line[0] == '{' && json.Valid(line)
+}
+
+func truncate(s string) string {
+	if len(s) > 80 {
+		return s[:77] + "..."
+	}
+	return s
+}
@@ -0,0 +1,26 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Render writes the report as a table with a summary line
+func (r *Report) Render(out io.Writer) {
+	fmt.Fprintf(out, "Provider: %s (%s)\n\n", r.Provider, r.Role)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDURATION\tDETAIL")
+	counts := map[string]int{}
+	for _, res := range r.Results {
+		counts[res.Status]++
+		duration := "-"
+		if res.Status != Skipped {
+			duration = res.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Check, res.Status, duration, res.Detail)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d passed, %d failed, %d skipped\n", counts[Passed], counts[Failed], counts[Skipped])
+}
@@ -0,0 +1,226 @@
+// Package control implements the local control socket a running task listens on,
+// and the client commands such as `dstream tap` use to talk to it.
+//
+// The socket is a unix socket in the task's working directory:
+//
+//	.dstream/tasks/<task>/control.sock
+//
+// A client sends one JSON request line. The server answers with one JSON
+// response line and, for streaming commands like tap, keeps writing until either
+// side closes the connection.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/logging"
+)
+
+var log = logging.Named("control")
+
+// SocketName is the file name of the control socket inside a task's directory
+const SocketName = "control.sock"
+
+// Commands understood by the server
+const (
+	CommandTap = "tap"
+)
+
+// Request is the first line a client sends
+type Request struct {
+	Command string      `json:"command"`
+	Tap     *TapOptions `json:"tap,omitempty"`
+}
+
+// Response is the first line the server sends back
+type Response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ErrNotRunning is returned by Dial when nothing is listening on the socket
+var ErrNotRunning = errors.New("task is not running")
+
+// SocketPath returns the control socket path for a task directory
+func SocketPath(taskDir string) string {
+	return filepath.Join(taskDir, SocketName)
+}
+
+// Handler serves one request. It owns conn until it returns; the response line
+// has not been written yet.
+type Handler func(conn net.Conn, req Request)
+
+// Server accepts connections on a control socket
+type Server struct {
+	path     string
+	ln       net.Listener
+	handlers map[string]Handler
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// Listen creates the socket at path. A socket left behind by a process that no
+// longer runs is replaced; a live one is an error, since it means the task is
+// already running from this directory.
+func Listen(path string) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create control socket directory: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use: the task is already running", path)
+		}
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on control socket: %w", err)
+	}
+	return &Server{
+		path:     path,
+		ln:       ln,
+		handlers: make(map[string]Handler),
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Handle registers the handler for a command. Register handlers before Serve.
+func (s *Server) Handle(command string, h Handler) {
+	s.handlers[command] = h
+}
+
+// Path returns the socket path
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Serve accepts connections in the background until Close
+func (s *Server) Serve() {
+	go func() {
+		for {
+			conn, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	var req Request
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err != nil {
+		WriteResponse(conn, fmt.Errorf("bad request: %w", err))
+		return
+	}
+
+	h, ok := s.handlers[req.Command]
+	if !ok {
+		WriteResponse(conn, fmt.Errorf("unknown command %q", req.Command))
+		return
+	}
+	log.Debug("Control request", "command", req.Command)
+	h(conn, req)
+}
+
+// Close stops accepting connections, closes open ones and removes the socket
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+// WriteResponse writes the response line for err (nil means OK)
+func WriteResponse(w io.Writer, err error) error {
+	resp := Response{OK: err == nil}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	data, _ := json.Marshal(resp)
+	_, werr := w.Write(append(data, '\n'))
+	return werr
+}
+
+// Dial connects to the control socket at path and sends req. It returns the
+// connection, positioned after the response line, for commands that stream.
+func Dial(path string, req Request) (io.ReadCloser, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, ErrNotRunning
+		}
+		return nil, err
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bad response: %w", err)
+	}
+	if !resp.OK {
+		conn.Close()
+		return nil, errors.New(resp.Error)
+	}
+	return &clientConn{Reader: r, conn: conn}, nil
+}
+
+type clientConn struct {
+	*bufio.Reader
+	conn net.Conn
+}
+
+func (c *clientConn) Close() error {
+	return c.conn.Close()
+}
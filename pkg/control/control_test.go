@@ -0,0 +1,170 @@
+package control
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	event := map[string]any{
+		"data":     map[string]any{"op": "insert", "qty": float64(3), "items": []any{"a", "b"}},
+		"metadata": map[string]any{"table": "orders", "deleted": nil},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"metadata.table", true},
+		{"$.metadata.table", true},
+		{"metadata.deleted", false},
+		{"metadata.missing", false},
+		{`data.op == "insert"`, true},
+		{`data.op != "insert"`, false},
+		{"metadata.table=orders", true},
+		{"metadata.table=customers", false},
+		{"data.qty == 3", true},
+		{"data.qty != 4", true},
+		{"data.items.1 == b", true},
+		{"data.items.5", false},
+		{"metadata.missing != 1", true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := f.Match(event); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "== 1", "a..b", "a ! b"} {
+		if _, err := ParseFilter(bad); err == nil {
+			t.Errorf("%q: expected a parse error", bad)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s, err := newSampler(TapOptions{Filters: []string{"op=insert"}, Every: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var kept []string
+	for _, line := range []string{`{"op":"insert","n":1}`, `{"op":"delete"}`, `{"op":"insert","n":2}`, "not json", `{"op":"insert","n":3}`} {
+		if s.keep(line, now) {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) != 2 || !strings.Contains(kept[0], `"n":1`) || !strings.Contains(kept[1], `"n":3`) {
+		t.Fatalf("every 2nd insert expected, got %v", kept)
+	}
+
+	s, _ = newSampler(TapOptions{Rate: 2})
+	if !s.keep("a", now) || s.keep("b", now.Add(100*time.Millisecond)) || !s.keep("c", now.Add(500*time.Millisecond)) {
+		t.Fatal("rate of 2/s should keep one event per 500ms")
+	}
+}
+
+func TestTapOverSocket(t *testing.T) {
+	path := SocketPath(t.TempDir())
+	srv, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	tap := NewTap()
+	srv.Handle(CommandTap, tap.Serve)
+	srv.Serve()
+
+	// Nothing attached: publishing is a no-op
+	tap.Publish(`{"n":0}`)
+
+	conn, err := Dial(path, Request{Command: CommandTap, Tap: &TapOptions{Filters: []string{"n != 2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitFor(t, func() bool { return tap.attached.Load() == 1 })
+
+	for _, line := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		tap.Publish(line)
+	}
+	scanner := bufio.NewScanner(conn)
+	for _, want := range []string{`{"n":1}`, `{"n":3}`} {
+		if !scanner.Scan() || scanner.Text() != want {
+			t.Fatalf("expected %s, got %q (err=%v)", want, scanner.Text(), scanner.Err())
+		}
+	}
+
+	conn.Close()
+	waitFor(t, func() bool { return tap.attached.Load() == 0 })
+}
+
+func TestBadTapRequestIsRejected(t *testing.T) {
+	path := SocketPath(t.TempDir())
+	srv, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.Handle(CommandTap, NewTap().Serve)
+	srv.Serve()
+
+	if _, err := Dial(path, Request{Command: CommandTap, Tap: &TapOptions{Every: -1}}); err == nil || !strings.Contains(err.Error(), "every") {
+		t.Fatalf("expected the bad option to be reported, got %v", err)
+	}
+	if _, err := Dial(path, Request{Command: "reboot"}); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("expected unknown command, got %v", err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := SocketPath(dir)
+
+	if _, err := Dial(path, Request{Command: CommandTap}); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning without a socket, got %v", err)
+	}
+
+	// A socket file with no listener behind it, as left by a killed run
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stale socket not left behind: %v", err)
+	}
+
+	srv, err := Listen(path)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Fatal("expected a live socket to be refused")
+	}
+	srv.Close()
+	if _, err := os.Stat(filepath.Join(dir, SocketName)); !os.IsNotExist(err) {
+		t.Fatalf("socket not removed on close: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,104 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Filter is a predicate on a relayed event, written as a JSON path with an
+// optional comparison:
+//
+//	metadata.table              the field is present and not null
+//	data.op == "insert"         the field equals a JSON value
+//	data.items.0.qty != 0       array elements are addressed by index
+//	metadata.table=orders       a bare value is compared as a string
+type Filter struct {
+	expr  string
+	path  []string
+	op    string // "", "==" or "!="
+	value any
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{expr: expr}
+	path := expr
+	if i := strings.IndexAny(expr, "!="); i >= 0 {
+		rest := expr[i:]
+		switch {
+		case strings.HasPrefix(rest, "!="), strings.HasPrefix(rest, "=="):
+			f.op, rest = rest[:2], rest[2:]
+		case strings.HasPrefix(rest, "="):
+			f.op, rest = "==", rest[1:]
+		default:
+			return nil, fmt.Errorf("filter %q: expected == or != after the path", expr)
+		}
+		path = expr[:i]
+		f.value = parseValue(strings.TrimSpace(rest))
+	}
+
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("filter %q: missing JSON path", expr)
+	}
+	f.path = strings.Split(path, ".")
+	for _, seg := range f.path {
+		if seg == "" {
+			return nil, fmt.Errorf("filter %q: empty path segment", expr)
+		}
+	}
+	return f, nil
+}
+
+// parseValue reads a comparison value as JSON, falling back to a plain string
+func parseValue(s string) any {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err == nil {
+		return v
+	}
+	return s
+}
+
+// String returns the expression the filter was parsed from
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether a decoded event satisfies the filter
+func (f *Filter) Match(event any) bool {
+	v, ok := lookup(event, f.path)
+	switch f.op {
+	case "==":
+		return ok && reflect.DeepEqual(v, f.value)
+	case "!=":
+		return !ok || !reflect.DeepEqual(v, f.value)
+	default:
+		return ok && v != nil
+	}
+}
+
+func lookup(v any, path []string) (any, bool) {
+	for _, seg := range path {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
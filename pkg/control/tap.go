@@ -0,0 +1,177 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tapBuffer is how many events may queue for a slow tap before it drops them
+const tapBuffer = 1024
+
+// TapOptions select which relayed events a tap receives. Filters are applied
+// first, then Every, then Rate.
+type TapOptions struct {
+	// Filters must all match; see ParseFilter for the syntax
+	Filters []string `json:"filters,omitempty"`
+	// Every keeps one matching event in N; 0 or 1 keeps them all
+	Every int `json:"every,omitempty"`
+	// Rate caps the events sent per second; 0 means no cap
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// Tap fans relayed events out to attached clients. Publish is called from the
+// relay loop: with no client attached it is a single atomic load, and a client
+// that can't keep up loses events rather than slowing the relay.
+type Tap struct {
+	attached atomic.Int32
+
+	mu   sync.RWMutex
+	subs map[chan string]struct{}
+}
+
+// NewTap returns a tap with no clients attached
+func NewTap() *Tap {
+	return &Tap{subs: make(map[chan string]struct{})}
+}
+
+// Publish offers a relayed line to every attached client
+func (t *Tap) Publish(line string) {
+	if t.attached.Load() == 0 {
+		return
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for ch := range t.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+func (t *Tap) subscribe() chan string {
+	ch := make(chan string, tapBuffer)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+	t.attached.Add(1)
+	return ch
+}
+
+func (t *Tap) unsubscribe(ch chan string) {
+	t.attached.Add(-1)
+	t.mu.Lock()
+	delete(t.subs, ch)
+	t.mu.Unlock()
+}
+
+// Serve is the handler for the tap command: it streams the selected events to
+// conn, one per line, until the client disconnects or the server closes
+func (t *Tap) Serve(conn net.Conn, req Request) {
+	var opts TapOptions
+	if req.Tap != nil {
+		opts = *req.Tap
+	}
+	s, err := newSampler(opts)
+	if err != nil {
+		WriteResponse(conn, err)
+		return
+	}
+
+	ch := t.subscribe()
+	defer t.unsubscribe(ch)
+	if err := WriteResponse(conn, nil); err != nil {
+		return
+	}
+	log.Info("Tap attached", "filters", len(opts.Filters), "every", opts.Every, "rate", opts.Rate)
+	defer log.Info("Tap detached")
+
+	// The client sends nothing after its request, so a read returns once it
+	// disconnects or the connection is closed
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case line := <-ch:
+			if !s.keep(line, time.Now()) {
+				continue
+			}
+			if _, err := fmt.Fprintln(conn, line); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sampler applies TapOptions to a stream of events
+type sampler struct {
+	filters  []*Filter
+	every    int
+	seen     int
+	interval time.Duration
+	next     time.Time
+}
+
+func newSampler(opts TapOptions) (*sampler, error) {
+	if opts.Every < 0 {
+		return nil, fmt.Errorf("every must not be negative, got %d", opts.Every)
+	}
+	if opts.Rate < 0 {
+		return nil, fmt.Errorf("rate must not be negative, got %v", opts.Rate)
+	}
+	s := &sampler{every: opts.Every}
+	if opts.Rate > 0 {
+		s.interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+	for _, expr := range opts.Filters {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		s.filters = append(s.filters, f)
+	}
+	return s, nil
+}
+
+// keep reports whether line, seen at now, should be sent
+func (s *sampler) keep(line string, now time.Time) bool {
+	if len(s.filters) > 0 {
+		// Lines that aren't JSON never match a filter
+		var event any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return false
+		}
+		for _, f := range s.filters {
+			if !f.Match(event) {
+				return false
+			}
+		}
+	}
+
+	s.seen++
+	if s.every > 1 && (s.seen-1)%s.every != 0 {
+		return false
+	}
+	if s.interval > 0 {
+		if now.Before(s.next) {
+			return false
+		}
+		s.next = now.Add(s.interval)
+	}
+	return true
+}
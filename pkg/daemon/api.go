@@ -0,0 +1,132 @@
+// Package daemon is the management API of `dstream serve`, and the client that
+// `dstream ctl` uses to call it. The API is JSON over HTTP, served on a unix
+// socket (by default .dstream/dstream.sock) and optionally on a TCP address:
+//
+//	GET  /v1/tasks                every task and its state
+//	GET  /v1/tasks/{name}         one task
+//	POST /v1/tasks/{name}/start   start a stopped task
+//	POST /v1/tasks/{name}/stop    stop a task gracefully
+//	POST /v1/tasks/{name}/restart stop and start a task
+//	POST /v1/reload               re-read the config file and apply it
+//	GET  /v1/status               the health document also served at /status
+//
+// Errors are returned as {"error": "..."} with a 4xx or 5xx status.
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/logging"
+	"github.com/katasec/dstream/pkg/state"
+)
+
+var log = logging.Named("daemon")
+
+// DefaultSocket is where `dstream serve` listens and `dstream ctl` connects
+var DefaultSocket = filepath.Join(state.DefaultDir, "dstream.sock")
+
+// Supervisor is the part of executor.Supervisor the API drives
+type Supervisor interface {
+	Tasks() []executor.TaskState
+	Task(name string) (executor.TaskState, error)
+	StartTask(name string) error
+	Stop(name string) error
+	Restart(name string) error
+	Apply(tasks []*config.TaskBlock) (executor.ReloadResult, error)
+}
+
+// API serves the management endpoints
+type API struct {
+	Supervisor Supervisor
+	// Load reads the tasks from the config file, for reload
+	Load func() ([]*config.TaskBlock, error)
+	// Health backs /v1/status
+	Health *health.Registry
+}
+
+// Handler returns the API's routes
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/tasks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.Supervisor.Tasks())
+	})
+	mux.HandleFunc("GET /v1/tasks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		a.respondTask(w, r.PathValue("name"), nil)
+	})
+	mux.HandleFunc("POST /v1/tasks/{name}/start", a.action("start", a.Supervisor.StartTask))
+	mux.HandleFunc("POST /v1/tasks/{name}/stop", a.action("stop", a.Supervisor.Stop))
+	mux.HandleFunc("POST /v1/tasks/{name}/restart", a.action("restart", a.Supervisor.Restart))
+	mux.HandleFunc("POST /v1/reload", a.reload)
+	mux.HandleFunc("GET /v1/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.Health.Snapshot())
+	})
+	return mux
+}
+
+// action runs a task operation and responds with the task's state afterwards
+func (a *API) action(name string, op func(string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		task := r.PathValue("name")
+		log.Info("Task "+name+" requested", "task", task)
+		a.respondTask(w, task, op(task))
+	}
+}
+
+func (a *API) respondTask(w http.ResponseWriter, name string, opErr error) {
+	if opErr != nil {
+		writeError(w, opErr)
+		return
+	}
+	st, err := a.Supervisor.Task(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (a *API) reload(w http.ResponseWriter, r *http.Request) {
+	log.Info("Reloading configuration")
+	tasks, err := a.Load()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+	result, err := a.Supervisor.Apply(tasks)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+	log.Info("Configuration reloaded", "started", len(result.Started), "restarted", len(result.Restarted),
+		"reloaded", len(result.Reloaded), "stopped", len(result.Stopped), "unchanged", len(result.Unchanged))
+	writeJSON(w, http.StatusOK, result)
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, executor.ErrTaskNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, executor.ErrTaskRunning):
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, errorBody{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/httpserver"
+)
+
+// fakeSupervisor keeps task states in a map
+type fakeSupervisor struct {
+	states  map[string]string
+	applied []string
+}
+
+func (f *fakeSupervisor) Tasks() []executor.TaskState {
+	var out []executor.TaskState
+	for _, name := range []string{"orders", "customers"} {
+		if st, ok := f.states[name]; ok {
+			out = append(out, executor.TaskState{Name: name, State: st})
+		}
+	}
+	return out
+}
+
+func (f *fakeSupervisor) Task(name string) (executor.TaskState, error) {
+	st, ok := f.states[name]
+	if !ok {
+		return executor.TaskState{}, fmt.Errorf("%w: %s", executor.ErrTaskNotFound, name)
+	}
+	return executor.TaskState{Name: name, State: st}, nil
+}
+
+func (f *fakeSupervisor) StartTask(name string) error {
+	if _, err := f.Task(name); err != nil {
+		return err
+	}
+	if f.states[name] == executor.TaskRunning {
+		return fmt.Errorf("%w: %s", executor.ErrTaskRunning, name)
+	}
+	f.states[name] = executor.TaskRunning
+	return nil
+}
+
+func (f *fakeSupervisor) Stop(name string) error {
+	if _, err := f.Task(name); err != nil {
+		return err
+	}
+	f.states[name] = executor.TaskStopped
+	return nil
+}
+
+func (f *fakeSupervisor) Restart(name string) error {
+	if err := f.Stop(name); err != nil {
+		return err
+	}
+	return f.StartTask(name)
+}
+
+func (f *fakeSupervisor) Apply(tasks []*config.TaskBlock) (executor.ReloadResult, error) {
+	var result executor.ReloadResult
+	for _, t := range tasks {
+		f.applied = append(f.applied, t.Name)
+		result.Unchanged = append(result.Unchanged, t.Name)
+	}
+	return result, nil
+}
+
+func startAPI(t *testing.T, sup Supervisor, load func() ([]*config.TaskBlock, error)) *Client {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "dstream.sock")
+	api := &API{Supervisor: sup, Load: load, Health: health.NewRegistry()}
+	srv, err := httpserver.ServeUnix(socket, api.Handler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return NewClient(socket, "")
+}
+
+func TestAPITaskActions(t *testing.T) {
+	sup := &fakeSupervisor{states: map[string]string{"orders": executor.TaskRunning, "customers": executor.TaskStopped}}
+	client := startAPI(t, sup, nil)
+
+	tasks, err := client.Tasks()
+	if err != nil || len(tasks) != 2 || tasks[1].State != executor.TaskStopped {
+		t.Fatalf("unexpected task list %+v (err=%v)", tasks, err)
+	}
+
+	st, err := client.Stop("orders")
+	if err != nil || st.State != executor.TaskStopped {
+		t.Fatalf("stop: %+v (err=%v)", st, err)
+	}
+	st, err = client.Start("customers")
+	if err != nil || st.State != executor.TaskRunning {
+		t.Fatalf("start: %+v (err=%v)", st, err)
+	}
+	if _, err := client.Start("customers"); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if _, err := client.Restart("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := client.Status(); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+}
+
+func TestAPIReload(t *testing.T) {
+	sup := &fakeSupervisor{states: map[string]string{}}
+	loadErr := error(nil)
+	client := startAPI(t, sup, func() ([]*config.TaskBlock, error) {
+		return []*config.TaskBlock{{Name: "orders"}}, loadErr
+	})
+
+	result, err := client.Reload()
+	if err != nil || fmt.Sprint(result.Unchanged) != "[orders]" || fmt.Sprint(sup.applied) != "[orders]" {
+		t.Fatalf("unexpected reload %+v (err=%v)", result, err)
+	}
+
+	loadErr = errors.New("dstream.hcl:3: unexpected }")
+	if _, err := client.Reload(); err == nil || !strings.Contains(err.Error(), "unexpected }") {
+		t.Fatalf("expected the config error, got %v", err)
+	}
+}
+
+func TestClientReportsNotRunning(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "dstream.sock"), "")
+	if _, err := client.Tasks(); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning, got %v", err)
+	}
+}
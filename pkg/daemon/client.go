@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/health"
+)
+
+// ErrNotRunning is returned when no daemon is listening
+var ErrNotRunning = errors.New("dstream serve is not running")
+
+// Client calls the API of a running `dstream serve`
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// NewClient connects over the unix socket at socket, or to the TCP address addr
+// when it is set
+func NewClient(socket, addr string) *Client {
+	if addr != "" {
+		return &Client{http: &http.Client{}, base: "http://" + addr}
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}, base: "http://dstream"}
+}
+
+// Tasks lists every task
+func (c *Client) Tasks() ([]executor.TaskState, error) {
+	var tasks []executor.TaskState
+	err := c.do(http.MethodGet, "/v1/tasks", &tasks)
+	return tasks, err
+}
+
+// Task returns one task
+func (c *Client) Task(name string) (executor.TaskState, error) {
+	var st executor.TaskState
+	err := c.do(http.MethodGet, "/v1/tasks/"+url.PathEscape(name), &st)
+	return st, err
+}
+
+// Start starts a task and returns its state
+func (c *Client) Start(name string) (executor.TaskState, error) {
+	return c.taskAction(name, "start")
+}
+
+// Stop stops a task and returns its state
+func (c *Client) Stop(name string) (executor.TaskState, error) {
+	return c.taskAction(name, "stop")
+}
+
+// Restart restarts a task and returns its state
+func (c *Client) Restart(name string) (executor.TaskState, error) {
+	return c.taskAction(name, "restart")
+}
+
+func (c *Client) taskAction(name, action string) (executor.TaskState, error) {
+	var st executor.TaskState
+	err := c.do(http.MethodPost, "/v1/tasks/"+url.PathEscape(name)+"/"+action, &st)
+	return st, err
+}
+
+// Reload makes the daemon re-read its config file
+func (c *Client) Reload() (executor.ReloadResult, error) {
+	var result executor.ReloadResult
+	err := c.do(http.MethodPost, "/v1/reload", &result)
+	return result, err
+}
+
+// Status returns the daemon's health document
+func (c *Client) Status() (health.Status, error) {
+	var status health.Status
+	err := c.do(http.MethodGet, "/v1/status", &status)
+	return status, err
+}
+
+func (c *Client) do(method, path string, out any) error {
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return ErrNotRunning
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body errorBody
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			return errors.New(body.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/history"
+)
+
+// ErrMaxRuntime is returned by a run stopped for lasting longer than its max runtime
+var ErrMaxRuntime = errors.New("max runtime reached")
+
+// Exit statuses of a batch run, as `dstream run --batch` exits with them
+const (
+	ExitCompleted   = 0 // the input finished and the output drained
+	ExitFailed      = 1
+	ExitInterrupted = 2 // stopped by a signal before the input finished
+	ExitMaxRuntime  = 3 // stopped for lasting longer than its max runtime
+)
+
+// RunSummary is what one run of a task's pipeline did
+type RunSummary struct {
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	Status        string    `json:"status"`
+	ExitReason    string    `json:"exit_reason"`
+	EventsRelayed int64     `json:"events_relayed"`
+	EventsDropped int64     `json:"events_dropped"`
+	BytesRelayed  int64     `json:"bytes_relayed"`
+	Error         string    `json:"error,omitempty"`
+
+	FaultsInjected map[string]int64 `json:"faults_injected,omitempty"`
+}
+
+func newRunSummary(run *history.Run) RunSummary {
+	return RunSummary{
+		StartedAt:     run.StartedAt,
+		FinishedAt:    run.FinishedAt,
+		Status:        run.Status,
+		ExitReason:    run.ExitReason,
+		EventsRelayed: run.EventsRelayed,
+		EventsDropped: run.EventsDropped,
+		BytesRelayed:  run.BytesRelayed,
+		Error:         run.Error,
+
+		FaultsInjected: run.FaultsInjected,
+	}
+}
+
+// Duration returns how long the run took
+func (r RunSummary) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// ExitCode returns the exit status of the run as a batch run
+func (r RunSummary) ExitCode() int {
+	switch {
+	case r.ExitReason == exitMaxRuntime:
+		return ExitMaxRuntime
+	case r.Status == history.StatusFailed:
+		return ExitFailed
+	case strings.HasPrefix(r.ExitReason, exitSignal):
+		return ExitInterrupted
+	default:
+		return ExitCompleted
+	}
+}
+
+// batchOptions returns the options a task runs with: a task with a schedule
+// block always runs as a batch, bounded by its max runtime unless opts set one
+func batchOptions(task *config.TaskBlock, opts RunOptions) RunOptions {
+	sched, _ := task.SchedulePolicy() // checked by checkSupervisable
+	if sched == nil {
+		return opts
+	}
+	opts.Batch = true
+	if opts.MaxRuntime == 0 {
+		opts.MaxRuntime = sched.MaxRuntime
+	}
+	return opts
+}
+
+// batchRestartPolicy adjusts a restart policy for batch runs: a run that
+// completes or reaches its max runtime is done, so only failures are retried
+func batchRestartPolicy(policy config.RestartPolicy) config.RestartPolicy {
+	if policy.Policy == config.RestartAlways {
+		policy.Policy = config.RestartOnFailure
+	}
+	return policy
+}
@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// runBatch runs task as a batch and returns its summary and the output's log
+func runBatch(t *testing.T, task *config.TaskBlock, opts RunOptions) (RunSummary, error, string) {
+	t.Helper()
+	useTempStateStore(t)
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	type result struct {
+		summary RunSummary
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		summary, err := runPipelineSummary(context.Background(), task, nil, nil, opts)
+		done <- result{summary, err}
+	}()
+	select {
+	case r := <-done:
+		data, _ := os.ReadFile(drainLog)
+		return r.summary, r.err, string(data)
+	case <-time.After(30 * time.Second):
+		t.Fatal("batch run did not finish")
+		return RunSummary{}, nil, ""
+	}
+}
+
+func TestBatchRunEndsWhenInputExits(t *testing.T) {
+	summary, err, log := runBatch(t, helperTask(t, "reloaded", helperProvider{Config: "count = 5"}, helperProvider{}), RunOptions{Batch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.EventsRelayed != 5 || summary.ExitReason != exitCompleted || summary.ExitCode() != ExitCompleted {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if !strings.HasSuffix(log, "event-5\neof\n") {
+		t.Fatalf("expected the output to drain every event, got %q", log)
+	}
+}
+
+func TestMaxRuntimeStopsThePipelineGracefully(t *testing.T) {
+	summary, err, log := runBatch(t, helperTask(t, "reloaded", helperProvider{}, helperProvider{}), RunOptions{Batch: true, MaxRuntime: 300 * time.Millisecond})
+	if !errors.Is(err, ErrMaxRuntime) {
+		t.Fatalf("expected ErrMaxRuntime, got %v", err)
+	}
+	if summary.ExitCode() != ExitMaxRuntime || summary.EventsRelayed == 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if !strings.HasSuffix(log, "flushed-3\neof\n") {
+		t.Fatalf("expected the input to flush into the output before stopping, got %q", log)
+	}
+}
+
+func TestRunSummaryExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		summary RunSummary
+		want    int
+	}{
+		{RunSummary{Status: "succeeded", ExitReason: exitCompleted}, ExitCompleted},
+		{RunSummary{Status: "failed", ExitReason: exitProviderFailed}, ExitFailed},
+		{RunSummary{Status: "succeeded", ExitReason: exitSignal + "terminated"}, ExitInterrupted},
+		{RunSummary{Status: "failed", ExitReason: exitMaxRuntime}, ExitMaxRuntime},
+	} {
+		if got := tc.summary.ExitCode(); got != tc.want {
+			t.Errorf("%+v: got %d, want %d", tc.summary, got, tc.want)
+		}
+	}
+}
+
+func TestSupervisorWaitsForScheduledTasks(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	task := helperTask(t, "reloaded", helperProvider{Config: "count = 3"}, helperProvider{})
+	task.Schedule = &config.ScheduleBlock{Cron: "0 0 1 1 *"}
+	task.Restart = &config.RestartBlock{Policy: config.RestartAlways}
+
+	// Under serve the task waits for its schedule
+	s := NewSupervisor(RunOptions{})
+	s.FollowSchedules()
+	t.Cleanup(func() {
+		s.StopAll(syscall.SIGTERM)
+		s.Wait()
+	})
+	if err := s.Start(task); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := s.Task(task.Name)
+	if st.State != TaskScheduled || st.NextRun.IsZero() || st.LastRun != nil {
+		t.Fatalf("expected the task to wait for its schedule, got %+v", st)
+	}
+	if err := s.Stop(task.Name); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := s.Task(task.Name); st.State != TaskStopped {
+		t.Fatalf("expected the scheduled task to stop, got %+v", st)
+	}
+
+	// Otherwise it runs once as a batch: a completed run isn't restarted, even
+	// with restart policy always
+	once := NewSupervisor(RunOptions{})
+	if err := once.Start(task); err != nil {
+		t.Fatal(err)
+	}
+	once.Wait()
+	st, _ = once.Task(task.Name)
+	if st.State != TaskStopped || st.Restarts != 0 || st.LastRun == nil || st.LastRun.EventsRelayed != 3 {
+		t.Fatalf("expected a single completed batch run, got %+v", st)
+	}
+}
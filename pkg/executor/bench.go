@@ -0,0 +1,355 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/katasec/dstream/pkg/builtin"
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/history"
+	"github.com/katasec/dstream/pkg/state"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// maxLatencySamples bounds the memory a benchmark spends on latencies; beyond
+// it a uniform sample of the events is kept
+const maxLatencySamples = 1 << 20
+
+// BenchGenerator is the builtin generator a benchmark runs in place of the
+// task's input provider; see pkg/builtin for what each setting does
+type BenchGenerator struct {
+	Count   int     `json:"count"`
+	Rate    float64 `json:"rate,omitempty"`
+	Size    int     `json:"size"`
+	SizeMax int     `json:"size_max,omitempty"`
+	Schema  string  `json:"schema"`
+	Seed    uint64  `json:"seed,omitempty"`
+}
+
+// BenchOptions adjust a benchmark run
+type BenchOptions struct {
+	Generator BenchGenerator
+	// MaxRuntime stops the run gracefully once it has lasted this long; 0 for
+	// no limit, in which case the generator needs a count
+	MaxRuntime time.Duration
+	// SampleInterval is how often CPU and memory are sampled
+	SampleInterval time.Duration
+}
+
+// BenchReport is what a benchmark measured. Latency is from the generator
+// creating an event to the relay handing it to the output provider, so it
+// grows when the output falls behind; backpressure is the time the relay spent
+// blocked writing to the output.
+type BenchReport struct {
+	Task       string         `json:"task"`
+	Output     state.Provider `json:"output"`
+	Generator  BenchGenerator `json:"generator"`
+	StartedAt  time.Time      `json:"started_at"`
+	Status     string         `json:"status"`
+	ExitReason string         `json:"exit_reason"`
+	Error      string         `json:"error,omitempty"`
+
+	Events          int64   `json:"events"`
+	EventsDropped   int64   `json:"events_dropped"`
+	Bytes           int64   `json:"bytes"`
+	RelaySeconds    float64 `json:"relay_seconds"` // first event relayed to last
+	EventsPerSecond float64 `json:"events_per_second"`
+	BytesPerSecond  float64 `json:"bytes_per_second"`
+
+	Latency      BenchLatency      `json:"latency"`
+	Backpressure BenchBackpressure `json:"backpressure"`
+	// Processes are keyed by "dstream", which runs the relay and the generator,
+	// and by the role of each provider process
+	Processes map[string]BenchProcess `json:"processes"`
+}
+
+// BenchLatency summarises event latencies, in milliseconds
+type BenchLatency struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+// BenchBackpressure is how long the relay waited on the output
+type BenchBackpressure struct {
+	Seconds  float64 `json:"seconds"`
+	Fraction float64 `json:"fraction"` // of the relay time
+}
+
+// BenchProcess is the resource usage of one process over the run
+type BenchProcess struct {
+	PID          int     `json:"pid"`
+	CPUSeconds   float64 `json:"cpu_seconds"`
+	CPUPercent   float64 `json:"cpu_percent"` // of one core, averaged over the run
+	PeakRSSBytes uint64  `json:"peak_rss_bytes"`
+}
+
+// RunBench runs the task with the builtin generator in place of its input
+// provider and the real output provider, and reports the throughput, latency
+// and resource usage. The run is a batch run that isn't recorded in the
+// history; it ends when the generator's count is sent or at the max runtime,
+// and SIGINT and SIGTERM end it early.
+func RunBench(ctx context.Context, task *config.TaskBlock, signals <-chan os.Signal, opts BenchOptions) (*BenchReport, error) {
+	if task.Output == nil {
+		return nil, fmt.Errorf("task %q must define an output block", task.Name)
+	}
+	if opts.Generator.Count == 0 && opts.MaxRuntime == 0 {
+		return nil, fmt.Errorf("a benchmark needs an event count or a max runtime")
+	}
+	if opts.SampleInterval <= 0 {
+		opts.SampleInterval = 500 * time.Millisecond
+	}
+
+	benched, err := benchTask(task, opts.Generator)
+	if err != nil {
+		return nil, err
+	}
+	path, err := resolveProviderPath(ctx, task.Output)
+	if err != nil {
+		return nil, err
+	}
+	output, err := providerState(task, "output", path)
+	if err != nil {
+		return nil, err
+	}
+	output.ConfigHash = ""
+	if output.Path == "" && output.Ref == "" {
+		output.Path = path
+	}
+
+	rec := newBenchRecorder(opts.SampleInterval)
+	summary, runErr := runPipelineSummary(ctx, benched, signals, nil, RunOptions{
+		Batch:      true,
+		MaxRuntime: opts.MaxRuntime,
+		ephemeral:  true,
+		bench:      rec,
+	})
+
+	// Reaching the max runtime is how an unbounded benchmark is meant to end
+	if errors.Is(runErr, ErrMaxRuntime) {
+		runErr = nil
+		summary.Status, summary.Error = history.StatusSucceeded, ""
+	}
+
+	report := rec.report()
+	report.Task, report.Output, report.Generator = task.Name, output, opts.Generator
+	report.StartedAt, report.Status, report.ExitReason, report.Error = summary.StartedAt, summary.Status, summary.ExitReason, summary.Error
+	report.Events, report.EventsDropped, report.Bytes = summary.EventsRelayed, summary.EventsDropped, summary.BytesRelayed
+	if report.RelaySeconds > 0 {
+		report.EventsPerSecond = float64(report.Events) / report.RelaySeconds
+		report.BytesPerSecond = float64(report.Bytes) / report.RelaySeconds
+		report.Backpressure.Fraction = report.Backpressure.Seconds / report.RelaySeconds
+	}
+	return report, runErr
+}
+
+// benchTask returns a copy of task with the generator as its input and nothing
+// that would change how the run goes: no bootstrap, schedule, restarts or
+// injected faults
+func benchTask(task *config.TaskBlock, gen BenchGenerator) (*config.TaskBlock, error) {
+	src, err := json.Marshal(gen)
+	if err != nil {
+		return nil, err
+	}
+	// The generator's config goes through the same HCL to JSON conversion as
+	// any provider's
+	file, diags := hcljson.Parse(src, "bench-generator.json")
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("generator config: %s", diags.Error())
+	}
+	benched := *task
+	benched.Input = &config.InputBlock{
+		ProviderRef: builtin.Scheme + "generator",
+		Config:      &config.ConfigBlock{Remain: file.Body},
+	}
+	benched.Bootstrap, benched.Schedule, benched.Restart, benched.FaultInjection = nil, nil, nil, nil
+	return &benched, nil
+}
+
+// benchRecorder collects measurements during a benchmark run: relayed is
+// called by the relay for each event, and watch samples the processes
+type benchRecorder struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	latencies []time.Duration // a uniform sample of at most maxLatencySamples
+	seen      int
+	rng       *rand.Rand
+	blocked   time.Duration
+	first     time.Time
+	last      time.Time
+	processes map[string]*processUsage
+}
+
+// processUsage tracks one process between samples
+type processUsage struct {
+	pid      int
+	baseline float64 // CPU seconds used before the run, for DStream itself
+	cpu      float64
+	peakRSS  uint64
+	since    time.Time
+	until    time.Time
+	provider *providerProcess // its exact usage is known once it has exited
+}
+
+func newBenchRecorder(interval time.Duration) *benchRecorder {
+	r := &benchRecorder{
+		interval:  interval,
+		rng:       rand.New(rand.NewPCG(1, 2)),
+		processes: make(map[string]*processUsage),
+	}
+	if usage := r.sampleProcess("dstream", os.Getpid()); usage != nil {
+		usage.baseline = usage.cpu
+	}
+	return r
+}
+
+// relayed records one event handed to the output, which took took to write
+func (r *benchRecorder) relayed(line string, took time.Duration) {
+	now := time.Now()
+	created, ok := generatedAt(line)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.first.IsZero() {
+		r.first = now
+	}
+	r.last = now
+	r.blocked += took
+	if !ok {
+		return
+	}
+	latency := now.Sub(created)
+	r.seen++
+	if len(r.latencies) < maxLatencySamples {
+		r.latencies = append(r.latencies, latency)
+	} else if i := r.rng.IntN(r.seen); i < maxLatencySamples {
+		r.latencies[i] = latency
+	}
+}
+
+// generatedAt finds when the generator created an event, from its
+// metadata.timestamp, without decoding the whole event
+func generatedAt(line string) (time.Time, bool) {
+	const key = `"timestamp":"`
+	i := strings.Index(line, key)
+	if i < 0 {
+		return time.Time{}, false
+	}
+	rest := line[i+len(key):]
+	end := strings.IndexByte(rest, '"')
+	if end < 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, rest[:end])
+	return t, err == nil
+}
+
+// watch samples DStream and the provider processes of lp until the returned
+// function is called
+func (r *benchRecorder) watch(lp *livePipeline) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	sample := func() {
+		r.sampleProcess("dstream", os.Getpid())
+		input, output := lp.providers()
+		for _, p := range []*providerProcess{input, output} {
+			if p == nil || p.cmd == nil || p.cmd.Process == nil {
+				continue // builtins are part of DStream
+			}
+			if usage := r.sampleProcess(p.role, p.cmd.Process.Pid); usage != nil {
+				usage.provider = p
+			}
+		}
+	}
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			sample()
+			select {
+			case <-ticker.C:
+			case <-done:
+				sample()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// sampleProcess adds a sample of one process's CPU and memory. It returns nil
+// once the process has gone.
+func (r *benchRecorder) sampleProcess(name string, pid int) *processUsage {
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil
+	}
+	times, err := proc.Times()
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	usage := r.processes[name]
+	if usage == nil || usage.pid != pid {
+		usage = &processUsage{pid: pid, since: now}
+		r.processes[name] = usage
+	}
+	usage.cpu, usage.until = times.User+times.System, now
+	if mem, err := proc.MemoryInfo(); err == nil {
+		usage.peakRSS = max(usage.peakRSS, mem.RSS)
+	}
+	return usage
+}
+
+// report summarises what was recorded
+func (r *benchRecorder) report() *BenchReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &BenchReport{Processes: make(map[string]BenchProcess)}
+	if !r.first.IsZero() {
+		report.RelaySeconds = r.last.Sub(r.first).Seconds()
+	}
+	report.Backpressure.Seconds = r.blocked.Seconds()
+
+	if n := len(r.latencies); n > 0 {
+		sorted := slices.Clone(r.latencies)
+		slices.Sort(sorted)
+		at := func(q float64) float64 {
+			return float64(sorted[min(int(q*float64(n)), n-1)]) / float64(time.Millisecond)
+		}
+		report.Latency = BenchLatency{Samples: n, P50: at(0.50), P90: at(0.90), P99: at(0.99), Max: at(1)}
+	}
+
+	for name, usage := range r.processes {
+		cpu := usage.cpu - usage.baseline
+		// A provider that has exited reports its exact usage; the last sample
+		// may have been taken a while before it exited
+		if p := usage.provider; p != nil && p.exited() && p.cmd.ProcessState != nil {
+			cpu = (p.cmd.ProcessState.UserTime() + p.cmd.ProcessState.SystemTime()).Seconds()
+		}
+		proc := BenchProcess{PID: usage.pid, CPUSeconds: cpu, PeakRSSBytes: usage.peakRSS}
+		if wall := usage.until.Sub(usage.since).Seconds(); wall > 0 {
+			proc.CPUPercent = 100 * cpu / wall
+		}
+		report.Processes[name] = proc
+	}
+	return report
+}
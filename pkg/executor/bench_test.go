@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunBenchReportsThroughputAndLatency(t *testing.T) {
+	useTempStateStore(t)
+	store := useTempHistoryStore(t)
+	task := parseTask(t, `
+task "bench" {
+  type = "providers"
+  input {
+    provider_ref = "builtin://file"
+    config {
+      path = "/dev/null"
+    }
+  }
+  output {
+    provider_ref = "builtin://null"
+  }
+}`)
+
+	report, err := RunBench(context.Background(), task, nil, BenchOptions{
+		Generator:      BenchGenerator{Count: 200, Size: 10, SizeMax: 100, Schema: "cdc", Seed: 7},
+		SampleInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 200 || report.Bytes == 0 || report.Status != "succeeded" {
+		t.Fatalf("expected 200 events relayed, got %+v", report)
+	}
+	if report.Latency.Samples != 200 || report.Latency.P50 > report.Latency.Max {
+		t.Fatalf("expected a latency for every event, got %+v", report.Latency)
+	}
+	if report.Output.Ref != "builtin://null" {
+		t.Fatalf("expected the output provider in the report, got %+v", report.Output)
+	}
+	if _, ok := report.Processes["dstream"]; !ok {
+		t.Fatalf("expected DStream's own usage, got %+v", report.Processes)
+	}
+
+	// A benchmark isn't a run of the task
+	if runs, _ := store.List(task.Name); len(runs) != 0 {
+		t.Fatalf("expected no recorded runs, got %v", runs)
+	}
+}
+
+func TestRunBenchStopsAtMaxRuntime(t *testing.T) {
+	useTempStateStore(t)
+	useTempHistoryStore(t)
+	task := parseTask(t, `
+task "bench" {
+  type = "providers"
+  input {
+    provider_ref = "builtin://file"
+    config {
+      path = "/dev/null"
+    }
+  }
+  output {
+    provider_ref = "builtin://null"
+  }
+}`)
+
+	if _, err := RunBench(context.Background(), task, nil, BenchOptions{}); err == nil {
+		t.Fatal("expected a benchmark without a count or max runtime to be rejected")
+	}
+	report, err := RunBench(context.Background(), task, nil, BenchOptions{
+		Generator:  BenchGenerator{Rate: 100, Schema: "simple"},
+		MaxRuntime: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected reaching the max runtime to end the benchmark cleanly, got %v", err)
+	}
+	if report.ExitReason != exitMaxRuntime || report.Status != "succeeded" || report.Events == 0 {
+		t.Fatalf("expected a run stopped at the max runtime, got %+v", report)
+	}
+}
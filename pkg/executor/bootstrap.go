@@ -0,0 +1,279 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/state"
+)
+
+// bootstrapLogInterval is how often snapshot progress is logged
+const bootstrapLogInterval = 5 * time.Second
+
+// snapshotMessage is a control line a snapshot provider writes on stdout among
+// its events. Any of the fields may be set:
+//
+//	{"snapshot":{"progress":{"done":1200,"total":50000},"checkpoint":{"last_id":1200}}}
+//	{"snapshot":{"complete":true,"watermark":{"lsn":"0x0000002A"}}}
+//
+// A checkpoint covers the events written before it; a snapshot resumed after an
+// interruption is sent the last one. The watermark is where the input picks up
+// once the snapshot is complete.
+type snapshotMessage struct {
+	Snapshot *struct {
+		Progress *struct {
+			Done  int64 `json:"done"`
+			Total int64 `json:"total"`
+		} `json:"progress"`
+		Checkpoint json.RawMessage `json:"checkpoint"`
+		Complete   bool            `json:"complete"`
+		Watermark  json.RawMessage `json:"watermark"`
+	} `json:"snapshot"`
+}
+
+// bootstrap runs the snapshot phase of a task with a bootstrap block. The
+// snapshot provider stands in for the input until it completes; its events are
+// relayed like any others, while its progress, checkpoints and watermark are
+// saved in the task state.
+type bootstrap struct {
+	task *config.TaskBlock
+
+	mu       sync.Mutex
+	snapshot *providerProcess // the running snapshot provider, nil when there is none
+
+	// Touched only by the relay once the snapshot has started
+	state    state.Bootstrap
+	complete bool
+	lastLog  time.Time
+}
+
+// newBootstrap returns the bootstrap phase of a run, or nil for a task without
+// one. A completed snapshot isn't repeated unless opts ask for it; its watermark
+// is still passed to the input.
+func newBootstrap(task *config.TaskBlock, opts RunOptions) (*bootstrap, error) {
+	if task.Bootstrap == nil {
+		return nil, nil
+	}
+	if opts.replaces("input") {
+		log.Info("The input provider is replaced, skipping the bootstrap snapshot", "task", task.Name)
+		return nil, nil
+	}
+	st, err := stateStore.LoadOrNew(task.Name)
+	if err != nil {
+		return nil, err
+	}
+	b := &bootstrap{task: task}
+	if st.Bootstrap != nil && !(opts.Rebootstrap && st.Bootstrap.Status == state.BootstrapCompleted) {
+		b.state = *st.Bootstrap
+	}
+	return b, nil
+}
+
+// pending reports whether the run starts with a snapshot
+func (b *bootstrap) pending() bool {
+	return b != nil && b.state.Status != state.BootstrapCompleted
+}
+
+// snapshotting reports whether p is the snapshot provider
+func (b *bootstrap) snapshotting(p *providerProcess) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshot != nil && b.snapshot == p
+}
+
+// inputOptions adds the snapshot's watermark to the input's run envelope once
+// the snapshot is complete
+func (b *bootstrap) inputOptions() []envelopeOption {
+	if b == nil || b.state.Status != state.BootstrapCompleted || len(b.state.Watermark) == 0 {
+		return nil
+	}
+	return []envelopeOption{withRawField("watermark", b.state.Watermark)}
+}
+
+// start launches the snapshot provider with the "snapshot" command, resuming
+// from the last checkpoint if an earlier snapshot was interrupted
+func (b *bootstrap) start(ctx context.Context) (*providerProcess, error) {
+	snapshotTask := b.task.BootstrapTask()
+	timeouts, err := snapshotTask.TimeoutsFor("input")
+	if err != nil {
+		return nil, err
+	}
+	path, err := resolveProviderPath(ctx, snapshotTask.Input)
+	if err != nil {
+		return nil, fmt.Errorf("resolve snapshot provider: %w", err)
+	}
+
+	opts := []envelopeOption{withTraceContext(ctx)}
+	if b.state.Status == state.BootstrapInProgress && len(b.state.Checkpoint) > 0 {
+		log.Info("Resuming snapshot from its last checkpoint", "task", b.task.Name, "path", path,
+			"checkpoint", string(b.state.Checkpoint), "events", b.state.Events)
+		opts = append(opts, withRawField("checkpoint", b.state.Checkpoint))
+	} else {
+		log.Info("Starting snapshot before streaming", "task", b.task.Name, "path", path)
+		b.state = state.Bootstrap{Status: state.BootstrapInProgress, StartedAt: time.Now().UTC()}
+	}
+	envelope, err := createCommandEnvelope(snapshotTask.InputConfigAsJSON, "snapshot", opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create snapshot command envelope: %w", err)
+	}
+
+	p, err := startProvider(ctx, b.task.Name, "input", path, envelope, timeouts, true)
+	if err != nil {
+		return nil, err
+	}
+	p.stdin.Close() // a snapshot is never reconfigured
+	p.name = "snapshot-provider"
+	b.mu.Lock()
+	b.snapshot = p
+	b.mu.Unlock()
+	b.save()
+	health.Default.Task(b.task.Name).Snapshotting(b.state.Done, b.state.Total, b.state.Events)
+	return p, nil
+}
+
+// handle looks at a line read from p. Snapshot control lines are consumed and
+// it returns true; anything else is an event to relay.
+func (b *bootstrap) handle(p *providerProcess, line string) bool {
+	if !b.snapshotting(p) {
+		return false
+	}
+	var msg snapshotMessage
+	if !strings.HasPrefix(line, `{"snapshot"`) || json.Unmarshal([]byte(line), &msg) != nil || msg.Snapshot == nil {
+		b.state.Events++
+		return false
+	}
+
+	m := msg.Snapshot
+	if m.Progress != nil {
+		b.state.Done, b.state.Total = m.Progress.Done, m.Progress.Total
+	}
+	if len(m.Checkpoint) > 0 {
+		b.state.Checkpoint = m.Checkpoint
+	}
+	if m.Complete {
+		b.complete = true
+		b.state.Watermark = m.Watermark
+	}
+	health.Default.Task(b.task.Name).Snapshotting(b.state.Done, b.state.Total, b.state.Events)
+	if len(m.Checkpoint) > 0 || m.Complete {
+		b.save()
+	}
+	if time.Since(b.lastLog) >= bootstrapLogInterval {
+		b.lastLog = time.Now()
+		args := []any{"task", b.task.Name, "done", b.state.Done, "events", b.state.Events}
+		if b.state.Total > 0 {
+			args = append(args, "total", b.state.Total,
+				"percent", fmt.Sprintf("%.1f", 100*float64(b.state.Done)/float64(b.state.Total)))
+		}
+		log.Info("Snapshot progress", args...)
+	}
+	return true
+}
+
+// finish records the end of the snapshot provider's output. It fails if the
+// provider didn't report completion.
+func (b *bootstrap) finish() error {
+	b.mu.Lock()
+	b.snapshot = nil
+	b.mu.Unlock()
+	if !b.complete {
+		return errors.New("snapshot provider exited without reporting completion; the next run resumes from its last checkpoint")
+	}
+
+	b.state.Status = state.BootstrapCompleted
+	b.state.Checkpoint = nil
+	b.state.CompletedAt = time.Now().UTC()
+	b.save()
+	health.Default.Task(b.task.Name).Bootstrapped()
+	log.Info("Snapshot completed, streaming from its watermark", "task", b.task.Name,
+		"events", b.state.Events, "watermark", string(b.state.Watermark),
+		"duration", b.state.CompletedAt.Sub(b.state.StartedAt).Round(time.Millisecond).String())
+	return nil
+}
+
+// interrupted records that the snapshot provider stopped before completing;
+// its last checkpoint stays in the task state for the next run
+func (b *bootstrap) interrupted() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.snapshot = nil
+}
+
+// save writes the bootstrap progress to the task state. Failing to is logged:
+// the snapshot goes on, but may have to start over if interrupted.
+func (b *bootstrap) save() {
+	st, err := stateStore.LoadOrNew(b.task.Name)
+	if err == nil {
+		bs := b.state
+		st.Bootstrap = &bs
+		err = stateStore.Save(st)
+	}
+	if err != nil {
+		log.Warn("Failed to save snapshot progress", "task", b.task.Name, "error", err.Error())
+	}
+}
+
+// handOver is called once the snapshot provider's output has ended. It waits
+// for the provider to exit and starts the task's input in its place, streaming
+// from the snapshot's watermark. ok is false when there is nothing to hand over
+// to: the pipeline is shutting down, or the snapshot provider failed, which is
+// reported as its exit.
+func (lp *livePipeline) handOver(snapshot *providerProcess) (next inputSwap, ok bool, err error) {
+	if !snapshot.waitExit(snapshot.timeouts.Shutdown) {
+		log.Warn("Snapshot provider did not exit after closing stdout, stopping it",
+			"timeout", snapshot.timeouts.Shutdown.String())
+		snapshot.stop()
+	}
+
+	lp.mu.Lock()
+	stopping, task := lp.stopping, lp.task
+	if stopping || snapshot.err != nil {
+		lp.inputEnded = true
+	}
+	lp.mu.Unlock()
+	if stopping || snapshot.err != nil {
+		lp.boot.interrupted()
+		return inputSwap{}, false, nil
+	}
+	if err := lp.boot.finish(); err != nil {
+		lp.mu.Lock()
+		lp.inputEnded = true
+		lp.mu.Unlock()
+		return inputSwap{}, false, err
+	}
+
+	lp.mu.Lock()
+	lp.retired[snapshot] = true
+	lp.mu.Unlock()
+	snapshot.awaitUntracked()
+
+	p, firstLine, err := lp.launch(task, "input")
+	lp.mu.Lock()
+	if err == nil {
+		lp.input = p
+	} else {
+		lp.inputEnded = true
+	}
+	lp.mu.Unlock()
+	if err != nil {
+		return inputSwap{}, false, fmt.Errorf("start input provider after snapshot: %w", err)
+	}
+	return inputSwap{p: p, firstLine: firstLine}, true, nil
+}
+
+// withRawField adds a JSON value to a command envelope as it is
+func withRawField(name string, value json.RawMessage) envelopeOption {
+	return func(envelope map[string]interface{}) {
+		envelope[name] = value
+	}
+}
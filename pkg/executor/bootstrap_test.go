@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/state"
+)
+
+func TestBootstrapResumesAndHandsOverToStreaming(t *testing.T) {
+	store := useTempStateStore(t)
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "snapshot")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	task := helperTask(t, "reloaded", helperProvider{Config: "count = 2\n      snapshot_rows = 5\n      snapshot_fail_at = 3"}, helperProvider{})
+	task.Bootstrap = &config.BootstrapBlock{}
+
+	// run runs the task as a batch and returns the output's log
+	run := func(opts RunOptions) (string, error) {
+		t.Helper()
+		os.Remove(drainLog)
+		opts.Batch = true
+		_, err := runPipelineSummary(context.Background(), task, nil, nil, opts)
+		data, _ := os.ReadFile(drainLog)
+		return string(data), err
+	}
+	bootstrapState := func() state.Bootstrap {
+		t.Helper()
+		st, err := store.Load(task.Name)
+		if err != nil || st.Bootstrap == nil {
+			t.Fatalf("expected bootstrap state, got %+v (err=%v)", st, err)
+		}
+		return *st.Bootstrap
+	}
+
+	// The snapshot fails part way; its checkpoint is kept
+	log, err := run(RunOptions{})
+	if err == nil {
+		t.Fatal("expected the failed snapshot to fail the run")
+	}
+	if !strings.HasPrefix(log, "snap-1\nsnap-2\nsnap-3\n") {
+		t.Fatalf("expected the snapshot rows, got %q", log)
+	}
+	var checkpoint struct{ Row int }
+	b := bootstrapState()
+	if err := json.Unmarshal(b.Checkpoint, &checkpoint); err != nil || b.Status != state.BootstrapInProgress || checkpoint.Row != 3 || b.Events != 3 {
+		t.Fatalf("expected the snapshot to be in progress at row 3, got %+v", b)
+	}
+
+	// The next run resumes it and hands over to the input at the watermark,
+	// without relaying the snapshot's control lines
+	if log, err = run(RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "snap-4\nsnap-5\nfrom:{\"lsn\":5}\nevent-1\nevent-2\neof\n"; log != want {
+		t.Fatalf("expected %q, got %q", want, log)
+	}
+	b = bootstrapState()
+	if b.Status != state.BootstrapCompleted || len(b.Checkpoint) != 0 || b.Events != 5 || b.CompletedAt.IsZero() {
+		t.Fatalf("expected the snapshot to be completed, got %+v", b)
+	}
+	var watermark struct{ LSN int }
+	if err := json.Unmarshal(b.Watermark, &watermark); err != nil || watermark.LSN != 5 {
+		t.Fatalf("unexpected watermark %s", b.Watermark)
+	}
+
+	// A completed snapshot isn't repeated unless asked for
+	if log, err = run(RunOptions{}); err != nil || log != "from:{\"lsn\":5}\nevent-1\nevent-2\neof\n" {
+		t.Fatalf("expected streaming from the watermark, got %q (err=%v)", log, err)
+	}
+	if log, err = run(RunOptions{Rebootstrap: true}); err == nil || !strings.HasPrefix(log, "snap-1\n") {
+		t.Fatalf("expected the snapshot to start over, got %q (err=%v)", log, err)
+	}
+}
@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/katasec/dstream/pkg/builtin"
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// startBuiltin starts a builtin provider, given by its builtin:// ref, in place
+// of a provider process. It runs in a goroutine but is wired up like a child:
+// its stdin and stdout are OS pipes, so the envelope, handshake, relay and
+// stdin EOF behave as they do for a binary, its stderr is the provider log,
+// and done is closed when it returns. interrupt stands in for SIGTERM and
+// abort for SIGKILL.
+func startBuiltin(ctx context.Context, task, role, ref, envelope string, timeouts config.Timeouts) (*providerProcess, error) {
+	name, _ := builtin.Parse(ref)
+	if !builtin.Known(name) {
+		return nil, fmt.Errorf("unknown builtin provider %q, expected one of %v", ref, builtin.Names())
+	}
+	p := &providerProcess{
+		role:     role,
+		name:     role + "-provider",
+		builtin:  ref,
+		timeouts: timeouts,
+		done:     make(chan struct{}),
+		stderr:   newProviderLog(task, role),
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create %s stdin pipe: %w", p.name, err)
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, fmt.Errorf("create %s stdout pipe: %w", p.name, err)
+	}
+	p.stdin = stdinW
+	p.stdoutR = stdoutR
+	p.stdout = bufio.NewScanner(closeOnEOF{stdoutR})
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	p.interrupt = func() { stopOnce.Do(func() { close(stop) }) }
+	runCtx, cancel := context.WithCancel(ctx)
+	p.abort = func() {
+		cancel()
+		stdoutR.Close() // unblocks a write to a full pipe
+	}
+
+	p.started = time.Now()
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s panicked: %v", ref, r)
+			}
+			// As when a process exits: its end of each pipe closes, so we read
+			// EOF and further writes fail
+			stdoutW.Close()
+			stdinR.Close()
+			cancel()
+			p.stderr.Flush()
+			p.finish(err)
+		}()
+		err = builtin.Run(runCtx, name, role, builtin.IO{Stdin: stdinR, Stdout: stdoutW, Stderr: p.stderr, Stop: stop})
+	}()
+
+	if _, err := fmt.Fprintln(p.stdin, envelope); err != nil {
+		p.kill()
+		return nil, fmt.Errorf("send %s config: %w", p.role, err)
+	}
+	return p, nil
+}
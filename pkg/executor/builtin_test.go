@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinProvidersRunInProcess(t *testing.T) {
+	states := useTempStateStore(t)
+	store := useTempHistoryStore(t)
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+
+	task := parseTask(t, fmt.Sprintf(`
+task "builtins" {
+  type = "providers"
+  input {
+    provider_ref = "builtin://generator"
+    config {
+      count    = 5
+      template = "{\"id\": [[.Seq]]}"
+    }
+  }
+  output {
+    provider_ref = "builtin://jsonl-file"
+    config {
+      path = %q
+    }
+  }
+}`, out))
+
+	summary, err := runPipelineSummary(context.Background(), task, nil, nil, RunOptions{Batch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.EventsRelayed != 5 {
+		t.Fatalf("expected 5 events relayed, got %+v", summary)
+	}
+	data, _ := os.ReadFile(out)
+	if want := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n{\"id\":4}\n{\"id\":5}\n"; string(data) != want {
+		t.Fatalf("expected %q, got %q", want, data)
+	}
+
+	runs, err := store.List(task.Name)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one recorded run, got %v (err=%v)", runs, err)
+	}
+	if p := runs[0].Providers["input"]; p.Ref != "builtin://generator" || p.Digest != "" {
+		t.Fatalf("expected the builtin ref in history, got %+v", p)
+	}
+
+	// Lifecycle commands get the same handshake, and builtins have no digest
+	if _, err := executeLifecycle(context.Background(), task, "init", lifecycleOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	st, err := states.Load(task.Name)
+	if err != nil || st.Providers["output"].Ref != "builtin://jsonl-file" || st.Providers["output"].ConfigHash == "" {
+		t.Fatalf("expected init to record the builtin providers, got %+v (err=%v)", st, err)
+	}
+}
+
+func TestUnknownBuiltinFailsToStart(t *testing.T) {
+	useTempStateStore(t)
+	useTempHistoryStore(t)
+	task := parseTask(t, `
+task "unknown" {
+  type = "providers"
+  input {
+    provider_ref = "builtin://nope"
+  }
+  output {
+    provider_ref = "builtin://null"
+  }
+}`)
+	_, err := runPipelineSummary(context.Background(), task, nil, nil, RunOptions{Batch: true})
+	if err == nil || !strings.Contains(err.Error(), `unknown builtin provider "builtin://nope"`) {
+		t.Fatalf("expected an unknown builtin error, got %v", err)
+	}
+}
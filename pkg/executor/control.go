@@ -0,0 +1,25 @@
+package executor
+
+import (
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/control"
+)
+
+// ControlSocket returns the path of the control socket a running task listens on
+func ControlSocket(taskName string) string {
+	return control.SocketPath(stateStore.TaskDir(taskName))
+}
+
+// startControl opens the task's control socket so `dstream tap` can attach. The
+// pipeline runs without it when the socket can't be created.
+func startControl(task *config.TaskBlock, tap *control.Tap) *control.Server {
+	srv, err := control.Listen(ControlSocket(task.Name))
+	if err != nil {
+		log.Warn("Control socket unavailable, dstream tap is disabled for this run", "error", err.Error())
+		return nil
+	}
+	srv.Handle(control.CommandTap, tap.Serve)
+	srv.Serve()
+	log.Debug("Control socket listening", "path", srv.Path())
+	return srv
+}
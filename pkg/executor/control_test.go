@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/control"
+)
+
+func TestTapRunningPipeline(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(context.Background(), task, signals, nil, RunOptions{}) }()
+
+	var conn io.ReadCloser
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		c, err := control.Dial(ControlSocket(task.Name), control.Request{
+			Command: control.CommandTap,
+			Tap:     &control.TapOptions{Every: 2},
+		})
+		if err == nil {
+			conn = c
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("could not attach to the pipeline: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	var seen []int
+	for len(seen) < 2 && scanner.Scan() {
+		n, err := strconv.Atoi(strings.TrimPrefix(scanner.Text(), "event-"))
+		if err != nil {
+			t.Fatalf("unexpected tapped line %q", scanner.Text())
+		}
+		seen = append(seen, n)
+	}
+	if len(seen) != 2 || seen[1]-seen[0] != 2 {
+		t.Fatalf("expected every 2nd event, got %v", seen)
+	}
+
+	signals <- syscall.SIGINT
+	if err := <-done; err != nil {
+		t.Fatalf("pipeline returned error: %v", err)
+	}
+	// Stopping the pipeline ends the tap and removes the socket
+	for scanner.Scan() {
+	}
+	conn.Close()
+	if _, err := os.Stat(ControlSocket(task.Name)); !os.IsNotExist(err) {
+		t.Fatalf("control socket left behind: %v", err)
+	}
+}
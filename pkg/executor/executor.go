@@ -3,17 +3,19 @@ package executor
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"time"
 
 	"github.com/hashicorp/go-plugin"
 
-	"github.com/katasec/dstream/internal/logging"
 	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/logging"
 	"github.com/katasec/dstream/pkg/orasfetch"
 	"github.com/katasec/dstream/pkg/plugins"
 	"github.com/katasec/dstream/pkg/plugins/serve"
 	pb "github.com/katasec/dstream/proto" // for schema dump
-	sdkLogging "github.com/katasec/dstream/sdk/logging"
 )
 
 // ExecuteTask looks up a task in dstream.hcl and runs its plugin via gRPC or orchestrates providers.
@@ -22,6 +24,44 @@ func ExecuteTask(task *config.TaskBlock) error {
 	return ExecuteTaskWithCommand(task, "run")
 }
 
+// RunOptions adjust how a provider task's pipeline runs
+type RunOptions struct {
+	// Record is a file every relayed line is written to, with the time it was
+	// relayed, for `dstream replay`
+	Record string
+	// Input and Output set to StdioEndpoint ("-") replace that provider with
+	// DStream's own stdin or stdout
+	Input, Output string
+	// Batch runs the pipeline as a job: it ends when the input provider exits and
+	// the output has drained, and only a failed run is restarted
+	Batch bool
+	// MaxRuntime stops the pipeline gracefully once it has run this long; 0 for
+	// no limit
+	MaxRuntime time.Duration
+	// Rebootstrap discards a completed bootstrap snapshot and takes it again
+	Rebootstrap bool
+
+	// Set by RunFixture
+	inputStream  io.Reader
+	outputStream io.Writer
+	ephemeral    bool // not recorded in the history, no control socket
+
+	// Set by RunBench
+	bench *benchRecorder
+}
+
+// ExecuteTaskWithOptions runs a task like ExecuteTask, with options that only
+// provider tasks support
+func ExecuteTaskWithOptions(task *config.TaskBlock, opts RunOptions) error {
+	if task.Type != "providers" {
+		if opts != (RunOptions{}) {
+			return fmt.Errorf("task %q: run options require type = \"providers\"", task.Name)
+		}
+		return ExecuteTask(task)
+	}
+	return executeProviderTask(task, "run", opts)
+}
+
 // ExecuteTaskWithCommand executes a task with a specific lifecycle command (init/run/destroy/plan/status)
 func ExecuteTaskWithCommand(task *config.TaskBlock, command string) error {
 	// Route based on task type
@@ -91,16 +131,9 @@ func executePluginTask(task *config.TaskBlock) error {
 	// ── launch plugin via HashiCorp go-plugin (gRPC only) ───────────────
 	cmd := exec.Command(pluginPath)
 	cmd.Stdout, cmd.Stderr = nil, nil
+	cmd.Env = append(os.Environ(), logging.ChildEnv()...)
 
-	// Create a custom logger for the plugin client that doesn't add redundant prefixes
-	hostLogger := logging.GetHCLogger()
-
-	// Use the clean logger without prefixes
-	sdklogger := sdkLogging.SetupCleanLogger() // Initialize clean SDK logging without prefixes
-	sdklogger.Info("Hello sdklogger")
-
-	// Set the logger for the plugin client
-	//hostLogger.SetLogger(sdklogger)
+	// go-plugin re-logs the plugin's stderr through this logger
 	client := plugin.NewClient(&plugin.ClientConfig{
 		HandshakeConfig: serve.Handshake,
 		Plugins: map[string]plugin.Plugin{
@@ -108,11 +141,9 @@ func executePluginTask(task *config.TaskBlock) error {
 		},
 		Cmd:              cmd,
 		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
-		Logger:           sdklogger,
+		Logger:           logging.GetHCLogger().Named("plugin"),
 	})
 
-	hostLogger.Info("Hello World!")
-
 	rpcClient, err := client.Client()
 	if err != nil {
 		return fmt.Errorf("RPC client setup failed: %w", err)
@@ -0,0 +1,205 @@
+package executor
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/metrics"
+)
+
+// Faults a fault_injection block injects, as counted in run history and metrics
+const (
+	faultDrop      = "drop"
+	faultCorrupt   = "corrupt"
+	faultDuplicate = "duplicate"
+	faultReorder   = "reorder"
+	faultDelay     = "delay"
+	faultPause     = "pause"
+	faultKill      = "kill"
+)
+
+// faultInjector makes the relay misbehave as a task's fault_injection block
+// asks. relay and flush are called by the relay goroutine only; killProviders
+// runs on its own. Each has its own random source, so the faults injected into
+// the same input lines are the same from run to run whatever the timing.
+type faultInjector struct {
+	policy  *config.FaultPolicy
+	seed    int64
+	lines   *rand.Rand // line faults and delays
+	pauses  *rand.Rand // when the output is paused
+	metrics *metrics.Task
+
+	batch     []string // lines held back to be reordered
+	nextPause time.Time
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newFaultInjector(task *config.TaskBlock, policy *config.FaultPolicy) *faultInjector {
+	seed := policy.Seed
+	if seed == 0 {
+		seed = rand.Int64()
+	}
+	f := &faultInjector{
+		policy:  policy,
+		seed:    seed,
+		lines:   rand.New(rand.NewPCG(uint64(seed), 1)),
+		pauses:  rand.New(rand.NewPCG(uint64(seed), 2)),
+		metrics: metrics.Default.Task(task.Name),
+		counts:  make(map[string]int64),
+	}
+	if policy.PauseInterval > 0 {
+		f.nextPause = time.Now().Add(jitter(f.pauses, policy.PauseInterval))
+	}
+	// The seed is logged so a run with a random one can be repeated
+	log.Warn("Fault injection is enabled", "task", task.Name, "seed", seed)
+	return f
+}
+
+// relay passes one line from the input through the line faults to write. The
+// lines it holds back count towards the spool depth until written or dropped.
+func (f *faultInjector) relay(ctx context.Context, line string, write func(string)) {
+	p := f.policy
+	if f.chance(p.DropRate) {
+		f.count(faultDrop)
+		f.metrics.AddSpoolDepth(-1)
+		return
+	}
+	if f.chance(p.CorruptRate) {
+		f.count(faultCorrupt)
+		line = f.corrupt(line)
+	}
+	copies := 1
+	if f.chance(p.DuplicateRate) {
+		f.count(faultDuplicate)
+		f.metrics.AddSpoolDepth(1)
+		copies = 2
+	}
+	for range copies {
+		if p.ReorderWindow < 2 {
+			f.emit(ctx, line, write)
+			continue
+		}
+		f.batch = append(f.batch, line)
+		if len(f.batch) >= p.ReorderWindow {
+			f.flush(ctx, write)
+		}
+	}
+}
+
+// flush writes the lines held back for reordering, shuffled. It is called
+// when a batch fills up and when the input ends, so no line is held back for
+// good.
+func (f *faultInjector) flush(ctx context.Context, write func(string)) {
+	batch := f.batch
+	for i, j := range f.lines.Perm(len(batch)) {
+		if i != j {
+			f.count(faultReorder)
+		}
+		f.emit(ctx, batch[j], write)
+	}
+	f.batch = batch[:0]
+}
+
+// emit writes one line, first pausing the output if a pause is due and
+// delaying the line if it is picked
+func (f *faultInjector) emit(ctx context.Context, line string, write func(string)) {
+	p := f.policy
+	if !f.nextPause.IsZero() && !time.Now().Before(f.nextPause) {
+		f.count(faultPause)
+		log.Warn("Fault injection: pausing the output", "pause", p.Pause.String())
+		sleepCtx(ctx, p.Pause)
+		f.nextPause = time.Now().Add(jitter(f.pauses, p.PauseInterval))
+	}
+	if p.Delay > 0 && f.chance(p.DelayRate) {
+		f.count(faultDelay)
+		sleepCtx(ctx, time.Duration(1+f.lines.Int64N(int64(p.Delay))))
+	}
+	write(line)
+}
+
+// corrupt cuts a line short. Events are JSON objects, and no proper prefix of
+// a JSON object is valid JSON.
+func (f *faultInjector) corrupt(line string) string {
+	if len(line) < 2 {
+		return line + "{"
+	}
+	return line[:1+f.lines.IntN(len(line)-1)]
+}
+
+// killProviders SIGKILLs a provider at random intervals until the run's context
+// ends or the relay stops. A killed provider fails the run, so the restart
+// policy decides what happens next.
+func (f *faultInjector) killProviders(ctx context.Context, lp *livePipeline, relayDone <-chan struct{}) {
+	p := f.policy
+	if p.KillInterval == 0 {
+		return
+	}
+	rng := rand.New(rand.NewPCG(uint64(f.seed), 3))
+	for {
+		timer := time.NewTimer(jitter(rng, p.KillInterval))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-relayDone:
+			timer.Stop()
+			return
+		}
+
+		input, output := lp.providers()
+		target := output
+		if p.KillProvider == config.KillInput || (p.KillProvider == config.KillAny && rng.IntN(2) == 0) {
+			target = input
+		}
+		if target == nil || target.exited() {
+			continue
+		}
+		f.count(faultKill)
+		log.Warn("Fault injection: killing provider", "provider", target.role)
+		target.kill()
+	}
+}
+
+// chance picks a line with the given probability
+func (f *faultInjector) chance(rate float64) bool {
+	return rate > 0 && f.lines.Float64() < rate
+}
+
+func (f *faultInjector) count(fault string) {
+	f.mu.Lock()
+	f.counts[fault]++
+	f.mu.Unlock()
+	f.metrics.FaultInjected(fault)
+}
+
+// injected returns how many of each fault were injected
+func (f *faultInjector) injected() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := make(map[string]int64, len(f.counts))
+	for fault, n := range f.counts {
+		counts[fault] = n
+	}
+	return counts
+}
+
+// jitter returns a random duration averaging d, between d/2 and 3d/2
+func jitter(rng *rand.Rand, d time.Duration) time.Duration {
+	return d/2 + time.Duration(rng.Int64N(int64(d)))
+}
+
+// sleepCtx waits for d or until ctx ends
+func sleepCtx(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// faultTask relays count generated events into a JSONL file with the given
+// fault_injection settings
+func faultTask(t *testing.T, out string, count int, faults string) string {
+	t.Helper()
+	return fmt.Sprintf(`
+task "chaos" {
+  type = "providers"
+  fault_injection {
+    %s
+  }
+  input {
+    provider_ref = "builtin://generator"
+    config {
+      count    = %d
+      template = "{\"id\": [[.Seq]]}"
+    }
+  }
+  output {
+    provider_ref = "builtin://jsonl-file"
+    config {
+      path     = %q
+      truncate = true
+    }
+  }
+}`, faults, count, out)
+}
+
+func TestFaultInjectionIsRepeatable(t *testing.T) {
+	useTempStateStore(t)
+	store := useTempHistoryStore(t)
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	task := parseTask(t, faultTask(t, out, 200, `
+    seed              = 7
+    drop_percent      = 10
+    duplicate_percent = 10
+    corrupt_percent   = 10
+    reorder_window    = 5
+    delay             = "1ms"
+    delay_percent     = 5`))
+
+	run := func() (RunSummary, string) {
+		summary, err := runPipelineSummary(context.Background(), task, nil, nil, RunOptions{Batch: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(out)
+		return summary, string(data)
+	}
+	first, written := run()
+
+	faults := first.FaultsInjected
+	for _, fault := range []string{faultDrop, faultDuplicate, faultCorrupt, faultReorder, faultDelay} {
+		if faults[fault] == 0 {
+			t.Errorf("expected some %s faults, got %v", fault, faults)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(written, "\n"), "\n")
+	if want := 200 - faults[faultDrop] + faults[faultDuplicate]; int64(len(lines)) != want || first.EventsRelayed != want {
+		t.Fatalf("expected %d lines written, got %d (summary %+v)", want, len(lines), first)
+	}
+	invalid := 0
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			invalid++
+		}
+	}
+	// A corrupt line may also be duplicated
+	if int64(invalid) < faults[faultCorrupt] || int64(invalid) > 2*faults[faultCorrupt] {
+		t.Fatalf("expected %d corrupt lines, got %d", faults[faultCorrupt], invalid)
+	}
+
+	// The same seed over the same input injects the same faults
+	second, again := run()
+	if again != written || fmt.Sprint(second.FaultsInjected) != fmt.Sprint(faults) {
+		t.Fatalf("expected a repeat of the first run, got %v", second.FaultsInjected)
+	}
+
+	runs, err := store.List(task.Name)
+	if err != nil || len(runs) != 2 || runs[0].FaultsInjected[faultDrop] != faults[faultDrop] {
+		t.Fatalf("expected the faults in the run history, got %+v (err=%v)", runs, err)
+	}
+}
+
+func TestFaultInjectionKillsProvider(t *testing.T) {
+	useTempStateStore(t)
+	useTempHistoryStore(t)
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	task := parseTask(t, faultTask(t, out, 0, `
+    seed          = 1
+    kill_interval = "100ms"`))
+
+	summary, err := runPipelineSummary(context.Background(), task, nil, nil, RunOptions{Batch: true})
+	if err == nil || !strings.Contains(err.Error(), "output provider") {
+		t.Fatalf("expected the killed output provider to fail the run, got %v", err)
+	}
+	if summary.FaultsInjected[faultKill] != 1 || summary.ExitReason != exitProviderFailed {
+		t.Fatalf("expected one kill, got %+v", summary)
+	}
+}
@@ -0,0 +1,19 @@
+package executor
+
+import (
+	"context"
+	"io"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// RunFixture runs a task's pipeline once for `dstream test`: the relay reads
+// events in place of the input provider and, unless capture is nil, writes what
+// it relays to capture in place of the output provider. The run ends once the
+// events are relayed and the output has drained. It isn't recorded in the run
+// history.
+func RunFixture(ctx context.Context, task *config.TaskBlock, events io.Reader, capture io.Writer, opts RunOptions) (RunSummary, error) {
+	opts.inputStream, opts.outputStream, opts.ephemeral = events, capture, true
+	opts.Batch = true
+	return runPipelineSummary(ctx, task, nil, nil, opts)
+}
@@ -3,12 +3,17 @@ package executor
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/katasec/dstream/pkg/history"
 )
 
 // --- Test helper processes ---
@@ -115,10 +120,213 @@ func TestMain(m *testing.M) {
 		}
 		os.Exit(0)
 
+	case "lifecycle_records":
+		// Lifecycle helper: read the command envelope, report resources on stdout.
+		// init creates a queue; destroy deletes every resource it was told about.
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		var envelope struct {
+			Command   string `json:"command"`
+			Resources []struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			} `json:"resources"`
+			Plan *struct {
+				ResourceChanges []struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"resource_changes"`
+			} `json:"plan"`
+		}
+		json.Unmarshal(scanner.Bytes(), &envelope)
+		fmt.Fprintln(os.Stdout, `{"status":"ready"}`)
+		switch envelope.Command {
+		case "plan":
+			fmt.Fprintln(os.Stdout, `{"resource_changes":[{"action":"create","type":"queue","name":"cars"},{"action":"create","type":"queue","name":"persons"}]}`)
+		case "init":
+			if envelope.Plan != nil {
+				// Apply only the reviewed changes
+				for _, c := range envelope.Plan.ResourceChanges {
+					fmt.Fprintf(os.Stdout, `{"resource":{"type":%q,"name":%q},"action":"created"}`+"\n", c.Type, c.Name)
+				}
+				break
+			}
+			fmt.Fprintln(os.Stdout, `{"resource":{"type":"queue","name":"cars","id":"q-1"},"action":"created"}`)
+			fmt.Fprintln(os.Stdout, "created queue cars")
+		case "destroy":
+			for _, r := range envelope.Resources {
+				fmt.Fprintf(os.Stdout, `{"resource":{"type":%q,"name":%q},"action":"deleted"}`+"\n", r.Type, r.Name)
+			}
+		}
+		os.Exit(0)
+
+	case "lifecycle_order":
+		// Lifecycle helper: append "<command>:<side>" to $LIFECYCLE_LOG, fail if config says so
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		var envelope struct {
+			Command string `json:"command"`
+			Config  struct {
+				Side string `json:"side"`
+				Fail bool   `json:"fail"`
+			} `json:"config"`
+		}
+		json.Unmarshal(scanner.Bytes(), &envelope)
+		f, _ := os.OpenFile(os.Getenv("LIFECYCLE_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		fmt.Fprintf(f, "%s:%s\n", envelope.Command, envelope.Config.Side)
+		f.Close()
+		if envelope.Config.Fail {
+			fmt.Fprintln(os.Stdout, `{"status":"error","message":"cannot reach database"}`)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stdout, `{"status":"ready"}`)
+		os.Exit(0)
+
+	case "trace_context":
+		// Tracing helper: record the trace context received via env and envelope
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		var envelope struct {
+			Traceparent string `json:"traceparent"`
+		}
+		json.Unmarshal(scanner.Bytes(), &envelope)
+		f, _ := os.OpenFile(os.Getenv("TRACE_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		fmt.Fprintf(f, "%s %s\n", os.Getenv("TRACEPARENT"), envelope.Traceparent)
+		f.Close()
+		fmt.Fprintln(os.Stdout, `{"status":"ready"}`)
+		os.Exit(0)
+
+	case "drain", "reconfigure", "slow_ready", "read_stdin", "stall", "snapshot":
+		streamProvider(os.Getenv("TEST_PROVIDER_BEHAVIOR"))
+
 	default:
-		// Normal test runner
-		os.Exit(m.Run())
+		// Normal test runner; runs are recorded in a throwaway history
+		dir, err := os.MkdirTemp("", "dstream-history-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		historyStore = history.NewStore(dir)
+		code := m.Run()
+		os.RemoveAll(dir)
+		os.Exit(code)
+	}
+}
+
+// streamConfig is the config a stream helper reads from its envelope. Several
+// tasks in one test share a mode, so what differs between them is set here.
+type streamConfig struct {
+	Side   string `json:"side"`             // input or output
+	Label  string `json:"label"`            // prefixed to what the provider writes
+	Count  int    `json:"count"`            // the input exits 0 after this many events
+	Fail   bool   `json:"fail"`             // the input exits 3 after its first event
+	Delay  string `json:"delay"`            // slow_ready: how long to hold back the handshake
+	Rows   int    `json:"snapshot_rows"`    // snapshot: rows in the snapshot
+	FailAt int    `json:"snapshot_fail_at"` // snapshot: exit 3 after this row
+}
+
+// streamProvider is a provider that relays a stream of events, acting out one
+// of these modes:
+//
+//   - drain: the input emits events until SIGTERM, then flushes a few more and
+//     exits. The output appends what it receives to $DRAIN_LOG and records
+//     whether it saw end-of-stream or was terminated first.
+//   - reconfigure: drain, with an output that advertises reconfigure and takes
+//     the label of each reconfigure envelope
+//   - slow_ready: drain, holding back the handshake for delay
+//   - read_stdin: drain, with an input that reads its stdin to EOF before the
+//     handshake
+//   - stall: drain, with an output that stops reading once it is ready
+//   - snapshot: drain, with an input that answers the snapshot command with
+//     snapshot_rows rows and a checkpoint after each, resuming after the
+//     checkpoint it is given, and that first emits "from:" and the watermark
+//     when it is given one
+func streamProvider(mode string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	var envelope struct {
+		Command    string            `json:"command"`
+		Config     streamConfig      `json:"config"`
+		Checkpoint struct{ Row int } `json:"checkpoint"`
+		Watermark  json.RawMessage   `json:"watermark"`
+	}
+	json.Unmarshal(scanner.Bytes(), &envelope)
+	cfg := envelope.Config
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGTERM)
+
+	switch {
+	case mode == "slow_ready":
+		if delay, err := time.ParseDuration(cfg.Delay); err == nil {
+			time.Sleep(delay)
+		}
+	case mode == "read_stdin" && cfg.Side == "input":
+		for scanner.Scan() {
+		}
+	}
+	if mode == "reconfigure" && cfg.Side == "output" {
+		fmt.Fprintln(os.Stdout, `{"status":"ready","capabilities":["reconfigure"]}`)
+	} else {
+		fmt.Fprintln(os.Stdout, `{"status":"ready"}`)
+	}
+
+	if cfg.Side == "input" {
+		if mode == "snapshot" && envelope.Command == "snapshot" {
+			for i := envelope.Checkpoint.Row + 1; i <= cfg.Rows; i++ {
+				fmt.Fprintf(os.Stdout, "%ssnap-%d\n", cfg.Label, i)
+				fmt.Fprintf(os.Stdout, `{"snapshot":{"progress":{"done":%d,"total":%d},"checkpoint":{"row":%d}}}`+"\n", i, cfg.Rows, i)
+				if i == cfg.FailAt {
+					os.Exit(3)
+				}
+			}
+			fmt.Fprintf(os.Stdout, `{"snapshot":{"complete":true,"watermark":{"lsn":%d}}}`+"\n", cfg.Rows)
+			os.Exit(0)
+		}
+		if mode == "snapshot" && len(envelope.Watermark) > 0 {
+			fmt.Fprintf(os.Stdout, "%sfrom:%s\n", cfg.Label, envelope.Watermark)
+		}
+		if cfg.Fail {
+			fmt.Fprintln(os.Stdout, "event-1")
+			os.Exit(3)
+		}
+		for i := 1; ; i++ {
+			select {
+			case <-terminated:
+				for j := 1; j <= 3; j++ {
+					fmt.Fprintf(os.Stdout, "%sflushed-%d\n", cfg.Label, j)
+				}
+				os.Exit(0)
+			case <-time.After(20 * time.Millisecond):
+				fmt.Fprintf(os.Stdout, "%sevent-%d\n", cfg.Label, i)
+				if i == cfg.Count {
+					os.Exit(0)
+				}
+			}
+		}
+	}
+
+	if mode == "stall" {
+		time.Sleep(10 * time.Minute)
+	}
+	f, _ := os.OpenFile(os.Getenv("DRAIN_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	go func() {
+		<-terminated
+		fmt.Fprintln(f, "sigterm")
+		os.Exit(1)
+	}()
+	label := cfg.Label
+	for scanner.Scan() {
+		if mode == "reconfigure" && strings.HasPrefix(scanner.Text(), `{"command"`) {
+			envelope.Config = streamConfig{}
+			json.Unmarshal(scanner.Bytes(), &envelope)
+			label = envelope.Config.Label
+			fmt.Fprintln(f, envelope.Command)
+			continue
+		}
+		fmt.Fprintln(f, label+scanner.Text())
 	}
+	fmt.Fprintln(f, label+"eof")
+	os.Exit(0)
 }
 
 // helperCmd returns an exec.Cmd that re-invokes the test binary as a fake provider.
@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/history"
+	"github.com/katasec/dstream/pkg/state"
+)
+
+// Exit reasons recorded in run history
+const (
+	exitCompleted      = "completed"      // the providers finished on their own
+	exitStartupFailed  = "startup_failed" // resolution, start or handshake failed
+	exitProviderFailed = "provider_failed"
+	exitSignal         = "signal: " // followed by the signal name
+	exitMaxRuntime     = "max_runtime"
+)
+
+// historyStore records runs under ~/.dstream/history; nil disables history
+var historyStore = defaultHistoryStore()
+
+func defaultHistoryStore() *history.Store {
+	dir, err := history.DefaultDir()
+	if err != nil {
+		return nil
+	}
+	store := history.NewStore(dir)
+	store.SetRetention(history.Retention{MaxRuns: config.DefaultHistoryMaxRuns})
+	return store
+}
+
+// ConfigureHistory applies the history block from dstream.hcl
+func ConfigureHistory(block *config.HistoryBlock) error {
+	settings, err := block.Settings()
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		historyStore = nil
+		return nil
+	}
+	if historyStore != nil {
+		historyStore.SetRetention(history.Retention{MaxRuns: settings.MaxRuns, MaxAge: settings.MaxAge})
+	}
+	return nil
+}
+
+// newRunRecord starts the history record of a run with what is known up front
+func newRunRecord(task *config.TaskBlock, command string) *history.Run {
+	now := time.Now()
+	run := &history.Run{
+		ID:        history.NewRunID(now),
+		Task:      task.Name,
+		Command:   command,
+		StartedAt: now.UTC(),
+		Providers: make(map[string]history.ProviderInfo),
+	}
+	if hash, err := task.ConfigHash(); err == nil {
+		run.ConfigHash = hash
+	}
+	if task.Input != nil {
+		run.Providers["input"] = history.ProviderInfo{Ref: task.Input.ProviderRef, Path: task.Input.ProviderPath}
+	}
+	if task.Output != nil {
+		run.Providers["output"] = history.ProviderInfo{Ref: task.Output.ProviderRef, Path: task.Output.ProviderPath}
+	}
+	return run
+}
+
+// completeRun fills in a run record once the run has ended
+func completeRun(run *history.Run, reason string, runErr error, stats *relayStats, input, output *providerProcess) {
+	run.FinishedAt = time.Now().UTC()
+	run.ExitReason = reason
+	run.Status = history.StatusSucceeded
+	run.EventsRelayed = stats.relayed.Load()
+	run.EventsDropped = stats.dropped.Load()
+	run.BytesRelayed = stats.bytes.Load()
+	run.Restarts = health.Default.Task(run.Task).Restarts()
+
+	for _, p := range []*providerProcess{input, output} {
+		if p == nil {
+			continue
+		}
+		info := run.Providers[p.role]
+		if p.isStream() {
+			run.Providers[p.role] = history.ProviderInfo{Path: StdioEndpoint}
+			continue
+		}
+		if p.builtin != "" {
+			run.Providers[p.role] = history.ProviderInfo{Ref: p.builtin}
+			continue
+		}
+		info.Path = p.cmd.Path
+		if digest, err := state.FileDigest(p.cmd.Path); err == nil {
+			info.Digest = digest
+		}
+		run.Providers[p.role] = info
+	}
+
+	if runErr != nil {
+		run.Status = history.StatusFailed
+		run.Error = runErr.Error()
+		for _, p := range []*providerProcess{input, output} {
+			if p == nil {
+				continue
+			}
+			if tail := p.stderr.Tail(); len(tail) > 0 {
+				if run.StderrTail == nil {
+					run.StderrTail = make(map[string][]string)
+				}
+				run.StderrTail[p.role] = tail
+			}
+		}
+	}
+}
+
+// recordRun appends a completed run record to the history. Failing to record is
+// logged, never returned: history must not fail a run.
+func recordRun(run *history.Run) {
+	if historyStore == nil {
+		return
+	}
+	if err := historyStore.Append(*run); err != nil {
+		log.Warn("Failed to record run history", "task", run.Task, "error", err.Error())
+	}
+}
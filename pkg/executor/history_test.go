@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/history"
+)
+
+func useTempHistoryStore(t *testing.T) *history.Store {
+	t.Helper()
+	prev := historyStore
+	historyStore = history.NewStore(t.TempDir())
+	t.Cleanup(func() { historyStore = prev })
+	return historyStore
+}
+
+func TestRunIsRecordedInHistory(t *testing.T) {
+	useTempStateStore(t)
+	store := useTempHistoryStore(t)
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	task := helperTask(t, "audited", helperProvider{}, helperProvider{})
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(context.Background(), task, signals, nil, RunOptions{}) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(drainLog)
+		if strings.Count(string(data), "event-") >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no events relayed before deadline, log: %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	signals <- syscall.SIGINT
+	if err := <-done; err != nil {
+		t.Fatalf("pipeline returned error: %v", err)
+	}
+
+	runs, err := store.List("audited")
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one recorded run, got %d (err=%v)", len(runs), err)
+	}
+	run := runs[0]
+	if run.Status != history.StatusSucceeded || run.ExitReason != "signal: interrupt" {
+		t.Fatalf("unexpected outcome: status=%q reason=%q", run.Status, run.ExitReason)
+	}
+	if run.EventsRelayed < 3 || run.BytesRelayed == 0 {
+		t.Fatalf("relay counts not recorded: events=%d bytes=%d", run.EventsRelayed, run.BytesRelayed)
+	}
+	if run.ConfigHash == "" || run.Providers["input"].Digest == "" || run.Providers["output"].Path != os.Args[0] {
+		t.Fatalf("config and providers not recorded: %+v", run)
+	}
+	if !run.FinishedAt.After(run.StartedAt) {
+		t.Fatalf("finish %v is not after start %v", run.FinishedAt, run.StartedAt)
+	}
+}
+
+func TestFailedStartupIsRecordedInHistory(t *testing.T) {
+	useTempStateStore(t)
+	store := useTempHistoryStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "crash_with_stderr")
+
+	task := helperTask(t, "ordered", helperProvider{}, helperProvider{})
+	if err := runPipeline(context.Background(), task, make(chan os.Signal), nil, RunOptions{}); err == nil {
+		t.Fatal("expected the pipeline to fail")
+	}
+
+	runs, err := store.List(task.Name)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one recorded run, got %d (err=%v)", len(runs), err)
+	}
+	run := runs[0]
+	if run.Status != history.StatusFailed || run.ExitReason != exitStartupFailed {
+		t.Fatalf("unexpected outcome: status=%q reason=%q", run.Status, run.ExitReason)
+	}
+	if !strings.Contains(run.Error, "FATAL: out of memory") {
+		t.Fatalf("error does not carry the provider's stderr: %q", run.Error)
+	}
+}
@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// parseTask decodes a single task from HCL source, for tests that need config blocks
+func parseTask(t *testing.T, src string) *config.TaskBlock {
+	t.Helper()
+	var root config.RootHCL
+	if err := hclsimple.Decode("test.hcl", []byte(src), nil, &root); err != nil {
+		t.Fatalf("decode test config: %v", err)
+	}
+	if len(root.Tasks) != 1 {
+		t.Fatalf("expected one task in test config, got %d", len(root.Tasks))
+	}
+	return &root.Tasks[0]
+}
+
+// helperProvider is HCL added to one provider of a helperTask: Block goes in
+// the input or output block, Config in its config block after side
+type helperProvider struct {
+	Block, Config string
+}
+
+// helperTask builds a providers task whose input and output are both this test
+// binary, acting out $TEST_PROVIDER_BEHAVIOR with side = "input" or "output"
+func helperTask(t *testing.T, name string, input, output helperProvider) *config.TaskBlock {
+	t.Helper()
+	return parseTask(t, fmt.Sprintf(`
+task %q {
+  type = "providers"
+  input {
+    provider_path = %q
+    %s
+    config {
+      side = "input"
+      %s
+    }
+  }
+  output {
+    provider_path = %q
+    %s
+    config {
+      side = "output"
+      %s
+    }
+  }
+}`, name, os.Args[0], input.Block, input.Config, os.Args[0], output.Block, output.Config))
+}
+
+func readLifecycleLog(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read lifecycle log: %v", err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	useTempStateStore(t)
+	logPath := filepath.Join(t.TempDir(), "lifecycle.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "lifecycle_order")
+	t.Setenv("LIFECYCLE_LOG", logPath)
+
+	task := helperTask(t, "ordered", helperProvider{}, helperProvider{})
+	for _, command := range []string{"init", "status", "destroy"} {
+		if err := ExecuteProviderTaskWithCommand(task, command); err != nil {
+			t.Fatalf("%s failed: %v", command, err)
+		}
+	}
+
+	got := strings.Join(readLifecycleLog(t, logPath), " ")
+	want := "init:input init:output status:input status:output destroy:output destroy:input"
+	if got != want {
+		t.Fatalf("unexpected lifecycle order\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestLifecycleSkipAndFailureAttribution(t *testing.T) {
+	useTempStateStore(t)
+	logPath := filepath.Join(t.TempDir(), "lifecycle.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "lifecycle_order")
+	t.Setenv("LIFECYCLE_LOG", logPath)
+
+	// Input opted out, output fails: the error must name the output side
+	task := helperTask(t, "ordered", helperProvider{Block: "skip_lifecycle = true"}, helperProvider{Config: "fail = true"})
+	err := ExecuteProviderTaskWithCommand(task, "init")
+	if err == nil {
+		t.Fatal("expected init to fail")
+	}
+	if !strings.Contains(err.Error(), "output provider init failed") || !strings.Contains(err.Error(), "cannot reach database") {
+		t.Fatalf("expected error attributed to output provider, got: %v", err)
+	}
+
+	if got := readLifecycleLog(t, logPath); len(got) != 1 || got[0] != "init:output" {
+		t.Fatalf("expected only the output provider to run, got %v", got)
+	}
+}
+
+func TestLifecycleReadyTimeoutFromConfig(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "hang")
+
+	task := helperTask(t, "slow", helperProvider{Block: "skip_lifecycle = true"}, helperProvider{Block: `timeouts {
+      ready = "300ms"
+    }`})
+
+	start := time.Now()
+	err := ExecuteProviderTaskWithCommand(task, "status")
+	if err == nil || !strings.Contains(err.Error(), "timed out waiting for ready signal after 300ms") {
+		t.Fatalf("expected configured ready timeout, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("ready timeout took too long: %v", elapsed)
+	}
+}
@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/metrics"
+)
+
+// spoolDepth scrapes a task's spool depth from the default metrics registry
+func spoolDepth(t *testing.T, task string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Default.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	prefix := fmt.Sprintf("dstream_spool_depth{task=%q} ", task)
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix)
+		}
+	}
+	return ""
+}
+
+func TestSpoolDepthStaysUpWhileTheOutputStalls(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "stall")
+	task := parseTask(t, fmt.Sprintf(`
+task "stalled" {
+  type = "providers"
+  input {
+    provider_ref = "builtin://generator"
+    timeouts {
+      shutdown = "100ms"
+    }
+    config {
+      size = 4096
+    }
+  }
+  output {
+    provider_path = %q
+    timeouts {
+      shutdown = "100ms"
+    }
+    config {
+      side = "output"
+    }
+  }
+}`, os.Args[0]))
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(context.Background(), task, signals, nil, RunOptions{}) }()
+
+	// Once the output's stdin pipe is full the event being written stays in the
+	// spool, however often it is scraped
+	deadline := time.Now().Add(10 * time.Second)
+	for spoolDepth(t, "stalled") != "1" {
+		if time.Now().After(deadline) {
+			t.Fatal("spool depth did not rise while the output stalled")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for range 5 {
+		time.Sleep(20 * time.Millisecond)
+		if depth := spoolDepth(t, "stalled"); depth != "1" {
+			t.Fatalf("expected the spool depth to stay at 1 while stalled, got %s", depth)
+		}
+	}
+
+	signals <- syscall.SIGTERM
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("pipeline did not shut down")
+	}
+	if depth := spoolDepth(t, "stalled"); depth != "0" {
+		t.Fatalf("expected the spool depth to return to 0, got %s", depth)
+	}
+}
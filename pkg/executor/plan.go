@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/plan"
+	"github.com/katasec/dstream/pkg/tracing"
+)
+
+// PlanTask runs the plan command against a task's providers and collects the
+// resource changes they propose into a plan that can be rendered or saved.
+func PlanTask(task *config.TaskBlock) (*plan.Plan, error) {
+	if task.Type != "providers" {
+		return nil, fmt.Errorf("plan is only supported for provider tasks, task %q has type %q", task.Name, task.Type)
+	}
+
+	hash, err := task.ConfigHash()
+	if err != nil {
+		return nil, err
+	}
+	p := plan.New(task.Name, hash)
+
+	startedAt := time.Now()
+	ctx, span := startTaskSpan(context.Background(), task, "plan")
+	result, err := executeLifecycle(ctx, task, "plan", lifecycleOptions{})
+	tracing.End(span, err)
+	recordLastRun(task, "plan", startedAt, err)
+	if err != nil {
+		return nil, err
+	}
+
+	p.ResourceChanges = append(p.ResourceChanges, result.changes...)
+	return p, nil
+}
+
+// ApplyPlan runs init against a task's providers, passing each one only the
+// changes from a previously reviewed plan. The plan is rejected if the task's
+// config has changed since it was created.
+func ApplyPlan(task *config.TaskBlock, p *plan.Plan) error {
+	if p.Task != task.Name {
+		return fmt.Errorf("plan is for task %q, not %q", p.Task, task.Name)
+	}
+
+	hash, err := task.ConfigHash()
+	if err != nil {
+		return err
+	}
+	if hash != p.ConfigHash {
+		return fmt.Errorf("plan for task %q is stale: the task config has changed since the plan was created, run 'dstream plan' again", task.Name)
+	}
+
+	startedAt := time.Now()
+	ctx, span := startTaskSpan(context.Background(), task, "init")
+	_, err = executeLifecycle(ctx, task, "init", lifecycleOptions{plan: p})
+	tracing.End(span, err)
+	recordLastRun(task, "init", startedAt, err)
+	return err
+}
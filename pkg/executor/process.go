@@ -0,0 +1,224 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/builtin"
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/logging"
+	"github.com/katasec/dstream/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// providerProcess is a running provider child process.
+//
+// The process is waited on exactly once, by a goroutine started in startProvider;
+// everything else observes exit through done. stdout is an os.Pipe owned by us
+// rather than cmd.StdoutPipe, so lines written just before exit can still be read
+// after Wait has returned; it is closed when the reader reaches EOF, or by kill.
+type providerProcess struct {
+	role     string // "input" or "output"
+	name     string // "input-provider" or "output-provider", used in handshake errors
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   *bufio.Scanner
+	stdoutR  *os.File
+	stderr   *providerLog
+	timeouts config.Timeouts
+	started  time.Time
+
+	capabilities []string // advertised in the ready handshake, e.g. "reconfigure"
+
+	done chan struct{} // closed once the process has exited
+	err  error         // exit error, valid after done is closed
+
+	untracked chan struct{} // closed once metrics and health have seen the exit; see trackProvider
+
+	// Set for stdio endpoints, which stand in for a provider without a process;
+	// see stdio.go. interrupt is called in place of sending a signal.
+	interrupt  func()
+	finishOnce sync.Once
+
+	// Set for builtin providers, which run in-process but otherwise act like a
+	// child; see builtin.go. abort is called in place of SIGKILL.
+	builtin string
+	abort   func()
+}
+
+// isStream reports whether p is a stdio endpoint or fixture stream rather than
+// a provider, builtin or not
+func (p *providerProcess) isStream() bool {
+	return p.cmd == nil && p.builtin == ""
+}
+
+// startProvider launches a provider binary and sends it its command envelope.
+// stdin is left open; input providers should close it once the envelope is sent,
+// output providers keep it for the relayed data.
+//
+// When isolate is set the child gets its own process group, so a Ctrl-C in the
+// terminal reaches only DStream, which then stops the providers in order. A
+// builtin:// path starts a builtin provider in-process instead.
+func startProvider(ctx context.Context, task string, role string, path string, envelope string, timeouts config.Timeouts, isolate bool) (*providerProcess, error) {
+	if _, ok := builtin.Parse(path); ok {
+		return startBuiltin(ctx, task, role, path, envelope, timeouts)
+	}
+	p := &providerProcess{
+		role:     role,
+		name:     role + "-provider",
+		timeouts: timeouts,
+		done:     make(chan struct{}),
+		stderr:   newProviderLog(task, role),
+	}
+
+	p.cmd = exec.CommandContext(ctx, path)
+	// Providers log at our level and in our format, and join our trace
+	p.cmd.Env = append(append(os.Environ(), logging.ChildEnv()...), tracing.Env(ctx)...)
+	if isolate {
+		isolateProcessGroup(p.cmd)
+	}
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create %s stdin pipe: %w", p.name, err)
+	}
+	p.stdin = stdin
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create %s stdout pipe: %w", p.name, err)
+	}
+	p.cmd.Stdout = stdoutW
+	p.stdoutR = stdoutR
+	p.stdout = bufio.NewScanner(closeOnEOF{stdoutR})
+
+	// Provider logs are re-emitted through our logger, and the tail is kept for
+	// error messages
+	p.cmd.Stderr = p.stderr
+
+	p.started = time.Now()
+	if err := p.cmd.Start(); err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, fmt.Errorf("start %s: %w", p.name, err)
+	}
+	// The child holds its own copy of the write end; ours must be closed so that
+	// reads see EOF when the child exits.
+	stdoutW.Close()
+
+	go func() {
+		p.err = p.cmd.Wait()
+		p.stderr.Flush()
+		close(p.done)
+	}()
+
+	if _, err := fmt.Fprintln(p.stdin, envelope); err != nil {
+		p.kill()
+		return nil, fmt.Errorf("send %s config: %w", p.role, err)
+	}
+
+	return p, nil
+}
+
+// awaitReady waits for the provider's handshake within its ready timeout. The
+// handshake span starts when the process was started.
+func (p *providerProcess) awaitReady(ctx context.Context) (firstNonHandshakeLine string, err error) {
+	if p.isStream() {
+		return "", nil // stdio endpoints have no handshake
+	}
+	_, span := tracing.Start(ctx, "provider.handshake",
+		trace.WithTimestamp(p.started),
+		trace.WithAttributes(attribute.String("provider.role", p.role)))
+	defer func() { tracing.End(span, err) }()
+
+	ready, firstNonHandshakeLine, err := awaitHandshake(p.stdout, p.name, p.timeouts.Ready, p.done, p.stderr.Tail)
+	p.capabilities = ready.Capabilities
+	return firstNonHandshakeLine, err
+}
+
+// supports reports whether the provider advertised a capability in its handshake
+func (p *providerProcess) supports(capability string) bool {
+	return slices.Contains(p.capabilities, capability)
+}
+
+// exited reports whether the process has exited
+func (p *providerProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// signal sends a signal to the process if it is still running
+func (p *providerProcess) signal(sig os.Signal) {
+	if p.cmd == nil {
+		p.interrupt()
+		return
+	}
+	if p.cmd.Process != nil && !p.exited() {
+		p.cmd.Process.Signal(sig)
+	}
+}
+
+// kill force-stops the process and waits for it to be reaped. Its stdout is
+// closed too, in case a grandchild still holds the pipe open.
+func (p *providerProcess) kill() {
+	switch {
+	case p.abort != nil:
+		p.abort()
+	case p.cmd == nil:
+		p.interrupt()
+	case p.cmd.Process != nil && !p.exited():
+		p.cmd.Process.Kill()
+	}
+	<-p.done
+	if p.stdoutR != nil {
+		p.stdoutR.Close()
+	}
+}
+
+// waitExit waits up to timeout for the process to exit on its own
+func (p *providerProcess) waitExit(timeout time.Duration) bool {
+	select {
+	case <-p.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// stop sends SIGTERM and waits up to the shutdown timeout before force killing.
+// Returns true if the process exited within the grace period.
+func (p *providerProcess) stop() bool {
+	p.signal(syscall.SIGTERM)
+	if p.waitExit(p.timeouts.Shutdown) {
+		return true
+	}
+	log.Warn("Graceful shutdown timeout, force killing provider",
+		"provider", p.role, "timeout", p.timeouts.Shutdown.String())
+	p.kill()
+	return false
+}
+
+// closeOnEOF closes a pipe once it has been read to the end
+type closeOnEOF struct {
+	f *os.File
+}
+
+func (r closeOnEOF) Read(b []byte) (int, error) {
+	n, err := r.f.Read(b)
+	if err == io.EOF {
+		r.f.Close()
+	}
+	return n, err
+}
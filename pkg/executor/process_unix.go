@@ -0,0 +1,14 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// isolateProcessGroup starts the child in a new process group, out of reach of
+// signals the terminal sends to DStream's group
+func isolateProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package executor
+
+import "os/exec"
+
+// isolateProcessGroup is a no-op on Windows, where console Ctrl-C handling
+// differs and providers are stopped with Kill
+func isolateProcessGroup(cmd *exec.Cmd) {}
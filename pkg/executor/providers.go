@@ -5,18 +5,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/katasec/dstream/pkg/builtin"
 	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/control"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/metrics"
 	"github.com/katasec/dstream/pkg/orasfetch"
+	"github.com/katasec/dstream/pkg/plan"
+	"github.com/katasec/dstream/pkg/recording"
+	"github.com/katasec/dstream/pkg/state"
+	"github.com/katasec/dstream/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ExecuteProviderTask orchestrates independent input and output provider processes
@@ -28,253 +39,280 @@ func ExecuteProviderTask(task *config.TaskBlock) error {
 
 // ExecuteProviderTaskWithCommand orchestrates providers with a specific lifecycle command
 func ExecuteProviderTaskWithCommand(task *config.TaskBlock, command string) error {
-	// For lifecycle commands (init/plan/status/destroy), only the output provider runs.
-	// Input providers are data readers — they don't manage infrastructure.
-	if command != "run" {
-		return executeOutputProviderOnly(task, command)
-	}
-
-	return executeFullPipeline(task)
+	return executeProviderTask(task, command, RunOptions{})
 }
 
-// executeOutputProviderOnly runs only the output provider for lifecycle commands
-func executeOutputProviderOnly(task *config.TaskBlock, command string) error {
-	log.Info("Running lifecycle command on output provider only", "task", task.Name, "command", command)
-
-	outputPath, err := resolveProviderPath(task.Output)
-	if err != nil {
-		return fmt.Errorf("resolve output provider: %w", err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	outputCmd := exec.CommandContext(ctx, outputPath)
-	outputStdin, err := outputCmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("create output provider stdin pipe: %w", err)
-	}
-	outputStdout, err := outputCmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("create output provider stdout pipe: %w", err)
-	}
-
-	// Capture stderr during startup for diagnostics, then tee to os.Stderr
-	var stderrBuf bytes.Buffer
-	outputCmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
-
-	outputConfig, err := createCommandEnvelope(func() (string, error) {
-		return task.OutputConfigAsJSON()
-	}, command)
-	if err != nil {
-		return fmt.Errorf("create output command envelope: %w", err)
-	}
+func executeProviderTask(task *config.TaskBlock, command string, opts RunOptions) error {
+	startedAt := time.Now()
+	ctx, span := startTaskSpan(context.Background(), task, command)
 
-	log.Debug("Sending lifecycle command to output provider", "command", command, "config", outputConfig)
-
-	if err := outputCmd.Start(); err != nil {
-		return fmt.Errorf("start output provider: %w", err)
+	var err error
+	if command != "run" {
+		// Lifecycle commands (init/plan/status/destroy) go to both providers in turn
+		_, err = executeLifecycle(ctx, task, command, lifecycleOptions{})
+	} else {
+		err = executeFullPipeline(ctx, task, opts)
 	}
 
-	if _, err := fmt.Fprintln(outputStdin, outputConfig); err != nil {
-		return fmt.Errorf("send output config: %w", err)
-	}
-	outputStdin.Close()
+	tracing.End(span, err)
+	recordLastRun(task, command, startedAt, err)
+	return err
+}
 
-	// Wait for ready handshake, then forward remaining stdout to os.Stdout
-	scanner := bufio.NewScanner(outputStdout)
-	firstLine, err := waitForReady(scanner, "output-provider", 30*time.Second, outputCmd, &stderrBuf)
-	if err != nil {
-		outputCmd.Process.Kill()
-		return err
-	}
-	// If legacy provider returned a non-handshake line, print it
-	if firstLine != "" {
-		fmt.Fprintln(os.Stdout, firstLine)
-	}
-	// Forward remaining stdout
-	go func() {
-		for scanner.Scan() {
-			fmt.Fprintln(os.Stdout, scanner.Text())
-		}
-	}()
+// executeFullPipeline runs both input and output providers with data relay,
+// shutting them down when DStream receives SIGINT or SIGTERM
+func executeFullPipeline(ctx context.Context, task *config.TaskBlock, opts RunOptions) error {
+	// Listen for OS signals (SIGINT/SIGTERM) for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
-	if err := outputCmd.Wait(); err != nil {
-		return fmt.Errorf("output provider failed: %w", err)
-	}
+	return runPipeline(ctx, task, sigChan, nil, opts)
+}
 
-	log.Info("Lifecycle command completed successfully", "task", task.Name, "command", command)
-	return nil
+// runPipeline runs the pipeline until the providers finish or a signal arrives on
+// signals. The first signal starts a graceful shutdown, a second force kills.
+// Task definitions received on reloads are applied to the running providers;
+// see livePipeline.reload.
+func runPipeline(ctx context.Context, task *config.TaskBlock, signals <-chan os.Signal, reloads <-chan *config.TaskBlock, opts RunOptions) error {
+	_, err := runPipelineSummary(ctx, task, signals, reloads, opts)
+	return err
 }
 
-// executeFullPipeline runs both input and output providers with data relay
-func executeFullPipeline(task *config.TaskBlock) error {
+// runPipelineSummary is runPipeline, also returning what the run did
+func runPipelineSummary(ctx context.Context, task *config.TaskBlock, signals <-chan os.Signal, reloads <-chan *config.TaskBlock, opts RunOptions) (summary RunSummary, err error) {
 	log.Info("Starting provider orchestration", "task", task.Name)
 
-	// Resolve input provider binary path
-	inputPath, err := resolveProviderPath(task.Input)
-	if err != nil {
-		return fmt.Errorf("resolve input provider: %w", err)
-	}
-
-	// Resolve output provider binary path
-	outputPath, err := resolveProviderPath(task.Output)
-	if err != nil {
-		return fmt.Errorf("resolve output provider: %w", err)
-	}
-
-	log.Info("Provider paths resolved",
-		"input_provider", inputPath,
-		"output_provider", outputPath)
-
-	// Start input and output provider processes
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Launch input provider process
-	inputCmd := exec.CommandContext(ctx, inputPath)
-	inputStdout, err := inputCmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("create input provider stdout pipe: %w", err)
-	}
-	inputStdin, err := inputCmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("create input provider stdin pipe: %w", err)
-	}
-	// Capture stderr during startup for diagnostics, then tee to os.Stderr
-	var inputStderrBuf bytes.Buffer
-	inputCmd.Stderr = io.MultiWriter(os.Stderr, &inputStderrBuf)
+	// Every run, including one that fails to start, is recorded in the history
+	var input, output *providerProcess
+	var faults *faultInjector
+	stats := &relayStats{}
+	run := newRunRecord(task, "run")
+	reason := exitCompleted
+	defer func() {
+		completeRun(run, reason, err, stats, input, output)
+		if faults != nil {
+			run.FaultsInjected = faults.injected()
+			log.Info("Injected faults", "task", task.Name, "faults", run.FaultsInjected)
+		}
+		if !opts.ephemeral {
+			recordRun(run)
+		}
+		summary = newRunSummary(run)
+	}()
 
-	// Launch output provider process
-	outputCmd := exec.CommandContext(ctx, outputPath)
-	outputStdin, err := outputCmd.StdinPipe()
+	sequence, err := task.ShutdownSequenceOrDefault()
 	if err != nil {
-		return fmt.Errorf("create output provider stdin pipe: %w", err)
+		reason = exitStartupFailed
+		return summary, err
 	}
-	outputStdout, err := outputCmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("create output provider stdout pipe: %w", err)
+	if err = opts.validateEndpoints(); err != nil {
+		reason = exitStartupFailed
+		return summary, err
 	}
-	// Capture stderr during startup for diagnostics, then tee to os.Stderr
-	var outputStderrBuf bytes.Buffer
-	outputCmd.Stderr = io.MultiWriter(os.Stderr, &outputStderrBuf)
-
-	// Create command envelopes
-	inputConfig, err := createCommandEnvelope(func() (string, error) {
-		return task.InputConfigAsJSON()
-	}, "run")
+	boot, err := newBootstrap(task, opts)
 	if err != nil {
-		return fmt.Errorf("create input command envelope: %w", err)
+		reason = exitStartupFailed
+		return summary, err
 	}
-
-	outputConfig, err := createCommandEnvelope(func() (string, error) {
-		return task.OutputConfigAsJSON()
-	}, "run")
+	faultPolicy, err := task.FaultPolicy()
 	if err != nil {
-		return fmt.Errorf("create output command envelope: %w", err)
+		reason = exitStartupFailed
+		return summary, err
 	}
-
-	log.Debug("Sending 'run' command to both providers for data processing",
-		"input_config", inputConfig,
-		"output_config", outputConfig)
-
-	// Start input provider
-	if err := inputCmd.Start(); err != nil {
-		return fmt.Errorf("start input provider: %w", err)
-	}
-
-	// Start output provider
-	if err := outputCmd.Start(); err != nil {
-		inputCmd.Process.Kill() // Cleanup input process
-		return fmt.Errorf("start output provider: %w", err)
+	if faultPolicy != nil {
+		faults = newFaultInjector(task, faultPolicy)
 	}
 
-	// Send configuration to input provider
-	if _, err := fmt.Fprintln(inputStdin, inputConfig); err != nil {
-		return fmt.Errorf("send input config: %w", err)
+	var recorder *recording.Writer
+	if opts.Record != "" {
+		if recorder, err = recording.Create(opts.Record); err != nil {
+			reason = exitStartupFailed
+			return summary, err
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Warn("Failed to close recording", "file", opts.Record, "error", err.Error())
+			}
+			log.Info("Recorded relayed events", "file", opts.Record, "events", recorder.Count())
+		}()
 	}
-	inputStdin.Close() // Close input stdin after sending config
 
-	// Send configuration to output provider
-	if _, err := fmt.Fprintln(outputStdin, outputConfig); err != nil {
-		return fmt.Errorf("send output config: %w", err)
+	// Relayed events are offered to `dstream tap` clients through the control socket
+	tap := control.NewTap()
+	if !opts.ephemeral {
+		if srv := startControl(task, tap); srv != nil {
+			defer srv.Close()
+		}
 	}
 
-	// Wait for ready handshake from both providers before starting data relay
-	inputScanner := bufio.NewScanner(inputStdout)
-	outputScanner := bufio.NewScanner(outputStdout)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	inputFirstLine, err := waitForReady(inputScanner, "input-provider", 30*time.Second, inputCmd, &inputStderrBuf)
-	if err != nil {
-		gracefulShutdown(inputCmd, outputCmd)
-		return err
-	}
+	status := health.Default.Task(task.Name)
+	status.Starting()
 
-	outputFirstLine, err := waitForReady(outputScanner, "output-provider", 30*time.Second, outputCmd, &outputStderrBuf)
+	// The startup span covers resolution, process start and both handshakes
+	startupCtx, startupSpan := tracing.Start(ctx, "task.startup")
+	input, output, inputFirstLine, outputFirstLine, err := startPipeline(startupCtx, task, boot, opts)
+	tracing.End(startupSpan, err)
 	if err != nil {
-		gracefulShutdown(inputCmd, outputCmd)
-		return err
+		reason = exitStartupFailed
+		status.Failed(err)
+		return summary, err
 	}
 
-	// Forward output provider's non-handshake stdout to os.Stdout
-	go func() {
-		if outputFirstLine != "" {
-			fmt.Fprintln(os.Stdout, outputFirstLine)
-		}
-		for outputScanner.Scan() {
-			fmt.Fprintln(os.Stdout, outputScanner.Text())
-		}
-	}()
+	// relayDone is closed once the relay has stopped writing to the output provider
+	relayDone := make(chan struct{})
+	taskMetrics := metrics.Default.Task(task.Name)
+	sampleEvent := tracing.EventSampler()
 
 	// Setup graceful shutdown handling
 	var wg sync.WaitGroup
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 4)
+
+	// A reload can replace either provider while the pipeline runs; the relay and
+	// shutdown always work on the current ones
+	var live *livePipeline
+
+	// watch reports a provider that fails, unless a reload replaced it
+	watch := func(p *providerProcess) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-p.done
+			if p.err != nil && !live.isRetired(p) {
+				errChan <- fmt.Errorf("%s provider failed: %w%s", p.role, p.err, stderrContext(p.stderr.Tail()))
+			}
+		}()
+	}
+	// Forward output provider's non-handshake stdout to os.Stdout
+	forwardOutput := func(p *providerProcess, firstLine string) {
+		go func() {
+			if firstLine != "" {
+				fmt.Fprintln(os.Stdout, firstLine)
+			}
+			for p.stdout.Scan() {
+				fmt.Fprintln(os.Stdout, p.stdout.Text())
+			}
+		}()
+	}
+	live = newLivePipeline(ctx, task, boot, input, output, func(p *providerProcess, firstLine string) {
+		watch(p)
+		if p.role == "output" {
+			forwardOutput(p, firstLine)
+		}
+	})
+	defer func() { input, output = live.providers() }()
+	forwardOutput(output, outputFirstLine)
+	if opts.bench != nil {
+		defer opts.bench.watch(live)()
+	}
+	if faults != nil {
+		go faults.killProviders(ctx, live, relayDone)
+	}
 
 	// Goroutine to pump data from input to output
 	wg.Add(1)
-	go func() {
+	go func(in *providerProcess, firstLine string) {
 		defer wg.Done()
-		defer outputStdin.Close()
+		defer close(relayDone)
+		defer live.closeOutput()
+
+		// Once a write fails the rest of the input is still read, so the input
+		// provider doesn't block on a full pipe, but counted as dropped.
+		var writeErr, recordErr error
+		defer taskMetrics.SetSpoolDepth(0)
+		forward := func(line string) {
+			defer taskMetrics.AddSpoolDepth(-1)
+			if writeErr != nil {
+				stats.dropped.Add(1)
+				taskMetrics.EventDropped()
+				return
+			}
+			var span trace.Span
+			if sampleEvent() {
+				line, span = traceEvent(ctx, line)
+			}
+			status.WriteStarted()
+			writeStart := time.Now()
+			n, err := live.write(line)
+			if span != nil {
+				tracing.End(span, err)
+			}
+			if err != nil {
+				writeErr = err
+				status.WriteFailed()
+				stats.dropped.Add(1)
+				taskMetrics.EventDropped()
+				errChan <- fmt.Errorf("write to output provider: %w", writeErr)
+				return
+			}
+			stats.relayed.Add(1)
+			stats.bytes.Add(int64(n))
+			taskMetrics.EventRelayed(n, time.Since(writeStart))
+			status.EventRelayed(n)
+			if opts.bench != nil {
+				opts.bench.relayed(line, time.Since(writeStart))
+			}
 
-		// If input provider sent a non-handshake first line (legacy), forward it as data
-		if inputFirstLine != "" {
-			if _, err := fmt.Fprintln(outputStdin, inputFirstLine); err != nil {
-				errChan <- fmt.Errorf("write to output provider: %w", err)
+			if recorder != nil && recordErr == nil {
+				if recordErr = recorder.Record(writeStart, line); recordErr != nil {
+					log.Warn("Stopped recording relayed events", "file", opts.Record, "error", recordErr.Error())
+				}
+			}
+			tap.Publish(line)
+		}
+		// Each line read counts towards the spool depth until forward handles it. A
+		// fault_injection block puts its faults in between.
+		relay := func(line string) {
+			taskMetrics.AddSpoolDepth(1)
+			if faults != nil {
+				faults.relay(ctx, line, forward)
 				return
 			}
+			forward(line)
 		}
 
-		for inputScanner.Scan() {
-			line := inputScanner.Text()
-			log.Debug("Data flowing", "data", line)
+		for {
+			// If input provider sent a non-handshake first line (legacy), forward it as data
+			if firstLine != "" {
+				relay(firstLine)
+			}
 
-			// Forward data to output provider
-			if _, err := fmt.Fprintln(outputStdin, line); err != nil {
-				errChan <- fmt.Errorf("write to output provider: %w", err)
-				return
+			for in.stdout.Scan() {
+				line := in.stdout.Text()
+				if live.boot.handle(in, line) {
+					continue
+				}
+				log.Debug("Data flowing", "data", line)
+				relay(line)
+			}
+			if faults != nil {
+				faults.flush(ctx, forward)
 			}
-		}
 
-		if err := inputScanner.Err(); err != nil {
-			errChan <- fmt.Errorf("read from input provider: %w", err)
-		}
-	}()
+			// A closed pipe means the input was force killed during shutdown
+			if err := in.stdout.Err(); err != nil && !errors.Is(err, os.ErrClosed) && !live.isRetired(in) {
+				errChan <- fmt.Errorf("read from input provider: %w", err)
+			}
 
-	// Wait for both processes to complete
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		if err := inputCmd.Wait(); err != nil {
-			errChan <- fmt.Errorf("input provider failed: %w", err)
+			// A reload may have replaced the input, or the snapshot handed over to
+			// it, in which case carry on with the new one
+			next, ok, err := live.nextInput()
+			if err != nil {
+				errChan <- err
+			}
+			if !ok {
+				return
+			}
+			in, firstLine = next.p, next.firstLine
 		}
-	}()
+	}(input, inputFirstLine)
 
-	go func() {
-		defer wg.Done()
-		if err := outputCmd.Wait(); err != nil {
-			errChan <- fmt.Errorf("output provider failed: %w", err)
-		}
-	}()
+	// Wait for both processes to complete
+	watch(input)
+	watch(output)
 
 	// Wait for completion or error
 	go func() {
@@ -282,32 +320,189 @@ func executeFullPipeline(task *config.TaskBlock) error {
 		close(errChan)
 	}()
 
-	// Listen for OS signals (SIGINT/SIGTERM) for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(sigChan)
+	// stopProviders shuts the current providers down gracefully, force killing
+	// them if another signal arrives meanwhile
+	stopProviders := func() {
+		input, output = live.shutdown()
+		shutdownDone := make(chan struct{})
+		go func() {
+			defer close(shutdownDone)
+			gracefulShutdown(input, output, relayDone, stats, sequence)
+		}()
+		select {
+		case <-shutdownDone:
+		case sig := <-signals:
+			log.Warn("Received second signal, force killing providers", "signal", sig.String())
+			input.kill()
+			output.kill()
+			<-shutdownDone
+		}
+	}
 
-	// Wait for: provider error, clean completion, or OS signal
-	select {
-	case err := <-errChan:
-		if err != nil {
-			log.Error("Provider execution error", "error", err.Error())
-			gracefulShutdown(inputCmd, outputCmd)
-			return err
+	var maxRuntime <-chan time.Time
+	if opts.MaxRuntime > 0 {
+		timer := time.NewTimer(opts.MaxRuntime)
+		defer timer.Stop()
+		maxRuntime = timer.C
+	}
+
+	// Wait for: provider error, clean completion, OS signal or the max runtime.
+	// Reloads are applied in between, one at a time.
+	for {
+		select {
+		case err := <-errChan:
+			if err != nil {
+				reason = exitProviderFailed
+				log.Error("Provider execution error", "error", err.Error())
+				status.Failed(err)
+				input, output = live.shutdown()
+				gracefulShutdown(input, output, relayDone, stats, sequence)
+				return summary, err
+			}
+		case sig := <-signals:
+			reason = exitSignal + sig.String()
+			log.Info("Received signal, shutting down providers", "signal", sig.String())
+			status.Stopping()
+			stopProviders()
+		case <-maxRuntime:
+			reason = exitMaxRuntime
+			err := fmt.Errorf("%w after %s", ErrMaxRuntime, opts.MaxRuntime)
+			log.Warn("Task reached its max runtime, shutting down providers", "task", task.Name,
+				"max_runtime", opts.MaxRuntime.String())
+			status.Stopping()
+			stopProviders()
+			status.Failed(err)
+			return summary, err
+		case updated := <-reloads:
+			log.Info("Reloading task", "task", task.Name)
+			if err := live.reload(updated); err != nil {
+				reason = exitProviderFailed
+				log.Error("Reload failed", "task", task.Name, "error", err.Error())
+				status.Failed(err)
+				input, output = live.shutdown()
+				gracefulShutdown(input, output, relayDone, stats, sequence)
+				return summary, err
+			}
+			continue
+		}
+		break
+	}
+
+	status.Stopped(nil)
+	log.Info("Provider orchestration completed successfully", "task", task.Name,
+		"events_relayed", stats.relayed.Load())
+	return summary, nil
+}
+
+// startPipeline resolves and starts both providers and waits for their handshakes.
+// The first lines are non-handshake output from legacy providers, to be relayed.
+// opts may replace either provider with DStream's own stdin or stdout. A pending
+// bootstrap snapshot starts in place of the input.
+func startPipeline(ctx context.Context, task *config.TaskBlock, boot *bootstrap, opts RunOptions) (input, output *providerProcess, inputFirstLine, outputFirstLine string, err error) {
+	if (task.Input == nil && !opts.replaces("input")) || (task.Output == nil && !opts.replaces("output")) {
+		return nil, nil, "", "", fmt.Errorf("task %q must define both an input and an output block", task.Name)
+	}
+
+	// Start input provider and send its configuration. Both providers run in their
+	// own process group so that shutdown signals reach them in order, not all at once.
+	switch {
+	case boot.pending():
+		input, err = boot.start(ctx)
+	case opts.inputStream != nil:
+		input, err = startStream(task, "input", opts.inputStream, nil)
+	default:
+		input, err = startEndpoint(ctx, task, "input", opts.Input, boot.inputOptions()...)
+		if err == nil {
+			closeInputStdin(task, input)
+		}
+	}
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+
+	// Start output provider and send its configuration; stdin stays open for data
+	if opts.outputStream != nil {
+		output, err = startStream(task, "output", nil, opts.outputStream)
+	} else {
+		output, err = startEndpoint(ctx, task, "output", opts.Output)
+	}
+	if err != nil {
+		input.kill() // Cleanup input process
+		return nil, nil, "", "", err
+	}
+
+	for _, p := range []*providerProcess{input, output} {
+		trackProvider(task.Name, p)
+	}
+
+	// Wait for ready handshake from both providers before starting data relay
+	if inputFirstLine, err = input.awaitReady(ctx); err == nil {
+		providerReady(task.Name, input)
+		if outputFirstLine, err = output.awaitReady(ctx); err == nil {
+			providerReady(task.Name, output)
 		}
-	case sig := <-sigChan:
-		log.Info("Received signal, shutting down providers", "signal", sig.String())
-		gracefulShutdown(inputCmd, outputCmd)
+	}
+	if err != nil {
+		// Nothing has been relayed yet, so there is nothing to drain
+		noRelay := make(chan struct{})
+		close(noRelay)
+		gracefulShutdown(input, output, noRelay, &relayStats{}, config.ShutdownParallel)
+		return nil, nil, "", "", err
 	}
 
-	log.Info("Provider orchestration completed successfully", "task", task.Name)
-	return nil
+	return input, output, inputFirstLine, outputFirstLine, nil
+}
+
+// startEndpoint starts one side of a pipeline for the "run" command: the task's
+// provider for role, or DStream's stdin or stdout when endpoint is StdioEndpoint.
+// opts are added to the provider's command envelope.
+func startEndpoint(ctx context.Context, task *config.TaskBlock, role, endpoint string, opts ...envelopeOption) (*providerProcess, error) {
+	timeouts, err := task.TimeoutsFor(role)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == StdioEndpoint {
+		log.Info("Using DStream's own stdio in place of a provider", "provider", role)
+		if role == "input" {
+			return streamInput(task.Name, "stdin", os.Stdin, timeouts)
+		}
+		return streamOutput(task.Name, "stdout", os.Stdout, timeouts), nil
+	}
+
+	var block interface{} = task.Input
+	configJSON := task.InputConfigAsJSON
+	if role == "output" {
+		block, configJSON = task.Output, task.OutputConfigAsJSON
+	}
+
+	path, err := resolveProviderPath(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s provider: %w", role, err)
+	}
+	log.Info("Provider path resolved", "provider", role, "path", path)
+
+	envelope, err := createCommandEnvelope(configJSON, "run", append([]envelopeOption{withTraceContext(ctx)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("create %s command envelope: %w", role, err)
+	}
+	log.Debug("Sending 'run' command to provider", "provider", role, "config", envelope)
+
+	return startProvider(ctx, task.Name, role, path, envelope, timeouts, true)
+}
+
+// relayStats counts the events passing through the relay
+type relayStats struct {
+	relayed atomic.Int64 // written to the output provider
+	dropped atomic.Int64 // read from the input provider but not delivered
+	bytes   atomic.Int64 // bytes written to the output provider
 }
 
 // providerReadySignal represents the handshake response from a provider after config validation
 type providerReadySignal struct {
 	Status  string `json:"status"`
 	Message string `json:"message,omitempty"`
+	// Capabilities lists optional protocol features the provider supports
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // waitForReady reads the first line from a provider's stdout and checks for the ready handshake.
@@ -320,27 +515,13 @@ type providerReadySignal struct {
 // If the provider doesn't emit a handshake (legacy), the first line is returned as non-handshake
 // so the caller can decide what to do with it.
 func waitForReady(scanner *bufio.Scanner, providerName string, timeout time.Duration, cmd *exec.Cmd, stderrBuf *bytes.Buffer) (firstNonHandshakeLine string, err error) {
-	type readResult struct {
-		line string
-		ok   bool
-	}
-
-	readyCh := make(chan readResult, 1)
-	go func() {
-		if scanner.Scan() {
-			readyCh <- readResult{line: scanner.Text(), ok: true}
-		} else {
-			readyCh <- readResult{ok: false}
-		}
-	}()
-
 	// Monitor process exit in background by polling Process state.
 	// We do NOT call cmd.Wait() here — that must remain for the caller to use.
 	// Instead, we use os.Process.Signal(0) which returns an error if the process has exited.
-	exitCh := make(chan struct{}, 1)
+	exitCh := make(chan struct{})
 	stopPolling := make(chan struct{})
 	go func() {
-		// Poll every 50ms — fast enough to detect crashes near-instantly vs the 30s timeout
+		// Poll every 50ms — fast enough to catch a crash long before the configured ready timeout
 		ticker := time.NewTicker(50 * time.Millisecond)
 		defer ticker.Stop()
 		for {
@@ -349,12 +530,12 @@ func waitForReady(scanner *bufio.Scanner, providerName string, timeout time.Dura
 				return
 			case <-ticker.C:
 				if cmd.ProcessState != nil {
-					exitCh <- struct{}{}
+					close(exitCh)
 					return
 				}
 				// Signal(0) doesn't send a signal; it checks if the process is alive
 				if cmd.Process != nil && cmd.Process.Signal(syscall.Signal(0)) != nil {
-					exitCh <- struct{}{}
+					close(exitCh)
 					return
 				}
 			}
@@ -362,22 +543,44 @@ func waitForReady(scanner *bufio.Scanner, providerName string, timeout time.Dura
 	}()
 	defer close(stopPolling)
 
-	stderrContext := func() string {
+	stderrTail := func() []string {
 		if stderrBuf == nil || stderrBuf.Len() == 0 {
-			return ""
-		}
-		// Trim and limit stderr to last 10 lines for readability
-		lines := strings.Split(strings.TrimSpace(stderrBuf.String()), "\n")
-		if len(lines) > 10 {
-			lines = lines[len(lines)-10:]
+			return nil
 		}
-		return "\nProvider stderr:\n  " + strings.Join(lines, "\n  ")
+		return strings.Split(strings.TrimSpace(stderrBuf.String()), "\n")
 	}
+	_, firstNonHandshakeLine, err = awaitHandshake(scanner, providerName, timeout, exitCh, stderrTail)
+	return firstNonHandshakeLine, err
+}
 
-	select {
-	case result := <-readyCh:
+// awaitHandshake is the core of waitForReady for callers that already know when the
+// provider exits: exited must be closed once the process is gone. stderrTail
+// returns the provider's recent stderr lines for error messages. The ready signal
+// is returned so the caller can see what the provider advertised.
+func awaitHandshake(scanner *bufio.Scanner, providerName string, timeout time.Duration, exited <-chan struct{}, stderrTail func() []string) (ready providerReadySignal, firstNonHandshakeLine string, err error) {
+	type readResult struct {
+		line string
+		ok   bool
+	}
+
+	readyCh := make(chan readResult, 1)
+	go func() {
+		if scanner.Scan() {
+			readyCh <- readResult{line: scanner.Text(), ok: true}
+		} else {
+			readyCh <- readResult{ok: false}
+		}
+	}()
+
+	handleLine := func(result readResult) (providerReadySignal, string, error) {
 		if !result.ok {
-			return "", fmt.Errorf("%s: provider closed stdout without ready signal%s", providerName, stderrContext())
+			// stdout closing usually means the process is on its way out; give it a
+			// moment to exit so the stderr context includes its last words.
+			select {
+			case <-exited:
+			case <-time.After(200 * time.Millisecond):
+			}
+			return providerReadySignal{}, "", fmt.Errorf("%s: provider closed stdout without ready signal%s", providerName, stderrContext(stderrTail()))
 		}
 
 		var signal providerReadySignal
@@ -385,33 +588,59 @@ func waitForReady(scanner *bufio.Scanner, providerName string, timeout time.Dura
 			switch signal.Status {
 			case "ready":
 				log.Info("Provider ready", "provider", providerName)
-				return "", nil
+				return signal, "", nil
 			case "error":
-				return "", fmt.Errorf("%s startup failed: %s%s", providerName, signal.Message, stderrContext())
+				return providerReadySignal{}, "", fmt.Errorf("%s startup failed: %s%s", providerName, signal.Message, stderrContext(stderrTail()))
 			}
 		}
 
 		// Not a handshake line — legacy provider, return the line for the caller to handle
 		log.Debug("Provider did not emit handshake, treating as legacy", "provider", providerName)
-		return result.line, nil
+		return providerReadySignal{}, result.line, nil
+	}
+
+	select {
+	case result := <-readyCh:
+		return handleLine(result)
 
-	case <-exitCh:
+	case <-exited:
+		// A provider that reports an error and exits straight away may have its exit
+		// noticed before its last stdout line is read; prefer the line if it's there.
+		select {
+		case result := <-readyCh:
+			if result.ok {
+				return handleLine(result)
+			}
+		case <-time.After(50 * time.Millisecond):
+		}
 		// Provider process exited before sending handshake — immediate detection
-		return "", fmt.Errorf("%s: provider crashed during startup%s", providerName, stderrContext())
+		return providerReadySignal{}, "", fmt.Errorf("%s: provider crashed during startup%s", providerName, stderrContext(stderrTail()))
 
 	case <-time.After(timeout):
-		return "", fmt.Errorf("%s: timed out waiting for ready signal after %s%s", providerName, timeout, stderrContext())
+		return providerReadySignal{}, "", fmt.Errorf("%s: timed out waiting for ready signal after %s%s", providerName, timeout, stderrContext(stderrTail()))
 	}
 }
 
-// resolveProviderPath determines the binary path for a provider
-func resolveProviderPath(block interface{}) (string, error) {
+// resolveProviderPath determines the binary path for a provider. A builtin://
+// ref is returned as it is.
+func resolveProviderPath(ctx context.Context, block interface{}) (path string, err error) {
+	_, span := tracing.Start(ctx, "provider.resolve")
+	defer func() {
+		span.SetAttributes(attribute.String("provider.path", path))
+		tracing.End(span, err)
+	}()
+
 	switch b := block.(type) {
 	case *config.InputBlock:
+		span.SetAttributes(attribute.String("provider.role", "input"))
 		if b.ProviderPath != "" {
 			return b.ProviderPath, nil
 		}
 		if b.ProviderRef != "" {
+			span.SetAttributes(attribute.String("provider.ref", b.ProviderRef))
+			if _, ok := builtin.Parse(b.ProviderRef); ok {
+				return b.ProviderRef, nil // started in-process by startProvider
+			}
 			path, err := orasfetch.PullBinary(b.ProviderRef)
 			if err != nil {
 				return "", fmt.Errorf("pull input provider from %s: %w", b.ProviderRef, err)
@@ -421,10 +650,15 @@ func resolveProviderPath(block interface{}) (string, error) {
 		return "", fmt.Errorf("input block must specify provider_path or provider_ref")
 	
 	case *config.OutputBlock:
+		span.SetAttributes(attribute.String("provider.role", "output"))
 		if b.ProviderPath != "" {
 			return b.ProviderPath, nil
 		}
 		if b.ProviderRef != "" {
+			span.SetAttributes(attribute.String("provider.ref", b.ProviderRef))
+			if _, ok := builtin.Parse(b.ProviderRef); ok {
+				return b.ProviderRef, nil // started in-process by startProvider
+			}
 			path, err := orasfetch.PullBinary(b.ProviderRef)
 			if err != nil {
 				return "", fmt.Errorf("pull output provider from %s: %w", b.ProviderRef, err)
@@ -438,57 +672,102 @@ func resolveProviderPath(block interface{}) (string, error) {
 	}
 }
 
-// gracefulShutdown attempts to gracefully terminate both provider processes
-func gracefulShutdown(inputCmd, outputCmd *exec.Cmd) {
-	log.Info("Initiating graceful shutdown of providers")
+// gracefulShutdown stops both providers according to the task's shutdown sequence.
+//
+// With input_first the input is signalled alone and the relay keeps forwarding
+// whatever it flushes until its stdout closes. The relay then closes the output's
+// stdin, and the output is given its shutdown timeout to finish writing and exit
+// before SIGTERM and finally SIGKILL. With parallel both are signalled at once.
+func gracefulShutdown(input, output *providerProcess, relayDone <-chan struct{}, stats *relayStats, sequence string) {
+	log.Info("Initiating graceful shutdown of providers", "sequence", sequence)
+	started := time.Now()
+
+	if sequence == config.ShutdownInputFirst {
+		drainInputFirst(input, output, relayDone)
+	} else {
+		// Signal both, then give each its own grace period before force killing
+		var wg sync.WaitGroup
+		for _, p := range []*providerProcess{input, output} {
+			wg.Add(1)
+			go func(p *providerProcess) {
+				defer wg.Done()
+				p.stop()
+			}(p)
+		}
+		wg.Wait()
+	}
+
+	// Both processes are gone, so the relay sees EOF or a broken pipe and returns
+	<-relayDone
+
+	log.Info("Graceful shutdown completed",
+		"drain_duration", time.Since(started).Round(time.Millisecond).String(),
+		"events_relayed", stats.relayed.Load(),
+		"events_dropped", stats.dropped.Load())
+}
 
-	// Send SIGTERM to both processes
-	if inputCmd.Process != nil {
-		inputCmd.Process.Signal(syscall.SIGTERM)
+// drainInputFirst stops the input, lets the relay flush to the output, then waits
+// for the output to finish on end-of-stream before escalating.
+func drainInputFirst(input, output *providerProcess, relayDone <-chan struct{}) {
+	input.signal(syscall.SIGTERM)
+
+	drained := waitClosed(relayDone, input.timeouts.Shutdown)
+	if !drained {
+		log.Warn("Input provider did not close stdout before shutdown timeout, force killing",
+			"provider", input.role, "timeout", input.timeouts.Shutdown.String())
+		input.kill()
+		drained = waitClosed(relayDone, output.timeouts.Shutdown)
 	}
-	if outputCmd.Process != nil {
-		outputCmd.Process.Signal(syscall.SIGTERM)
+
+	// The relay closes the output's stdin when it returns, signalling end-of-stream
+	if drained && output.waitExit(output.timeouts.Shutdown) {
+		log.Debug("Output provider finished after end-of-stream")
+	} else {
+		log.Warn("Output provider did not finish after end-of-stream, stopping it",
+			"provider", output.role, "timeout", output.timeouts.Shutdown.String())
+		output.stop()
 	}
 
-	// Wait for graceful shutdown with timeout
-	done := make(chan bool, 2)
-	
-	go func() {
-		inputCmd.Wait()
-		done <- true
-	}()
-	
-	go func() {
-		outputCmd.Wait()
-		done <- true
-	}()
+	// The input may have closed stdout without exiting
+	input.stop()
+}
 
-	// Wait for both processes or timeout
-	timeout := time.After(10 * time.Second)
-	shutdownCount := 0
+// waitClosed waits up to timeout for ch to be closed
+func waitClosed(ch <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
 
-	for shutdownCount < 2 {
-		select {
-		case <-done:
-			shutdownCount++
-		case <-timeout:
-			log.Warn("Graceful shutdown timeout, force killing providers")
-			if inputCmd.Process != nil {
-				inputCmd.Process.Kill()
-			}
-			if outputCmd.Process != nil {
-				outputCmd.Process.Kill()
-			}
-			return
+// envelopeOption adds an optional field to a command envelope
+type envelopeOption func(envelope map[string]interface{})
+
+// withResources passes the resources recorded in state for a provider, so lifecycle
+// commands can act on what was actually created rather than what the config says now.
+func withResources(resources []state.Resource) envelopeOption {
+	return func(envelope map[string]interface{}) {
+		if len(resources) > 0 {
+			envelope["resources"] = resources
 		}
 	}
+}
 
-	log.Info("Graceful shutdown completed")
+// withPlan passes the reviewed changes a provider should apply, and nothing else
+func withPlan(changes []plan.ResourceChange) envelopeOption {
+	return func(envelope map[string]interface{}) {
+		if changes == nil {
+			changes = []plan.ResourceChange{}
+		}
+		envelope["plan"] = map[string]interface{}{"resource_changes": changes}
+	}
 }
 
 // createCommandEnvelope wraps a provider config JSON with a command header
 // This implements the command envelope pattern from DESIGN_NOTES_VERB_ROUTING.md
-func createCommandEnvelope(configFunc func() (string, error), command string) (string, error) {
+func createCommandEnvelope(configFunc func() (string, error), command string, opts ...envelopeOption) (string, error) {
 	// Get the original config JSON
 	configJSON, err := configFunc()
 	if err != nil {
@@ -506,6 +785,9 @@ func createCommandEnvelope(configFunc func() (string, error), command string) (s
 		"command": command,
 		"config":  config,
 	}
+	for _, opt := range opts {
+		opt(envelope)
+	}
 
 	// Marshal the envelope back to JSON
 	envelopeJSON, err := json.Marshal(envelope)
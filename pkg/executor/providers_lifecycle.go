@@ -0,0 +1,243 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/plan"
+	"github.com/katasec/dstream/pkg/state"
+	"github.com/katasec/dstream/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// lifecycleOptions carries optional inputs to a lifecycle command
+type lifecycleOptions struct {
+	plan *plan.Plan // init only: apply just the changes from a reviewed plan
+}
+
+// lifecycleResult is what providers reported while running a lifecycle command
+type lifecycleResult struct {
+	changes  []plan.ResourceChange
+	outcomes []providerOutcome
+}
+
+// providerOutcome records how one provider fared during a lifecycle command
+type providerOutcome struct {
+	role     string
+	skipped  bool
+	duration time.Duration
+	err      error
+}
+
+// providerSpec describes one side of a provider task
+type providerSpec struct {
+	role          string      // "input" or "output"
+	block         interface{} // *config.InputBlock or *config.OutputBlock, for resolveProviderPath
+	configJSON    func() (string, error)
+	skipLifecycle bool
+}
+
+// taskProviders returns the task's providers in pipeline order (input, then output)
+func taskProviders(task *config.TaskBlock) []providerSpec {
+	var specs []providerSpec
+	if task.Input != nil {
+		specs = append(specs, providerSpec{
+			role:          "input",
+			block:         task.Input,
+			configJSON:    task.InputConfigAsJSON,
+			skipLifecycle: task.Input.SkipLifecycle,
+		})
+	}
+	if task.Output != nil {
+		specs = append(specs, providerSpec{
+			role:          "output",
+			block:         task.Output,
+			configJSON:    task.OutputConfigAsJSON,
+			skipLifecycle: task.Output.SkipLifecycle,
+		})
+	}
+	return specs
+}
+
+// lifecycleOrder returns the providers in the order a command should reach them.
+// init builds from the source outwards (input, then output) and destroy tears down
+// in reverse, so the output never points at infrastructure that no longer exists.
+func lifecycleOrder(specs []providerSpec, command string) []providerSpec {
+	if command != "destroy" {
+		return specs
+	}
+	reversed := make([]providerSpec, len(specs))
+	for i, s := range specs {
+		reversed[len(specs)-1-i] = s
+	}
+	return reversed
+}
+
+// executeLifecycle runs a lifecycle command (init/plan/status/destroy) against each
+// of the task's providers in turn and aggregates what they report.
+//
+// init stops at the first failing provider, since later providers usually depend on
+// what earlier ones create. destroy, plan and status carry on to the remaining
+// providers so a single failure doesn't hide the state of the other side.
+func executeLifecycle(ctx context.Context, task *config.TaskBlock, command string, opts lifecycleOptions) (*lifecycleResult, error) {
+	result := &lifecycleResult{}
+	paths := make(map[string]string)
+	var errs []error
+
+	for _, spec := range lifecycleOrder(taskProviders(task), command) {
+		if spec.skipLifecycle {
+			log.Info("Skipping lifecycle command for provider", "task", task.Name, "command", command,
+				"provider", spec.role, "reason", "skip_lifecycle = true")
+			result.outcomes = append(result.outcomes, providerOutcome{role: spec.role, skipped: true})
+			continue
+		}
+
+		started := time.Now()
+		providerCtx, span := tracing.Start(ctx, "provider."+command,
+			trace.WithAttributes(attribute.String("provider.role", spec.role)))
+		path, changes, err := runLifecycleProvider(providerCtx, task, spec, command, opts)
+		tracing.End(span, err)
+		result.outcomes = append(result.outcomes, providerOutcome{role: spec.role, duration: time.Since(started), err: err})
+		result.changes = append(result.changes, changes...)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s provider %s failed: %w", spec.role, command, err))
+			if command == "init" {
+				break
+			}
+			continue
+		}
+		paths[spec.role] = path
+	}
+
+	logLifecycleSummary(task, command, result.outcomes)
+
+	if len(errs) > 0 {
+		return result, errors.Join(errs...)
+	}
+
+	if command == "init" {
+		if err := recordInit(task, paths); err != nil {
+			log.Warn("Failed to update task state", "task", task.Name, "error", err.Error())
+		}
+	}
+
+	log.Info("Lifecycle command completed successfully", "task", task.Name, "command", command)
+	return result, nil
+}
+
+// logLifecycleSummary reports one line per provider so failures are attributable
+func logLifecycleSummary(task *config.TaskBlock, command string, outcomes []providerOutcome) {
+	for _, o := range outcomes {
+		switch {
+		case o.skipped:
+			log.Info("Lifecycle result", "task", task.Name, "command", command, "provider", o.role, "result", "skipped")
+		case o.err != nil:
+			log.Error("Lifecycle result", "task", task.Name, "command", command, "provider", o.role,
+				"result", "failed", "duration", o.duration.Round(time.Millisecond).String())
+		default:
+			log.Info("Lifecycle result", "task", task.Name, "command", command, "provider", o.role,
+				"result", "succeeded", "duration", o.duration.Round(time.Millisecond).String())
+		}
+	}
+}
+
+// runLifecycleProvider runs one provider with a lifecycle command and collects the
+// resource records and proposed changes it prints. Returns the resolved binary path.
+func runLifecycleProvider(ctx context.Context, task *config.TaskBlock, spec providerSpec, command string, opts lifecycleOptions) (string, []plan.ResourceChange, error) {
+	log.Info("Running lifecycle command", "task", task.Name, "command", command, "provider", spec.role)
+
+	path, err := resolveProviderPath(ctx, spec.block)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve %s provider: %w", spec.role, err)
+	}
+
+	timeouts, err := task.TimeoutsFor(spec.role)
+	if err != nil {
+		return path, nil, err
+	}
+
+	// Tell the provider which resources it reported previously, so destroy can
+	// clean up everything it created even if the config has changed since.
+	st, err := stateStore.LoadOrNew(task.Name)
+	if err != nil {
+		return path, nil, err
+	}
+
+	envelopeOpts := []envelopeOption{withResources(st.ResourcesFor(spec.role)), withTraceContext(ctx)}
+	if opts.plan != nil {
+		envelopeOpts = append(envelopeOpts, withPlan(opts.plan.ChangesFor(spec.role)))
+	}
+
+	envelope, err := createCommandEnvelope(spec.configJSON, command, envelopeOpts...)
+	if err != nil {
+		return path, nil, fmt.Errorf("create %s command envelope: %w", spec.role, err)
+	}
+
+	log.Debug("Sending lifecycle command to provider", "provider", spec.role, "command", command, "config", envelope)
+
+	// The lifecycle timeout bounds the whole command; the process is killed when it expires
+	ctx, cancel := context.WithTimeout(ctx, timeouts.Lifecycle)
+	defer cancel()
+
+	proc, err := startProvider(ctx, task.Name, spec.role, path, envelope, timeouts, false)
+	if err != nil {
+		return path, nil, err
+	}
+	proc.stdin.Close()
+
+	firstLine, err := proc.awaitReady(ctx)
+	if err != nil {
+		proc.kill()
+		return path, nil, err
+	}
+
+	// Collect resource records and proposed changes, forward everything else to os.Stdout.
+	// stdout reaches EOF once the provider exits, so nothing it printed is lost.
+	var records []*state.Record
+	var changes []plan.ResourceChange
+	handleLine := func(line string) {
+		if rec, ok := state.ParseRecord(line); ok {
+			log.Info("Provider reported resource", "provider", spec.role, "action", rec.Action,
+				"type", rec.Resource.Type, "name", rec.Resource.Name)
+			records = append(records, rec)
+			return
+		}
+		if proposed, ok := plan.ParseLine(line); ok {
+			for _, c := range proposed {
+				c.Provider = spec.role
+				changes = append(changes, c)
+			}
+			return
+		}
+		fmt.Fprintln(os.Stdout, line)
+	}
+	// If legacy provider returned a non-handshake line, handle it like any other
+	if firstLine != "" {
+		handleLine(firstLine)
+	}
+	for proc.stdout.Scan() {
+		handleLine(proc.stdout.Text())
+	}
+
+	<-proc.done
+	var waitErr error
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		waitErr = fmt.Errorf("%s did not finish %s within lifecycle timeout %s", proc.name, command, timeouts.Lifecycle)
+	case proc.err != nil:
+		waitErr = fmt.Errorf("%s exited: %w%s", proc.name, proc.err, stderrContext(proc.stderr.Tail()))
+	}
+
+	// Record resources even if the provider failed part-way: anything it reported
+	// creating exists now and must be known to a later destroy.
+	if err := recordResources(task, spec.role, records); err != nil {
+		log.Warn("Failed to update task state", "task", task.Name, "error", err.Error())
+	}
+	return path, changes, waitErr
+}
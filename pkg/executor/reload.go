@@ -0,0 +1,404 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/metrics"
+)
+
+// capabilityReconfigure is advertised in the ready handshake by providers that
+// accept a "reconfigure" command envelope on stdin while they run
+const capabilityReconfigure = "reconfigure"
+
+// livePipeline holds the providers of a running pipeline. A reload can replace
+// either of them while the other keeps running: writes to the output pause while
+// it is swapped, and the relay carries on with the new input once the old one
+// has drained.
+type livePipeline struct {
+	ctx  context.Context
+	boot *bootstrap // nil unless the task has a bootstrap block
+
+	// started is called for every provider a reload starts, once it is ready
+	started func(p *providerProcess, firstLine string)
+
+	mu         sync.Mutex
+	task       *config.TaskBlock // the definition the running providers were started from
+	input      *providerProcess
+	output     *providerProcess
+	retired    map[*providerProcess]bool // replaced on purpose, so their exit is not a failure
+	swap       chan inputSwap            // set while the input is being replaced
+	inputEnded bool                      // the relay has finished reading input
+	stopping   bool                      // the pipeline is shutting down
+
+	// writeMu is held for every write to the output's stdin, and while the output
+	// is replaced or reconfigured
+	writeMu sync.Mutex
+}
+
+// inputSwap hands the relay the input that replaced the one it was reading. p is
+// nil when the replacement failed to start.
+type inputSwap struct {
+	p         *providerProcess
+	firstLine string
+}
+
+func newLivePipeline(ctx context.Context, task *config.TaskBlock, boot *bootstrap, input, output *providerProcess, started func(*providerProcess, string)) *livePipeline {
+	return &livePipeline{
+		ctx:     ctx,
+		boot:    boot,
+		task:    task,
+		started: started,
+		input:   input,
+		output:  output,
+		retired: make(map[*providerProcess]bool),
+	}
+}
+
+// providers returns the current input and output
+func (lp *livePipeline) providers() (input, output *providerProcess) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	return lp.input, lp.output
+}
+
+// shutdown marks the pipeline as shutting down and returns the providers to stop
+func (lp *livePipeline) shutdown() (input, output *providerProcess) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.stopping = true
+	return lp.input, lp.output
+}
+
+// isRetired reports whether p was replaced by a reload
+func (lp *livePipeline) isRetired(p *providerProcess) bool {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	return lp.retired[p]
+}
+
+// write sends one line to the current output
+func (lp *livePipeline) write(line string) (int, error) {
+	lp.writeMu.Lock()
+	defer lp.writeMu.Unlock()
+	return fmt.Fprintln(lp.output.stdin, line)
+}
+
+// closeOutput signals end-of-stream to the current output
+func (lp *livePipeline) closeOutput() {
+	lp.writeMu.Lock()
+	defer lp.writeMu.Unlock()
+	lp.output.stdin.Close()
+}
+
+// nextInput is called by the relay when its input reaches EOF. If a reload is
+// replacing the input it waits for the new one, and a completed snapshot hands
+// over to the input; otherwise the input has ended.
+func (lp *livePipeline) nextInput() (inputSwap, bool, error) {
+	lp.mu.Lock()
+	if snapshot := lp.input; lp.boot.snapshotting(snapshot) {
+		lp.mu.Unlock()
+		return lp.handOver(snapshot)
+	}
+	swap := lp.swap
+	lp.swap = nil
+	if swap == nil {
+		lp.inputEnded = true
+	}
+	lp.mu.Unlock()
+	if swap == nil {
+		return inputSwap{}, false, nil
+	}
+	next := <-swap
+	return next, next.p != nil, nil
+}
+
+// reload brings the running providers in line with a new definition of the
+// task. Each provider whose config changed is sent a reconfigure envelope if it
+// advertised support, or else restarted on its own; unchanged ones are left
+// alone. An error means the pipeline lost a provider and cannot go on.
+func (lp *livePipeline) reload(task *config.TaskBlock) error {
+	lp.mu.Lock()
+	current := lp.task
+	lp.mu.Unlock()
+	for _, role := range []string{"input", "output"} {
+		change, err := diffProvider(current, task, role)
+		if err != nil {
+			return err
+		}
+		if change == providerUnchanged {
+			continue
+		}
+
+		lp.mu.Lock()
+		p := lp.output
+		if role == "input" {
+			p = lp.input
+		}
+		ended := lp.inputEnded
+		lp.mu.Unlock()
+
+		switch {
+		case p.isStream():
+			log.Warn("Provider config changed, but DStream's stdio stands in for it", "provider", role)
+			continue
+		case ended:
+			log.Info("Provider config changed after the input finished, not reloading", "provider", role)
+			continue
+		case lp.boot.snapshotting(p):
+			log.Info("Input config changed during the snapshot, applying it once the snapshot completes", "provider", role)
+			continue
+		case change == providerConfigChanged && p.supports(capabilityReconfigure) &&
+			(role == "output" || inputReconfigurable(current)):
+			err = lp.reconfigure(p, task)
+		case role == "input":
+			err = lp.replaceInput(task)
+		default:
+			err = lp.replaceOutput(task)
+		}
+		if err != nil {
+			return fmt.Errorf("reload %s provider: %w", role, err)
+		}
+	}
+	lp.mu.Lock()
+	lp.task = task
+	lp.mu.Unlock()
+	return nil
+}
+
+// reconfigure sends a running provider its new config
+func (lp *livePipeline) reconfigure(p *providerProcess, task *config.TaskBlock) error {
+	configJSON := task.InputConfigAsJSON
+	if p.role == "output" {
+		configJSON = task.OutputConfigAsJSON
+	}
+	envelope, err := createCommandEnvelope(configJSON, "reconfigure", withTraceContext(lp.ctx))
+	if err != nil {
+		return fmt.Errorf("create %s command envelope: %w", p.role, err)
+	}
+
+	// The output's stdin also carries events, so the envelope goes between two of them
+	if p.role == "output" {
+		lp.writeMu.Lock()
+		defer lp.writeMu.Unlock()
+	}
+	if _, err := fmt.Fprintln(p.stdin, envelope); err != nil {
+		return fmt.Errorf("send reconfigure: %w", err)
+	}
+	log.Info("Sent new config to provider", "provider", p.role)
+	return nil
+}
+
+// replaceInput stops the input, letting the relay drain what it flushes, and
+// starts a new one from task. The output keeps running throughout.
+func (lp *livePipeline) replaceInput(task *config.TaskBlock) error {
+	lp.mu.Lock()
+	// nextInput reads swap and sets inputEnded under the same lock, so a new
+	// input is only started while the relay will still pick it up
+	if lp.inputEnded {
+		lp.mu.Unlock()
+		log.Info("Provider config changed after the input finished, not reloading", "provider", "input")
+		return nil
+	}
+	old := lp.input
+	swap := make(chan inputSwap, 1)
+	lp.retired[old] = true
+	lp.swap = swap
+	lp.mu.Unlock()
+
+	log.Info("Restarting provider with its new config", "provider", old.role)
+	old.stop()
+	old.awaitUntracked()
+
+	next, firstLine, err := lp.start(task, "input")
+	if err == nil {
+		lp.mu.Lock()
+		lp.input = next
+		lp.mu.Unlock()
+	}
+	swap <- inputSwap{p: next, firstLine: firstLine}
+	return err
+}
+
+// replaceOutput ends the output's stream, waits for it to finish writing what it
+// has, and starts a new one from task. Events from the input wait in the relay
+// meanwhile.
+func (lp *livePipeline) replaceOutput(task *config.TaskBlock) error {
+	lp.writeMu.Lock()
+	defer lp.writeMu.Unlock()
+
+	lp.mu.Lock()
+	old := lp.output
+	lp.retired[old] = true
+	lp.mu.Unlock()
+
+	log.Info("Restarting provider with its new config", "provider", old.role)
+	old.stdin.Close()
+	if !old.waitExit(old.timeouts.Shutdown) {
+		log.Warn("Output provider did not finish after end-of-stream, stopping it",
+			"provider", old.role, "timeout", old.timeouts.Shutdown.String())
+		old.stop()
+	}
+	old.awaitUntracked()
+
+	next, _, err := lp.start(task, "output")
+	if err != nil {
+		return err
+	}
+	lp.mu.Lock()
+	lp.output = next
+	lp.mu.Unlock()
+	return nil
+}
+
+// start launches a provider from task in place of one a reload replaced
+func (lp *livePipeline) start(task *config.TaskBlock, role string) (*providerProcess, string, error) {
+	metrics.Default.Task(task.Name).ProviderRestarted(role)
+	health.Default.Task(task.Name).ProviderRestarted(role)
+	return lp.launch(task, role)
+}
+
+// launch starts a provider from task and waits for its handshake. The input
+// streams from the snapshot's watermark, if there was one.
+func (lp *livePipeline) launch(task *config.TaskBlock, role string) (*providerProcess, string, error) {
+	var opts []envelopeOption
+	if role == "input" {
+		opts = lp.boot.inputOptions()
+	}
+	p, err := startEndpoint(lp.ctx, task, role, "", opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	closeInputStdin(task, p)
+	trackProvider(task.Name, p)
+
+	firstLine, err := p.awaitReady(lp.ctx)
+	if err != nil {
+		p.kill()
+		return nil, "", err
+	}
+	providerReady(task.Name, p)
+	lp.started(p, firstLine)
+	return p, firstLine, nil
+}
+
+// providerChange is how a new task definition affects one provider
+type providerChange int
+
+const (
+	providerUnchanged providerChange = iota
+	// providerConfigChanged means only the config block changed, which a provider
+	// that supports reconfigure can take while running
+	providerConfigChanged
+	// providerReplaced means the provider binary, reference or timeouts changed,
+	// so it has to be restarted
+	providerReplaced
+)
+
+// diffProvider compares one provider between two definitions of a task
+func diffProvider(old, updated *config.TaskBlock, role string) (providerChange, error) {
+	oldIdentity, oldConfig, err := providerDefinition(old, role)
+	if err != nil {
+		return providerUnchanged, err
+	}
+	newIdentity, newConfig, err := providerDefinition(updated, role)
+	if err != nil {
+		return providerUnchanged, err
+	}
+	switch {
+	case oldIdentity != newIdentity:
+		return providerReplaced, nil
+	case oldConfig != newConfig:
+		return providerConfigChanged, nil
+	}
+	return providerUnchanged, nil
+}
+
+// providerDefinition renders what identifies a provider and its config
+func providerDefinition(task *config.TaskBlock, role string) (identity, configJSON string, err error) {
+	timeouts, err := task.TimeoutsFor(role)
+	if err != nil {
+		return "", "", err
+	}
+	var ident struct {
+		Provider, ProviderPath, ProviderRef string
+		Timeouts                            config.Timeouts
+		Reconfigure                         bool
+	}
+	ident.Timeouts = timeouts
+	if role == "input" {
+		if task.Input != nil {
+			ident.Provider, ident.ProviderPath, ident.ProviderRef = task.Input.Provider, task.Input.ProviderPath, task.Input.ProviderRef
+			ident.Reconfigure = task.Input.Reconfigure
+		}
+		configJSON, err = task.InputConfigAsJSON()
+	} else {
+		if task.Output != nil {
+			ident.Provider, ident.ProviderPath, ident.ProviderRef = task.Output.Provider, task.Output.ProviderPath, task.Output.ProviderRef
+		}
+		configJSON, err = task.OutputConfigAsJSON()
+	}
+	if err != nil {
+		return "", "", err
+	}
+	encoded, _ := json.Marshal(ident)
+	return string(encoded), configJSON, nil
+}
+
+// trackProvider registers a started provider process with metrics and health
+func trackProvider(task string, p *providerProcess) {
+	if p.isStream() {
+		return
+	}
+	taskMetrics := metrics.Default.Task(task)
+	status := health.Default.Task(task)
+	pid := 0 // builtins share our process, whose usage isn't theirs
+	if p.cmd != nil {
+		pid = p.cmd.Process.Pid
+		taskMetrics.TrackProcess(p.role, pid)
+	}
+	status.ProviderStarted(p.role, pid)
+	p.untracked = make(chan struct{})
+	go func() {
+		defer close(p.untracked)
+		<-p.done
+		taskMetrics.UntrackProcess(p.role)
+		status.ProviderExited(p.role, p.err)
+	}()
+}
+
+// awaitUntracked waits until a provider's exit has been recorded, so that its
+// replacement isn't untracked in its place
+func (p *providerProcess) awaitUntracked() {
+	<-p.done
+	if p.untracked != nil {
+		<-p.untracked
+	}
+}
+
+// closeInputStdin closes an input's stdin once its envelope is sent, so that
+// an input reading stdin to EOF gets on with its handshake. An input block with
+// reconfigure = true keeps it open for reconfigure envelopes instead. Outputs
+// keep stdin open for the relayed data either way.
+func closeInputStdin(task *config.TaskBlock, p *providerProcess) {
+	if p.role == "input" && !p.isStream() && !inputReconfigurable(task) {
+		p.stdin.Close()
+	}
+}
+
+// inputReconfigurable reports whether the task's input block opted into
+// reconfigure envelopes
+func inputReconfigurable(task *config.TaskBlock) bool {
+	return task.Input != nil && task.Input.Reconfigure
+}
+
+// providerReady records a completed handshake
+func providerReady(task string, p *providerProcess) {
+	metrics.Default.Task(task).HandshakeCompleted(p.role, time.Since(p.started))
+	health.Default.Task(task).ProviderReady(p.role)
+}
@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// reloadPipeline runs task with providers acting out behavior, hands it updated
+// once a few events are through, and stops it once the updated providers have
+// relayed events. It returns the output's log.
+func reloadPipeline(t *testing.T, behavior string, task, updated *config.TaskBlock, updatedMarker string) []string {
+	t.Helper()
+	useTempStateStore(t)
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", behavior)
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	signals := make(chan os.Signal, 1)
+	reloads := make(chan *config.TaskBlock, 1)
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(context.Background(), task, signals, reloads, RunOptions{}) }()
+
+	waitForLog := func(marker string, count int) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			data, _ := os.ReadFile(drainLog)
+			if strings.Count(string(data), marker) >= count {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%q not seen before deadline, log: %q", marker, data)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitForLog("event-", 3)
+	reloads <- updated
+	waitForLog(updatedMarker, 3)
+	signals <- syscall.SIGTERM
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("pipeline returned error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("pipeline did not shut down")
+	}
+	data, err := os.ReadFile(drainLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+// checkEventsInOrder checks each input's events arrived once each and in order.
+// Events are told apart by the input's label; the updated output's "b:" is ignored.
+func checkEventsInOrder(t *testing.T, lines []string) {
+	t.Helper()
+	last := map[string]int{}
+	for _, line := range lines {
+		line = strings.TrimPrefix(line, "b:")
+		i := strings.Index(line, "event-")
+		if i < 0 {
+			continue
+		}
+		var n int
+		fmt.Sscanf(line[i:], "event-%d", &n)
+		if input := line[:i]; n != last[input]+1 {
+			t.Fatalf("expected event-%d from input %q, got %q in %v", last[input]+1, input, line, lines)
+		}
+		last[line[:i]] = n
+	}
+}
+
+func TestReloadRestartsOnlyTheChangedOutput(t *testing.T) {
+	lines := reloadPipeline(t, "drain",
+		helperTask(t, "reloaded", helperProvider{}, helperProvider{}),
+		helperTask(t, "reloaded", helperProvider{}, helperProvider{Config: `label = "b:"`}), "b:event-")
+
+	// The old output saw end-of-stream before the new one took over from the next
+	// event, and the input carried on throughout
+	joined := strings.Join(lines, " ")
+	if strings.Count(joined, "eof") != 2 || !strings.Contains(joined, " eof b:event-") {
+		t.Fatalf("expected the old output to finish before the new one received events, got %v", lines)
+	}
+	if tail := strings.Join(lines[len(lines)-4:], " "); tail != "b:flushed-1 b:flushed-2 b:flushed-3 b:eof" {
+		t.Fatalf("expected the shutdown to drain into the new output, got %v", lines)
+	}
+	checkEventsInOrder(t, lines)
+}
+
+func TestReloadReconfiguresOutputInPlace(t *testing.T) {
+	lines := reloadPipeline(t, "reconfigure",
+		helperTask(t, "reloaded", helperProvider{}, helperProvider{}),
+		helperTask(t, "reloaded", helperProvider{}, helperProvider{Config: `label = "b:"`}), "b:event-")
+
+	joined := strings.Join(lines, " ")
+	if strings.Count(joined, "reconfigure") != 1 || strings.Count(joined, "eof") != 1 {
+		t.Fatalf("expected one reconfigure and a single end-of-stream, got %v", lines)
+	}
+	if tail := strings.Join(lines[len(lines)-4:], " "); tail != "b:flushed-1 b:flushed-2 b:flushed-3 b:eof" {
+		t.Fatalf("expected the reconfigured output to see the rest of the stream, got %v", lines)
+	}
+	checkEventsInOrder(t, lines)
+}
+
+func TestReloadRestartsOnlyTheChangedInput(t *testing.T) {
+	lines := reloadPipeline(t, "drain",
+		helperTask(t, "reloaded", helperProvider{}, helperProvider{}),
+		helperTask(t, "reloaded", helperProvider{Config: `label = "y:"`}, helperProvider{}), "y:event-")
+
+	// The old input flushed into the same output before the new one started
+	joined := strings.Join(lines, " ")
+	if !strings.Contains(joined, "flushed-3 y:event-1 ") {
+		t.Fatalf("expected the old input to drain before the new one started, got %v", lines)
+	}
+	if strings.Count(joined, "eof") != 1 {
+		t.Fatalf("expected the output to keep running, got %v", lines)
+	}
+	checkEventsInOrder(t, lines)
+}
+
+func TestInputStdinClosesAfterEnvelope(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "read_stdin")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	// An input that reads stdin to EOF before its handshake gets EOF right after
+	// the envelope
+	timeouts := `timeouts {
+      ready    = "500ms"
+      shutdown = "100ms"
+    }`
+	input := helperProvider{Block: timeouts, Config: "count = 3"}
+	summary, err := runPipelineSummary(context.Background(), helperTask(t, "eof", input, helperProvider{}), nil, nil, RunOptions{Batch: true})
+	if err != nil || summary.EventsRelayed != 3 {
+		t.Fatalf("expected the input to get EOF and relay its events, got %+v (err=%v)", summary, err)
+	}
+
+	// Opting into reconfigure envelopes keeps its stdin open
+	input.Block = "reconfigure = true\n" + timeouts
+	_, err = runPipelineSummary(context.Background(), helperTask(t, "eof", input, helperProvider{}), nil, nil, RunOptions{Batch: true})
+	if err == nil || !strings.Contains(err.Error(), "timed out waiting for ready signal") {
+		t.Fatalf("expected stdin to stay open for a reconfigurable input, got %v", err)
+	}
+}
+
+func TestReplaceInputAfterTheInputEnded(t *testing.T) {
+	task := helperTask(t, "reloaded", helperProvider{}, helperProvider{})
+	input := &providerProcess{role: "input"}
+	lp := newLivePipeline(context.Background(), task, nil, input, nil, nil)
+	if _, more, err := lp.nextInput(); more || err != nil {
+		t.Fatalf("expected the input to end, got more=%v err=%v", more, err)
+	}
+
+	if err := lp.replaceInput(task); err != nil {
+		t.Fatal(err)
+	}
+	if lp.swap != nil || lp.retired[input] || lp.input != input {
+		t.Fatal("expected no replacement once the relay stopped reading input")
+	}
+}
+
+func TestDiffProvider(t *testing.T) {
+	base := helperTask(t, "reloaded", helperProvider{}, helperProvider{})
+	for _, tc := range []struct {
+		name    string
+		updated *config.TaskBlock
+		input   providerChange
+		output  providerChange
+	}{
+		{"same", helperTask(t, "reloaded", helperProvider{}, helperProvider{}), providerUnchanged, providerUnchanged},
+		{"output config", helperTask(t, "reloaded", helperProvider{}, helperProvider{Config: `label = "b:"`}), providerUnchanged, providerConfigChanged},
+		{"input config", helperTask(t, "reloaded", helperProvider{Config: `label = "y:"`}, helperProvider{}), providerConfigChanged, providerUnchanged},
+		{"timeouts", helperTask(t, "reloaded", helperProvider{Block: `timeouts {
+      shutdown = "1s"
+    }`}, helperProvider{}), providerReplaced, providerUnchanged},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for role, want := range map[string]providerChange{"input": tc.input, "output": tc.output} {
+				got, err := diffProvider(base, tc.updated, role)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s: got %d, want %d", role, got, want)
+				}
+			}
+		})
+	}
+}
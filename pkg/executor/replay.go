@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/recording"
+	"github.com/katasec/dstream/pkg/tracing"
+)
+
+// ReplayOptions control how a recording is fed to an output provider
+type ReplayOptions struct {
+	// Speed scales the recorded gaps between events: 1 keeps the original timing,
+	// 2 replays twice as fast, and 0 sends events as fast as the provider takes them
+	Speed float64
+	// From and To limit the replay to events recorded within that range; a zero
+	// time leaves that end open
+	From, To time.Time
+	// Limit stops the replay after this many events; 0 replays them all
+	Limit int
+}
+
+// ReplayTask feeds a file written by `run --record` into the task's output
+// provider only. The input provider is not started.
+func ReplayTask(task *config.TaskBlock, path string, opts ReplayOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open recording: %w", err)
+	}
+	defer f.Close()
+
+	ctx, span := startTaskSpan(context.Background(), task, "replay")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	err = replay(ctx, task, f, opts, sigChan)
+	tracing.End(span, err)
+	return err
+}
+
+// replay runs the output provider and writes the recording to it. A signal stops
+// the replay early; the provider is then given end-of-stream as usual.
+func replay(ctx context.Context, task *config.TaskBlock, r io.Reader, opts ReplayOptions, signals <-chan os.Signal) error {
+	if task.Output == nil {
+		return fmt.Errorf("task %q must define an output block", task.Name)
+	}
+	if opts.Speed < 0 {
+		return fmt.Errorf("replay speed must not be negative, got %v", opts.Speed)
+	}
+
+	output, err := startEndpoint(ctx, task, "output", "")
+	if err != nil {
+		return err
+	}
+	firstLine, err := output.awaitReady(ctx)
+	if err != nil {
+		output.kill()
+		return err
+	}
+
+	// Forward output provider's non-handshake stdout to os.Stdout
+	go func() {
+		if firstLine != "" {
+			fmt.Fprintln(os.Stdout, firstLine)
+		}
+		for output.stdout.Scan() {
+			fmt.Fprintln(os.Stdout, output.stdout.Text())
+		}
+	}()
+
+	log.Info("Replaying recording into output provider", "task", task.Name, "speed", opts.Speed)
+	started := time.Now()
+	sent, feedErr := feedRecording(output, recording.NewReader(r), opts, signals)
+	output.stdin.Close()
+
+	// End-of-stream lets the provider flush and exit on its own
+	if !output.waitExit(output.timeouts.Shutdown) {
+		log.Warn("Output provider did not finish after end-of-stream, stopping it", "provider", output.role)
+		output.stop()
+	}
+	log.Info("Replay finished", "task", task.Name, "events", sent,
+		"duration", time.Since(started).Round(time.Millisecond).String())
+
+	if feedErr != nil {
+		return feedErr
+	}
+	if output.err != nil {
+		return fmt.Errorf("output provider failed: %w%s", output.err, stderrContext(output.stderr.Tail()))
+	}
+	return nil
+}
+
+// feedRecording writes the selected entries to the provider's stdin, pacing them
+// by their recorded timestamps. It returns how many events were sent.
+func feedRecording(output *providerProcess, rec *recording.Reader, opts ReplayOptions, signals <-chan os.Signal) (int, error) {
+	var prev time.Time
+	sent := 0
+	for opts.Limit == 0 || sent < opts.Limit {
+		entry, err := rec.Next()
+		if errors.Is(err, io.EOF) {
+			return sent, nil
+		}
+		if err != nil {
+			return sent, err
+		}
+		if !opts.From.IsZero() && entry.Time.Before(opts.From) {
+			continue
+		}
+		if !opts.To.IsZero() && entry.Time.After(opts.To) {
+			return sent, nil
+		}
+
+		var wait <-chan time.Time
+		if opts.Speed > 0 && !prev.IsZero() {
+			if gap := entry.Time.Sub(prev); gap > 0 {
+				wait = time.After(time.Duration(float64(gap) / opts.Speed))
+			}
+		}
+		prev = entry.Time
+		if wait != nil {
+			select {
+			case <-wait:
+			case sig := <-signals:
+				log.Info("Received signal, stopping replay", "signal", sig.String())
+				return sent, nil
+			case <-output.done:
+				return sent, fmt.Errorf("output provider exited during replay (%v)%s", exitStatus(output.err), stderrContext(output.stderr.Tail()))
+			}
+		} else {
+			select {
+			case sig := <-signals:
+				log.Info("Received signal, stopping replay", "signal", sig.String())
+				return sent, nil
+			default:
+			}
+		}
+
+		if _, err := fmt.Fprintln(output.stdin, entry.Line); err != nil {
+			return sent, fmt.Errorf("write to output provider: %w%s", err, stderrContext(output.stderr.Tail()))
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// exitStatus describes how a process exited
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
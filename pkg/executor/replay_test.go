@@ -0,0 +1,105 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/recording"
+)
+
+func TestRunRecordsRelayedLines(t *testing.T) {
+	useTempStateStore(t)
+	dir := t.TempDir()
+	drainLog := filepath.Join(dir, "drain.log")
+	recordPath := filepath.Join(dir, "events.jsonl")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(context.Background(), task, signals, nil, RunOptions{Record: recordPath}) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(drainLog)
+		if strings.Count(string(data), "event-") >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no events relayed before deadline, log: %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	signals <- syscall.SIGINT
+	if err := <-done; err != nil {
+		t.Fatalf("pipeline returned error: %v", err)
+	}
+
+	f, err := os.Open(recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := recording.NewReader(f)
+	var prev time.Time
+	for i := 1; i <= 3; i++ {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		if e.Line != fmt.Sprintf("event-%d", i) || e.Time.Before(prev) {
+			t.Fatalf("entry %d: unexpected %+v", i, e)
+		}
+		prev = e.Time
+	}
+}
+
+func TestReplayFiltersAndLimits(t *testing.T) {
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	base := time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&b, "{\"ts\":%q,\"line\":\"event-%d\"}\n", base.Add(time.Duration(i)*time.Minute).Format(time.RFC3339), i)
+	}
+
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	opts := ReplayOptions{From: base.Add(3 * time.Minute), To: base.Add(8 * time.Minute), Limit: 4}
+	if err := replay(context.Background(), task, strings.NewReader(b.String()), opts, make(chan os.Signal)); err != nil {
+		t.Fatalf("replay returned error: %v", err)
+	}
+
+	data, _ := os.ReadFile(drainLog)
+	if got, want := string(data), "event-3\nevent-4\nevent-5\nevent-6\neof\n"; got != want {
+		t.Fatalf("output received %q, want %q", got, want)
+	}
+}
+
+func TestReplayKeepsScaledTiming(t *testing.T) {
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	// Two seconds of recorded gaps replayed at 10x take about 200ms
+	base := time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)
+	src := fmt.Sprintf("{\"ts\":%q,\"line\":\"a\"}\n{\"ts\":%q,\"line\":\"b\"}\n{\"ts\":%q,\"line\":\"c\"}\n",
+		base.Format(time.RFC3339), base.Add(time.Second).Format(time.RFC3339), base.Add(2*time.Second).Format(time.RFC3339))
+
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	started := time.Now()
+	if err := replay(context.Background(), task, strings.NewReader(src), ReplayOptions{Speed: 10}, make(chan os.Signal)); err != nil {
+		t.Fatalf("replay returned error: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Fatalf("replay at 10x took %v, want about 200ms", elapsed)
+	}
+}
@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// runScheduled runs a task each time its schedule fires until it is asked to
+// stop. Each run is a batch run; a run still going when the next one is due is
+// handled as the schedule's overlap policy says. A failed run is recorded and
+// the task waits for the next one.
+func (s *Supervisor) runScheduled(t *supervisedTask, policy config.RestartPolicy, sched *config.SchedulePolicy) error {
+	var running chan error // set while a run is going
+	queued := false
+	for {
+		if running == nil && queued {
+			queued = false
+			running = s.startScheduledRun(t, policy)
+		}
+
+		next := sched.Next(time.Now())
+		s.mu.Lock()
+		t.nextRun = next
+		if running == nil && t.state != TaskStopping {
+			t.state = TaskScheduled
+		}
+		name := t.task.Name
+		s.mu.Unlock()
+		if running == nil {
+			log.Info("Next scheduled run", "task", name, "at", next.Format(time.RFC3339))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-t.stop:
+			timer.Stop()
+			if running != nil {
+				// The stop signal has gone to the running pipeline
+				return <-running
+			}
+			return nil
+		case err := <-running:
+			timer.Stop()
+			running = nil
+			s.mu.Lock()
+			t.err = err
+			s.mu.Unlock()
+		case <-timer.C:
+			switch {
+			case running == nil:
+				running = s.startScheduledRun(t, policy)
+			case sched.Overlap == config.OverlapQueue:
+				log.Info("Scheduled run is due while the last one is running, queuing it", "task", name)
+				queued = true
+			case sched.Overlap == config.OverlapReplace:
+				log.Info("Scheduled run is due while the last one is running, replacing it", "task", name)
+				queued = true
+				select {
+				case t.signals <- syscall.SIGTERM:
+				default:
+				}
+			default:
+				log.Warn("Scheduled run is due while the last one is running, skipping it", "task", name)
+			}
+		}
+	}
+}
+
+// startScheduledRun starts one run of a scheduled task and returns a channel
+// that receives its result, or nil if the task is stopping
+func (s *Supervisor) startScheduledRun(t *supervisedTask, policy config.RestartPolicy) chan error {
+	// A signal left from replacing the last run must not stop this one; one
+	// sent to stop the task comes after t.stop is closed
+	select {
+	case <-t.signals:
+	default:
+	}
+	if t.stopping() {
+		return nil
+	}
+	s.setState(t, TaskRunning)
+	s.mu.Lock()
+	name := t.task.Name
+	s.mu.Unlock()
+	log.Info("Starting scheduled run", "task", name)
+
+	done := make(chan error, 1)
+	go func() { done <- s.run(t, policy) }()
+	return done
+}
@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsInputBeforeOutput(t *testing.T) {
+	useTempStateStore(t)
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	task := helperTask(t, "draining", helperProvider{}, helperProvider{})
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(context.Background(), task, signals, nil, RunOptions{}) }()
+
+	// Let a few events through before asking DStream to stop
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(drainLog)
+		if strings.Count(string(data), "event-") >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no events relayed before deadline, log: %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	signals <- syscall.SIGINT
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("pipeline returned error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("pipeline did not shut down")
+	}
+
+	data, err := os.ReadFile(drainLog)
+	if err != nil {
+		t.Fatalf("read drain log: %v", err)
+	}
+	lines := strings.Fields(string(data))
+	tail := strings.Join(lines[len(lines)-4:], " ")
+	if tail != "flushed-1 flushed-2 flushed-3 eof" {
+		t.Fatalf("expected the input's flushed events and end-of-stream to reach the output, got: %v", lines)
+	}
+	if strings.Contains(string(data), "sigterm") {
+		t.Fatalf("output was terminated before it finished: %v", lines)
+	}
+}
@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/katasec/dstream/pkg/builtin"
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/state"
+)
+
+// providerState describes a provider as it is configured right now.
+// path is the resolved binary; when empty or builtin the digest is left blank.
+func providerState(task *config.TaskBlock, role string, path string) (state.Provider, error) {
+	var p state.Provider
+	var err error
+
+	switch role {
+	case "input":
+		if task.Input != nil {
+			p.Ref, p.Path = task.Input.ProviderRef, task.Input.ProviderPath
+		}
+		p.ConfigHash, err = task.InputConfigHash()
+	case "output":
+		if task.Output != nil {
+			p.Ref, p.Path = task.Output.ProviderRef, task.Output.ProviderPath
+		}
+		p.ConfigHash, err = task.OutputConfigHash()
+	default:
+		return p, fmt.Errorf("unknown provider role %q", role)
+	}
+	if err != nil {
+		return p, err
+	}
+
+	if _, ok := builtin.Parse(path); ok {
+		return p, nil // builtins are versioned with DStream
+	}
+	if path != "" {
+		if p.Digest, err = state.FileDigest(path); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// currentState builds a state snapshot of the task's configuration, for comparison
+// against what was recorded. Provider paths are keyed by role and may be empty.
+func currentState(task *config.TaskBlock, paths map[string]string) (*state.State, error) {
+	cur := state.New(task.Name)
+
+	hash, err := task.ConfigHash()
+	if err != nil {
+		return nil, err
+	}
+	cur.ConfigHash = hash
+
+	for _, role := range []string{"input", "output"} {
+		p, err := providerState(task, role, paths[role])
+		if err != nil {
+			return nil, fmt.Errorf("describe %s provider: %w", role, err)
+		}
+		cur.Providers[role] = p
+	}
+	return cur, nil
+}
+
+// CompareState reports how a task's current configuration differs from the state
+// recorded by its last successful init. It returns state.ErrNotFound if the task
+// has never been initialized.
+func CompareState(task *config.TaskBlock) (*state.State, []state.Difference, error) {
+	recorded, err := stateStore.Load(task.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only compare digests for providers that are already on disk; plan should
+	// not trigger an ORAS pull just to report drift.
+	paths := make(map[string]string)
+	if task.Input != nil && task.Input.ProviderPath != "" {
+		paths["input"] = task.Input.ProviderPath
+	}
+	if task.Output != nil && task.Output.ProviderPath != "" {
+		paths["output"] = task.Output.ProviderPath
+	}
+
+	cur, err := currentState(task, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return recorded, state.Compare(recorded, cur), nil
+}
+
+// recordResources folds the resource records reported by one provider into the task state
+func recordResources(task *config.TaskBlock, role string, records []*state.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	st, err := stateStore.LoadOrNew(task.Name)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		st.Apply(role, rec)
+	}
+	return stateStore.Save(st)
+}
+
+// recordInit stamps the task's config hash and provider details after a successful
+// init, so that later plans can detect drift. paths holds the binaries that ran,
+// keyed by role; digests of providers that did not run are kept from before.
+func recordInit(task *config.TaskBlock, paths map[string]string) error {
+	st, err := stateStore.LoadOrNew(task.Name)
+	if err != nil {
+		return err
+	}
+
+	cur, err := currentState(task, paths)
+	if err != nil {
+		return err
+	}
+	st.ConfigHash = cur.ConfigHash
+	for role, p := range cur.Providers {
+		if p.Digest == "" {
+			p.Digest = st.Providers[role].Digest
+		}
+		st.Providers[role] = p
+	}
+
+	return stateStore.Save(st)
+}
+
+// recordLastRun stamps the outcome of a command on the task state
+func recordLastRun(task *config.TaskBlock, command string, startedAt time.Time, cmdErr error) {
+	st, err := stateStore.LoadOrNew(task.Name)
+	if err != nil {
+		log.Warn("Failed to load task state", "task", task.Name, "error", err.Error())
+		return
+	}
+
+	st.LastRun = &state.RunInfo{
+		Command:    command,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: time.Now().UTC(),
+		Status:     "succeeded",
+	}
+	if cmdErr != nil {
+		st.LastRun.Status = "failed"
+		st.LastRun.Error = cmdErr.Error()
+	}
+
+	if err := stateStore.Save(st); err != nil {
+		log.Warn("Failed to save task state", "task", task.Name, "error", err.Error())
+	}
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"os"
+	"testing"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/state"
+)
+
+// useTempStateStore points the executor at an empty state directory for one test
+func useTempStateStore(t *testing.T) *state.Store {
+	t.Helper()
+	prev := stateStore
+	stateStore = state.NewStore(t.TempDir())
+	t.Cleanup(func() { stateStore = prev })
+	return stateStore
+}
+
+func TestLifecycleRecordsResourcesInState(t *testing.T) {
+	store := useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "lifecycle_records")
+
+	task := &config.TaskBlock{
+		Name:   "records",
+		Type:   "providers",
+		Input:  &config.InputBlock{ProviderPath: os.Args[0], SkipLifecycle: true},
+		Output: &config.OutputBlock{ProviderPath: os.Args[0]},
+	}
+
+	if err := ExecuteProviderTaskWithCommand(task, "init"); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	st, err := store.Load("records")
+	if err != nil {
+		t.Fatalf("load state after init: %v", err)
+	}
+	if len(st.Resources) != 1 || st.Resources[0].Address() != "output.queue.cars" {
+		t.Fatalf("expected output.queue.cars in state, got %+v", st.Resources)
+	}
+	if st.ConfigHash == "" || st.Providers["output"].Digest == "" {
+		t.Fatalf("expected config hash and output digest after init, got %+v", st)
+	}
+	if st.LastRun == nil || st.LastRun.Command != "init" || st.LastRun.Status != "succeeded" {
+		t.Fatalf("expected successful init as last run, got %+v", st.LastRun)
+	}
+
+	if _, diffs, err := CompareState(task); err != nil || len(diffs) != 0 {
+		t.Fatalf("expected no drift right after init, got %v (err=%v)", diffs, err)
+	}
+
+	// destroy is told about the recorded queue and reports it deleted
+	if err := ExecuteProviderTaskWithCommand(task, "destroy"); err != nil {
+		t.Fatalf("destroy failed: %v", err)
+	}
+	st, err = store.Load("records")
+	if err != nil {
+		t.Fatalf("load state after destroy: %v", err)
+	}
+	if len(st.Resources) != 0 {
+		t.Fatalf("expected no resources after destroy, got %+v", st.Resources)
+	}
+}
+
+func TestPlanThenApplyOnlyReviewedChanges(t *testing.T) {
+	store := useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "lifecycle_records")
+
+	task := &config.TaskBlock{
+		Name:   "planned",
+		Type:   "providers",
+		Input:  &config.InputBlock{ProviderPath: os.Args[0], SkipLifecycle: true},
+		Output: &config.OutputBlock{ProviderPath: os.Args[0]},
+	}
+
+	p, err := PlanTask(task)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if s := p.Summarize(); s.Add != 2 {
+		t.Fatalf("expected 2 creates in plan, got %s", s)
+	}
+
+	// Drop one change during review; only the remaining one should be applied
+	p.ResourceChanges = p.ResourceChanges[:1]
+	if err := ApplyPlan(task, p); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	st, err := store.Load("planned")
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if len(st.Resources) != 1 || st.Resources[0].Address() != "output.queue.cars" {
+		t.Fatalf("expected only the reviewed change in state, got %+v", st.Resources)
+	}
+
+	// A plan created against a different config is rejected
+	p.ConfigHash = "sha256:stale"
+	if err := ApplyPlan(task, p); err == nil {
+		t.Fatal("expected stale plan to be rejected")
+	}
+}
@@ -0,0 +1,283 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stderrTailLines is how many recent stderr lines are kept per provider for
+// crash diagnostics
+const stderrTailLines = 50
+
+// stderrContextLines is how many of those lines are quoted in an error
+const stderrContextLines = 10
+
+// providerLog is the Stderr of a provider process. It splits the stream into
+// lines, re-emits each one through the host logger with the provider's task and
+// role attached, and keeps the most recent lines for error messages.
+//
+// Lines are parsed as hclog JSON, logfmt, or hclog's "[LEVEL] name: message"
+// text format, and anything else is logged as-is at info level.
+type providerLog struct {
+	task string
+	role string
+
+	partial []byte // an unterminated line, completed by the next Write
+
+	mu   sync.Mutex
+	tail []string // ring buffer of the last stderrTailLines lines
+	next int
+	full bool
+}
+
+func newProviderLog(task, role string) *providerLog {
+	return &providerLog{task: task, role: role, tail: make([]string, stderrTailLines)}
+}
+
+// Write is called by os/exec's copying goroutine, never concurrently
+func (l *providerLog) Write(p []byte) (int, error) {
+	data := p
+	if len(l.partial) > 0 {
+		data = append(l.partial, p...)
+		l.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		l.line(string(bytes.TrimRight(data[:i], "\r")))
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		l.partial = append([]byte(nil), data...)
+	}
+	return len(p), nil
+}
+
+// Flush emits a final line the provider did not terminate with a newline
+func (l *providerLog) Flush() {
+	if len(l.partial) > 0 {
+		l.line(string(l.partial))
+		l.partial = nil
+	}
+}
+
+// Tail returns the most recent stderr lines, oldest first
+func (l *providerLog) Tail() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]string(nil), l.tail[:l.next]...)
+	}
+	return append(append([]string(nil), l.tail[l.next:]...), l.tail[:l.next]...)
+}
+
+func (l *providerLog) line(raw string) {
+	line := stripANSI(raw)
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	l.mu.Lock()
+	l.tail[l.next] = line
+	l.next = (l.next + 1) % len(l.tail)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+
+	entry := parseProviderLogLine(line)
+	args := append([]interface{}{"provider", l.role, "task", l.task}, entry.fields...)
+	if entry.module != "" {
+		args = append(args, "module", entry.module)
+	}
+
+	switch entry.level {
+	case "trace", "debug":
+		log.Debug(entry.message, args...)
+	case "warn", "warning":
+		log.Warn(entry.message, args...)
+	case "error", "err", "fatal", "panic":
+		log.Error(entry.message, args...)
+	default:
+		log.Info(entry.message, args...)
+	}
+}
+
+// providerLogEntry is one parsed stderr line
+type providerLogEntry struct {
+	level   string
+	message string
+	module  string
+	fields  []interface{} // key/value pairs, in the order they appeared where known
+}
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	// hclog text: "[INFO]  name: message: key=value", optionally after a timestamp
+	hclogText = regexp.MustCompile(`^(?:\S+ ){0,2}\[(TRACE|DEBUG|INFO|WARN|ERROR)\]\s+(.*)$`)
+)
+
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// parseProviderLogLine recognises the log formats providers commonly write
+func parseProviderLogLine(line string) providerLogEntry {
+	trimmed := strings.TrimSpace(line)
+
+	if strings.HasPrefix(trimmed, "{") {
+		if entry, ok := parseJSONLogLine(trimmed); ok {
+			return entry
+		}
+	}
+	if m := hclogText.FindStringSubmatch(trimmed); m != nil {
+		return parseHCLogText(strings.ToLower(m[1]), m[2])
+	}
+	if entry, ok := parseLogfmtLine(trimmed); ok {
+		return entry
+	}
+	return providerLogEntry{level: "info", message: trimmed}
+}
+
+// parseJSONLogLine handles hclog JSON ("@level", "@message", "@module") and the
+// common "level"/"msg" keys used by slog, zap and logrus
+func parseJSONLogLine(line string) (providerLogEntry, bool) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return providerLogEntry{}, false
+	}
+
+	take := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := obj[k]; ok {
+				delete(obj, k)
+				if s, ok := v.(string); ok {
+					return s
+				}
+			}
+		}
+		return ""
+	}
+
+	entry := providerLogEntry{
+		level:   strings.ToLower(take("@level", "level", "lvl", "severity")),
+		message: take("@message", "msg", "message"),
+		module:  take("@module", "logger", "name"),
+	}
+	if entry.level == "" && entry.message == "" {
+		return providerLogEntry{}, false
+	}
+	// The host stamps its own time
+	take("@timestamp", "time", "ts", "timestamp")
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry.fields = append(entry.fields, k, obj[k])
+	}
+	return entry, true
+}
+
+// parseHCLogText handles the rest of an hclog text line after the level:
+// "name: message: key=value key2=value2"
+func parseHCLogText(level, rest string) providerLogEntry {
+	entry := providerLogEntry{level: level}
+
+	// hclog separates the message from its key/value pairs with ": "
+	message := rest
+	if i := strings.LastIndex(rest, ": "); i >= 0 {
+		if fields, ok := parseLogfmtPairs(rest[i+2:]); ok && len(fields) > 0 {
+			message, entry.fields = rest[:i], fields
+		}
+	}
+	if i := strings.Index(message, ": "); i > 0 && !strings.ContainsAny(message[:i], " \t") {
+		entry.module, message = message[:i], message[i+2:]
+	}
+	entry.message = strings.TrimSpace(message)
+	return entry
+}
+
+// parseLogfmtLine handles "level=info msg=\"...\" key=value" lines
+func parseLogfmtLine(line string) (providerLogEntry, bool) {
+	pairs, ok := parseLogfmtPairs(line)
+	if !ok {
+		return providerLogEntry{}, false
+	}
+
+	entry := providerLogEntry{}
+	for i := 0; i < len(pairs); i += 2 {
+		key, value := pairs[i].(string), pairs[i+1]
+		switch key {
+		case "level", "lvl":
+			entry.level = strings.ToLower(value.(string))
+		case "msg", "message":
+			entry.message = value.(string)
+		case "time", "ts":
+		default:
+			entry.fields = append(entry.fields, key, value)
+		}
+	}
+	if entry.level == "" && entry.message == "" {
+		return providerLogEntry{}, false
+	}
+	return entry, true
+}
+
+// parseLogfmtPairs splits key=value pairs, with double-quoted values. It fails
+// if any token is not a pair, so prose is not mistaken for logfmt.
+func parseLogfmtPairs(s string) ([]interface{}, bool) {
+	var pairs []interface{}
+	s = strings.TrimSpace(s)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t\"") {
+			return nil, false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && (s[end] != '"' || s[end-1] == '\\') {
+				end++
+			}
+			if end >= len(s) {
+				return nil, false
+			}
+			value = strings.ReplaceAll(s[1:end], `\"`, `"`)
+			s = s[end+1:]
+		} else if sp := strings.IndexAny(s, " \t"); sp >= 0 {
+			value, s = s[:sp], s[sp:]
+		} else {
+			value, s = s, ""
+		}
+		pairs = append(pairs, key, value)
+		s = strings.TrimLeft(s, " \t")
+	}
+	return pairs, len(pairs) > 0
+}
+
+// stderrContext formats the last few stderr lines for an error message
+func stderrContext(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	if len(lines) > stderrContextLines {
+		lines = lines[len(lines)-stderrContextLines:]
+	}
+	return "\nProvider stderr:\n  " + strings.Join(lines, "\n  ")
+}
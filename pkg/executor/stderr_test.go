@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+func TestParseProviderLogLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want providerLogEntry
+	}{
+		{
+			name: "hclog json",
+			line: `{"@level":"warn","@message":"lag growing","@module":"mssql","@timestamp":"2025-01-01T00:00:00Z","table":"orders","lag":12}`,
+			want: providerLogEntry{level: "warn", message: "lag growing", module: "mssql", fields: []interface{}{"lag", float64(12), "table", "orders"}},
+		},
+		{
+			name: "slog json",
+			line: `{"time":"2025-01-01T00:00:00Z","level":"ERROR","msg":"connect failed","err":"timeout"}`,
+			want: providerLogEntry{level: "error", message: "connect failed", fields: []interface{}{"err", "timeout"}},
+		},
+		{
+			name: "logfmt",
+			line: `time=2025-01-01T00:00:00Z level=debug msg="polling table" table=dbo.orders`,
+			want: providerLogEntry{level: "debug", message: "polling table", fields: []interface{}{"table", "dbo.orders"}},
+		},
+		{
+			name: "hclog text",
+			line: `2025-01-01T00:00:00.000Z [INFO]  mssql: checkpoint saved: lsn=0x01 table=orders`,
+			want: providerLogEntry{level: "info", message: "checkpoint saved", module: "mssql", fields: []interface{}{"lsn", "0x01", "table", "orders"}},
+		},
+		{
+			name: "hclog text without fields",
+			line: `[ERROR] connection lost: retrying soon`,
+			want: providerLogEntry{level: "error", message: "connection lost: retrying soon"},
+		},
+		{
+			name: "plain",
+			line: `[provider] started successfully`,
+			want: providerLogEntry{level: "info", message: "[provider] started successfully"},
+		},
+		{
+			name: "prose with an equals sign",
+			line: `retry limit = 3 exceeded`,
+			want: providerLogEntry{level: "info", message: "retry limit = 3 exceeded"},
+		},
+		{
+			name: "json that is not a log entry",
+			line: `{"rows":3}`,
+			want: providerLogEntry{level: "info", message: `{"rows":3}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseProviderLogLine(tt.line)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProviderLogLine(%q)\n got: %#v\nwant: %#v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderLogSplitsLines(t *testing.T) {
+	l := newProviderLog("orders", "input")
+
+	fmt.Fprint(l, "first\r\nsec")
+	fmt.Fprint(l, "ond\n\n\x1b[31mthird\x1b[0m\nunterminated")
+	if got, want := l.Tail(), []string{"first", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Tail() = %q, want %q", got, want)
+	}
+
+	l.Flush()
+	if got := l.Tail(); got[len(got)-1] != "unterminated" {
+		t.Fatalf("Flush did not emit the partial line, tail = %q", got)
+	}
+}
+
+func TestProviderLogKeepsLastLines(t *testing.T) {
+	l := newProviderLog("orders", "output")
+	for i := 0; i < stderrTailLines+7; i++ {
+		fmt.Fprintf(l, "line %d\n", i)
+	}
+
+	tail := l.Tail()
+	if len(tail) != stderrTailLines {
+		t.Fatalf("tail has %d lines, want %d", len(tail), stderrTailLines)
+	}
+	if tail[0] != "line 7" || tail[len(tail)-1] != fmt.Sprintf("line %d", stderrTailLines+6) {
+		t.Fatalf("tail is not the most recent lines in order: first %q, last %q", tail[0], tail[len(tail)-1])
+	}
+
+	ctx := stderrContext(tail)
+	if n := strings.Count(ctx, "\n  "); n != stderrContextLines {
+		t.Fatalf("stderrContext quoted %d lines, want %d", n, stderrContextLines)
+	}
+}
+
+func TestStartProviderCrashIncludesStderrTail(t *testing.T) {
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "crash_with_stderr")
+
+	p, err := startProvider(context.Background(), "orders", "input", os.Args[0], "{}", config.Timeouts{Ready: 5 * time.Second}, false)
+	if err != nil {
+		t.Fatalf("startProvider: %v", err)
+	}
+	defer p.kill()
+
+	_, err = p.awaitReady(context.Background())
+	if err == nil {
+		t.Fatal("expected a crash error")
+	}
+	if !strings.Contains(err.Error(), "FATAL: out of memory") {
+		t.Fatalf("error does not include the provider's last stderr lines: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// StdioEndpoint is the --input / --output value that replaces a provider with
+// DStream's own stdin or stdout
+const StdioEndpoint = "-"
+
+// validateEndpoints checks the --input and --output values of a run
+func (o RunOptions) validateEndpoints() error {
+	for flag, v := range map[string]string{"input": o.Input, "output": o.Output} {
+		if v != "" && v != StdioEndpoint {
+			return fmt.Errorf("--%s only accepts %q, got %q", flag, StdioEndpoint, v)
+		}
+	}
+	if o.Input == StdioEndpoint && o.Output == StdioEndpoint {
+		return fmt.Errorf("--input and --output can't both be %q", StdioEndpoint)
+	}
+	return nil
+}
+
+// replaces reports whether the provider for role is replaced by DStream's stdio
+// or a fixture stream
+func (o RunOptions) replaces(role string) bool {
+	if role == "input" {
+		return o.Input == StdioEndpoint || o.inputStream != nil
+	}
+	return o.Output == StdioEndpoint || o.outputStream != nil
+}
+
+// The stdio endpoints, and the fixture streams of dstream test, stand in for a
+// provider process so the relay, shutdown and history code treat them like any
+// other. They have no handshake; done is closed
+// when the stream ends, and interrupt ends it early.
+
+// finish marks a stdio endpoint as ended
+func (p *providerProcess) finish(err error) {
+	p.finishOnce.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
+
+// startStream starts a fixture stream in place of the provider for role: the
+// input reads events from in, the output writes them to out
+func startStream(task *config.TaskBlock, role string, in io.Reader, out io.Writer) (*providerProcess, error) {
+	timeouts, err := task.TimeoutsFor(role)
+	if err != nil {
+		return nil, err
+	}
+	if role == "input" {
+		return streamInput(task.Name, "fixture", in, timeouts)
+	}
+	return streamOutput(task.Name, "capture", out, timeouts), nil
+}
+
+// streamInput relays src, DStream's stdin or a fixture, in place of the input
+// provider. It is copied through a pipe so that stopping the input ends the
+// stream even when a read from a terminal would block.
+func streamInput(task, name string, src io.Reader, timeouts config.Timeouts) (*providerProcess, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create stdin pipe: %w", err)
+	}
+	p := &providerProcess{
+		role:     "input",
+		name:     name,
+		stdoutR:  r,
+		stdout:   bufio.NewScanner(closeOnEOF{r}),
+		stderr:   newProviderLog(task, "input"),
+		timeouts: timeouts,
+		started:  time.Now(),
+		done:     make(chan struct{}),
+	}
+	p.interrupt = func() {
+		w.Close()
+		p.finish(nil)
+	}
+
+	go func() {
+		_, err := io.Copy(w, src)
+		w.Close()
+		if err != nil {
+			err = fmt.Errorf("read %s: %w", name, err)
+		}
+		p.finish(err)
+	}()
+	return p, nil
+}
+
+// streamOutput writes relayed events to dst, DStream's stdout or a capture, in
+// place of the output provider. It ends when the relay closes it.
+func streamOutput(task, name string, dst io.Writer, timeouts config.Timeouts) *providerProcess {
+	p := &providerProcess{
+		role:     "output",
+		name:     name,
+		stdout:   bufio.NewScanner(strings.NewReader("")),
+		stderr:   newProviderLog(task, "output"),
+		timeouts: timeouts,
+		started:  time.Now(),
+		done:     make(chan struct{}),
+	}
+	p.stdin = streamWriter{p, dst}
+	p.interrupt = func() { p.finish(nil) }
+	return p
+}
+
+type streamWriter struct {
+	p   *providerProcess
+	dst io.Writer
+}
+
+func (w streamWriter) Write(b []byte) (int, error) {
+	return w.dst.Write(b)
+}
+
+func (w streamWriter) Close() error {
+	w.p.finish(nil)
+	return nil
+}
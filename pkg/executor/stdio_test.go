@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// replaceStdio swaps os.Stdin or os.Stdout for a pipe for one test, returning the
+// end the test uses
+func replaceStdio(t *testing.T, f **os.File) *os.File {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := *f
+	var ours *os.File
+	if f == &os.Stdin {
+		*f, ours = r, w
+	} else {
+		*f, ours = w, r
+	}
+	t.Cleanup(func() {
+		*f = prev
+		r.Close()
+		w.Close()
+	})
+	return ours
+}
+
+func TestRunWithStdinAsInput(t *testing.T) {
+	useTempStateStore(t)
+	drainLog := filepath.Join(t.TempDir(), "drain.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", drainLog)
+
+	stdin := replaceStdio(t, &os.Stdin)
+	stdin.WriteString("one\ntwo\nthree\n")
+	stdin.Close()
+
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	if err := runPipeline(context.Background(), task, make(chan os.Signal), nil, RunOptions{Input: StdioEndpoint}); err != nil {
+		t.Fatalf("pipeline returned error: %v", err)
+	}
+
+	data, _ := os.ReadFile(drainLog)
+	if got, want := string(data), "one\ntwo\nthree\neof\n"; got != want {
+		t.Fatalf("output received %q, want %q", got, want)
+	}
+}
+
+func TestRunWithStdoutAsOutput(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+
+	stdout := replaceStdio(t, &os.Stdout)
+	lines := make(chan string, 100)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runPipeline(context.Background(), task, signals, nil, RunOptions{Output: StdioEndpoint})
+	}()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, "event-") {
+				t.Fatalf("unexpected line on stdout: %q", line)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("no events written to stdout before deadline")
+		}
+	}
+
+	// Shutdown still drains the input into stdout
+	signals <- syscall.SIGINT
+	if err := <-done; err != nil {
+		t.Fatalf("pipeline returned error: %v", err)
+	}
+	os.Stdout.Close()
+	var rest []string
+	for line := range lines {
+		rest = append(rest, line)
+	}
+	if len(rest) < 3 || rest[len(rest)-1] != "flushed-3" {
+		t.Fatalf("flushed events not written to stdout: %v", rest)
+	}
+}
+
+func TestStdioEndpointsAreValidated(t *testing.T) {
+	for _, opts := range []RunOptions{
+		{Input: "events.jsonl"},
+		{Output: "+"},
+		{Input: StdioEndpoint, Output: StdioEndpoint},
+	} {
+		if err := opts.validateEndpoints(); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+	if err := (RunOptions{Output: StdioEndpoint}).validateEndpoints(); err != nil {
+		t.Errorf("--output - rejected: %v", err)
+	}
+}
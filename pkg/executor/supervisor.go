@@ -0,0 +1,720 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/health"
+	"github.com/katasec/dstream/pkg/metrics"
+	"github.com/katasec/dstream/pkg/tracing"
+)
+
+// Supervised task states
+const (
+	TaskWaiting    = "waiting"   // for the tasks it depends on to be running
+	TaskScheduled  = "scheduled" // waiting for its schedule to start the next run
+	TaskRunning    = "running"
+	TaskRestarting = "restarting" // waiting out the backoff before a restart
+	TaskStopping   = "stopping"
+	TaskStopped    = "stopped"
+	TaskFailed     = "failed"
+	TaskDisabled   = "disabled" // known from the config but not started
+)
+
+// Errors returned by Supervisor
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskRunning  = errors.New("task is already running")
+)
+
+// TaskState is what the supervisor knows about one task
+type TaskState struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	ConfigHash string    `json:"config_hash,omitempty"`
+	Restarts   int       `json:"restarts"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	StoppedAt  time.Time `json:"stopped_at,omitzero"`
+	Error      string    `json:"error,omitempty"`
+	// NextRun is when a scheduled task runs next, under `dstream serve`
+	NextRun time.Time `json:"next_run,omitzero"`
+	// LastRun is what the task's latest run did
+	LastRun *RunSummary `json:"last_run,omitempty"`
+}
+
+// ReloadResult lists what Apply did to each task
+type ReloadResult struct {
+	Started   []string `json:"started,omitempty"`
+	Restarted []string `json:"restarted,omitempty"`
+	Reloaded  []string `json:"reloaded,omitempty"` // provider config applied in place
+	Stopped   []string `json:"stopped,omitempty"`
+	Unchanged []string `json:"unchanged,omitempty"`
+}
+
+// Supervisor runs provider tasks side by side in one process. Each task has its
+// own providers and restart policy, so one failing doesn't stop the others, and
+// each can be started, stopped and restarted on its own.
+type Supervisor struct {
+	opts      RunOptions
+	schedules bool // run tasks with a schedule block on their schedule
+
+	mu    sync.Mutex
+	tasks map[string]*supervisedTask
+	wg    sync.WaitGroup
+}
+
+// supervisedTask is one task's definition and, while it runs, its controls.
+// Fields other than the channels are guarded by Supervisor.mu.
+type supervisedTask struct {
+	task        *config.TaskBlock // updated in place when a reload changes only provider config
+	fingerprint string
+
+	state     string
+	restarts  int
+	startedAt time.Time
+	stoppedAt time.Time
+	err       error
+	nextRun   time.Time
+	lastRun   *RunSummary
+
+	// reachedRunning records that the task got as far as running, so a stop
+	// afterwards is one it completed rather than failed to start
+	reachedRunning bool
+
+	signals  chan os.Signal         // forwarded to the running pipeline
+	reloads  chan *config.TaskBlock // new definitions for the running pipeline
+	stop     chan struct{}          // closed when the task is asked to stop
+	stopOnce sync.Once
+	done     chan struct{} // closed when the task has stopped for good
+}
+
+// NewSupervisor returns a supervisor whose tasks run with opts
+func NewSupervisor(opts RunOptions) *Supervisor {
+	return &Supervisor{opts: opts, tasks: make(map[string]*supervisedTask)}
+}
+
+// FollowSchedules makes tasks with a schedule block run each time it fires, as
+// `dstream serve` does, instead of once straight away. It applies to tasks
+// started after it is called.
+func (s *Supervisor) FollowSchedules() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules = true
+}
+
+// Supervise runs tasks under a supervisor until they have all stopped. SIGINT or
+// SIGTERM shuts every task down gracefully; a second one force kills. SIGHUP
+// applies the tasks returned by load, as Apply does. It returns the final state
+// of each task and the errors of the tasks that failed.
+func Supervise(tasks []*config.TaskBlock, opts RunOptions, load func() ([]*config.TaskBlock, error)) ([]TaskState, error) {
+	if err := checkSupervised(tasks, opts); err != nil {
+		return nil, err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	s := NewSupervisor(opts)
+	err := s.supervise(tasks, sigChan, load)
+	return s.Tasks(), err
+}
+
+// checkSupervised checks the tasks can be supervised together
+func checkSupervised(tasks []*config.TaskBlock, opts RunOptions) error {
+	if len(tasks) > 1 && (opts.Record != "" || opts.Input != "" || opts.Output != "") {
+		return fmt.Errorf("--record, --input and --output apply to a single task")
+	}
+	for _, task := range tasks {
+		if err := checkSupervisable(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSupervisable(task *config.TaskBlock) error {
+	if task.Type != "providers" {
+		return fmt.Errorf("task %q: only type = \"providers\" tasks can be supervised", task.Name)
+	}
+	if _, err := task.RestartPolicy(); err != nil {
+		return err
+	}
+	if _, err := task.SchedulePolicy(); err != nil {
+		return err
+	}
+	_, err := task.FaultPolicy()
+	return err
+}
+
+func (s *Supervisor) supervise(tasks []*config.TaskBlock, signals <-chan os.Signal, load func() ([]*config.TaskBlock, error)) error {
+	for _, task := range tasks {
+		if err := s.Start(task); err != nil {
+			s.StopAll(syscall.SIGTERM)
+			s.Wait()
+			return err
+		}
+	}
+	if len(tasks) > 1 {
+		log.Info("Supervising tasks", "count", len(tasks))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	stopping := false
+	for {
+		select {
+		case <-done:
+			return s.Err()
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if !stopping {
+					s.ReloadFrom(load)
+				}
+				continue
+			}
+			if !stopping && len(tasks) > 1 {
+				log.Info("Received signal, stopping all tasks", "signal", sig.String())
+			}
+			stopping = true
+			s.StopAll(sig)
+		}
+	}
+}
+
+// Start runs a task, replacing any stopped task of the same name
+func (s *Supervisor) Start(task *config.TaskBlock) error {
+	if err := checkSupervisable(task); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tasks[task.Name]; ok && t.active() {
+		return fmt.Errorf("%w: %s", ErrTaskRunning, task.Name)
+	}
+	s.startLocked(task)
+	return nil
+}
+
+// StartTask runs a task the supervisor already knows by name
+func (s *Supervisor) StartTask(name string) error {
+	s.mu.Lock()
+	t, ok := s.tasks[name]
+	var task *config.TaskBlock
+	if ok {
+		task = t.task
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	return s.Start(task)
+}
+
+// startLocked starts a task's supervision loop; s.mu must be held
+func (s *Supervisor) startLocked(task *config.TaskBlock) {
+	policy, _ := task.RestartPolicy() // checked by checkSupervisable
+	sched, _ := task.SchedulePolicy()
+	if !s.schedules {
+		sched = nil
+	}
+	state := TaskRunning
+	switch {
+	case len(task.DependsOn) > 0:
+		state = TaskWaiting
+	case sched != nil:
+		state = TaskScheduled
+	}
+	t := &supervisedTask{
+		task:        task,
+		fingerprint: taskFingerprint(task),
+		state:       state,
+		startedAt:   time.Now(),
+		signals:     make(chan os.Signal, 2),
+		reloads:     make(chan *config.TaskBlock, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if state == TaskScheduled {
+		t.nextRun = sched.Next(time.Now())
+	}
+	s.tasks[task.Name] = t
+	// Clear what a previous run left, so dependents don't see it as running
+	health.Default.Task(task.Name).Starting()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(t.done)
+		err := s.awaitDependencies(t)
+		switch {
+		case err != nil || t.stopping():
+		case sched != nil:
+			err = s.runScheduled(t, policy, sched)
+		default:
+			s.setState(t, TaskRunning)
+			err = s.run(t, policy)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		t.err, t.stoppedAt = err, time.Now()
+		t.state = TaskStopped
+		if err != nil {
+			t.state = TaskFailed
+		}
+	}()
+}
+
+// Stop gracefully stops a task and waits for it. Calling it again while the
+// task is still stopping force kills its providers.
+func (s *Supervisor) Stop(name string) error {
+	s.mu.Lock()
+	t, ok := s.tasks[name]
+	if ok && t.active() {
+		t.requestStop(syscall.SIGTERM)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	if t.done != nil {
+		<-t.done
+	}
+	return nil
+}
+
+// Restart stops a task if it is running and starts it again with its current
+// definition
+func (s *Supervisor) Restart(name string) error {
+	if err := s.Stop(name); err != nil {
+		return err
+	}
+	return s.StartTask(name)
+}
+
+// StopAll passes sig to every running task without waiting: the first starts a
+// graceful shutdown, a second force kills
+func (s *Supervisor) StopAll(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.active() {
+			t.requestStop(sig)
+		}
+	}
+}
+
+// Wait blocks until every started task has stopped
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// Err returns the errors of the tasks that failed. A single task's error is
+// returned as is.
+func (s *Supervisor) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var failed []error
+	for _, name := range s.namesLocked() {
+		if err := s.tasks[name].err; err != nil {
+			failed = append(failed, fmt.Errorf("task %q: %w", name, err))
+		}
+	}
+	if len(s.tasks) == 1 && len(failed) == 1 {
+		return errors.Unwrap(failed[0])
+	}
+	return errors.Join(failed...)
+}
+
+// Tasks returns the state of every known task, by name
+func (s *Supervisor) Tasks() []TaskState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []TaskState
+	for _, name := range s.namesLocked() {
+		states = append(states, s.tasks[name].stateLocked())
+	}
+	return states
+}
+
+// Task returns the state of one task
+func (s *Supervisor) Task(name string) (TaskState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[name]
+	if !ok {
+		return TaskState{}, fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	return t.stateLocked(), nil
+}
+
+// Apply brings the supervisor in line with a freshly loaded config. Enabled tasks
+// that aren't running are started and disabled or removed ones are stopped. A
+// running task where only provider config changed is reloaded in place, touching
+// just the providers that changed; one whose task settings changed is restarted.
+// The others are left alone.
+func (s *Supervisor) Apply(tasks []*config.TaskBlock) (ReloadResult, error) {
+	var result ReloadResult
+	for _, task := range tasks {
+		if err := checkSupervisable(task); err != nil {
+			return result, err
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, task := range tasks {
+		wanted[task.Name] = true
+		s.mu.Lock()
+		t, known := s.tasks[task.Name]
+		running := known && t.active()
+		isNew := !known || t.state == TaskDisabled
+		changed := known && t.fingerprint != taskFingerprint(task)
+		inPlace := changed && taskSettings(t.task) == taskSettings(task)
+		s.mu.Unlock()
+
+		switch {
+		case !task.IsEnabled():
+			if running {
+				s.Stop(task.Name)
+				result.Stopped = append(result.Stopped, task.Name)
+			}
+			s.setDisabled(task)
+		case running && inPlace:
+			s.reload(t, task)
+			result.Reloaded = append(result.Reloaded, task.Name)
+		case running && changed:
+			s.Stop(task.Name)
+			if err := s.Start(task); err != nil {
+				return result, err
+			}
+			result.Restarted = append(result.Restarted, task.Name)
+		case isNew || changed:
+			// New tasks, and stopped ones whose config was fixed, are started
+			if err := s.Start(task); err != nil {
+				return result, err
+			}
+			result.Started = append(result.Started, task.Name)
+		default:
+			// Unchanged tasks keep running, or stay stopped if they were stopped. They
+			// still take the new definition, for depends_on, tags and the like.
+			s.mu.Lock()
+			t.task = task
+			s.mu.Unlock()
+			result.Unchanged = append(result.Unchanged, task.Name)
+		}
+	}
+
+	s.mu.Lock()
+	var removed []string
+	for name := range s.tasks {
+		if !wanted[name] {
+			removed = append(removed, name)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(removed)
+	for _, name := range removed {
+		s.Stop(name)
+		s.mu.Lock()
+		delete(s.tasks, name)
+		s.mu.Unlock()
+		result.Stopped = append(result.Stopped, name)
+	}
+	return result, nil
+}
+
+// ReloadFrom applies the tasks returned by load and logs what changed. Errors are
+// logged and returned; tasks keep running as they were.
+func (s *Supervisor) ReloadFrom(load func() ([]*config.TaskBlock, error)) (ReloadResult, error) {
+	if load == nil {
+		log.Warn("Reload requested, but there is no config to reload from")
+		return ReloadResult{}, nil
+	}
+	log.Info("Reloading configuration")
+	tasks, err := load()
+	if err == nil {
+		var result ReloadResult
+		if result, err = s.Apply(tasks); err == nil {
+			log.Info("Configuration reloaded", "started", len(result.Started), "restarted", len(result.Restarted),
+				"reloaded", len(result.Reloaded), "stopped", len(result.Stopped), "unchanged", len(result.Unchanged))
+			return result, nil
+		}
+	}
+	log.Error("Reload failed", "error", err.Error())
+	return ReloadResult{}, err
+}
+
+// reload hands a running task its new definition. A reload the pipeline hasn't
+// picked up yet is replaced, as the newer definition supersedes it.
+func (s *Supervisor) reload(t *supervisedTask, task *config.TaskBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.task, t.fingerprint = task, taskFingerprint(task)
+	select {
+	case <-t.reloads:
+	default:
+	}
+	t.reloads <- task
+}
+
+// setDisabled records a task that is configured but not to be started
+func (s *Supervisor) setDisabled(task *config.TaskBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[task.Name] = &supervisedTask{task: task, fingerprint: taskFingerprint(task), state: TaskDisabled}
+}
+
+func (s *Supervisor) namesLocked() []string {
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// run drives one task's pipeline, restarting it as its policy says until it
+// stops for good or is asked to stop
+func (s *Supervisor) run(t *supervisedTask, policy config.RestartPolicy) error {
+	backoff := policy.Backoff
+	restarts := 0
+	for {
+		// Each attempt starts from the latest definition, which a reload may have updated
+		s.mu.Lock()
+		task := t.task
+		s.mu.Unlock()
+
+		opts := batchOptions(task, s.opts)
+		if opts.Batch {
+			policy = batchRestartPolicy(policy)
+		}
+		started := time.Now()
+		summary, err := runAttempt(task, t.signals, t.reloads, opts)
+		s.mu.Lock()
+		t.lastRun = &summary
+		s.mu.Unlock()
+		if opts.Batch {
+			log.Info("Batch run finished", "task", task.Name, "exit_reason", summary.ExitReason,
+				"events_relayed", summary.EventsRelayed, "events_dropped", summary.EventsDropped,
+				"bytes_relayed", summary.BytesRelayed, "duration", summary.Duration().Round(time.Millisecond).String())
+		}
+
+		if t.stopping() || !policy.ShouldRestart(err) || errors.Is(err, ErrMaxRuntime) {
+			return err
+		}
+
+		// A run that stayed up for a while starts the count and backoff afresh
+		if time.Since(started) > policy.MaxBackoff {
+			restarts, backoff = 0, policy.Backoff
+		}
+		if policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts {
+			log.Error("Task keeps stopping, giving up", "task", task.Name, "restarts", restarts)
+			return err
+		}
+
+		if err != nil {
+			log.Warn("Task failed, restarting", "task", task.Name, "backoff", backoff.String(), "error", err.Error())
+		} else {
+			log.Info("Task completed, restarting", "task", task.Name, "backoff", backoff.String())
+		}
+		s.setState(t, TaskRestarting)
+		select {
+		case <-t.stop:
+			return err
+		case <-time.After(backoff):
+		}
+
+		restarts++
+		backoff = min(backoff*2, policy.MaxBackoff)
+		s.mu.Lock()
+		t.restarts++
+		t.state = TaskRunning
+		s.mu.Unlock()
+		for _, role := range []string{"input", "output"} {
+			metrics.Default.Task(task.Name).ProviderRestarted(role)
+			health.Default.Task(task.Name).ProviderRestarted(role)
+		}
+	}
+}
+
+// awaitDependencies waits until every task t depends on that this supervisor
+// runs has its providers ready. Dependencies run elsewhere aren't waited for.
+func (s *Supervisor) awaitDependencies(t *supervisedTask) error {
+	s.mu.Lock()
+	name := t.task.Name
+	s.mu.Unlock()
+	waiting := false
+	for {
+		pending, err := s.pendingDependencies(t)
+		if err != nil || len(pending) == 0 {
+			if waiting && err == nil {
+				log.Info("Dependencies are running, starting task", "task", name)
+			}
+			return err
+		}
+		if !waiting {
+			log.Info("Waiting for dependencies", "task", name, "depends_on", strings.Join(pending, ", "))
+			waiting = true
+		}
+		select {
+		case <-t.stop:
+			return nil
+		case <-time.After(dependencyPollInterval):
+		}
+	}
+}
+
+// dependencyPollInterval is how often a waiting task checks its dependencies
+const dependencyPollInterval = 100 * time.Millisecond
+
+// pendingDependencies lists the dependencies of t that aren't running yet. A
+// dependency that failed, or stopped before it ran, is an error, as it won't
+// become ready; one that ran and completed, such as a batch task, is not waited for.
+func (s *Supervisor) pendingDependencies(t *supervisedTask) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []string
+	for _, name := range t.task.DependsOn {
+		dep, ok := s.tasks[name]
+		if !ok || dep.state == TaskDisabled {
+			continue
+		}
+		switch {
+		case dep.state == TaskFailed:
+			return nil, fmt.Errorf("dependency %q failed", name)
+		case dep.state == TaskStopped && !dep.reachedRunning:
+			return nil, fmt.Errorf("dependency %q stopped before it was running", name)
+		case dep.state == TaskStopped:
+			// ran and completed
+		case dep.state != TaskRunning || health.Default.Task(name).Phase() != health.PhaseRunning:
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+func (s *Supervisor) setState(t *supervisedTask, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.state != TaskStopping {
+		t.state = state
+	}
+	if t.state == TaskRunning {
+		t.reachedRunning = true
+	}
+}
+
+// active reports whether the task is running or on its way to stopping
+func (t *supervisedTask) active() bool {
+	switch t.state {
+	case TaskWaiting, TaskScheduled, TaskRunning, TaskRestarting, TaskStopping:
+		return true
+	}
+	return false
+}
+
+// requestStop stops restarts and passes sig to the running pipeline
+func (t *supervisedTask) requestStop(sig os.Signal) {
+	t.state = TaskStopping
+	t.stopOnce.Do(func() { close(t.stop) })
+	select {
+	case t.signals <- sig:
+	default:
+	}
+}
+
+func (t *supervisedTask) stopping() bool {
+	select {
+	case <-t.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *supervisedTask) stateLocked() TaskState {
+	st := TaskState{
+		Name:      t.task.Name,
+		State:     t.state,
+		Restarts:  t.restarts,
+		StartedAt: t.startedAt,
+		StoppedAt: t.stoppedAt,
+		NextRun:   t.nextRun,
+		LastRun:   t.lastRun,
+	}
+	if hash, err := t.task.ConfigHash(); err == nil {
+		st.ConfigHash = hash
+	}
+	if t.err != nil {
+		st.Error = t.err.Error()
+	}
+	return st
+}
+
+// taskFingerprint identifies everything in a task's definition that affects a
+// running pipeline, so a reload touches only tasks that changed. It covers each
+// provider as a reload compares them, so any change a reload acts on counts.
+func taskFingerprint(task *config.TaskBlock) string {
+	fingerprint := taskSettings(task)
+	for _, role := range []string{"input", "output"} {
+		identity, configJSON, err := providerDefinition(task, role)
+		if err != nil {
+			identity = err.Error()
+		}
+		fingerprint += identity + configJSON
+	}
+	return fingerprint
+}
+
+// taskSettings is the part of a task's definition that applies to the pipeline
+// as a whole. While it stays the same, a changed task is reloaded in place.
+func taskSettings(task *config.TaskBlock) string {
+	settings, _ := json.Marshal(struct {
+		ShutdownSequence string
+		Timeouts         *config.TimeoutsBlock
+		Restart          *config.RestartBlock
+		Schedule         *config.ScheduleBlock
+		Bootstrap        string
+		FaultInjection   *config.FaultInjectionBlock
+	}{task.ShutdownSequence, task.Timeouts, task.Restart, task.Schedule, bootstrapDefinition(task), task.FaultInjection})
+	return string(settings)
+}
+
+// bootstrapDefinition renders a task's snapshot provider and its config, or ""
+// for a task without a bootstrap block
+func bootstrapDefinition(task *config.TaskBlock) string {
+	snapshot := task.BootstrapTask()
+	if snapshot == nil {
+		return ""
+	}
+	identity, configJSON, err := providerDefinition(snapshot, "input")
+	if err != nil {
+		return err.Error()
+	}
+	return identity + configJSON
+}
+
+// runAttempt runs a task's pipeline once, as `dstream run` does
+func runAttempt(task *config.TaskBlock, signals <-chan os.Signal, reloads <-chan *config.TaskBlock, opts RunOptions) (RunSummary, error) {
+	startedAt := time.Now()
+	ctx, span := startTaskSpan(context.Background(), task, "run")
+	summary, err := runPipelineSummary(ctx, task, signals, reloads, opts)
+	tracing.End(span, err)
+	recordLastRun(task, "run", startedAt, err)
+	return summary, err
+}
@@ -0,0 +1,264 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/health"
+)
+
+func TestSuperviseIsolatesAndRestartsTasks(t *testing.T) {
+	useTempStateStore(t)
+	dir := t.TempDir()
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", filepath.Join(dir, "drain.log"))
+
+	healthy := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	flaky := helperTask(t, "flaky", helperProvider{Config: "fail = true"}, helperProvider{})
+	flaky.Restart = &config.RestartBlock{Policy: config.RestartOnFailure, MaxRestarts: 2, Backoff: "10ms"}
+
+	tasks := []*config.TaskBlock{healthy, flaky}
+	restartsBefore := health.Default.Task("flaky").Restarts()
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- NewSupervisor(RunOptions{}).supervise(tasks, signals, nil) }()
+
+	// The flaky task gives up after its restarts while the healthy one keeps going
+	deadline := time.Now().Add(10 * time.Second)
+	for health.Default.Task("flaky").Restarts()-restartsBefore < 2*2 {
+		if time.Now().After(deadline) {
+			t.Fatal("flaky task was not restarted before deadline")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("supervisor returned while a task was still running: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), `task "flaky"`) || strings.Contains(err.Error(), `task "recorded"`) {
+			t.Fatalf("expected only the flaky task to fail, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("supervisor did not stop after SIGTERM")
+	}
+}
+
+func TestSuperviseRejectsMixedOptions(t *testing.T) {
+	task := helperTask(t, "recorded", helperProvider{}, helperProvider{})
+	if err := checkSupervised([]*config.TaskBlock{task, task}, RunOptions{Output: StdioEndpoint}); err == nil {
+		t.Fatal("expected stdio options to be rejected for several tasks")
+	}
+	legacy := parseTask(t, `task "legacy" {
+  type = "plugin"
+}`)
+	if err := checkSupervised([]*config.TaskBlock{task, legacy}, RunOptions{}); err == nil {
+		t.Fatal("expected a plugin task to be rejected")
+	}
+}
+
+func TestSupervisorApplyRestartsOnlyChangedTasks(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	s := NewSupervisor(RunOptions{})
+	t.Cleanup(func() {
+		s.StopAll(syscall.SIGTERM)
+		s.Wait()
+	})
+
+	result, err := s.Apply([]*config.TaskBlock{helperTask(t, "a", helperProvider{}, helperProvider{}), helperTask(t, "b", helperProvider{}, helperProvider{})})
+	if err != nil || len(result.Started) != 2 {
+		t.Fatalf("expected both tasks started, got %+v (err=%v)", result, err)
+	}
+	before, _ := s.Task("a")
+	beforeB, _ := s.Task("b")
+
+	// b's output config changes, so it is reloaded in place; c is new and a is untouched
+	result, err = s.Apply([]*config.TaskBlock{
+		helperTask(t, "a", helperProvider{}, helperProvider{}),
+		helperTask(t, "b", helperProvider{}, helperProvider{Config: `batch = 10`}),
+		helperTask(t, "c", helperProvider{}, helperProvider{}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(result.Unchanged) != "[a]" || fmt.Sprint(result.Reloaded) != "[b]" || fmt.Sprint(result.Started) != "[c]" {
+		t.Fatalf("unexpected reload result: %+v", result)
+	}
+	if after, _ := s.Task("a"); !after.StartedAt.Equal(before.StartedAt) || after.State != TaskRunning {
+		t.Fatalf("unchanged task was disturbed: %+v", after)
+	}
+	if after, _ := s.Task("b"); !after.StartedAt.Equal(beforeB.StartedAt) || after.ConfigHash == beforeB.ConfigHash {
+		t.Fatalf("expected b to keep running with its new config: %+v", after)
+	}
+
+	// Removing a task stops it; stopping and starting work by name
+	result, err = s.Apply([]*config.TaskBlock{helperTask(t, "a", helperProvider{}, helperProvider{}), helperTask(t, "b", helperProvider{}, helperProvider{Config: `batch = 10`})})
+	if err != nil || fmt.Sprint(result.Stopped) != "[c]" {
+		t.Fatalf("expected c to be stopped, got %+v (err=%v)", result, err)
+	}
+	if err := s.Stop("a"); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := s.Task("a"); st.State != TaskStopped {
+		t.Fatalf("expected a to be stopped, got %+v", st)
+	}
+	if err := s.StartTask("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartTask("a"); !errors.Is(err, ErrTaskRunning) {
+		t.Fatalf("expected ErrTaskRunning, got %v", err)
+	}
+	if err := s.Stop("missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound, got %v", err)
+	}
+}
+
+func TestSupervisorStartsTasksAfterTheirDependencies(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "slow_ready")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	// up takes a while to become ready; down depends on it but is applied first
+	up := helperTask(t, "up", helperProvider{}, helperProvider{Config: `delay = "300ms"`})
+	down := helperTask(t, "down", helperProvider{}, helperProvider{})
+	down.DependsOn = []string{"up"}
+
+	s := NewSupervisor(RunOptions{})
+	t.Cleanup(func() {
+		s.StopAll(syscall.SIGTERM)
+		s.Wait()
+	})
+	if _, err := s.Apply([]*config.TaskBlock{down, up}); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := s.Task("down"); st.State != TaskWaiting {
+		t.Fatalf("expected down to wait for up, got %+v", st)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if st, _ := s.Task("down"); st.State == TaskRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("down did not start after up was running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if phase := health.Default.Task("up").Phase(); phase != health.PhaseRunning {
+		t.Fatalf("down started while up was %s", phase)
+	}
+}
+
+func TestSupervisorStartsTasksAfterACompletedDependency(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "drain")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	s := NewSupervisor(RunOptions{Batch: true})
+	t.Cleanup(func() {
+		s.StopAll(syscall.SIGTERM)
+		s.Wait()
+	})
+
+	// up is a batch task whose input ends after a few events
+	up := helperTask(t, "up", helperProvider{Config: `count = 3`}, helperProvider{})
+	if _, err := s.Apply([]*config.TaskBlock{up}); err != nil {
+		t.Fatal(err)
+	}
+	waitForTaskState(t, s, "up", TaskStopped)
+
+	down := helperTask(t, "down", helperProvider{}, helperProvider{})
+	down.DependsOn = []string{"up"}
+	if _, err := s.Apply([]*config.TaskBlock{up, down}); err != nil {
+		t.Fatal(err)
+	}
+	waitForTaskState(t, s, "down", TaskRunning)
+}
+
+// waitForTaskState waits for a supervised task to reach state
+func waitForTaskState(t *testing.T, s *Supervisor, name, state string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		st, _ := s.Task(name)
+		if st.State == state {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not reach %s: %+v", name, state, st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisorApplyUpdatesAnUnchangedTasksDependencies(t *testing.T) {
+	useTempStateStore(t)
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "slow_ready")
+	t.Setenv("DRAIN_LOG", filepath.Join(t.TempDir(), "drain.log"))
+
+	// up is slow to become ready, so down waits for it
+	up := helperTask(t, "up", helperProvider{}, helperProvider{Config: `delay = "2s"`})
+	down := helperTask(t, "down", helperProvider{}, helperProvider{})
+	down.DependsOn = []string{"up"}
+
+	s := NewSupervisor(RunOptions{})
+	t.Cleanup(func() {
+		s.StopAll(syscall.SIGTERM)
+		s.Wait()
+	})
+	if _, err := s.Apply([]*config.TaskBlock{up, down}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping the dependency doesn't change down's pipeline, but it stops waiting
+	result, err := s.Apply([]*config.TaskBlock{up, helperTask(t, "down", helperProvider{}, helperProvider{})})
+	if err != nil || fmt.Sprint(result.Unchanged) != "[up down]" {
+		t.Fatalf("expected both tasks unchanged, got %+v (err=%v)", result, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if st, _ := s.Task("down"); st.State == TaskRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("down kept waiting for a dependency it no longer has")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTaskFingerprint(t *testing.T) {
+	base := taskFingerprint(helperTask(t, "a", helperProvider{}, helperProvider{}))
+	for _, tc := range []struct {
+		name    string
+		updated *config.TaskBlock
+		changed bool
+	}{
+		{"same", helperTask(t, "a", helperProvider{}, helperProvider{}), false},
+		{"input config", helperTask(t, "a", helperProvider{Config: `label = "y:"`}, helperProvider{}), true},
+		{"input reconfigure", helperTask(t, "a", helperProvider{Block: `reconfigure = true`}, helperProvider{}), true},
+		{"output timeouts", helperTask(t, "a", helperProvider{}, helperProvider{Block: `timeouts {
+      ready = "1s"
+    }`}), true},
+	} {
+		if changed := taskFingerprint(tc.updated) != base; changed != tc.changed {
+			t.Errorf("%s: expected changed=%v", tc.name, tc.changed)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startTaskSpan starts the root span for one command against a task
+func startTaskSpan(ctx context.Context, task *config.TaskBlock, command string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "dstream."+command, trace.WithAttributes(
+		attribute.String("dstream.task", task.Name),
+		attribute.String("dstream.command", command),
+	))
+}
+
+// withTraceContext passes the current span to the provider in the envelope, so it
+// can parent its own spans without reading the environment
+func withTraceContext(ctx context.Context) envelopeOption {
+	traceparent, tracestate := tracing.Traceparent(ctx)
+	return func(envelope map[string]interface{}) {
+		if traceparent == "" {
+			return
+		}
+		envelope["traceparent"] = traceparent
+		if tracestate != "" {
+			envelope["tracestate"] = tracestate
+		}
+	}
+}
+
+// traceEvent starts a span for one sampled event on its way through the relay.
+//
+// If the input provider put a traceparent in the event metadata the span continues
+// that trace; otherwise it is a child of ctx. The event is forwarded with the
+// relay span's traceparent in its metadata, so the output provider can attach its
+// write as a child; the rest of the line is passed on byte for byte. Lines that
+// aren't data envelopes get a span but are unchanged.
+func traceEvent(ctx context.Context, line string) (string, trace.Span) {
+	var event struct {
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		_, span := tracing.Start(ctx, "relay.event")
+		return line, span
+	}
+	// A field that isn't a string is left empty
+	var metadata struct {
+		Traceparent string `json:"traceparent"`
+		Tracestate  string `json:"tracestate"`
+		Table       string `json:"table"`
+		Operation   string `json:"operation"`
+	}
+	json.Unmarshal(event.Metadata, &metadata)
+
+	// An event traced by the input continues its trace, linked back to the run
+	parent, opts := ctx, []trace.SpanStartOption(nil)
+	if metadata.Traceparent != "" {
+		parent = tracing.ContextWithTraceparent(ctx, metadata.Traceparent, metadata.Tracestate)
+		opts = append(opts, trace.WithLinks(trace.LinkFromContext(ctx)))
+	}
+
+	spanCtx, span := tracing.Start(parent, "relay.event", opts...)
+	if metadata.Table != "" {
+		span.SetAttributes(attribute.String("event.table", metadata.Table))
+	}
+	if metadata.Operation != "" {
+		span.SetAttributes(attribute.String("event.operation", metadata.Operation))
+	}
+
+	traceparent, tracestate := tracing.Traceparent(spanCtx)
+	if traceparent == "" {
+		return line, span
+	}
+	tp, _ := json.Marshal(traceparent)
+	fields := []jsonField{{"traceparent", tp}}
+	if tracestate != "" {
+		ts, _ := json.Marshal(tracestate)
+		fields = append(fields, jsonField{"tracestate", ts})
+	}
+	traced, err := setJSONFields([]byte(event.Metadata), fields...)
+	if err != nil {
+		// Metadata that isn't an object is replaced
+		traced, err = setJSONFields([]byte("{}"), fields...)
+	}
+	if err == nil {
+		traced, err = setJSONFields([]byte(line), jsonField{"metadata", traced})
+	}
+	if err != nil {
+		return line, span
+	}
+	return string(traced), span
+}
+
+// jsonField is a key and its JSON-encoded value for setJSONFields
+type jsonField struct {
+	key   string
+	value []byte
+}
+
+// setJSONFields sets fields of the JSON object in data, replacing the values of
+// keys it has and adding the others at the end. Everything else in data is kept
+// as it was, down to key order, whitespace and number formatting.
+func setJSONFields(data []byte, fields ...jsonField) ([]byte, error) {
+	values := make(map[string][]byte, len(fields))
+	for _, f := range fields {
+		values[f.key] = f.value
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	var out bytes.Buffer
+	copied, empty := 0, true
+	found := make(map[string]bool, len(fields))
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		empty = false
+		key, _ := tok.(string)
+		if replacement, ok := values[key]; ok {
+			end := int(dec.InputOffset())
+			out.Write(data[copied : end-len(value)])
+			out.Write(replacement)
+			copied, found[key] = end, true
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	closing := int(dec.InputOffset()) - 1
+	out.Write(data[copied:closing])
+	for _, f := range fields {
+		if found[f.key] {
+			continue
+		}
+		if !empty {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(values[f.key])
+		empty = false
+	}
+	out.Write(data[closing:])
+	return out.Bytes(), nil
+}
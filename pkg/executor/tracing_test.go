@@ -0,0 +1,166 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/katasec/dstream/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useSpanRecorder installs a tracer provider that keeps finished spans in memory
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		tp.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestLifecycleSpansAndTraceContext(t *testing.T) {
+	useTempStateStore(t)
+	recorder := useSpanRecorder(t)
+	traceLog := filepath.Join(t.TempDir(), "trace.log")
+	t.Setenv("TEST_PROVIDER_BEHAVIOR", "trace_context")
+	t.Setenv("TRACE_LOG", traceLog)
+
+	if err := ExecuteProviderTaskWithCommand(helperTask(t, "ordered", helperProvider{}, helperProvider{}), "status"); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+
+	var root trace.SpanContext
+	names := make(map[string]int)
+	for _, s := range recorder.Ended() {
+		names[s.Name()]++
+		if s.Name() == "dstream.status" {
+			root = s.SpanContext()
+		}
+	}
+	for name, want := range map[string]int{"dstream.status": 1, "provider.status": 2, "provider.resolve": 2, "provider.handshake": 2} {
+		if names[name] != want {
+			t.Errorf("expected %d %q spans, got %d (all: %v)", want, name, names[name], names)
+		}
+	}
+
+	data, err := os.ReadFile(traceLog)
+	if err != nil {
+		t.Fatalf("read trace log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected both providers to record trace context, got %q", data)
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != fields[1] {
+			t.Fatalf("expected the same traceparent in env and envelope, got %q", line)
+		}
+		if !strings.Contains(fields[0], root.TraceID().String()) {
+			t.Fatalf("traceparent %q is not part of trace %s", fields[0], root.TraceID())
+		}
+	}
+}
+
+func TestTraceEventContinuesInputTrace(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	// The input provider traced this event itself
+	inputCtx, inputSpan := tracing.Start(context.Background(), "provider.emit")
+	inputTraceparent, _ := tracing.Traceparent(inputCtx)
+	inputSpan.End()
+
+	line := `{"metadata":{"table":"cars","traceparent":"` + inputTraceparent + `"},"data":{"id":1}}`
+	runCtx, runSpan := tracing.Start(context.Background(), "dstream.run")
+	traced, span := traceEvent(runCtx, line)
+	span.End()
+	runSpan.End()
+
+	var event struct {
+		Metadata map[string]interface{} `json:"metadata"`
+		Data     map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(traced), &event); err != nil {
+		t.Fatalf("traced event is not JSON: %v", err)
+	}
+	if event.Data["id"] != float64(1) || event.Metadata["table"] != "cars" {
+		t.Fatalf("event content changed: %s", traced)
+	}
+
+	relayTraceparent, _ := event.Metadata["traceparent"].(string)
+	if relayTraceparent == inputTraceparent || !strings.Contains(relayTraceparent, inputSpan.SpanContext().TraceID().String()) {
+		t.Fatalf("expected a relay traceparent in the input's trace, got %q", relayTraceparent)
+	}
+
+	for _, s := range recorder.Ended() {
+		if s.Name() != "relay.event" {
+			continue
+		}
+		if s.Parent().SpanID() != inputSpan.SpanContext().SpanID() {
+			t.Errorf("relay span should be a child of the input's span")
+		}
+		if len(s.Links()) != 1 || s.Links()[0].SpanContext.TraceID() != runSpan.SpanContext().TraceID() {
+			t.Errorf("relay span should link back to the run")
+		}
+		return
+	}
+	t.Fatal("no relay.event span recorded")
+}
+
+func TestTraceEventOnlyAddsTheTraceparent(t *testing.T) {
+	useSpanRecorder(t)
+	inputCtx, inputSpan := tracing.Start(context.Background(), "provider.emit")
+	inputTraceparent, _ := tracing.Traceparent(inputCtx)
+	inputSpan.End()
+
+	// Integers past 2^53, key order and spacing all survive
+	for _, tt := range []struct {
+		line string
+		want string // with %s for the relay's traceparent
+	}{
+		{
+			`{"metadata": {"table": "cars", "lsn": 12345678901234567890}, "data": {"price": 1.50, "id": 9007199254740993}}`,
+			`{"metadata": {"table": "cars", "lsn": 12345678901234567890,"traceparent":"%s"}, "data": {"price": 1.50, "id": 9007199254740993}}`,
+		},
+		{
+			`{"metadata":{"traceparent":"` + inputTraceparent + `", "z":1e400},"data":{}}`,
+			`{"metadata":{"traceparent":"%s", "z":1e400},"data":{}}`,
+		},
+		{`{"data":{"id":9007199254740993}}`, `{"data":{"id":9007199254740993},"metadata":{"traceparent":"%s"}}`},
+		{`{"metadata":null}`, `{"metadata":{"traceparent":"%s"}}`},
+		{`{}`, `{"metadata":{"traceparent":"%s"}}`},
+	} {
+		traced, span := traceEvent(context.Background(), tt.line)
+		span.End()
+		var event struct {
+			Metadata struct {
+				Traceparent string `json:"traceparent"`
+			} `json:"metadata"`
+		}
+		json.Unmarshal([]byte(traced), &event)
+		if tp := event.Metadata.Traceparent; tp == "" || tp == inputTraceparent || traced != fmt.Sprintf(tt.want, tp) {
+			t.Errorf("%s: got %s", tt.line, traced)
+		}
+	}
+}
+
+func TestTraceEventLeavesNonEnvelopeLines(t *testing.T) {
+	useSpanRecorder(t)
+	traced, span := traceEvent(context.Background(), "plain text")
+	span.End()
+	if traced != "plain text" {
+		t.Fatalf("expected non-JSON line unchanged, got %q", traced)
+	}
+}
@@ -1,5 +1,11 @@
 package executor
 
-import "github.com/katasec/dstream/pkg/logging"
+import (
+	"github.com/katasec/dstream/pkg/logging"
+	"github.com/katasec/dstream/pkg/state"
+)
 
 var log = logging.GetHCLogger()
+
+// stateStore holds per-task state in the working directory
+var stateStore = state.NewStore(state.DefaultDir)
@@ -0,0 +1,303 @@
+// Package health tracks the runtime status of running tasks and serves it over
+// HTTP for container orchestrators: /healthz for liveness, /readyz for readiness
+// and /status for a JSON description of each task.
+package health
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStallThreshold is how long a single write to the output provider may
+// block before the task is reported as not ready
+const DefaultStallThreshold = 60 * time.Second
+
+// Task phases
+const (
+	PhaseStarting = "starting"
+	PhaseRunning  = "running"
+	PhaseStopping = "stopping"
+	PhaseStopped  = "stopped"
+	PhaseFailed   = "failed"
+)
+
+// throughputWindow is the number of seconds events per second is averaged over
+const throughputWindow = 60
+
+// Registry holds the status of every task run by this process
+type Registry struct {
+	// StallThreshold overrides DefaultStallThreshold when set
+	StallThreshold time.Duration
+
+	started time.Time
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+// Default is the registry the executor reports to and `--health-addr` serves
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		started: time.Now(),
+		tasks:   make(map[string]*Task),
+	}
+}
+
+// Task returns the status of a task, creating it on first use
+func (r *Registry) Task(name string) *Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tasks[name]; ok {
+		return t
+	}
+	t := &Task{
+		name:      name,
+		phase:     PhaseStarting,
+		startedAt: time.Now(),
+		providers: make(map[string]*providerStatus),
+	}
+	r.tasks[name] = t
+	return t
+}
+
+// tasksSorted returns the registered tasks ordered by name
+func (r *Registry) tasksSorted() []*Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tasks := make([]*Task, 0, len(r.tasks))
+	for _, t := range r.tasks {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].name < tasks[j].name })
+	return tasks
+}
+
+func (r *Registry) stallThreshold() time.Duration {
+	if r.StallThreshold > 0 {
+		return r.StallThreshold
+	}
+	return DefaultStallThreshold
+}
+
+// Task is the live status of one task. The relay counters are atomic and the
+// throughput buckets hold the lock only briefly, so they can be updated per event.
+type Task struct {
+	name string
+
+	eventsRelayed atomic.Int64
+	bytesRelayed  atomic.Int64
+	lastEvent     atomic.Int64 // unix nanoseconds, zero until the first event
+	writeStarted  atomic.Int64 // unix nanoseconds of the write in progress, zero when idle
+
+	mu        sync.Mutex
+	phase     string
+	startedAt time.Time
+	providers map[string]*providerStatus
+	lastError string
+	errorAt   time.Time
+	bootstrap *BootstrapStatus // nil unless the run started with a snapshot
+	buckets   [throughputWindow]bucket
+}
+
+type providerStatus struct {
+	pid       int
+	startedAt time.Time
+	ready     bool
+	exited    bool
+	exitError string
+	restarts  int
+}
+
+// bucket counts the events relayed during one second
+type bucket struct {
+	second int64
+	events int64
+}
+
+// Starting resets the task for a new run, keeping provider restart counts
+func (t *Task) Starting() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phase = PhaseStarting
+	t.startedAt = time.Now()
+	t.bootstrap = nil
+	for role, p := range t.providers {
+		t.providers[role] = &providerStatus{restarts: p.restarts}
+	}
+}
+
+// Phase returns the task's current phase
+func (t *Task) Phase() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phase
+}
+
+// ProviderStarted records a provider process that has been launched
+func (t *Task) ProviderStarted(role string, pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.provider(role)
+	p.pid, p.startedAt, p.ready, p.exited, p.exitError = pid, time.Now(), false, false, ""
+}
+
+// ProviderReady records a provider that has completed its handshake. The task
+// is running once every started provider is ready.
+func (t *Task) ProviderReady(role string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.provider(role).ready = true
+	for _, p := range t.providers {
+		if !p.ready {
+			return
+		}
+	}
+	if t.phase == PhaseStarting {
+		t.phase = PhaseRunning
+	}
+}
+
+// ProviderExited records a provider process that has exited
+func (t *Task) ProviderExited(role string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.provider(role)
+	p.exited, p.ready = true, false
+	if err != nil {
+		p.exitError = err.Error()
+	}
+}
+
+// ProviderRestarted counts a restart of a provider process
+func (t *Task) ProviderRestarted(role string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.provider(role).restarts++
+}
+
+// Restarts returns the number of provider restarts since the task was registered
+func (t *Task) Restarts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, p := range t.providers {
+		n += p.restarts
+	}
+	return n
+}
+
+// Snapshotting records the progress of the task's bootstrap snapshot: done of
+// total as the provider counts them, total 0 if unknown, and the events relayed
+func (t *Task) Snapshotting(done, total, events int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bootstrap = &BootstrapStatus{State: BootstrapSnapshotting, Done: done, Total: total, Events: events}
+}
+
+// Bootstrapped records that the snapshot completed and streaming took over
+func (t *Task) Bootstrapped() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bootstrap == nil {
+		t.bootstrap = &BootstrapStatus{}
+	}
+	t.bootstrap.State = BootstrapStreaming
+}
+
+// Stopping records that the task is shutting down
+func (t *Task) Stopping() {
+	t.setPhase(PhaseStopping)
+}
+
+// Stopped records the end of a run; a non-nil err marks it failed
+func (t *Task) Stopped(err error) {
+	if err != nil {
+		t.Failed(err)
+		return
+	}
+	t.setPhase(PhaseStopped)
+}
+
+// Failed records the error that stopped the task
+func (t *Task) Failed(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phase = PhaseFailed
+	t.lastError = err.Error()
+	t.errorAt = time.Now()
+}
+
+// WriteStarted marks the start of a write to the output provider
+func (t *Task) WriteStarted() {
+	t.writeStarted.Store(time.Now().UnixNano())
+}
+
+// EventRelayed records a completed write of one event
+func (t *Task) EventRelayed(bytes int) {
+	now := time.Now()
+	t.writeStarted.Store(0)
+	t.eventsRelayed.Add(1)
+	t.bytesRelayed.Add(int64(bytes))
+	t.lastEvent.Store(now.UnixNano())
+
+	sec := now.Unix()
+	t.mu.Lock()
+	b := &t.buckets[sec%throughputWindow]
+	if b.second != sec {
+		b.second, b.events = sec, 0
+	}
+	b.events++
+	t.mu.Unlock()
+}
+
+// WriteFailed clears the write in progress after an error
+func (t *Task) WriteFailed() {
+	t.writeStarted.Store(0)
+}
+
+func (t *Task) setPhase(phase string) {
+	t.mu.Lock()
+	t.phase = phase
+	t.mu.Unlock()
+}
+
+// provider returns the status for role, creating it; t.mu must be held
+func (t *Task) provider(role string) *providerStatus {
+	p, ok := t.providers[role]
+	if !ok {
+		p = &providerStatus{}
+		t.providers[role] = p
+	}
+	return p
+}
+
+// eventsPerSecond averages the completed seconds in the window, or since the
+// task started if that is shorter; t.mu must be held
+func (t *Task) eventsPerSecond(now time.Time) float64 {
+	current := now.Unix()
+	seconds := min(int64(throughputWindow), current-t.startedAt.Unix())
+	if seconds <= 0 {
+		return 0
+	}
+
+	var events int64
+	for _, b := range t.buckets {
+		if b.second < current && b.second >= current-seconds {
+			events += b.events
+		}
+	}
+	return float64(events) / float64(seconds)
+}
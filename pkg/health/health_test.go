@@ -0,0 +1,133 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, r *Registry, path string) (int, string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	r.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealthzAlwaysOK(t *testing.T) {
+	if code, body := get(t, NewRegistry(), "/healthz"); code != http.StatusOK || strings.TrimSpace(body) != "ok" {
+		t.Fatalf("unexpected /healthz response: %d %q", code, body)
+	}
+}
+
+func TestReadyzFollowsProviderHandshakes(t *testing.T) {
+	r := NewRegistry()
+	if code, body := get(t, r, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "no tasks running") {
+		t.Fatalf("expected not ready without tasks, got %d %q", code, body)
+	}
+
+	task := r.Task("cdc")
+	task.Starting()
+	task.ProviderStarted("input", 101)
+	task.ProviderStarted("output", 102)
+	task.ProviderReady("input")
+	if code, body := get(t, r, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "task is starting") {
+		t.Fatalf("expected not ready before output handshake, got %d %q", code, body)
+	}
+
+	task.ProviderReady("output")
+	if code, body := get(t, r, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected ready, got %d %q", code, body)
+	}
+
+	task.ProviderExited("output", errors.New("exit status 1"))
+	if code, body := get(t, r, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "output provider is not ready") {
+		t.Fatalf("expected not ready after output exit, got %d %q", code, body)
+	}
+}
+
+func TestReadyzReportsStalledRelay(t *testing.T) {
+	r := NewRegistry()
+	r.StallThreshold = 50 * time.Millisecond
+	task := r.Task("cdc")
+	task.ProviderStarted("input", 1)
+	task.ProviderStarted("output", 2)
+	task.ProviderReady("input")
+	task.ProviderReady("output")
+
+	// An idle relay is ready
+	if code, _ := get(t, r, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected idle relay to be ready, got %d", code)
+	}
+
+	task.WriteStarted()
+	time.Sleep(100 * time.Millisecond)
+	if code, body := get(t, r, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "relay stalled") {
+		t.Fatalf("expected stalled relay, got %d %q", code, body)
+	}
+
+	task.EventRelayed(10)
+	if code, _ := get(t, r, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected ready once the write completed, got %d", code)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	r := NewRegistry()
+	task := r.Task("cdc")
+	task.ProviderStarted("input", 101)
+	task.ProviderStarted("output", 102)
+	task.ProviderReady("input")
+	task.ProviderReady("output")
+	task.ProviderRestarted("output")
+	task.EventRelayed(40)
+	task.EventRelayed(60)
+	task.Failed(errors.New("output provider failed: exit status 2"))
+
+	code, body := get(t, r, "/status")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d", code)
+	}
+
+	var status Status
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatalf("decode status: %v\n%s", err, body)
+	}
+	if len(status.Tasks) != 1 {
+		t.Fatalf("expected one task, got %d", len(status.Tasks))
+	}
+	s := status.Tasks[0]
+	if s.Name != "cdc" || s.Phase != PhaseFailed || s.Ready {
+		t.Errorf("unexpected task status: %+v", s)
+	}
+	if s.Providers["input"].PID != 101 || s.Providers["output"].Restarts != 1 {
+		t.Errorf("unexpected providers: %+v", s.Providers)
+	}
+	if s.Relay.EventsRelayed != 2 || s.Relay.BytesRelayed != 100 || s.Relay.LastEventAt == nil {
+		t.Errorf("unexpected relay status: %+v", s.Relay)
+	}
+	if s.LastError == nil || !strings.Contains(s.LastError.Message, "exit status 2") {
+		t.Errorf("expected last error, got %+v", s.LastError)
+	}
+}
+
+func TestEventsPerSecond(t *testing.T) {
+	task := NewRegistry().Task("cdc")
+	now := time.Now()
+	task.startedAt = now.Add(-10 * time.Second)
+	for i := 1; i <= 4; i++ {
+		sec := now.Unix() - int64(i)
+		task.buckets[sec%throughputWindow] = bucket{second: sec, events: 5}
+	}
+	// The current second is still filling and isn't counted
+	task.buckets[now.Unix()%throughputWindow] = bucket{second: now.Unix(), events: 100}
+
+	if got := task.eventsPerSecond(now); got != 2 {
+		t.Fatalf("expected 20 events over 10s = 2/s, got %v", got)
+	}
+}
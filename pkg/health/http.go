@@ -0,0 +1,196 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/katasec/dstream/pkg/httpserver"
+)
+
+// Status is the JSON document served at /status
+type Status struct {
+	UptimeSeconds float64      `json:"uptime_seconds"`
+	Tasks         []TaskStatus `json:"tasks"`
+}
+
+// TaskStatus describes one task
+type TaskStatus struct {
+	Name          string                    `json:"name"`
+	Phase         string                    `json:"phase"`
+	Ready         bool                      `json:"ready"`
+	NotReady      string                    `json:"not_ready_reason,omitempty"`
+	StartedAt     time.Time                 `json:"started_at"`
+	UptimeSeconds float64                   `json:"uptime_seconds"`
+	Providers     map[string]ProviderStatus `json:"providers"`
+	Relay         RelayStatus               `json:"relay"`
+	LastError     *ErrorStatus              `json:"last_error,omitempty"`
+	Bootstrap     *BootstrapStatus          `json:"bootstrap,omitempty"`
+}
+
+// ProviderStatus describes one provider process
+type ProviderStatus struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	Ready     bool      `json:"ready"`
+	Exited    bool      `json:"exited"`
+	ExitError string    `json:"exit_error,omitempty"`
+	Restarts  int       `json:"restarts"`
+}
+
+// RelayStatus describes the data flowing between the providers
+type RelayStatus struct {
+	EventsRelayed         int64      `json:"events_relayed"`
+	BytesRelayed          int64      `json:"bytes_relayed"`
+	EventsPerSecond       float64    `json:"events_per_second"`
+	LastEventAt           *time.Time `json:"last_event_at,omitempty"`
+	SecondsSinceLastEvent *float64   `json:"seconds_since_last_event,omitempty"`
+}
+
+// Bootstrap states
+const (
+	BootstrapSnapshotting = "snapshotting"
+	BootstrapStreaming    = "streaming" // the snapshot completed and the input took over
+)
+
+// BootstrapStatus describes the snapshot phase of a run that started with one
+type BootstrapStatus struct {
+	State  string `json:"state"`
+	Done   int64  `json:"done"`
+	Total  int64  `json:"total,omitempty"`
+	Events int64  `json:"events"`
+}
+
+// ErrorStatus is the last error a task stopped with
+type ErrorStatus struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// Snapshot returns the status of every task
+func (r *Registry) Snapshot() Status {
+	now := time.Now()
+	status := Status{
+		UptimeSeconds: now.Sub(r.started).Seconds(),
+		Tasks:         []TaskStatus{},
+	}
+	for _, t := range r.tasksSorted() {
+		status.Tasks = append(status.Tasks, t.snapshot(now, r.stallThreshold()))
+	}
+	return status
+}
+
+func (t *Task) snapshot(now time.Time, stallThreshold time.Duration) TaskStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := TaskStatus{
+		Name:          t.name,
+		Phase:         t.phase,
+		StartedAt:     t.startedAt,
+		UptimeSeconds: now.Sub(t.startedAt).Seconds(),
+		Providers:     make(map[string]ProviderStatus, len(t.providers)),
+		Relay: RelayStatus{
+			EventsRelayed:   t.eventsRelayed.Load(),
+			BytesRelayed:    t.bytesRelayed.Load(),
+			EventsPerSecond: t.eventsPerSecond(now),
+		},
+	}
+	for role, p := range t.providers {
+		s.Providers[role] = ProviderStatus{
+			PID:       p.pid,
+			StartedAt: p.startedAt,
+			Ready:     p.ready,
+			Exited:    p.exited,
+			ExitError: p.exitError,
+			Restarts:  p.restarts,
+		}
+	}
+	if last := t.lastEvent.Load(); last != 0 {
+		at := time.Unix(0, last)
+		age := now.Sub(at).Seconds()
+		s.Relay.LastEventAt, s.Relay.SecondsSinceLastEvent = &at, &age
+	}
+	if t.lastError != "" {
+		s.LastError = &ErrorStatus{Message: t.lastError, At: t.errorAt}
+	}
+	if t.bootstrap != nil {
+		b := *t.bootstrap
+		s.Bootstrap = &b
+	}
+
+	s.NotReady = t.notReadyReason(now, stallThreshold)
+	s.Ready = s.NotReady == ""
+	return s
+}
+
+// notReadyReason explains why the task is not ready, or returns "" if it is;
+// t.mu must be held
+func (t *Task) notReadyReason(now time.Time, stallThreshold time.Duration) string {
+	if t.phase != PhaseRunning {
+		return "task is " + t.phase
+	}
+	for _, role := range []string{"input", "output"} {
+		if p, ok := t.providers[role]; ok && !p.ready {
+			return role + " provider is not ready"
+		}
+	}
+	// An idle relay is fine; a write that has been blocked too long is not
+	if started := t.writeStarted.Load(); started != 0 {
+		if blocked := now.Sub(time.Unix(0, started)); blocked > stallThreshold {
+			return fmt.Sprintf("relay stalled: write to output provider blocked for %s", blocked.Round(time.Second))
+		}
+	}
+	return ""
+}
+
+// Register mounts /healthz, /readyz and /status
+func (r *Registry) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", r.handleHealthz)
+	mux.HandleFunc("/readyz", r.handleReadyz)
+	mux.HandleFunc("/status", r.handleStatus)
+}
+
+// Serve starts serving the health endpoints on addr
+func (r *Registry) Serve(addr string) (*httpserver.Server, error) {
+	mux := http.NewServeMux()
+	r.Register(mux)
+	return httpserver.Serve(addr, mux)
+}
+
+// handleHealthz answers as long as DStream itself is responsive
+func (r *Registry) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz succeeds when every task is running with ready providers and a
+// relay that is moving or idle
+func (r *Registry) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	status := r.Snapshot()
+
+	var reasons []string
+	if len(status.Tasks) == 0 {
+		reasons = append(reasons, "no tasks running")
+	}
+	for _, t := range status.Tasks {
+		if !t.Ready {
+			reasons = append(reasons, fmt.Sprintf("task %q: %s", t.Name, t.NotReady))
+		}
+	}
+
+	if len(reasons) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(reasons, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+func (r *Registry) handleStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(r.Snapshot())
+}
@@ -0,0 +1,292 @@
+// Package history keeps an audit trail of task runs: when each run started and
+// stopped, why it stopped, what it ran, and how much data it moved.
+//
+// Runs are appended, one JSON object per line, to a file per task under the
+// user's DStream home:
+//
+//	~/.dstream/history/<task>.jsonl
+//
+// where <task> is the task name as state.EscapeTaskName writes it, the same as
+// the task's state directory, so every task's file is in the history directory.
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/katasec/dstream/pkg/state"
+)
+
+// Run statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ErrNotFound is returned by Get when no run has the given ID
+var ErrNotFound = errors.New("run not found")
+
+// Run is one execution of a task
+type Run struct {
+	ID         string                  `json:"id"`
+	Task       string                  `json:"task"`
+	Command    string                  `json:"command"`
+	ConfigHash string                  `json:"config_hash,omitempty"`
+	Providers  map[string]ProviderInfo `json:"providers,omitempty"` // keyed by role
+	StartedAt  time.Time               `json:"started_at"`
+	FinishedAt time.Time               `json:"finished_at"`
+	Status     string                  `json:"status"`
+	ExitReason string                  `json:"exit_reason"`
+	Error      string                  `json:"error,omitempty"`
+
+	EventsRelayed int64 `json:"events_relayed"`
+	EventsDropped int64 `json:"events_dropped"`
+	BytesRelayed  int64 `json:"bytes_relayed"`
+	Restarts      int   `json:"restarts"`
+
+	// FaultsInjected counts the faults a fault_injection block injected, by kind
+	FaultsInjected map[string]int64 `json:"faults_injected,omitempty"`
+
+	// StderrTail holds each provider's last stderr lines, kept only for failed runs
+	StderrTail map[string][]string `json:"stderr_tail,omitempty"`
+}
+
+// ProviderInfo records which provider binary a run used
+type ProviderInfo struct {
+	Ref    string `json:"ref,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// Duration is how long the run lasted
+func (r Run) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// NewRunID returns a unique, time-ordered run ID such as "20250102T150405-1a2b3c"
+func NewRunID(at time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return at.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// Retention limits how much history is kept per task. Zero values mean no limit.
+type Retention struct {
+	MaxRuns int
+	MaxAge  time.Duration
+}
+
+// Store reads and appends run history under a directory
+type Store struct {
+	dir       string
+	retention Retention
+}
+
+// DefaultDir returns ~/.dstream/history
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".dstream", "history"), nil
+}
+
+// NewStore returns a store in dir that keeps every run until SetRetention
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// SetRetention replaces the store's retention limits
+func (s *Store) SetRetention(r Retention) {
+	s.retention = r
+}
+
+func (s *Store) file(task string) string {
+	return filepath.Join(s.dir, state.EscapeTaskName(task)+".jsonl")
+}
+
+// Append records a run, then drops runs of the same task that fall outside the
+// retention limits
+func (s *Store) Append(run Run) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("create history dir: %w", err)
+	}
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("marshal run: %w", err)
+	}
+	f, err := os.OpenFile(s.file(run.Task), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write history: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+
+	return s.prune(run.Task, time.Now())
+}
+
+// prune rewrites a task's history without the runs retention no longer allows
+func (s *Store) prune(task string, now time.Time) error {
+	runs, err := s.read(task)
+	if err != nil {
+		return err
+	}
+
+	keep := runs
+	if s.retention.MaxAge > 0 {
+		keep = keep[:0:0]
+		for _, r := range runs {
+			if now.Sub(r.FinishedAt) <= s.retention.MaxAge {
+				keep = append(keep, r)
+			}
+		}
+	}
+	if s.retention.MaxRuns > 0 && len(keep) > s.retention.MaxRuns {
+		keep = keep[len(keep)-s.retention.MaxRuns:]
+	}
+	if len(keep) == len(runs) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(s.file(task))+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("prune history: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range keep {
+		if err := enc.Encode(r); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("prune history: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("prune history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("prune history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.file(task)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("prune history: %w", err)
+	}
+	return nil
+}
+
+// read returns a task's runs in the order they were recorded. Lines that fail to
+// parse, such as one cut short by a crash, are skipped.
+func (s *Store) read(task string) ([]Run, error) {
+	f, err := os.Open(s.file(task))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history for task %q: %w", task, err)
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Run
+		if err := json.Unmarshal(scanner.Bytes(), &r); err == nil {
+			runs = append(runs, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history for task %q: %w", task, err)
+	}
+	return runs, nil
+}
+
+// Tasks returns the names of tasks with recorded history, sorted
+func (s *Store) Tasks() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list history dir: %w", err)
+	}
+
+	var tasks []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if task, err := state.UnescapeTaskName(name); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Strings(tasks)
+	return tasks, nil
+}
+
+// List returns the runs of one task, or of every task when task is empty,
+// newest first
+func (s *Store) List(task string) ([]Run, error) {
+	tasks := []string{task}
+	if task == "" {
+		var err error
+		if tasks, err = s.Tasks(); err != nil {
+			return nil, err
+		}
+	}
+
+	var runs []Run
+	for _, t := range tasks {
+		r, err := s.read(t)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r...)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// Get returns the run with the given ID. A unique prefix of the ID is enough.
+func (s *Store) Get(id string) (*Run, error) {
+	runs, err := s.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Run
+	for i := range runs {
+		if runs[i].ID == id {
+			return &runs[i], nil
+		}
+		if strings.HasPrefix(runs[i].ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("run ID %q is ambiguous", id)
+			}
+			found = &runs[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
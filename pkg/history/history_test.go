@@ -0,0 +1,131 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func testRun(task string, started time.Time) Run {
+	return Run{
+		ID:         NewRunID(started),
+		Task:       task,
+		Command:    "run",
+		StartedAt:  started,
+		FinishedAt: started.Add(time.Minute),
+		Status:     StatusSucceeded,
+		ExitReason: "completed",
+	}
+}
+
+func TestAppendListGet(t *testing.T) {
+	store := NewStore(t.TempDir())
+	base := time.Now().Add(-time.Hour)
+
+	first := testRun("orders", base)
+	second := testRun("orders", base.Add(10*time.Minute))
+	other := testRun("customers", base.Add(5*time.Minute))
+	for _, r := range []Run{first, second, other} {
+		if err := store.Append(r); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	runs, err := store.List("orders")
+	if err != nil || len(runs) != 2 || runs[0].ID != second.ID {
+		t.Fatalf("expected orders runs newest first, got %+v (err=%v)", runs, err)
+	}
+
+	all, err := store.List("")
+	if err != nil || len(all) != 3 || all[1].ID != other.ID {
+		t.Fatalf("expected all runs newest first, got %+v (err=%v)", all, err)
+	}
+
+	tasks, err := store.Tasks()
+	if err != nil || len(tasks) != 2 || tasks[0] != "customers" {
+		t.Fatalf("expected [customers orders], got %v (err=%v)", tasks, err)
+	}
+
+	got, err := store.Get(first.ID[:len(first.ID)-2])
+	if err != nil || got.ID != first.ID {
+		t.Fatalf("get by prefix: %+v (err=%v)", got, err)
+	}
+	if _, err := store.Get("nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreKeepsTaskNamesInsideTheStore(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(root, "history"))
+	store.SetRetention(Retention{MaxRuns: 1})
+	names := []string{"../../escaped", "a/b", `..\x`, "50%", ".."}
+	for _, name := range names {
+		for range 2 {
+			if err := store.Append(testRun(name, time.Now())); err != nil {
+				t.Fatalf("%q: append: %v", name, err)
+			}
+		}
+		if runs, err := store.List(name); err != nil || len(runs) != 1 || runs[0].Task != name {
+			t.Fatalf("%q: expected one run, got %+v (err=%v)", name, runs, err)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Fatalf("expected only the store under %s, got %v", root, entries)
+	}
+	tasks, err := store.Tasks()
+	sort.Strings(names)
+	if err != nil || fmt.Sprint(tasks) != fmt.Sprint(names) {
+		t.Fatalf("expected %q, got %q (err=%v)", names, tasks, err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.SetRetention(Retention{MaxRuns: 2, MaxAge: 24 * time.Hour})
+
+	now := time.Now()
+	old := testRun("orders", now.Add(-48*time.Hour))
+	for _, r := range []Run{old, testRun("orders", now.Add(-3*time.Minute)), testRun("orders", now.Add(-2*time.Minute)), testRun("orders", now.Add(-time.Minute))} {
+		if err := store.Append(r); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	runs, err := store.List("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs after pruning, got %d", len(runs))
+	}
+	for _, r := range runs {
+		if r.ID == old.ID {
+			t.Fatal("run older than max_age was kept")
+		}
+	}
+}
+
+func TestReadSkipsTruncatedLines(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	if err := store.Append(testRun("orders", time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "orders.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"2025`)
+	f.Close()
+
+	runs, err := store.List("orders")
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected the complete run only, got %d (err=%v)", len(runs), err)
+	}
+}
@@ -0,0 +1,79 @@
+// Package httpserver runs the small embedded HTTP servers DStream exposes for
+// metrics, health checks and the management API of `dstream serve`.
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/katasec/dstream/pkg/logging"
+)
+
+var log = logging.GetHCLogger().Named("http")
+
+// Server serves a handler on a listen address
+type Server struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+// Serve starts serving handler on addr. The listener is opened before returning
+// so that a bad address fails the command straight away.
+func Serve(addr string, handler http.Handler) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return serve(ln, addr, handler), nil
+}
+
+// ServeUnix serves handler on a unix socket. A socket file left behind by a
+// process that has gone is replaced; one that still answers is an error.
+func ServeUnix(path string, handler http.Handler) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return serve(ln, path, handler), nil
+}
+
+func serve(ln net.Listener, addr string, handler http.Handler) *Server {
+	s := &Server{
+		srv: &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second},
+		ln:  ln,
+	}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("HTTP server stopped", "addr", addr, "error", err.Error())
+		}
+	}()
+	return s
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stops the server, letting in-flight requests finish
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
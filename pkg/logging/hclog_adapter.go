@@ -3,7 +3,7 @@ package logging
 import (
 	"io"
 	"log"
-	"os"
+	"strings"
 
 	hclog "github.com/hashicorp/go-hclog"
 )
@@ -40,19 +40,33 @@ func (l *HcLogAdapter) Info(msg string, args ...interface{})  { l.Log(hclog.Info
 func (l *HcLogAdapter) Warn(msg string, args ...interface{})  { l.Log(hclog.Warn, msg, args...) }
 func (l *HcLogAdapter) Error(msg string, args ...interface{}) { l.Log(hclog.Error, msg, args...) }
 
-func (l *HcLogAdapter) IsTrace() bool { return true }
-func (l *HcLogAdapter) IsDebug() bool { return true }
-func (l *HcLogAdapter) IsInfo() bool  { return true }
-func (l *HcLogAdapter) IsWarn() bool  { return true }
-func (l *HcLogAdapter) IsError() bool { return true }
+func (l *HcLogAdapter) IsTrace() bool { return l.GetLevel() <= hclog.Trace }
+func (l *HcLogAdapter) IsDebug() bool { return l.GetLevel() <= hclog.Debug }
+func (l *HcLogAdapter) IsInfo() bool  { return l.GetLevel() <= hclog.Info }
+func (l *HcLogAdapter) IsWarn() bool  { return l.GetLevel() <= hclog.Warn }
+func (l *HcLogAdapter) IsError() bool { return l.GetLevel() <= hclog.Error }
 
-func (l *HcLogAdapter) ImpliedArgs() []interface{} { return nil }
+func (l *HcLogAdapter) ImpliedArgs() []interface{} {
+	if std, ok := l.delegate.(*stdLogger); ok {
+		return std.args
+	}
+	return nil
+}
 
+// With adds fields to every line when the delegate is one of ours
 func (l *HcLogAdapter) With(args ...interface{}) hclog.Logger {
+	if std, ok := l.delegate.(*stdLogger); ok {
+		return &HcLogAdapter{delegate: std.with(args...), name: l.name}
+	}
 	return l
 }
 
+// Named returns a sub-logger; names nest as "parent.child"
 func (l *HcLogAdapter) Named(name string) hclog.Logger {
+	if std, ok := l.delegate.(*stdLogger); ok {
+		std = std.named(name)
+		return &HcLogAdapter{delegate: std, name: std.name}
+	}
 	return &HcLogAdapter{delegate: l.delegate, name: name}
 }
 
@@ -61,21 +75,38 @@ func (l *HcLogAdapter) Name() string {
 }
 
 func (l *HcLogAdapter) ResetNamed(name string) hclog.Logger {
-	return l.Named(name)
+	if std, ok := l.delegate.(*stdLogger); ok {
+		return &HcLogAdapter{delegate: &stdLogger{name: name, args: std.args}, name: name}
+	}
+	return &HcLogAdapter{delegate: l.delegate, name: name}
 }
 
+// SetLevel is a no-op: the level is global, set with SetLogLevel or Configure
 func (l *HcLogAdapter) SetLevel(hclog.Level) {}
 
 func (l *HcLogAdapter) GetLevel() hclog.Level {
-	return hclog.Info
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return hclog.LevelFromString(levelName(out.level))
 }
 
-// StandardLogger returns a standard logger that writes to stderr to prevent plugin handshake issues.
-func (l *HcLogAdapter) StandardLogger(_ *hclog.StandardLoggerOptions) *log.Logger {
-	return log.New(os.Stderr, "", log.LstdFlags)
+// StandardLogger returns a standard logger whose lines are logged at info, so
+// they never reach stdout and follow the configured format.
+func (l *HcLogAdapter) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	return log.New(l.StandardWriter(opts), "", 0)
 }
 
-// StandardWriter returns stderr to avoid writing to stdout before handshake.
+// StandardWriter returns a writer that logs each line written to it at info
 func (l *HcLogAdapter) StandardWriter(_ *hclog.StandardLoggerOptions) io.Writer {
-	return os.Stderr
+	return lineWriter{l.delegate}
+}
+
+// lineWriter logs each write as one info line
+type lineWriter struct {
+	logger Logger
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
 }
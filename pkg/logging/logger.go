@@ -1,13 +1,21 @@
+// Package logging is DStream's host logger. Every component logs through the
+// same global configuration (level, text or JSON, timestamps, color, and an
+// optional rotating log file) and can take a named sub-logger so lines show where
+// they came from. Providers log through sdk/logging, which reads the settings
+// passed to them by ChildEnv.
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
+	sdkLogging "github.com/katasec/dstream/sdk/logging"
 )
 
 // LogLevel represents the logging level
@@ -28,15 +36,39 @@ const (
 	colorError = "\033[38;5;167m" // Error - toned-down crimson
 )
 
-var (
-	// Global logger instance
-	globalLogger Logger
-	once         sync.Once
-
-	// Environment variable names
-	envLogLevel = "DSTREAM_LOG_LEVEL" // debug, info, warn, error
+// Color modes for Options.Color
+const (
+	ColorAuto   = "auto"   // color when writing to a terminal and NO_COLOR is unset
+	ColorAlways = "always" // always color
+	ColorNever  = "never"  // never color
 )
 
+// Options is the logging configuration, usually set from the CLI flags
+type Options struct {
+	Level  string // debug, info, warn or error; defaults to DSTREAM_LOG_LEVEL, then info
+	Format string // text or json
+	Time   bool   // prefix text lines with a timestamp; JSON lines always have one
+	Color  string // auto, always or never
+
+	// File, when set, receives the logs instead of stderr. It is rotated once it
+	// grows past MaxSizeMB, keeping MaxBackups old files as File.1, File.2, ...
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// DefaultOptions is the configuration the logger starts with
+func DefaultOptions() Options {
+	return Options{
+		Level:      os.Getenv(sdkLogging.EnvLogLevel),
+		Format:     "text",
+		Time:       true,
+		Color:      ColorAuto,
+		MaxSizeMB:  100,
+		MaxBackups: 3,
+	}
+}
+
 // Logger interface defines the logging methods
 type Logger interface {
 	// Standard log package compatible methods
@@ -50,68 +82,128 @@ type Logger interface {
 	Error(msg string, args ...any)
 }
 
-// stdLogger implements Logger using the standard log package
+// output is the shared state every logger writes through
+type output struct {
+	mu     sync.Mutex
+	level  LogLevel
+	json   bool
+	time   bool
+	color  bool
+	w      io.Writer
+	closer io.Closer // the log file, if any
+}
+
+var (
+	out = &output{level: LevelInfo, time: true, w: os.Stderr}
+
+	// Global logger instance
+	globalLogger Logger = &stdLogger{}
+)
+
+// stdLogger writes to the shared output; name tags lines from a sub-logger
 type stdLogger struct {
-	logLevel LogLevel
-	debug    *log.Logger
-	info     *log.Logger
-	warn     *log.Logger
-	error    *log.Logger
+	name string
+	args []any // fields added to every line, from With
 }
 
-// Initialize the global logger
+// Initialize the global logger from the environment
 func init() {
 	SetupLogging()
 }
 
-// SetupLogging configures the global logger based on environment variables
+// SetupLogging applies the default options, which honor DSTREAM_LOG_LEVEL
 func SetupLogging() {
-	once.Do(func() {
-		// Get log level from environment
-		logLevel := getLogLevel()
-
-		// Create loggers for each level without prefixes
-		// Use os.Stderr consistently for all log levels to match plugin logging
-		debugLogger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
-		infoLogger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
-		warnLogger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
-		errorLogger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
-
-		// Create logger
-		globalLogger = &stdLogger{
-			logLevel: logLevel,
-			debug:    debugLogger,
-			info:     infoLogger,
-			warn:     warnLogger,
-			error:    errorLogger,
+	Configure(DefaultOptions())
+}
+
+// Configure replaces the logging configuration. Loggers already handed out pick
+// it up immediately.
+func Configure(opts Options) error {
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if opts.File != "" {
+		f, err := openRotatingFile(opts.File, int64(opts.MaxSizeMB)*1024*1024, opts.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("open log file: %w", err)
 		}
-	})
+		w, closer = f, f
+	}
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.closer != nil {
+		out.closer.Close()
+	}
+	out.level = parseLevel(opts.Level)
+	out.json = strings.EqualFold(opts.Format, "json")
+	out.time = opts.Time
+	out.color = useColor(opts.Color, w)
+	out.w, out.closer = w, closer
+	return nil
+}
+
+// Close closes the log file, if there is one, and goes back to stderr
+func Close() {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.closer != nil {
+		out.closer.Close()
+		out.w, out.closer = os.Stderr, nil
+	}
 }
 
 // GetLogger returns the global logger instance
 func GetLogger() Logger {
-	if globalLogger == nil {
-		SetupLogging()
-	}
 	return globalLogger
 }
 
+// Named returns a sub-logger whose lines are tagged with a component name
+func Named(name string) Logger {
+	return &stdLogger{name: name}
+}
+
 // GetHCLogger returns an hclog-compatible logger that wraps the standard logger
 func GetHCLogger() hclog.Logger {
-	// Get the standard logger
-	stdLogger := GetLogger()
+	return NewHcLogAdapter(GetLogger())
+}
 
-	// Wrap it in the HcLogAdapter
-	return NewHcLogAdapter(stdLogger)
+// SetLogLevel updates the log level of the global logger at runtime
+func SetLogLevel(level string) {
+	out.mu.Lock()
+	out.level = parseLevel(level)
+	out.mu.Unlock()
 }
 
-// Helper function to get log level from environment
-func getLogLevel() LogLevel {
-	level := strings.ToLower(os.Getenv(envLogLevel))
-	switch level {
-	case "debug":
+// SetLogFormat switches the global logger between "text" and "json" output. JSON
+// lines use hclog's keys (@timestamp, @level, @message, @module) so host and
+// provider logs can be processed alike.
+func SetLogFormat(format string) {
+	out.mu.Lock()
+	out.json = strings.EqualFold(format, "json")
+	out.mu.Unlock()
+}
+
+// ChildEnv returns the environment variables that give a provider the same log
+// level and format as DStream. They should be appended after os.Environ() so they
+// take precedence.
+func ChildEnv() []string {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	return []string{
+		sdkLogging.EnvLogLevel + "=" + levelName(out.level),
+		fmt.Sprintf("%s=%t", sdkLogging.EnvLogJSON, out.json),
+	}
+}
+
+// parseLevel maps a level name to a LogLevel, defaulting to info
+func parseLevel(level string) LogLevel {
+	switch strings.ToLower(level) {
+	case "trace", "debug":
 		return LevelDebug
-	case "warn":
+	case "warn", "warning":
 		return LevelWarn
 	case "error":
 		return LevelError
@@ -120,110 +212,179 @@ func getLogLevel() LogLevel {
 	}
 }
 
-// formatMessage formats the message with any additional arguments
-func formatMessage(msg string, args ...any) string {
-	if len(args) == 0 {
-		return msg
+func levelName(level LogLevel) string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
 	}
+}
 
-	// Convert args to key-value pairs
-	pairs := make([]string, 0, len(args)/2)
-	for i := 0; i < len(args); i += 2 {
-		if i+1 < len(args) {
-			pairs = append(pairs, fmt.Sprintf("%v=%v", args[i], args[i+1]))
-		}
+// useColor resolves a color mode for the given writer
+func useColor(mode string, w io.Writer) bool {
+	switch strings.ToLower(mode) {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
 	}
-
-	// If there are key-value pairs, append them to the message
-	if len(pairs) > 0 {
-		return fmt.Sprintf("%s [%s]", msg, strings.Join(pairs, " "))
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
 	}
-	return msg
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 // Printf provides compatibility with standard log.Printf
 func (l *stdLogger) Printf(format string, v ...any) {
-	if l.logLevel <= LevelInfo {
-		l.info.Printf("%s[INFO]%s %s", colorInfo, colorReset, fmt.Sprintf(format, v...))
-	}
+	l.log(LevelInfo, fmt.Sprintf(format, v...), nil)
 }
 
 // Println provides compatibility with standard log.Println
 func (l *stdLogger) Println(v ...any) {
-	if l.logLevel <= LevelInfo {
-		message := fmt.Sprintln(v...)
-		// Remove trailing newline that fmt.Sprintln adds
-		message = strings.TrimSuffix(message, "\n")
-		l.info.Printf("%s[INFO]%s %s", colorInfo, colorReset, message)
-	}
+	// Remove trailing newline that fmt.Sprintln adds
+	l.log(LevelInfo, strings.TrimSuffix(fmt.Sprintln(v...), "\n"), nil)
 }
 
 // Debug logs a debug message
-// func (l *stdLogger) Debug(msg string, args ...any) {
-// 	if l.logLevel <= LevelDebug {
-// 		l.debug.Printf("%s [DEBUG] %s %s", colorDebug, colorReset, formatMessage(msg, args...))
-// 	}
-// }
-
 func (l *stdLogger) Debug(msg string, args ...any) {
-	if l.logLevel <= LevelDebug {
-		if len(args) > 0 {
-			l.debug.Printf("%s[DEBUG] %s%s %v", colorDebug, colorReset, msg, formatArgs(args))
-		} else {
-			l.debug.Printf("%s[DEBUG] %s%s", colorDebug, colorReset, msg)
-		}
-	}
+	l.log(LevelDebug, msg, args)
 }
 
 // Info logs an info message
 func (l *stdLogger) Info(msg string, args ...any) {
-	if l.logLevel <= LevelInfo {
-		l.info.Printf("%s[INFO] %s%s %s", colorInfo, colorReset, msg, formatArgs(args))
-	}
+	l.log(LevelInfo, msg, args)
 }
 
-// Info logs an info message
-// func (l *stdLogger) Info(msg string, args ...any) {
-// 	if l.logLevel <= LevelInfo {
-// 		if len(args) > 0 {
-// 			l.info.Printf("%s%s%s %v", colorInfo, msg, colorReset, formatArgs(args))
-// 		} else {
-// 			l.info.Printf("%s%s%s", colorInfo, msg, colorReset)
-// 		}
-// 	}
-// }
-
 // Warn logs a warning message
 func (l *stdLogger) Warn(msg string, args ...any) {
-	if l.logLevel <= LevelWarn {
-		l.warn.Printf("%s[WARN]%s %s", colorWarn, colorReset, formatMessage(msg, args...))
-	}
+	l.log(LevelWarn, msg, args)
 }
 
 // Error logs an error message
 func (l *stdLogger) Error(msg string, args ...any) {
-	if l.logLevel <= LevelError {
-		l.error.Printf("%s[ERROR]%s %s", colorError, colorReset, formatMessage(msg, args...))
+	l.log(LevelError, msg, args)
+}
+
+// with returns a copy of the logger that adds args to every line
+func (l *stdLogger) with(args ...any) *stdLogger {
+	return &stdLogger{name: l.name, args: append(append([]any(nil), l.args...), args...)}
+}
+
+// named returns a copy of the logger with name appended to its own
+func (l *stdLogger) named(name string) *stdLogger {
+	if l.name != "" {
+		name = l.name + "." + name
 	}
+	return &stdLogger{name: name, args: l.args}
 }
 
-// SetLogLevel updates the log level of the global logger at runtime
-func SetLogLevel(level string) {
-	var lvl LogLevel
-	switch strings.ToLower(level) {
-	case "debug":
-		lvl = LevelDebug
-	case "warn":
-		lvl = LevelWarn
-	case "error":
-		lvl = LevelError
-	default:
-		lvl = LevelInfo
+func (l *stdLogger) log(level LogLevel, msg string, args []any) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if level < out.level {
+		return
+	}
+	if len(l.args) > 0 {
+		args = append(append([]any(nil), l.args...), args...)
+	}
+
+	now := time.Now()
+	var line []byte
+	if out.json {
+		line = formatJSON(now, level, l.name, msg, args)
+	} else {
+		line = formatText(now, level, l.name, msg, args, out.time, out.color)
+	}
+	out.w.Write(line)
+}
+
+// formatText renders "2006/01/02 15:04:05 [INFO] name: message key=value, key=value"
+func formatText(now time.Time, level LogLevel, name, msg string, args []any, withTime, color bool) []byte {
+	var b strings.Builder
+	if withTime {
+		b.WriteString(now.Format("2006/01/02 15:04:05 "))
 	}
 
-	if logger, ok := globalLogger.(*stdLogger); ok {
-		logger.logLevel = lvl
+	tag, c := "[INFO]", colorInfo
+	switch level {
+	case LevelDebug:
+		tag, c = "[DEBUG]", colorDebug
+	case LevelWarn:
+		tag, c = "[WARN]", colorWarn
+	case LevelError:
+		tag, c = "[ERROR]", colorError
+	}
+	if color {
+		b.WriteString(c + tag + colorReset)
+	} else {
+		b.WriteString(tag)
+	}
+	b.WriteByte(' ')
+
+	if name != "" {
+		b.WriteString(name + ": ")
+	}
+	b.WriteString(msg)
+	if len(args) > 0 {
+		b.WriteByte(' ')
+		b.WriteString(formatArgs(args))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// formatJSON renders one log entry as a JSON line
+func formatJSON(now time.Time, level LogLevel, name, msg string, args []any) []byte {
+	entry := map[string]any{
+		"@timestamp": now.Format("2006-01-02T15:04:05.000000Z07:00"),
+		"@level":     levelName(level),
+		"@message":   msg,
+	}
+	if name != "" {
+		entry["@module"] = name
+	}
+	if len(args)%2 != 0 {
+		args = append(args, "MISSING_VALUE")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", args[i])
+		}
+		entry[key] = jsonValue(args[i+1])
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"@level":%q,"@message":%q}`, levelName(level), msg))
+	}
+	return append(line, '\n')
+}
+
+// jsonValue makes a field value safe to marshal: errors become their message and
+// anything JSON can't encode is formatted with %v
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%v", v)
 	}
+	return v
 }
 
 // Helper function to format key-value pairs for structured logging
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// logToFile points the global logger at a file in a temp dir for one test
+func logToFile(t *testing.T, opts Options) string {
+	t.Helper()
+	opts.File = filepath.Join(t.TempDir(), "dstream.log")
+	if err := Configure(opts); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	t.Cleanup(SetupLogging)
+	return opts.File
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+func TestTextFormat(t *testing.T) {
+	path := logToFile(t, Options{Level: "info", Format: "text", Color: ColorNever})
+
+	GetLogger().Debug("hidden")
+	Named("http").Info("Serving", "addr", ":8080")
+	GetHCLogger().Named("executor").With("task", "orders").Warn("slow", "ms", 12)
+
+	lines := readLines(t, path)
+	want := []string{
+		"[INFO] http: Serving addr=:8080",
+		"[WARN] executor: slow task=orders, ms=12",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got lines %q, want %q", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestTextFormatWithTime(t *testing.T) {
+	path := logToFile(t, Options{Level: "info", Time: true, Color: ColorNever})
+
+	GetLogger().Info("hello")
+
+	line := readLines(t, path)[0]
+	// "2006/01/02 15:04:05 [INFO] hello"
+	if !strings.HasSuffix(line, " [INFO] hello") || len(line) != len("2006/01/02 15:04:05 [INFO] hello") {
+		t.Fatalf("line %q does not start with a timestamp", line)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	path := logToFile(t, Options{Level: "debug", Format: "json"})
+
+	GetHCLogger().Named("executor").Debug("relay stopped", "err", errors.New("boom"), "events", 3)
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(readLines(t, path)[0]), &entry); err != nil {
+		t.Fatalf("not JSON: %v", err)
+	}
+	for key, want := range map[string]any{
+		"@level":   "debug",
+		"@message": "relay stopped",
+		"@module":  "executor",
+		"err":      "boom",
+		"events":   float64(3),
+	} {
+		if entry[key] != want {
+			t.Errorf("%s = %v, want %v", key, entry[key], want)
+		}
+	}
+	if _, ok := entry["@timestamp"]; !ok {
+		t.Error("missing @timestamp")
+	}
+}
+
+func TestChildEnv(t *testing.T) {
+	logToFile(t, Options{Level: "warn", Format: "json"})
+
+	got := strings.Join(ChildEnv(), " ")
+	if got != "DSTREAM_LOG_LEVEL=warn DSTREAM_LOG_JSON=true" {
+		t.Fatalf("ChildEnv() = %q", got)
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dstream.log")
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "four\nfive\n",
+		path + ".1": "three\n",
+		path + ".2": "one\ntwo\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+		}
+	}
+}
+
+func TestLogFileRotationFailureKeepsWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dstream.log")
+	// A directory in the way of the first backup stops the rename
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("write %q: %v", line, err)
+		}
+	}
+	if f.rotateErr == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "one\ntwo\nthree\nfour\n" {
+		t.Fatalf("expected every line in %s, got %q", filepath.Base(path), data)
+	}
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is a log file that is renamed aside once it reaches maxSize.
+// Backups are numbered from newest to oldest: path.1, path.2, ... path.maxBackups.
+type rotatingFile struct {
+	path       string
+	maxSize    int64 // zero disables rotation
+	maxBackups int
+
+	mu        sync.Mutex
+	f         *os.File
+	size      int64
+	rotateErr error // the last rotation failure, reported once until one succeeds
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past maxSize. A
+// single write larger than maxSize still goes to a fresh file whole. If the
+// file can't be rotated, p is appended to it anyway and the failure is reported
+// on stderr, as the log can't report it.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		err := r.rotate()
+		if err != nil && r.rotateErr == nil {
+			fmt.Fprintf(os.Stderr, "dstream: log rotation failed, still writing to %s: %v\n", r.path, err)
+		}
+		r.rotateErr = err
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups up by one and starts a new file; r.mu must be held.
+// If the file can't be moved aside it is reopened, so writes carry on.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	err := r.shift()
+	if openErr := r.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// shift moves the closed file to the first backup, or removes it without backups
+func (r *rotatingFile) shift() error {
+	if r.maxBackups > 0 {
+		os.Remove(r.backup(r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(r.backup(i), r.backup(i+1))
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return fmt.Errorf("rotate %s: %w", r.path, err)
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return fmt.Errorf("rotate %s: %w", r.path, err)
+	}
+	return nil
+}
+
+func (r *rotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// Close closes the current file
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+var (
+	lastEventAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "seconds_since_last_event"),
+		"Seconds since the last event was relayed. Absent until the first event.",
+		[]string{"task"}, nil)
+	spoolDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "spool_depth"),
+		"Events read from the input provider and not yet written to the output provider or dropped.",
+		[]string{"task"}, nil)
+	providerCPUDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "provider", "cpu_seconds_total"),
+		"User and system CPU time consumed by the provider process.",
+		[]string{"task", "provider"}, nil)
+	providerRSSDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "provider", "resident_memory_bytes"),
+		"Resident memory size of the provider process.",
+		[]string{"task", "provider"}, nil)
+)
+
+// taskCollector reports the values that are only meaningful at scrape time:
+// how long a task has been idle and what its provider processes are using.
+type taskCollector struct {
+	registry *Registry
+}
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastEventAgeDesc
+	ch <- spoolDepthDesc
+	ch <- providerCPUDesc
+	ch <- providerRSSDesc
+}
+
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	c.registry.mu.Lock()
+	tasks := make([]*Task, 0, len(c.registry.tasks))
+	for _, t := range c.registry.tasks {
+		tasks = append(tasks, t)
+	}
+	c.registry.mu.Unlock()
+
+	for _, t := range tasks {
+		if lastEvent := t.lastEvent.Load(); lastEvent != 0 {
+			ch <- prometheus.MustNewConstMetric(lastEventAgeDesc, prometheus.GaugeValue,
+				time.Since(time.Unix(0, lastEvent)).Seconds(), t.name)
+		}
+		ch <- prometheus.MustNewConstMetric(spoolDepthDesc, prometheus.GaugeValue, float64(t.inFlight.Load()), t.name)
+
+		t.mu.Lock()
+		processes := make(map[string]int32, len(t.processes))
+		for role, pid := range t.processes {
+			processes[role] = pid
+		}
+		t.mu.Unlock()
+
+		for role, pid := range processes {
+			collectProcess(ch, t.name, role, pid)
+		}
+	}
+}
+
+// collectProcess reports CPU and RSS for one provider. A process that has just
+// exited is skipped rather than failing the scrape.
+func collectProcess(ch chan<- prometheus.Metric, task, role string, pid int32) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return
+	}
+	if times, err := proc.Times(); err == nil {
+		ch <- prometheus.MustNewConstMetric(providerCPUDesc, prometheus.CounterValue,
+			times.User+times.System, task, role)
+	}
+	if mem, err := proc.MemoryInfo(); err == nil {
+		ch <- prometheus.MustNewConstMetric(providerRSSDesc, prometheus.GaugeValue,
+			float64(mem.RSS), task, role)
+	}
+}
@@ -0,0 +1,188 @@
+// Package metrics exposes Prometheus metrics for running tasks: relay throughput
+// and latency, provider handshakes and restarts, and the resource usage of each
+// provider child process.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "dstream"
+
+// Registry holds the metrics for every task run by this process
+type Registry struct {
+	reg *prometheus.Registry
+
+	eventsRelayed    *prometheus.CounterVec
+	bytesRelayed     *prometheus.CounterVec
+	eventsDropped    *prometheus.CounterVec
+	writeLatency     *prometheus.HistogramVec
+	handshake        *prometheus.HistogramVec
+	providerRestarts *prometheus.CounterVec
+	faultsInjected   *prometheus.CounterVec
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+// Default is the registry the executor records to and `--metrics-addr` serves
+var Default = NewRegistry()
+
+// NewRegistry creates a registry with the DStream metrics and the Go runtime and
+// process collectors for DStream itself
+func NewRegistry() *Registry {
+	r := &Registry{
+		reg:   prometheus.NewRegistry(),
+		tasks: make(map[string]*Task),
+
+		eventsRelayed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_relayed_total",
+			Help:      "Events relayed from the input provider to the output provider.",
+		}, []string{"task"}),
+		bytesRelayed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_relayed_total",
+			Help:      "Bytes relayed from the input provider to the output provider.",
+		}, []string{"task"}),
+		eventsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_dropped_total",
+			Help:      "Events read from the input provider that could not be written to the output provider.",
+		}, []string{"task"}),
+		writeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "relay_write_duration_seconds",
+			Help:      "Time taken to write one event to the output provider's stdin.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs .. ~2.6s
+		}, []string{"task"}),
+		handshake: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "provider_handshake_duration_seconds",
+			Help:      "Time from starting a provider to its ready handshake.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"task", "provider"}),
+		providerRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "provider_restarts_total",
+			Help:      "Times a provider process has been restarted.",
+		}, []string{"task", "provider"}),
+		faultsInjected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "faults_injected_total",
+			Help:      "Faults injected into the relay by a task's fault_injection block.",
+		}, []string{"task", "fault"}),
+	}
+
+	r.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		r.eventsRelayed,
+		r.bytesRelayed,
+		r.eventsDropped,
+		r.writeLatency,
+		r.handshake,
+		r.providerRestarts,
+		r.faultsInjected,
+		&taskCollector{registry: r},
+	)
+	return r
+}
+
+// Task returns the metrics for a task, creating them on first use
+func (r *Registry) Task(name string) *Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tasks[name]; ok {
+		return t
+	}
+	t := &Task{
+		name:          name,
+		eventsRelayed: r.eventsRelayed.WithLabelValues(name),
+		bytesRelayed:  r.bytesRelayed.WithLabelValues(name),
+		eventsDropped: r.eventsDropped.WithLabelValues(name),
+		writeLatency:  r.writeLatency.WithLabelValues(name),
+		registry:      r,
+		processes:     make(map[string]int32),
+	}
+	r.tasks[name] = t
+	return t
+}
+
+// Task records the metrics of one running task. Its methods are safe to call
+// from the relay and provider goroutines concurrently.
+type Task struct {
+	name          string
+	eventsRelayed prometheus.Counter
+	bytesRelayed  prometheus.Counter
+	eventsDropped prometheus.Counter
+	writeLatency  prometheus.Observer
+	registry      *Registry
+
+	lastEvent atomic.Int64 // unix nanoseconds, zero until the first event
+	inFlight  atomic.Int64 // spool depth
+
+	mu        sync.Mutex
+	processes map[string]int32 // provider role -> pid
+}
+
+// EventRelayed records one event written to the output provider
+func (t *Task) EventRelayed(bytes int, writeDuration time.Duration) {
+	t.eventsRelayed.Inc()
+	t.bytesRelayed.Add(float64(bytes))
+	t.writeLatency.Observe(writeDuration.Seconds())
+	t.lastEvent.Store(time.Now().UnixNano())
+}
+
+// EventDropped records one event that could not be delivered
+func (t *Task) EventDropped() {
+	t.eventsDropped.Inc()
+}
+
+// AddSpoolDepth adjusts the spool depth: the events read from the input
+// provider and not yet written to the output provider or dropped, including
+// any the relay holds back. The relay adds each event as it is read and
+// removes it once handled, so a stalled output shows as a depth that stays up.
+func (t *Task) AddSpoolDepth(delta int) {
+	t.inFlight.Add(int64(delta))
+}
+
+// SetSpoolDepth sets the spool depth, back to 0 when a run ends
+func (t *Task) SetSpoolDepth(n int) {
+	t.inFlight.Store(int64(n))
+}
+
+// HandshakeCompleted records how long a provider took to report ready
+func (t *Task) HandshakeCompleted(provider string, d time.Duration) {
+	t.registry.handshake.WithLabelValues(t.name, provider).Observe(d.Seconds())
+}
+
+// ProviderRestarted records a restart of a provider process
+func (t *Task) ProviderRestarted(provider string) {
+	t.registry.providerRestarts.WithLabelValues(t.name, provider).Inc()
+}
+
+// FaultInjected records one fault injected into the relay
+func (t *Task) FaultInjected(fault string) {
+	t.registry.faultsInjected.WithLabelValues(t.name, fault).Inc()
+}
+
+// TrackProcess reports CPU and memory for a provider's process until it is untracked
+func (t *Task) TrackProcess(provider string, pid int) {
+	t.mu.Lock()
+	t.processes[provider] = int32(pid)
+	t.mu.Unlock()
+}
+
+// UntrackProcess stops reporting a provider's process once it has exited
+func (t *Task) UntrackProcess(provider string) {
+	t.mu.Lock()
+	delete(t.processes, provider)
+	t.mu.Unlock()
+}
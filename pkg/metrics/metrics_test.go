@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestTaskMetricsAreExposed(t *testing.T) {
+	r := NewRegistry()
+	task := r.Task("cdc")
+
+	if got := r.Task("cdc"); got != task {
+		t.Fatal("expected the same task metrics on repeated lookups")
+	}
+
+	task.EventRelayed(100, 2*time.Millisecond)
+	task.EventRelayed(50, time.Millisecond)
+	task.EventDropped()
+	task.HandshakeCompleted("input", 300*time.Millisecond)
+	task.ProviderRestarted("output")
+	task.TrackProcess("input", os.Getpid())
+
+	body := scrape(t, r)
+	for _, want := range []string{
+		`dstream_events_relayed_total{task="cdc"} 2`,
+		`dstream_bytes_relayed_total{task="cdc"} 150`,
+		`dstream_events_dropped_total{task="cdc"} 1`,
+		`dstream_relay_write_duration_seconds_count{task="cdc"} 2`,
+		`dstream_provider_handshake_duration_seconds_count{provider="input",task="cdc"} 1`,
+		`dstream_provider_restarts_total{provider="output",task="cdc"} 1`,
+		`dstream_spool_depth{task="cdc"} 0`,
+		`dstream_seconds_since_last_event{task="cdc"}`,
+		`dstream_provider_resident_memory_bytes{provider="input",task="cdc"}`,
+		`dstream_provider_cpu_seconds_total{provider="input",task="cdc"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+
+	task.UntrackProcess("input")
+	if body := scrape(t, r); strings.Contains(body, "dstream_provider_resident_memory_bytes{") {
+		t.Error("expected untracked process to no longer be reported")
+	}
+}
+
+func TestSpoolDepth(t *testing.T) {
+	r := NewRegistry()
+	task := r.Task("spooled")
+
+	task.AddSpoolDepth(1)
+	task.AddSpoolDepth(1)
+	task.AddSpoolDepth(-1)
+	if body := scrape(t, r); !strings.Contains(body, `dstream_spool_depth{task="spooled"} 1`) {
+		t.Errorf("expected one event in the spool, got:\n%s", body)
+	}
+	task.SetSpoolDepth(0)
+	if body := scrape(t, r); !strings.Contains(body, `dstream_spool_depth{task="spooled"} 0`) {
+		t.Error("expected the spool depth to be reset")
+	}
+}
+
+func TestLastEventAgeAbsentBeforeFirstEvent(t *testing.T) {
+	r := NewRegistry()
+	r.Task("idle")
+
+	body := scrape(t, r)
+	if strings.Contains(body, `dstream_seconds_since_last_event{task="idle"}`) {
+		t.Error("expected no last-event age before any event was relayed")
+	}
+	if !strings.Contains(body, `dstream_spool_depth{task="idle"} 0`) {
+		t.Error("expected spool depth for an idle task")
+	}
+}
+
+func TestServe(t *testing.T) {
+	r := NewRegistry()
+	r.Task("served").EventRelayed(10, time.Millisecond)
+
+	srv, err := r.Serve("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	defer srv.Close()
+
+	resp, err := http.Get("http://" + srv.Addr() + "/metrics")
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `dstream_events_relayed_total{task="served"} 1`) {
+		t.Errorf("unexpected metrics output:\n%s", body)
+	}
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/katasec/dstream/pkg/httpserver"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler serves the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.reg, promhttp.HandlerOpts{})
+}
+
+// Register mounts the registry at /metrics
+func (r *Registry) Register(mux *http.ServeMux) {
+	mux.Handle("/metrics", r.Handler())
+}
+
+// Serve starts serving the registry at http://addr/metrics
+func (r *Registry) Serve(addr string) (*httpserver.Server, error) {
+	mux := http.NewServeMux()
+	r.Register(mux)
+	return httpserver.Serve(addr, mux)
+}
@@ -1,13 +1,14 @@
 package monitoring
 
 import (
+	"context"
 	"runtime"
 	"time"
 
 	"github.com/katasec/dstream/pkg/logging"
 )
 
-var log = logging.GetHCLogger()
+var log = logging.GetHCLogger().Named("monitor")
 
 // Monitor holds the configuration for memory logging
 type Monitor struct {
@@ -23,14 +24,23 @@ func NewMonitor(interval time.Duration) *Monitor {
 	return m
 }
 
-// Start logs memory usage and the number of goroutines periodically
-func (m *Monitor) Start() {
+// Start logs memory usage and the number of goroutines periodically until ctx is
+// cancelled. For scrapeable metrics use `dstream run --metrics-addr` instead.
+func (m *Monitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
 	for {
 		var memStats runtime.MemStats
 		runtime.ReadMemStats(&memStats)
 		log.Debug("Number of Goroutines:", "Num", runtime.NumGoroutine())
 		log.Debug("Total Memory Allocated: ", "Alloc in MB", memStats.Alloc/1024/1024)
 		log.Debug("Total Memory System: ", "Sys in MB", memStats.Sys/1024/1024)
-		time.Sleep(m.interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
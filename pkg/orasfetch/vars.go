@@ -2,4 +2,4 @@ package orasfetch
 
 import "github.com/katasec/dstream/pkg/logging"
 
-var log = logging.GetLogger()
+var log = logging.Named("oras")
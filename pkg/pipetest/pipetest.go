@@ -0,0 +1,289 @@
+// Package pipetest runs the pipeline tests in *.dstest.hcl files. A test feeds
+// a JSONL fixture through the executor's relay in place of the task's input
+// provider, optionally through transform stages, into either the task's real
+// output provider or a capture, and checks the relayed events against a golden
+// file and assertions.
+package pipetest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/katasec/dstream/pkg/config"
+	"github.com/katasec/dstream/pkg/control"
+	"github.com/katasec/dstream/pkg/executor"
+	"github.com/katasec/dstream/pkg/recording"
+)
+
+// maxReportedDiffs is how many mismatched golden lines a failure lists
+const maxReportedDiffs = 5
+
+// Options adjust how tests run
+type Options struct {
+	// Update rewrites golden files with the relayed events instead of comparing
+	Update bool
+	// Run selects the tests whose name matches; nil runs them all
+	Run *regexp.Regexp
+}
+
+// Result is the outcome of one test
+type Result struct {
+	Name     string
+	Failures []string // empty when the test passed
+	Events   int      // events relayed to the output
+	Updated  bool     // the golden file was rewritten
+	Duration time.Duration
+}
+
+// Passed reports whether the test passed
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// RunFile runs the tests in f one after another. Tasks not defined in the file
+// are looked up in root, which may be nil.
+func RunFile(ctx context.Context, f *config.TestFile, root *config.RootHCL, opts Options) []Result {
+	var results []Result
+	for i := range f.Tests {
+		t := &f.Tests[i]
+		if opts.Run != nil && !opts.Run.MatchString(t.Name) {
+			continue
+		}
+		started := time.Now()
+		res := runTest(ctx, f, t, root, opts)
+		res.Name, res.Duration = t.Name, time.Since(started)
+		results = append(results, res)
+	}
+	return results
+}
+
+func runTest(ctx context.Context, f *config.TestFile, t *config.TestBlock, root *config.RootHCL, opts Options) Result {
+	fail := func(err error) Result { return Result{Failures: []string{err.Error()}} }
+
+	task, err := f.TaskFor(t, root)
+	if err != nil {
+		return fail(err)
+	}
+	events, err := readLines(f.Resolve(t.Input))
+	if err != nil {
+		return fail(fmt.Errorf("input fixture: %w", err))
+	}
+	for i, tr := range t.Transforms {
+		if events, err = transform(ctx, tr, events); err != nil {
+			return fail(fmt.Errorf("transform %d: %w", i+1, err))
+		}
+	}
+	relayed, err := relay(ctx, task, events, t.Output == config.TestOutputProvider)
+	if err != nil {
+		return fail(fmt.Errorf("run %s: %w", task.Name, err))
+	}
+
+	res := Result{Events: len(relayed)}
+	if t.Expect != nil {
+		res.Failures, res.Updated = expect(f, t.Expect, relayed, opts.Update)
+	}
+	return res
+}
+
+// relay runs the task with events in place of its input provider and returns
+// the events relayed to the output: the task's output provider, or a capture
+func relay(ctx context.Context, task *config.TaskBlock, events []string, toProvider bool) ([]string, error) {
+	src := strings.NewReader(strings.Join(events, "\n") + "\n")
+	if len(events) == 0 {
+		src = strings.NewReader("")
+	}
+
+	if !toProvider {
+		var capture bytes.Buffer
+		if _, err := executor.RunFixture(ctx, task, src, &capture, executor.RunOptions{}); err != nil {
+			return nil, err
+		}
+		return splitLines(capture.String()), nil
+	}
+
+	// What reached the output provider is taken from a recording of the relay
+	dir, err := os.MkdirTemp("", "dstest-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "relayed.jsonl")
+	if _, err := executor.RunFixture(ctx, task, src, nil, executor.RunOptions{Record: path}); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var relayed []string
+	r := recording.NewReader(file)
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return relayed, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		relayed = append(relayed, entry.Line)
+	}
+}
+
+// transform passes events through one transform stage
+func transform(ctx context.Context, tr config.TransformBlock, events []string) ([]string, error) {
+	if tr.Filter != "" {
+		filter, err := control.ParseFilter(tr.Filter)
+		if err != nil {
+			return nil, err
+		}
+		var kept []string
+		for i, line := range events {
+			var event any
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				return nil, fmt.Errorf("event %d is not JSON: %w", i+1, err)
+			}
+			if filter.Match(event) {
+				kept = append(kept, line)
+			}
+		}
+		return kept, nil
+	}
+
+	cmd := exec.CommandContext(ctx, tr.Command[0], tr.Command[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(events, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", tr.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return splitLines(string(out)), nil
+}
+
+// expect checks the relayed events against an expect block, or writes them to
+// its golden file when updating
+func expect(f *config.TestFile, e *config.ExpectBlock, relayed []string, update bool) (failures []string, updated bool) {
+	if e.Golden != "" {
+		path := f.Resolve(e.Golden)
+		if update {
+			data := strings.Join(relayed, "\n")
+			if len(relayed) > 0 {
+				data += "\n"
+			}
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				failures = append(failures, fmt.Sprintf("update golden file: %v", err))
+			}
+			updated = true
+		} else if golden, err := readLines(path); err != nil {
+			failures = append(failures, fmt.Sprintf("golden file: %v (run with --update to create it)", err))
+		} else {
+			failures = append(failures, diff(golden, relayed)...)
+		}
+	}
+
+	if e.Count != nil && *e.Count != len(relayed) {
+		failures = append(failures, fmt.Sprintf("expected %d events, got %d", *e.Count, len(relayed)))
+	}
+
+	for _, expr := range e.Assert {
+		filter, err := control.ParseFilter(expr)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		for i, line := range relayed {
+			var event any
+			if err := json.Unmarshal([]byte(line), &event); err != nil || !filter.Match(event) {
+				failures = append(failures, fmt.Sprintf("event %d doesn't match %q: %s", i+1, expr, line))
+				break
+			}
+		}
+	}
+	return failures, updated
+}
+
+// diff compares relayed events with golden ones line by line. Lines that are
+// JSON are compared as values, so key order and spacing don't matter.
+func diff(golden, relayed []string) []string {
+	var diffs []string
+	for i := 0; i < max(len(golden), len(relayed)); i++ {
+		var want, got string
+		if i < len(golden) {
+			want = golden[i]
+		}
+		if i < len(relayed) {
+			got = relayed[i]
+		}
+		if sameEvent(want, got) {
+			continue
+		}
+		if len(diffs) == maxReportedDiffs {
+			diffs = append(diffs, "...")
+			break
+		}
+		switch {
+		case i >= len(relayed):
+			diffs = append(diffs, fmt.Sprintf("golden line %d: missing %s", i+1, want))
+		case i >= len(golden):
+			diffs = append(diffs, fmt.Sprintf("golden line %d: unexpected %s", i+1, got))
+		default:
+			diffs = append(diffs, fmt.Sprintf("golden line %d:\n    want %s\n    got  %s", i+1, want, got))
+		}
+	}
+	if len(golden) != len(relayed) {
+		diffs = append(diffs, fmt.Sprintf("golden file has %d events, got %d", len(golden), len(relayed)))
+	}
+	return diffs
+}
+
+func sameEvent(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var av, bv any
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// readLines reads the non-blank lines of a JSONL file
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
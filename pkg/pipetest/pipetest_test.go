@@ -0,0 +1,163 @@
+package pipetest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/katasec/dstream/pkg/config"
+)
+
+// TestMain doubles as an output provider: with PIPETEST_OUTPUT set the test
+// binary appends the events it receives to that file
+func TestMain(m *testing.M) {
+	path := os.Getenv("PIPETEST_OUTPUT")
+	if path == "" {
+		os.Exit(m.Run())
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	fmt.Println(`{"status":"ready"}`)
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	for scanner.Scan() {
+		fmt.Fprintln(f, scanner.Text())
+	}
+	f.Close()
+	os.Exit(0)
+}
+
+const fixture = `{"metadata":{"operation":"insert"},"data":{"id":1}}
+{"metadata":{"operation":"delete"},"data":{"id":2}}
+{"metadata":{"operation":"insert"},"data":{"id":3}}
+`
+
+// loadTests writes a test file and its fixture to a temp dir and loads it
+func loadTests(t *testing.T, tests string) *config.TestFile {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "events.jsonl"), []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "pipeline"+config.TestFileSuffix)
+	src := fmt.Sprintf(`
+task "captured" {
+  type = "providers"
+}
+task "delivered" {
+  type = "providers"
+  output {
+    provider_path = %q
+  }
+}
+%s`, os.Args[0], tests)
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := config.LoadTestFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestGoldenFileIsUpdatedThenCompared(t *testing.T) {
+	f := loadTests(t, `
+test "inserts" {
+  task  = "captured"
+  input = "events.jsonl"
+  transform {
+    filter = "metadata.operation == \"insert\""
+  }
+  expect {
+    golden = "inserts.jsonl"
+    count  = 2
+    assert = ["data.id != null"]
+  }
+}`)
+	results := RunFile(context.Background(), f, nil, Options{})
+	if len(results) != 1 || results[0].Passed() {
+		t.Fatalf("expected a missing golden file to fail, got %+v", results)
+	}
+
+	results = RunFile(context.Background(), f, nil, Options{Update: true})
+	if !results[0].Passed() || !results[0].Updated || results[0].Events != 2 {
+		t.Fatalf("expected the golden file to be written, got %+v", results[0])
+	}
+
+	// Key order doesn't matter; values do
+	golden := f.Resolve("inserts.jsonl")
+	os.WriteFile(golden, []byte(`{"data":{"id":1},"metadata":{"operation":"insert"}}
+{"metadata":{"operation":"insert"},"data":{"id":3}}
+`), 0o644)
+	if results = RunFile(context.Background(), f, nil, Options{}); !results[0].Passed() {
+		t.Fatalf("expected the golden file to match, got %+v", results[0])
+	}
+	os.WriteFile(golden, []byte(`{"metadata":{"operation":"insert"},"data":{"id":1}}`+"\n"), 0o644)
+	results = RunFile(context.Background(), f, nil, Options{})
+	if results[0].Passed() || !strings.Contains(strings.Join(results[0].Failures, "\n"), "golden line 2: unexpected") {
+		t.Fatalf("expected a golden diff, got %+v", results[0])
+	}
+}
+
+func TestAssertionsAndTransforms(t *testing.T) {
+	f := loadTests(t, `
+test "every event is an insert" {
+  task  = "captured"
+  input = "events.jsonl"
+  expect {
+    assert = ["metadata.operation == \"insert\""]
+  }
+}
+test "piped through a command" {
+  task  = "captured"
+  input = "events.jsonl"
+  transform {
+    command = ["head", "-n", "1"]
+  }
+  expect {
+    count = 1
+  }
+}`)
+	results := RunFile(context.Background(), f, nil, Options{})
+	if len(results) != 2 {
+		t.Fatalf("expected two results, got %+v", results)
+	}
+	if results[0].Passed() || !strings.Contains(results[0].Failures[0], "event 2 doesn't match") {
+		t.Fatalf("expected the assertion to fail on event 2, got %+v", results[0])
+	}
+	if !results[1].Passed() {
+		t.Fatalf("expected the command transform to keep one event, got %+v", results[1])
+	}
+}
+
+func TestOutputProviderReceivesEvents(t *testing.T) {
+	received := filepath.Join(t.TempDir(), "received.jsonl")
+	t.Setenv("PIPETEST_OUTPUT", received)
+	f := loadTests(t, `
+test "delivered" {
+  task   = "delivered"
+  input  = "events.jsonl"
+  output = "provider"
+  expect {
+    count = 3
+  }
+}
+test "unknown task" {
+  task  = "missing"
+  input = "events.jsonl"
+}`)
+	results := RunFile(context.Background(), f, nil, Options{})
+	if !results[0].Passed() {
+		t.Fatalf("expected the output provider to receive every event, got %+v", results[0])
+	}
+	if data, _ := os.ReadFile(received); string(data) != fixture {
+		t.Fatalf("expected the provider to receive the fixture, got %q", data)
+	}
+	if results[1].Passed() {
+		t.Fatal("expected a test of an unknown task to fail")
+	}
+}
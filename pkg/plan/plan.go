@@ -0,0 +1,160 @@
+// Package plan defines the structured plan format that providers emit during
+// `dstream plan`, and how DStream renders, saves and loads plans.
+//
+// Providers report proposed changes as stdout lines during the plan command:
+//
+//	{"resource_changes":[{"action":"create","type":"queue","name":"cars","after":{"max_size":1024}}]}
+//
+// A saved plan can be handed back to `dstream init plan.json`, in which case each
+// provider receives only the changes that were reviewed.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FormatVersion is the version of the saved plan format written by this build
+const FormatVersion = 1
+
+// Change actions a provider may propose
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionNoOp   = "no-op"
+)
+
+// ResourceChange is a single proposed change to a provider-managed resource
+type ResourceChange struct {
+	Provider string                 `json:"provider"` // "input" or "output", set by DStream
+	Action   string                 `json:"action"`
+	Type     string                 `json:"type"`
+	Name     string                 `json:"name"`
+	Before   map[string]interface{} `json:"before,omitempty"`
+	After    map[string]interface{} `json:"after,omitempty"`
+}
+
+// Address identifies the resource the change applies to, e.g. "output.queue.cars".
+// It matches the addresses used in task state.
+func (c ResourceChange) Address() string {
+	return c.Provider + "." + c.Type + "." + c.Name
+}
+
+// Plan is the full set of changes proposed for a task
+type Plan struct {
+	FormatVersion   int              `json:"format_version"`
+	Task            string           `json:"task"`
+	ConfigHash      string           `json:"config_hash"`
+	CreatedAt       time.Time        `json:"created_at"`
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+// New returns an empty plan for a task
+func New(task string, configHash string) *Plan {
+	return &Plan{
+		FormatVersion:   FormatVersion,
+		Task:            task,
+		ConfigHash:      configHash,
+		CreatedAt:       time.Now().UTC(),
+		ResourceChanges: []ResourceChange{},
+	}
+}
+
+// ChangesFor returns the changes proposed by one provider role
+func (p *Plan) ChangesFor(provider string) []ResourceChange {
+	var out []ResourceChange
+	for _, c := range p.ResourceChanges {
+		if c.Provider == provider {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Summary counts changes by kind
+type Summary struct {
+	Add     int
+	Change  int
+	Destroy int
+}
+
+// Summarize counts the plan's changes by kind; no-ops are not counted
+func (p *Plan) Summarize() Summary {
+	var s Summary
+	for _, c := range p.ResourceChanges {
+		switch c.Action {
+		case ActionCreate:
+			s.Add++
+		case ActionUpdate:
+			s.Change++
+		case ActionDelete:
+			s.Destroy++
+		}
+	}
+	return s
+}
+
+// HasChanges reports whether applying the plan would do anything
+func (p *Plan) HasChanges() bool {
+	s := p.Summarize()
+	return s.Add+s.Change+s.Destroy > 0
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy", s.Add, s.Change, s.Destroy)
+}
+
+// ParseLine tries to interpret a provider stdout line as a list of proposed changes
+func ParseLine(line string) ([]ResourceChange, bool) {
+	var msg struct {
+		ResourceChanges []ResourceChange `json:"resource_changes"`
+	}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.ResourceChanges == nil {
+		return nil, false
+	}
+	for _, c := range msg.ResourceChanges {
+		if c.Type == "" || c.Name == "" {
+			return nil, false
+		}
+		switch c.Action {
+		case ActionCreate, ActionUpdate, ActionDelete, ActionNoOp:
+		default:
+			return nil, false
+		}
+	}
+	return msg.ResourceChanges, true
+}
+
+// Save writes the plan to a file as indented JSON
+func Save(p *Plan, path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	return nil
+}
+
+// Load reads a plan previously written by Save
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plan: %w", err)
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse plan %s: %w", path, err)
+	}
+	if p.FormatVersion == 0 || p.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("plan %s has unsupported format version %d", path, p.FormatVersion)
+	}
+	if p.Task == "" {
+		return nil, fmt.Errorf("plan %s does not name a task", path)
+	}
+	return &p, nil
+}
@@ -0,0 +1,83 @@
+package plan
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	changes, ok := ParseLine(`{"resource_changes":[{"action":"create","type":"queue","name":"cars","after":{"max_size":1024}},{"action":"delete","type":"queue","name":"old"}]}`)
+	if !ok || len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v (ok=%v)", changes, ok)
+	}
+
+	for _, line := range []string{
+		`not json`,
+		`{"status":"ready"}`,
+		`{"resource_changes":[{"action":"explode","type":"queue","name":"cars"}]}`,
+		`{"resource_changes":[{"action":"create","name":"cars"}]}`,
+	} {
+		if _, ok := ParseLine(line); ok {
+			t.Fatalf("expected %s not to parse as plan changes", line)
+		}
+	}
+}
+
+func TestRenderAndSummary(t *testing.T) {
+	p := New("orders", "sha256:1")
+	p.ResourceChanges = []ResourceChange{
+		{Provider: "output", Action: ActionCreate, Type: "queue", Name: "cars", After: map[string]interface{}{"max_size": 1024}},
+		{Provider: "output", Action: ActionCreate, Type: "queue", Name: "persons"},
+		{Provider: "output", Action: ActionUpdate, Type: "topic", Name: "events",
+			Before: map[string]interface{}{"ttl": "1h", "name": "events"},
+			After:  map[string]interface{}{"ttl": "2h", "name": "events"}},
+		{Provider: "output", Action: ActionDelete, Type: "queue", Name: "old"},
+		{Provider: "input", Action: ActionNoOp, Type: "cdc", Name: "Persons"},
+	}
+
+	if got := p.Summarize().String(); got != "2 to add, 1 to change, 1 to destroy" {
+		t.Fatalf("unexpected summary: %q", got)
+	}
+
+	var buf bytes.Buffer
+	(&Renderer{Out: &buf}).Render(p)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# output.queue.cars will be created",
+		`+ max_size = 1024`,
+		"# output.topic.events will be updated in-place",
+		`~ ttl  = "1h" -> "2h"`,
+		"# output.queue.old will be destroyed",
+		"Plan: 2 to add, 1 to change, 1 to destroy.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered plan missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\033[") {
+		t.Errorf("expected no ANSI codes with color disabled:\n%s", out)
+	}
+	if strings.Contains(out, "input.cdc.Persons") {
+		t.Errorf("no-op changes should not be rendered:\n%s", out)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	p := New("orders", "sha256:1")
+	p.ResourceChanges = append(p.ResourceChanges, ResourceChange{Provider: "output", Action: ActionCreate, Type: "queue", Name: "cars"})
+
+	if err := Save(p, path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.Task != "orders" || loaded.ConfigHash != "sha256:1" || len(loaded.ChangesFor("output")) != 1 {
+		t.Fatalf("unexpected plan after round trip: %+v", loaded)
+	}
+}
@@ -0,0 +1,123 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ANSI color codes, matching the host logger palette
+const (
+	colorReset  = "\033[0m"
+	colorCreate = "\033[38;5;78m"  // leafy green
+	colorUpdate = "\033[38;5;220m" // amber
+	colorDelete = "\033[38;5;167m" // crimson
+	colorBold   = "\033[1m"
+)
+
+// Renderer writes a Terraform-style diff of a plan
+type Renderer struct {
+	Out   io.Writer
+	Color bool
+}
+
+// Render writes every change followed by the summary line
+func (r *Renderer) Render(p *Plan) {
+	if !p.HasChanges() {
+		fmt.Fprintln(r.Out, r.paint(colorBold, "No changes.")+" Infrastructure matches the configuration.")
+		return
+	}
+
+	fmt.Fprintln(r.Out, "DStream will perform the following actions:")
+	fmt.Fprintln(r.Out)
+
+	for _, c := range p.ResourceChanges {
+		if c.Action == ActionNoOp {
+			continue
+		}
+		r.renderChange(c)
+		fmt.Fprintln(r.Out)
+	}
+
+	fmt.Fprintf(r.Out, "%s %s.\n", r.paint(colorBold, "Plan:"), p.Summarize())
+}
+
+func (r *Renderer) renderChange(c ResourceChange) {
+	symbol, color, verb := changeStyle(c.Action)
+
+	fmt.Fprintf(r.Out, "  %s\n", r.paint(colorBold, fmt.Sprintf("# %s will be %s", c.Address(), verb)))
+	fmt.Fprintf(r.Out, "  %s resource %q %q {\n", r.paint(color, symbol), c.Type, c.Name)
+
+	keys := attributeKeys(c.Before, c.After)
+	width := 0
+	for _, k := range keys {
+		if len(k) > width {
+			width = len(k)
+		}
+	}
+
+	for _, k := range keys {
+		before, hadBefore := c.Before[k]
+		after, hasAfter := c.After[k]
+		name := k + strings.Repeat(" ", width-len(k))
+
+		switch {
+		case c.Action == ActionCreate || (!hadBefore && hasAfter):
+			fmt.Fprintf(r.Out, "      %s %s = %s\n", r.paint(colorCreate, "+"), name, formatValue(after))
+		case c.Action == ActionDelete || (hadBefore && !hasAfter):
+			fmt.Fprintf(r.Out, "      %s %s = %s\n", r.paint(colorDelete, "-"), name, formatValue(before))
+		case !reflect.DeepEqual(before, after):
+			fmt.Fprintf(r.Out, "      %s %s = %s -> %s\n", r.paint(colorUpdate, "~"), name, formatValue(before), formatValue(after))
+		default:
+			fmt.Fprintf(r.Out, "        %s = %s\n", name, formatValue(after))
+		}
+	}
+
+	fmt.Fprintln(r.Out, "    }")
+}
+
+func (r *Renderer) paint(color, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func changeStyle(action string) (symbol, color, verb string) {
+	switch action {
+	case ActionCreate:
+		return "+", colorCreate, "created"
+	case ActionDelete:
+		return "-", colorDelete, "destroyed"
+	default:
+		return "~", colorUpdate, "updated in-place"
+	}
+}
+
+// attributeKeys returns the union of attribute names, sorted
+func attributeKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue renders an attribute value as compact JSON, so strings are quoted
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
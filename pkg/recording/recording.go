@@ -0,0 +1,108 @@
+// Package recording reads and writes recorded event streams: the lines the relay
+// wrote to an output provider, each with the time it was relayed, one JSON object
+// per line:
+//
+//	{"ts":"2025-01-02T15:04:05.123456789Z","line":"{\"data\":{...},\"metadata\":{...}}"}
+//
+// The relayed line is kept as a string so it is replayed byte for byte.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one recorded event
+type Entry struct {
+	Time time.Time `json:"ts"`
+	Line string    `json:"line"`
+}
+
+// Writer appends entries to a recording file
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	n   int64
+}
+
+// Create creates or truncates a recording file
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+	return &Writer{f: f, buf: bufio.NewWriter(f)}, nil
+}
+
+// Record appends one line relayed at t
+func (w *Writer) Record(t time.Time, line string) error {
+	data, err := json.Marshal(Entry{Time: t.UTC(), Line: line})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.buf.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write recording: %w", err)
+	}
+	w.n++
+	return nil
+}
+
+// Count returns the number of entries recorded so far
+func (w *Writer) Count() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Close flushes and closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		w.f.Close()
+		return fmt.Errorf("write recording: %w", err)
+	}
+	return w.f.Close()
+}
+
+// Reader reads entries from a recording
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader reads a recording from r
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next entry, or io.EOF at the end of the recording
+func (r *Reader) Next() (Entry, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(r.scanner.Bytes(), &e); err != nil {
+			return Entry{}, fmt.Errorf("recording line %d: %w", r.line, err)
+		}
+		return e, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Entry{}, fmt.Errorf("read recording: %w", err)
+	}
+	return Entry{}, io.EOF
+}
@@ -0,0 +1,61 @@
+package recording
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	lines := []string{`{"data":{"id":1},"metadata":{}}`, "plain text line"}
+	for i, line := range lines {
+		if err := w.Record(base.Add(time.Duration(i)*time.Second), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Count() != 2 {
+		t.Fatalf("expected 2 entries counted, got %d", w.Count())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewReader(f)
+	for i, want := range lines {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		if e.Line != want || !e.Time.Equal(base.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("entry %d: got %+v", i, e)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReaderReportsBadLine(t *testing.T) {
+	r := NewReader(strings.NewReader("{\"ts\":\"2025-01-02T15:04:05Z\",\"line\":\"a\"}\n\nnot json\n"))
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected an error naming line 3, got %v", err)
+	}
+}
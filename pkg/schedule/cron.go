@@ -0,0 +1,245 @@
+// Package schedule parses cron expressions and works out when they next fire.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed five-field cron expression:
+//
+//	┌───────────── minute (0-59)
+//	│ ┌─────────── hour (0-23)
+//	│ │ ┌───────── day of month (1-31)
+//	│ │ │ ┌─────── month (1-12 or jan-dec)
+//	│ │ │ │ ┌───── day of week (0-6 or sun-sat, 7 is also sunday)
+//	│ │ │ │ │
+//	* * * * *
+//
+// Each field is *, a value, a range a-b, or a list of those separated by
+// commas, and * or a range may take a step such as */15 or 1-5/2. As in cron,
+// when both day fields are restricted a day matching either one fires. When
+// clocks go back, an hour that is * or a step fires in both copies of the
+// repeated hour and a fixed hour only in the first.
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domAny and dowAny record a day field that is *, so the other one decides
+	domAny bool
+	dowAny bool
+	// hourEvery records an hour field that is * or a step, which fires again in
+	// the hour repeated when clocks go back; a fixed hour fires once that day
+	hourEvery bool
+}
+
+// macros are the @ shorthands for common expressions
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string // names for values from min, if any
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12,
+		names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// maxSearch bounds how far ahead Next looks; every valid expression fires
+// within a leap-year cycle
+const maxSearch = 8 * 366 * 24 * time.Hour
+
+// Parse parses a five-field cron expression or one of the macros @yearly,
+// @annually, @monthly, @weekly, @daily, @midnight and @hourly
+func Parse(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@") {
+		m, ok := macros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("cron %q: unknown macro", expr)
+		}
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+	}
+
+	c := &Cron{expr: expr}
+	var err error
+	for _, f := range []struct {
+		spec  string
+		field field
+		dst   *uint64
+	}{
+		{fields[0], minuteField, &c.minute},
+		{fields[1], hourField, &c.hour},
+		{fields[2], domField, &c.dom},
+		{fields[3], monthField, &c.month},
+		{fields[4], dowField, &c.dow},
+	} {
+		if *f.dst, err = f.field.parse(f.spec); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	c.domAny = fields[2] == "*" || fields[2] == "?"
+	c.dowAny = fields[4] == "*" || fields[4] == "?"
+	c.hourEvery = strings.ContainsAny(fields[1], "*/")
+
+	if c.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("cron %q never fires", expr)
+	}
+	return c, nil
+}
+
+// String returns the expression c was parsed from
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first time after t that c fires, in t's location and to the
+// minute, or the zero time if it never does
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			// Add rather than rebuild the date so a repeated DST hour isn't skipped
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		case !c.hourEvery && repeatedWallClock(t):
+			// Already fired at this time of day, before the clocks went back
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// repeatedWallClock reports whether t's date and time of day already came up
+// earlier that day, because t is in the hour repeated when clocks go back
+func repeatedWallClock(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	return earlier.Day() == t.Day() && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// parse turns one field of an expression into a bitset of the values it allows
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rng, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepSpec)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*" || rng == "?":
+			lo, hi = f.min, f.max
+			if f.name == dowField.name {
+				hi = 6
+			}
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: range %q runs backwards", f.name, rng)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			// a/n means every n from a to the end of the range
+			hi = lo
+			if hasStep {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single number or name in the field's range
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", f.name, s)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s: %d is out of range %d-%d", f.name, n, f.min, f.max)
+	}
+	return n, nil
+}
@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2025-01-15 10:31"},
+		{"*/15 * * * *", "2025-01-15 10:45"},
+		{"0 2 * * *", "2025-01-16 02:00"},
+		{"@daily", "2025-01-16 00:00"},
+		{"@hourly", "2025-01-15 11:00"},
+		{"30 9 * * mon-fri", "2025-01-16 09:30"},
+		{"0 0 * * sun", "2025-01-19 00:00"},
+		{"0 0 * * 7", "2025-01-19 00:00"},
+		{"0 12 1 * *", "2025-02-01 12:00"},
+		{"0 0 29 feb *", "2028-02-29 00:00"},
+		{"15,45 8-10/2 * * *", "2025-01-15 10:45"},
+		{"15 7-9/2 * * *", "2025-01-16 07:15"},
+		{"0 0 1 * 5", "2025-01-17 00:00"}, // the 1st or a Friday
+		{"0 0 1 jan *", "2026-01-01 00:00"},
+	} {
+		c, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := c.Next(from).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tz database:", err)
+	}
+	c, err := Parse("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := c.Next(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC).In(loc))
+	if next.Location() != loc || next.Format("2006-01-02 15:04") != "2025-06-02 02:00" {
+		t.Fatalf("expected 02:00 New York time, got %s", next)
+	}
+}
+
+func TestNextAcrossDSTChanges(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tz database:", err)
+	}
+	// Clocks go back from 02:00 EDT to 01:00 EST on 2026-11-01, so 01:00-01:59
+	// comes up twice
+	from := time.Date(2026, 11, 1, 0, 45, 0, 0, loc)
+	for _, tt := range []struct {
+		expr string
+		want string
+	}{
+		// A fixed hour fires once, in the first 01:30
+		{"30 1 * * *", "[2026-11-01 01:30 EDT 2026-11-02 01:30 EST 2026-11-03 01:30 EST]"},
+		{"30 0-3 * * *", "[2026-11-01 01:30 EDT 2026-11-01 02:30 EST 2026-11-01 03:30 EST]"},
+		// A wildcard or stepped hour fires in both
+		{"30 * * * *", "[2026-11-01 01:30 EDT 2026-11-01 01:30 EST 2026-11-01 02:30 EST]"},
+		{"30 */1 * * *", "[2026-11-01 01:30 EDT 2026-11-01 01:30 EST 2026-11-01 02:30 EST]"},
+	} {
+		c, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		var got []string
+		for next := from; len(got) < 3; {
+			next = c.Next(next)
+			got = append(got, next.Format("2006-01-02 15:04 MST"))
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// Clocks go forward from 02:00 EST to 03:00 EDT on 2026-03-08
+	c, err := Parse("0 4 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(time.Date(2026, 3, 8, 0, 0, 0, 0, loc)).Format("2006-01-02 15:04 MST"); got != "2026-03-08 04:00 EDT" {
+		t.Errorf("spring forward: got %s", got)
+	}
+}
+
+func TestParseRejectsBadExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * smarch *",
+		"@fortnightly",
+		"0 0 30 feb *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
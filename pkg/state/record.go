@@ -0,0 +1,101 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Resource record actions a provider may report
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionExists  = "exists"
+	ActionDeleted = "deleted"
+)
+
+// Record is a resource record emitted by a provider on stdout during a
+// lifecycle command, one JSON object per line:
+//
+//	{"resource":{"type":"servicebus_queue","name":"cars","id":"/subs/.../cars"},"action":"created"}
+//
+// Lines that are not resource records are passed through to the user untouched.
+type Record struct {
+	Action   string    `json:"action"`
+	Resource *Resource `json:"resource"`
+}
+
+// ParseRecord tries to interpret a provider stdout line as a resource record
+func ParseRecord(line string) (*Record, bool) {
+	var rec Record
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return nil, false
+	}
+	if rec.Resource == nil || rec.Resource.Type == "" || rec.Resource.Name == "" {
+		return nil, false
+	}
+	switch rec.Action {
+	case ActionCreated, ActionUpdated, ActionExists, ActionDeleted:
+		return &rec, true
+	default:
+		return nil, false
+	}
+}
+
+// Apply folds a record reported by the given provider role into the state
+func (s *State) Apply(provider string, rec *Record) {
+	r := *rec.Resource
+	r.Provider = provider
+	if rec.Action == ActionDeleted {
+		s.Remove(r.Address())
+		return
+	}
+	s.Upsert(r)
+}
+
+// Difference is one way the current task config differs from recorded state
+type Difference struct {
+	Field  string
+	Before string
+	After  string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s -> %s", d.Field, orNone(d.Before), orNone(d.After))
+}
+
+// Compare reports how the current provider settings differ from the recorded ones.
+// An empty result means the task has not changed since its state was written.
+func Compare(recorded, current *State) []Difference {
+	var diffs []Difference
+	for _, role := range []string{"input", "output"} {
+		before, after := recorded.Providers[role], current.Providers[role]
+		if before.Ref != after.Ref {
+			diffs = append(diffs, Difference{Field: role + ".provider_ref", Before: before.Ref, After: after.Ref})
+		}
+		if before.Path != after.Path {
+			diffs = append(diffs, Difference{Field: role + ".provider_path", Before: before.Path, After: after.Path})
+		}
+		if before.Digest != "" && after.Digest != "" && before.Digest != after.Digest {
+			diffs = append(diffs, Difference{Field: role + ".digest", Before: before.Digest, After: after.Digest})
+		}
+		if before.ConfigHash != after.ConfigHash {
+			diffs = append(diffs, Difference{Field: role + ".config", Before: shortHash(before.ConfigHash), After: shortHash(after.ConfigHash)})
+		}
+	}
+	return diffs
+}
+
+func shortHash(h string) string {
+	const prefix = "sha256:"
+	if len(h) > len(prefix)+12 {
+		return h[:len(prefix)+12]
+	}
+	return h
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,299 @@
+// Package state persists what DStream knows about a task between commands:
+// the resources its providers reported during lifecycle commands, the config
+// they were created from, the provider binaries that ran, and the last run.
+//
+// State lives in a per-task working directory next to the config file:
+//
+//	.dstream/tasks/<task>/state.json
+//
+// where <task> is the task name as EscapeTaskName writes it, so it is always
+// one directory under tasks.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDir is the working directory DStream keeps per-task state under
+	DefaultDir = ".dstream"
+
+	// FormatVersion is the version of the state file format written by this build
+	FormatVersion = 1
+
+	stateFileName = "state.json"
+)
+
+// ErrNotFound is returned by Load when a task has no state yet
+var ErrNotFound = errors.New("no state recorded for task")
+
+// State is the persisted record of a single task
+type State struct {
+	Version    int                 `json:"version"`
+	Task       string              `json:"task"`
+	ConfigHash string              `json:"config_hash,omitempty"`
+	Providers  map[string]Provider `json:"providers,omitempty"` // keyed by role: "input" or "output"
+	Resources  []Resource          `json:"resources"`
+	LastRun    *RunInfo            `json:"last_run,omitempty"`
+	Bootstrap  *Bootstrap          `json:"bootstrap,omitempty"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// Provider records which provider binary and config a lifecycle command ran with
+type Provider struct {
+	Ref        string `json:"ref,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	ConfigHash string `json:"config_hash,omitempty"`
+}
+
+// Resource is a piece of infrastructure a provider reported owning
+type Resource struct {
+	Provider   string                 `json:"provider"` // "input" or "output", set by DStream
+	Type       string                 `json:"type"`
+	Name       string                 `json:"name"`
+	ID         string                 `json:"id,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Address uniquely identifies a resource within a task, e.g. "output.servicebus_queue.cars"
+func (r Resource) Address() string {
+	return r.Provider + "." + r.Type + "." + r.Name
+}
+
+// RunInfo describes the most recent command executed against a task
+type RunInfo struct {
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Status     string    `json:"status"` // "succeeded" or "failed"
+	Error      string    `json:"error,omitempty"`
+}
+
+// Bootstrap statuses
+const (
+	BootstrapInProgress = "in_progress"
+	BootstrapCompleted  = "completed"
+)
+
+// Bootstrap records a task's snapshot phase, so that an interrupted snapshot
+// resumes from its last checkpoint and a completed one isn't repeated. The
+// checkpoint and watermark are the provider's own, passed back to it as they were.
+type Bootstrap struct {
+	Status      string          `json:"status"`
+	Checkpoint  json.RawMessage `json:"checkpoint,omitempty"` // where an interrupted snapshot resumes
+	Watermark   json.RawMessage `json:"watermark,omitempty"`  // where streaming starts once it completed
+	Done        int64           `json:"done,omitempty"`       // progress as the provider counts it
+	Total       int64           `json:"total,omitempty"`
+	Events      int64           `json:"events"` // snapshot events relayed up to the checkpoint
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at,omitzero"`
+}
+
+// New returns an empty state for a task
+func New(task string) *State {
+	return &State{
+		Version:   FormatVersion,
+		Task:      task,
+		Providers: make(map[string]Provider),
+		Resources: []Resource{},
+	}
+}
+
+// Upsert adds a resource or replaces the one with the same address
+func (s *State) Upsert(r Resource) {
+	for i := range s.Resources {
+		if s.Resources[i].Address() == r.Address() {
+			s.Resources[i] = r
+			return
+		}
+	}
+	s.Resources = append(s.Resources, r)
+	sort.Slice(s.Resources, func(i, j int) bool {
+		return s.Resources[i].Address() < s.Resources[j].Address()
+	})
+}
+
+// Remove deletes the resource with the given address, reporting whether it existed
+func (s *State) Remove(address string) bool {
+	for i := range s.Resources {
+		if s.Resources[i].Address() == address {
+			s.Resources = append(s.Resources[:i], s.Resources[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ResourcesFor returns the resources owned by one provider role
+func (s *State) ResourcesFor(provider string) []Resource {
+	var out []Resource
+	for _, r := range s.Resources {
+		if r.Provider == provider {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Store reads and writes task state files under a root directory
+type Store struct {
+	root string
+}
+
+// NewStore returns a store rooted at dir (usually DefaultDir)
+func NewStore(dir string) *Store {
+	return &Store{root: dir}
+}
+
+// TaskDir returns the working directory for a task
+func (s *Store) TaskDir(task string) string {
+	return filepath.Join(s.root, "tasks", EscapeTaskName(task))
+}
+
+// taskNameEscaper escapes the characters that would let a task name reach
+// outside the directory it is stored in
+var taskNameEscaper = strings.NewReplacer("%", "%25", "/", "%2F", `\`, "%5C")
+
+// EscapeTaskName turns a task name into a single path element for stores that
+// keep a file or directory per task. /, \ and % are escaped as in URLs, and so
+// are the dots of . and ..; other names are used as they are.
+func EscapeTaskName(task string) string {
+	if task == "." || task == ".." {
+		return strings.ReplaceAll(task, ".", "%2E")
+	}
+	return taskNameEscaper.Replace(task)
+}
+
+// UnescapeTaskName returns the task name a path element from EscapeTaskName
+// stands for
+func UnescapeTaskName(name string) (string, error) {
+	return url.PathUnescape(name)
+}
+
+// Load reads a task's state, returning ErrNotFound if none has been recorded
+func (s *Store) Load(task string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(s.TaskDir(task), stateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state for task %q: %w", task, err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse state for task %q: %w", task, err)
+	}
+	if st.Version > FormatVersion {
+		return nil, fmt.Errorf("state for task %q has format version %d, this build supports up to %d", task, st.Version, FormatVersion)
+	}
+	if st.Providers == nil {
+		st.Providers = make(map[string]Provider)
+	}
+	return &st, nil
+}
+
+// LoadOrNew reads a task's state, returning an empty state if none exists
+func (s *Store) LoadOrNew(task string) (*State, error) {
+	st, err := s.Load(task)
+	if errors.Is(err, ErrNotFound) {
+		return New(task), nil
+	}
+	return st, err
+}
+
+// Save writes a task's state atomically (write to temp file, then rename)
+func (s *Store) Save(st *State) error {
+	dir := s.TaskDir(st.Task)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	st.Version = FormatVersion
+	st.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, stateFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp state file: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, stateFileName)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes a task's state file
+func (s *Store) Remove(task string) error {
+	err := os.Remove(filepath.Join(s.TaskDir(task), stateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// List returns the names of all tasks with recorded state, sorted
+func (s *Store) List() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, "tasks"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list state dir: %w", err)
+	}
+
+	var tasks []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.root, "tasks", e.Name(), stateFileName)); err != nil {
+			continue
+		}
+		if task, err := UnescapeTaskName(e.Name()); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Strings(tasks)
+	return tasks, nil
+}
+
+// FileDigest returns the sha256 digest of a provider binary, e.g. "sha256:ab12..."
+func FileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,154 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	if _, err := store.Load("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got: %v", err)
+	}
+
+	st := New("orders")
+	st.ConfigHash = "sha256:abc"
+	st.Providers["output"] = Provider{Ref: "ghcr.io/katasec/out:v1", Digest: "sha256:def"}
+	st.Upsert(Resource{Provider: "output", Type: "queue", Name: "orders", ID: "q-1"})
+
+	if err := store.Save(st); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, err := store.Load("orders")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.ConfigHash != st.ConfigHash || len(loaded.Resources) != 1 {
+		t.Fatalf("unexpected state after round trip: %+v", loaded)
+	}
+	if loaded.Providers["output"].Digest != "sha256:def" {
+		t.Fatalf("provider digest not persisted: %+v", loaded.Providers)
+	}
+
+	tasks, err := store.List()
+	if err != nil || len(tasks) != 1 || tasks[0] != "orders" {
+		t.Fatalf("expected [orders], got %v (err=%v)", tasks, err)
+	}
+
+	if err := store.Remove("orders"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := store.Load("orders"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after remove, got: %v", err)
+	}
+}
+
+func TestEscapeTaskName(t *testing.T) {
+	for name, want := range map[string]string{
+		"orders": "orders",
+		"a/b":    "a%2Fb",
+		`a\b`:    "a%5Cb",
+		"50%":    "50%25",
+		"..":     "%2E%2E",
+		".":      "%2E",
+		"../x":   "..%2Fx",
+	} {
+		got := EscapeTaskName(name)
+		if got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+		if back, err := UnescapeTaskName(got); err != nil || back != name {
+			t.Errorf("%q: unescaped to %q (err=%v)", name, back, err)
+		}
+	}
+}
+
+func TestStoreKeepsTaskNamesInsideTheStore(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(root, ".dstream"))
+	names := []string{"..", ".", "../../escaped", "a/b", `..\x`, "50%", "plain"}
+	for _, name := range names {
+		if dir := store.TaskDir(name); filepath.Dir(dir) != filepath.Join(root, ".dstream", "tasks") {
+			t.Errorf("%q: task dir %s is not in the store", name, dir)
+		}
+		if err := store.Save(New(name)); err != nil {
+			t.Fatalf("%q: save: %v", name, err)
+		}
+		if st, err := store.Load(name); err != nil || st.Task != name {
+			t.Fatalf("%q: load: %+v (err=%v)", name, st, err)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Fatalf("expected only the store under %s, got %v", root, entries)
+	}
+
+	tasks, err := store.List()
+	sort.Strings(names)
+	if err != nil || fmt.Sprint(tasks) != fmt.Sprint(names) {
+		t.Fatalf("expected %q, got %q (err=%v)", names, tasks, err)
+	}
+}
+
+func TestParseAndApplyRecords(t *testing.T) {
+	st := New("orders")
+
+	for _, line := range []string{
+		`{"resource":{"type":"queue","name":"cars","id":"q-1"},"action":"created"}`,
+		`{"resource":{"type":"queue","name":"persons"},"action":"exists"}`,
+		`{"resource":{"type":"queue","name":"cars","id":"q-2"},"action":"updated"}`,
+	} {
+		rec, ok := ParseRecord(line)
+		if !ok {
+			t.Fatalf("expected %s to parse as a record", line)
+		}
+		st.Apply("output", rec)
+	}
+
+	if len(st.Resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d: %+v", len(st.Resources), st.Resources)
+	}
+	if st.Resources[0].Address() != "output.queue.cars" || st.Resources[0].ID != "q-2" {
+		t.Fatalf("expected updated cars queue first, got %+v", st.Resources[0])
+	}
+
+	rec, _ := ParseRecord(`{"resource":{"type":"queue","name":"cars"},"action":"deleted"}`)
+	st.Apply("output", rec)
+	if len(st.Resources) != 1 || st.Resources[0].Name != "persons" {
+		t.Fatalf("expected only persons queue after delete, got %+v", st.Resources)
+	}
+
+	for _, line := range []string{
+		`plain text`,
+		`{"status":"ready"}`,
+		`{"resource":{"type":"queue","name":"x"},"action":"exploded"}`,
+		`{"resource":{"name":"x"},"action":"created"}`,
+	} {
+		if _, ok := ParseRecord(line); ok {
+			t.Fatalf("expected %s not to parse as a record", line)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	recorded := New("orders")
+	recorded.Providers["output"] = Provider{Ref: "out:v1", ConfigHash: "sha256:1", Digest: "sha256:a"}
+
+	same := New("orders")
+	same.Providers["output"] = Provider{Ref: "out:v1", ConfigHash: "sha256:1"}
+	if diffs := Compare(recorded, same); len(diffs) != 0 {
+		t.Fatalf("expected no differences when digest is unknown, got %v", diffs)
+	}
+
+	changed := New("orders")
+	changed.Providers["output"] = Provider{Ref: "out:v2", ConfigHash: "sha256:2", Digest: "sha256:b"}
+	diffs := Compare(recorded, changed)
+	if len(diffs) != 3 {
+		t.Fatalf("expected ref, digest and config differences, got %v", diffs)
+	}
+}
@@ -0,0 +1,190 @@
+// Package tracing sets up OpenTelemetry tracing for DStream and carries the W3C
+// trace context across the process boundary to providers.
+//
+// Providers receive the context of the span that started them in two places:
+// the TRACEPARENT/TRACESTATE environment variables and the "traceparent" field
+// of the command envelope. Either can be used to parent the provider's own spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted by Setup
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Environment variables used to hand the trace context to provider processes
+const (
+	EnvTraceparent = "TRACEPARENT"
+	EnvTracestate  = "TRACESTATE"
+)
+
+const instrumentationName = "github.com/katasec/dstream"
+
+// Options configures tracing for this process
+type Options struct {
+	// Exporter is "otlp", "stdout" or "none". OTLP honours the standard
+	// OTEL_EXPORTER_OTLP_* environment variables and defaults to localhost:4317.
+	Exporter string
+	// Endpoint overrides the OTLP collector address, e.g. "localhost:4317"
+	Endpoint string
+	// Writer receives spans from the stdout exporter; defaults to os.Stdout
+	Writer io.Writer
+	// EventSampleRatio is the fraction of relayed events, 0 to 1, that get a span
+	EventSampleRatio float64
+}
+
+var (
+	mu               sync.Mutex
+	provider         *sdktrace.TracerProvider
+	eventSampleRatio float64
+	propagator       = propagation.TraceContext{}
+)
+
+// Setup installs the global tracer provider. With the "none" exporter spans are
+// still created, so trace context is passed to providers, but nothing is exported.
+func Setup(ctx context.Context, opts Options) error {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch opts.Exporter {
+	case "", ExporterNone:
+	case ExporterOTLP:
+		var clientOpts []otlptracegrpc.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracegrpc.WithEndpoint(opts.Endpoint), otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, clientOpts...)
+	case ExporterStdout:
+		w := opts.Writer
+		if w == nil {
+			w = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return fmt.Errorf("unknown trace exporter %q, expected %q, %q or %q", opts.Exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+	if err != nil {
+		return fmt.Errorf("create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	if opts.EventSampleRatio < 0 || opts.EventSampleRatio > 1 {
+		return fmt.Errorf("event sample ratio must be between 0 and 1, got %v", opts.EventSampleRatio)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("dstream")))
+	if err != nil {
+		return fmt.Errorf("create trace resource: %w", err)
+	}
+
+	tpOpts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter != nil {
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(exporter))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	provider = sdktrace.NewTracerProvider(tpOpts...)
+	eventSampleRatio = opts.EventSampleRatio
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return nil
+}
+
+// Shutdown flushes any buffered spans and stops the exporter
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	p := provider
+	provider = nil
+	mu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.Shutdown(ctx)
+}
+
+// Tracer returns DStream's tracer. Before Setup it is a no-op tracer.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span with DStream's tracer
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// EventSampler returns a function that reports whether the next relayed event
+// should be traced, at the ratio configured by Setup. The ratio is read once so
+// the relay doesn't take a lock per event.
+func EventSampler() func() bool {
+	mu.Lock()
+	ratio := eventSampleRatio
+	mu.Unlock()
+
+	if ratio <= 0 {
+		return func() bool { return false }
+	}
+	return func() bool { return rand.Float64() < ratio }
+}
+
+// Traceparent returns the W3C traceparent and tracestate headers for the span in
+// ctx. Both are empty when there is no valid span.
+func Traceparent(ctx context.Context) (traceparent, tracestate string) {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent"), carrier.Get("tracestate")
+}
+
+// ContextWithTraceparent returns ctx with the remote span described by a
+// traceparent header, as sent by a provider
+func ContextWithTraceparent(ctx context.Context, traceparent, tracestate string) context.Context {
+	carrier := propagation.MapCarrier{"traceparent": traceparent}
+	if tracestate != "" {
+		carrier["tracestate"] = tracestate
+	}
+	return propagator.Extract(ctx, carrier)
+}
+
+// Env returns the environment variables that pass the span in ctx to a child
+// process. It is empty when there is no valid span.
+func Env(ctx context.Context) []string {
+	traceparent, tracestate := Traceparent(ctx)
+	if traceparent == "" {
+		return nil
+	}
+	env := []string{EnvTraceparent + "=" + traceparent}
+	if tracestate != "" {
+		env = append(env, EnvTracestate+"="+tracestate)
+	}
+	return env
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStdoutExporterAndPropagation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(context.Background(), Options{Exporter: ExporterStdout, Writer: &buf}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	ctx, span := Start(context.Background(), "task.startup")
+	traceparent, _ := Traceparent(ctx)
+	if !strings.HasPrefix(traceparent, "00-"+span.SpanContext().TraceID().String()) {
+		t.Fatalf("unexpected traceparent %q for span %s", traceparent, span.SpanContext().TraceID())
+	}
+
+	env := Env(ctx)
+	if len(env) != 1 || env[0] != EnvTraceparent+"="+traceparent {
+		t.Fatalf("unexpected env: %v", env)
+	}
+
+	// A provider's span continues the same trace
+	remote := ContextWithTraceparent(context.Background(), traceparent, "")
+	_, child := Start(remote, "provider.emit")
+	if child.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Fatal("expected child span to continue the remote trace")
+	}
+	child.End()
+	End(span, nil)
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	for _, name := range []string{`"Name":"task.startup"`, `"Name":"provider.emit"`} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("exported spans missing %s", name)
+		}
+	}
+}
+
+func TestNoSpanNoTraceparent(t *testing.T) {
+	if tp, _ := Traceparent(context.Background()); tp != "" {
+		t.Fatalf("expected no traceparent without a span, got %q", tp)
+	}
+	if env := Env(context.Background()); env != nil {
+		t.Fatalf("expected no env without a span, got %v", env)
+	}
+}
+
+func TestSetupRejectsBadOptions(t *testing.T) {
+	if err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("expected unknown exporter to be rejected")
+	}
+	if err := Setup(context.Background(), Options{EventSampleRatio: 2}); err == nil {
+		t.Error("expected sample ratio above 1 to be rejected")
+	}
+}
+
+func TestEventSampler(t *testing.T) {
+	if err := Setup(context.Background(), Options{EventSampleRatio: 1}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	defer Shutdown(context.Background())
+
+	if sample := EventSampler(); !sample() {
+		t.Error("expected every event to be sampled at ratio 1")
+	}
+
+	if err := Setup(context.Background(), Options{}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if sample := EventSampler(); sample() {
+		t.Error("expected no events to be sampled by default")
+	}
+}
@@ -11,27 +11,35 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
-var (
-	// Environment variable names
-	envLogLevel = "DSTREAM_LOG_LEVEL" // debug, info, warn, error
-	envLogJSON  = "DSTREAM_LOG_JSON"  // true/false
+// Environment variables DStream sets for every provider it starts, so provider
+// logs match the host's level and format
+const (
+	EnvLogLevel = "DSTREAM_LOG_LEVEL" // debug, info, warn, error
+	EnvLogJSON  = "DSTREAM_LOG_JSON"  // true/false
 )
 
+// levelFromEnv returns the level DStream asked for, defaulting to info
+func levelFromEnv() hclog.Level {
+	if level := os.Getenv(EnvLogLevel); level != "" {
+		if l := hclog.LevelFromString(level); l != hclog.NoLevel {
+			return l
+		}
+	}
+	return hclog.Info
+}
+
+// jsonFromEnv reports whether DStream asked for JSON logs
+func jsonFromEnv() bool {
+	jsonEnv := os.Getenv(EnvLogJSON)
+	return jsonEnv == "true" || jsonEnv == "1"
+}
+
 // GetLogger returns an hclog-compatible logger for plugins to use
 // This logger does NOT add timestamps as plugins should let the host
 // handle timestamp formatting to avoid duplication
 func GetLogger(name string) hclog.Logger {
-	// Get log level from environment
-	logLevel := hclog.Info
-	if level := os.Getenv(envLogLevel); level != "" {
-		logLevel = hclog.LevelFromString(level)
-	}
-
-	// Check if JSON logging is enabled
-	jsonFormat := false
-	if jsonEnv := os.Getenv(envLogJSON); jsonEnv == "true" || jsonEnv == "1" {
-		jsonFormat = true
-	}
+	logLevel := levelFromEnv()
+	jsonFormat := jsonFromEnv()
 
 	// Create a logger with no timestamps - the host will add these
 	return hclog.New(&hclog.LoggerOptions{
@@ -55,11 +63,7 @@ func SetupPluginLogger(pluginName string) hclog.Logger {
 // SetupBareLogger creates a logger with absolutely no formatting
 // This is useful when you want completely clean output with no prefixes or timestamps
 func SetupBareLogger() hclog.Logger {
-	// Get log level from environment
-	logLevel := hclog.Info
-	if level := os.Getenv(envLogLevel); level != "" {
-		logLevel = hclog.LevelFromString(level)
-	}
+	logLevel := levelFromEnv()
 
 	// Create the underlying logger for compatibility
 	baseLogger := hclog.New(&hclog.LoggerOptions{
@@ -81,17 +85,8 @@ func SetupBareLogger() hclog.Logger {
 // SetupCleanLogger creates a logger without the standard prefix format
 // This is useful when you want cleaner log output without the [LEVEL] name: prefix
 func SetupCleanLogger() hclog.Logger {
-	// Get log level from environment
-	logLevel := hclog.Info
-	if level := os.Getenv(envLogLevel); level != "" {
-		logLevel = hclog.LevelFromString(level)
-	}
-
-	// Check if JSON logging is enabled
-	jsonFormat := false
-	if jsonEnv := os.Getenv(envLogJSON); jsonEnv == "true" || jsonEnv == "1" {
-		jsonFormat = true
-	}
+	logLevel := levelFromEnv()
+	jsonFormat := jsonFromEnv()
 
 	// Create the underlying logger for compatibility
 	baseLogger := hclog.New(&hclog.LoggerOptions{